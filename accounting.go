@@ -0,0 +1,173 @@
+package metal
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrMemoryBudget is returned when creating a buffer would exceed the memory budget set with
+// SetMemoryBudget.
+var ErrMemoryBudget = errors.New("Memory budget exceeded")
+
+// An Allocation is the number and total size of a group of buffers.
+type Allocation struct {
+	Buffers int
+	Bytes   uint64
+}
+
+// MemoryStats describe the memory that is allocated for buffers and textures.
+type MemoryStats struct {
+	// Allocation is the number and total size of all buffers that this package has allocated and
+	// not yet released. Buffers that wrap memory that this package doesn't allocate, such as those
+	// created with NewBufferNoCopy and MapFile, are not included. ManagedBuffers are.
+	Allocation
+
+	// ByType breaks the buffers down by the name of their Go element type, such as "float32" or
+	// "metal.Float4". Buffers in a BufferPool are counted as "uint8".
+	ByType map[string]Allocation
+
+	// ByStorage breaks the buffers down by storage mode.
+	ByStorage map[StorageMode]Allocation
+
+	// Textures is the number (in Buffers) and total size of all textures that this package has
+	// allocated and not yet released. Textures count towards the budget along with the buffers.
+	Textures Allocation
+
+	// Budget is the limit on the total size of all buffers, or 0 if there is no limit.
+	Budget uint64
+
+	// DeviceAllocated is the total number of bytes that the device has allocated for this process,
+	// including memory that this package doesn't keep track of.
+	DeviceAllocated uint64
+
+	// DeviceRecommendedMax is the number of bytes that the device can use without affecting
+	// performance, such as by swapping memory.
+	DeviceRecommendedMax uint64
+}
+
+// A bufferRecord is what the memory registry knows about a live buffer.
+type bufferRecord struct {
+	elemType string
+	storage  StorageMode
+	numBytes uint64
+	layout   Layout
+	dimLens  []int
+
+	// texture is true for textures, which are counted separately from buffers. Their elemType is
+	// the name of their pixel format.
+	texture bool
+}
+
+// A memoryRegistry keeps track of every buffer that is allocated and enforces the memory budget.
+// Space for a buffer is reserved before it's allocated, so that concurrent allocations can't
+// exceed the budget together.
+type memoryRegistry struct {
+	mu       sync.Mutex
+	buffers  map[int]bufferRecord
+	reserved uint64
+	budget   uint64
+}
+
+// reserve sets aside numBytes bytes for a new buffer. It returns an error that wraps
+// ErrMemoryBudget if that would exceed the budget. The reservation must be followed by either add
+// or cancel.
+func (r *memoryRegistry) reserve(numBytes uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.budget > 0 && (numBytes > r.budget || r.reserved > r.budget-numBytes) {
+		return fmt.Errorf("Unable to create buffer: %w (%d bytes requested, %d of %d bytes in use)",
+			ErrMemoryBudget, numBytes, r.reserved, r.budget)
+	}
+	r.reserved += numBytes
+
+	return nil
+}
+
+// cancel gives back a reservation of numBytes bytes for a buffer that couldn't be allocated.
+func (r *memoryRegistry) cancel(numBytes uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reserved -= numBytes
+}
+
+// add records a buffer that was allocated with space set aside by reserve.
+func (r *memoryRegistry) add(id int, rec bufferRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.buffers == nil {
+		r.buffers = make(map[int]bufferRecord)
+	}
+	r.buffers[id] = rec
+}
+
+// remove forgets a buffer that was released and frees up its space. It does nothing for buffers
+// that aren't recorded.
+func (r *memoryRegistry) remove(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.buffers[id]
+	if !ok {
+		return
+	}
+
+	delete(r.buffers, id)
+	r.reserved -= rec.numBytes
+}
+
+// lookup returns the record of a buffer, if it's recorded.
+func (r *memoryRegistry) lookup(id int) (bufferRecord, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.buffers[id]
+
+	return rec, ok
+}
+
+// setBudget sets the limit on the total size of all buffers. 0 means no limit.
+func (r *memoryRegistry) setBudget(numBytes uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.budget = numBytes
+}
+
+// stats summarizes the recorded buffers.
+func (r *memoryRegistry) stats() MemoryStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := MemoryStats{
+		ByType:    make(map[string]Allocation),
+		ByStorage: make(map[StorageMode]Allocation),
+		Budget:    r.budget,
+	}
+
+	for _, rec := range r.buffers {
+		if rec.texture {
+			stats.Textures.Buffers++
+			stats.Textures.Bytes += rec.numBytes
+			continue
+		}
+
+		stats.Buffers++
+		stats.Bytes += rec.numBytes
+
+		a := stats.ByType[rec.elemType]
+		a.Buffers++
+		a.Bytes += rec.numBytes
+		stats.ByType[rec.elemType] = a
+
+		a = stats.ByStorage[rec.storage]
+		a.Buffers++
+		a.Bytes += rec.numBytes
+		stats.ByStorage[rec.storage] = a
+	}
+
+	return stats
+}
@@ -0,0 +1,111 @@
+package metal
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_memoryRegistry tests that memoryRegistry keeps track of buffers and enforces the budget.
+func Test_memoryRegistry(t *testing.T) {
+	var r memoryRegistry
+
+	stats := r.stats()
+	require.Equal(t, Allocation{}, stats.Allocation)
+	require.Empty(t, stats.ByType)
+	require.Empty(t, stats.ByStorage)
+
+	// Without a budget, anything goes.
+	require.Nil(t, r.reserve(1<<40))
+	r.cancel(1 << 40)
+
+	require.Nil(t, r.reserve(400))
+	r.add(1, bufferRecord{elemType: "float32", storage: StorageShared, numBytes: 400})
+	require.Nil(t, r.reserve(800))
+	r.add(2, bufferRecord{elemType: "float32", storage: StoragePrivate, numBytes: 800})
+	require.Nil(t, r.reserve(64))
+	r.add(3, bufferRecord{elemType: "metal.Float4", storage: StorageShared, numBytes: 64})
+
+	stats = r.stats()
+	require.Equal(t, Allocation{Buffers: 3, Bytes: 1264}, stats.Allocation)
+	require.Equal(t, map[string]Allocation{
+		"float32":      {Buffers: 2, Bytes: 1200},
+		"metal.Float4": {Buffers: 1, Bytes: 64},
+	}, stats.ByType)
+	require.Equal(t, map[StorageMode]Allocation{
+		StorageShared:  {Buffers: 2, Bytes: 464},
+		StoragePrivate: {Buffers: 1, Bytes: 800},
+	}, stats.ByStorage)
+	require.Equal(t, uint64(0), stats.Budget)
+
+	// With a budget, allocations that don't fit fail.
+	r.setBudget(2000)
+	require.Nil(t, r.reserve(736))
+	r.cancel(736)
+
+	err := r.reserve(737)
+	require.NotNil(t, err)
+	require.True(t, errors.Is(err, ErrMemoryBudget))
+	require.Equal(t, "Unable to create buffer: Memory budget exceeded (737 bytes requested, 1264 of "+
+		"2000 bytes in use)", err.Error())
+
+	err = r.reserve(1 << 63)
+	require.NotNil(t, err)
+	require.True(t, errors.Is(err, ErrMemoryBudget))
+
+	// Releasing a buffer frees up its space.
+	r.remove(2)
+	r.remove(2)
+	r.remove(100)
+	require.Nil(t, r.reserve(1500))
+	r.cancel(1500)
+
+	stats = r.stats()
+	require.Equal(t, Allocation{Buffers: 2, Bytes: 464}, stats.Allocation)
+	require.Equal(t, uint64(2000), stats.Budget)
+
+	// Textures are counted separately, but they count towards the budget too.
+	require.Nil(t, r.reserve(1024))
+	r.add(4, bufferRecord{elemType: "rgba8Unorm", storage: StorageShared, numBytes: 1024, texture: true})
+	stats = r.stats()
+	require.Equal(t, Allocation{Buffers: 2, Bytes: 464}, stats.Allocation)
+	require.Equal(t, Allocation{Buffers: 1, Bytes: 1024}, stats.Textures)
+	require.NotContains(t, stats.ByType, "rgba8Unorm")
+	require.NotNil(t, r.reserve(1000))
+	r.remove(4)
+	require.Equal(t, Allocation{}, r.stats().Textures)
+
+	// A budget lower than what's in use only blocks new allocations.
+	r.setBudget(100)
+	require.NotNil(t, r.reserve(4))
+	require.Equal(t, Allocation{Buffers: 2, Bytes: 464}, r.stats().Allocation)
+}
+
+// Test_memoryRegistry_concurrent tests that concurrent reservations never exceed the budget
+// together.
+func Test_memoryRegistry_concurrent(t *testing.T) {
+	var r memoryRegistry
+	r.setBudget(1000)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if err := r.reserve(100); err == nil {
+				r.add(id, bufferRecord{elemType: "uint8", storage: StorageShared, numBytes: 100})
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, 10, succeeded)
+	require.Equal(t, Allocation{Buffers: 10, Bytes: 1000}, r.stats().Allocation)
+}
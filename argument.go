@@ -0,0 +1,102 @@
+package metal
+
+import (
+	"fmt"
+)
+
+const (
+	// maxBufferArguments is the number of entries in metal's buffer argument table, which limits how
+	// many buffers can be supplied to a metal function directly. Argument buffers get around this.
+	maxBufferArguments = 31
+
+	// maxSamplerArguments is the number of entries in metal's sampler argument table.
+	maxSamplerArguments = 16
+)
+
+// checkArgumentCounts checks that metal can bind numBuffers buffers and numSamplers samplers to a
+// metal function.
+func checkArgumentCounts(numBuffers, numSamplers int) error {
+	if numBuffers > maxBufferArguments {
+		return fmt.Errorf("Metal functions take at most %d buffers instead of %d (use an argument "+
+			"buffer for more)", maxBufferArguments, numBuffers)
+	}
+	if numSamplers > maxSamplerArguments {
+		return fmt.Errorf("Metal functions take at most %d samplers instead of %d",
+			maxSamplerArguments, numSamplers)
+	}
+
+	return nil
+}
+
+// mtlDataTypePointer is the MTLDataType value of struct members that point to a buffer.
+const mtlDataTypePointer = 60
+
+// dataTypeSizes holds the size in bytes of the scalar and vector types that the members of an
+// argument buffer can have, by MTLDataType value.
+var dataTypeSizes = map[int]int{
+	3: 4, 4: 8, 5: 16, 6: 16, // float
+	16: 2, 17: 4, 18: 8, 19: 8, // half
+	29: 4, 30: 8, 31: 16, 32: 16, // int
+	33: 4, 34: 8, 35: 16, 36: 16, // uint
+	37: 2, 38: 4, 39: 8, 40: 8, // short
+	41: 2, 42: 4, 43: 8, 44: 8, // ushort
+	45: 1, 46: 2, 47: 4, 48: 4, // char
+	49: 1, 50: 2, 51: 4, 52: 4, // uchar
+	53: 1, 54: 2, 55: 4, 56: 4, // bool
+	81: 8, 82: 16, 83: 32, 84: 32, // long
+	85: 8, 86: 16, 87: 32, 88: 32, // ulong
+	121: 2, 122: 4, 123: 8, 124: 8, // bfloat
+}
+
+// An argumentMember is the member of an argument buffer's struct at one [[id(n)]] index. Every
+// element of an array of pointers is a member of its own.
+type argumentMember struct {
+	name    string
+	pointer bool
+
+	// size is the number of bytes of a scalar or vector member, or 0 for members of any other type,
+	// such as textures and nested structs.
+	size int
+}
+
+// newArgumentMember describes the member with the provided name and MTLDataType value.
+func newArgumentMember(name string, dataType int) argumentMember {
+	return argumentMember{
+		name:    name,
+		pointer: dataType == mtlDataTypePointer,
+		size:    dataTypeSizes[dataType],
+	}
+}
+
+// argumentMembers holds the members of an argument buffer's struct by index.
+type argumentMembers map[int]argumentMember
+
+// checkPointer checks that the member at index points to a buffer.
+func (m argumentMembers) checkPointer(index int) error {
+	member, ok := m[index]
+	if !ok {
+		return fmt.Errorf("Invalid argument index %d", index)
+	}
+	if !member.pointer {
+		return fmt.Errorf("Argument %d (%s) is not a pointer to a buffer", index, member.name)
+	}
+
+	return nil
+}
+
+// checkData checks that the member at index is a scalar or vector of size bytes.
+func (m argumentMembers) checkData(index, size int) error {
+	member, ok := m[index]
+	if !ok {
+		return fmt.Errorf("Invalid argument index %d", index)
+	}
+	if member.size == 0 {
+		return fmt.Errorf("Argument %d (%s) is not a scalar or vector", index, member.name)
+	}
+	if member.size != size {
+		return fmt.Errorf("Argument %d (%s) is %d bytes instead of %d bytes", index, member.name,
+			member.size, size)
+	}
+
+	return nil
+}
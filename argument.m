@@ -0,0 +1,268 @@
+// go:build darwin
+//  +build darwin
+
+#include "metal.h"
+#include "cache.h"
+#include "device.h"
+#include "error.h"
+#import <Metal/Metal.h>
+
+// Defined in function.m. This can't be declared in metal.h because cgo can't
+// parse the Objective-C types.
+id<MTLFunction> function_retrieve(int functionId);
+
+// Free the members that argument_buffer_new found.
+void argument_members_free(argument_member *members, int numMembers) {
+  for (int i = 0; i < numMembers; i++) {
+    free((void *)members[i].name);
+  }
+  free(members);
+}
+
+// Add a member of an argument buffer's struct to members, which holds
+// numMembers members and grows as needed. This returns false if the memory for
+// members couldn't be allocated.
+static _Bool add_member(argument_member **members, int *numMembers,
+                        NSString *name, NSUInteger index,
+                        MTLDataType dataType) {
+  argument_member *grown =
+      realloc(*members, sizeof(argument_member) * (*numMembers + 1));
+  if (grown == nil) {
+    return false;
+  }
+  *members = grown;
+
+  argument_member *member = &grown[*numMembers];
+  member->name = strdup([name UTF8String]);
+  member->index = (int)index;
+  member->dataType = (int)dataType;
+  (*numMembers)++;
+
+  return true;
+}
+
+// Find the members of the struct that the metal function takes at the buffer
+// index bufferIndex, through the reflection of a pipeline for the function.
+// Every element of an array of pointers is a member of its own. The members
+// are stored in a new array in members, and their number in numMembers; they
+// must be freed with argument_members_free. If any error is encountered, this
+// returns false and sets an error message in error.
+static _Bool find_members(id<MTLFunction> function, int bufferIndex,
+                          argument_member **members, int *numMembers,
+                          const char **error) {
+  MTLComputePipelineReflection *reflection = nil;
+  NSError *pipelineError = nil;
+  id<MTLComputePipelineState> pipeline = [[function device]
+      newComputePipelineStateWithFunction:function
+                                  options:MTLPipelineOptionArgumentInfo
+                               reflection:&reflection
+                                    error:&pipelineError];
+  if (pipeline == nil) {
+    logError(error, @"Failed to create pipeline (see console log)");
+    NSLog(@"Failed to create pipeline: %@", pipelineError);
+    return false;
+  }
+  [pipeline release];
+
+  MTLStructType *structType = nil;
+  for (MTLArgument *argument in [reflection arguments]) {
+    if ([argument type] == MTLArgumentTypeBuffer &&
+        [argument index] == (NSUInteger)bufferIndex) {
+      structType = [argument bufferStructType];
+      break;
+    }
+  }
+  if (structType == nil) {
+    logError(error,
+             [NSString stringWithFormat:@"Failed to find argument buffer at "
+                                        @"buffer index %d",
+                                        bufferIndex]);
+    return false;
+  }
+
+  *members = nil;
+  *numMembers = 0;
+  for (MTLStructMember *member in [structType members]) {
+    _Bool ok = true;
+    MTLArrayType *arrayType = [member arrayType];
+    if (arrayType != nil && [arrayType elementType] == MTLDataTypePointer) {
+      NSUInteger stride = [arrayType argumentIndexStride];
+      if (stride == 0) {
+        stride = 1;
+      }
+      for (NSUInteger i = 0; ok && i < [arrayType arrayLength]; i++) {
+        ok = add_member(
+            members, numMembers,
+            [NSString stringWithFormat:@"%@[%lu]", [member name], i],
+            [member argumentIndex] + i * stride, MTLDataTypePointer);
+      }
+    } else if (arrayType != nil) {
+      // Arrays of scalars are only accessible through their first element.
+      ok = add_member(members, numMembers, [member name],
+                      [member argumentIndex], [arrayType elementType]);
+    } else {
+      ok = add_member(members, numMembers, [member name],
+                      [member argumentIndex], [member dataType]);
+    }
+
+    if (!ok) {
+      argument_members_free(*members, *numMembers);
+      logError(error, @"Failed to list members of argument buffer");
+      return false;
+    }
+  }
+
+  return true;
+}
+
+// Set up an argument buffer for the struct that the metal function with the
+// provided function Id takes at the buffer index bufferIndex. This creates an
+// argument encoder, which writes the struct's members, and a buffer that is
+// large enough to hold them. The buffer is cached, and its Id is stored in
+// bufferId, so that it can be supplied as an argument to the metal function
+// like any other buffer. The struct's members are stored in members and
+// numMembers (see find_members), and must be freed with argument_members_free.
+// This returns the Id of the argument encoder. If any error is encountered,
+// this returns 0 and sets an error message in error.
+int argument_buffer_new(int functionId, int bufferIndex, int *bufferId,
+                        argument_member **members, int *numMembers,
+                        const char **error) {
+  id<MTLFunction> function = function_retrieve(functionId);
+  if (function == nil) {
+    logError(error, @"Failed to retrieve function");
+    return 0;
+  }
+
+  if (!find_members(function, bufferIndex, members, numMembers, error)) {
+    return 0;
+  }
+
+  // Metal throws an exception instead of returning nil if the argument isn't
+  // a struct that can be encoded.
+  id<MTLArgumentEncoder> encoder = nil;
+  @try {
+    encoder = [function newArgumentEncoderWithBufferIndex:bufferIndex];
+  } @catch (NSException *exception) {
+    NSLog(@"Failed to create argument encoder: %@", exception);
+  }
+  if (encoder == nil) {
+    argument_members_free(*members, *numMembers);
+    logError(error,
+             [NSString stringWithFormat:@"Failed to find argument buffer at "
+                                        @"buffer index %d",
+                                        bufferIndex]);
+    return 0;
+  }
+
+  // Metal can't create empty buffers, so there is always at least one byte. The
+  // buffer is on the same GPU as the function.
+  NSUInteger length = [encoder encodedLength];
+  if (length == 0) {
+    length = 1;
+  }
+  id<MTLBuffer> buffer =
+      [[function device] newBufferWithLength:length
+                                     options:MTLResourceStorageModeShared];
+  if (buffer == nil) {
+    [encoder release];
+    argument_members_free(*members, *numMembers);
+    logError(error, [NSString
+                        stringWithFormat:@"Failed to create buffer with %lu bytes",
+                                         length]);
+    return 0;
+  }
+  [encoder setArgumentBuffer:buffer offset:0];
+
+  // Add the encoder and the buffer to the cache and return their unique Ids.
+  int encoderId = cache_cache(encoder);
+  if (encoderId == 0) {
+    [encoder release];
+    [buffer release];
+    argument_members_free(*members, *numMembers);
+    logError(error, @"Failed to cache argument encoder");
+    return 0;
+  }
+  *bufferId = cache_cache(buffer);
+  if (*bufferId == 0) {
+    [buffer release];
+    argument_members_free(*members, *numMembers);
+    logError(error, @"Failed to cache buffer");
+    return 0;
+  }
+
+  return encoderId;
+}
+
+// Write a pointer to a buffer, starting offset bytes into the buffer, to the
+// member of an argument buffer with the provided index ([[id(n)]] in the struct
+// declaration). If any error is encountered, this returns false and sets an
+// error message in error.
+_Bool argument_buffer_set_buffer(int encoderId, int index, int bufferId,
+                                 unsigned long long offset,
+                                 const char **error) {
+  id<MTLArgumentEncoder> encoder = cache_retrieve(encoderId);
+  if (encoder == nil) {
+    logError(error, @"Failed to retrieve argument buffer");
+    return false;
+  }
+
+  id<MTLBuffer> buffer = cache_retrieve(bufferId);
+  if (buffer == nil) {
+    logError(error, @"Failed to retrieve buffer");
+    return false;
+  }
+  if (!device_same([buffer device], [encoder device])) {
+    logError(error,
+             @"Buffer is on a different device than the argument buffer");
+    return false;
+  }
+
+  // Metal throws an exception if there is no member at the index.
+  @try {
+    [encoder setBuffer:buffer offset:(NSUInteger)offset atIndex:index];
+  } @catch (NSException *exception) {
+    NSLog(@"Failed to set argument: %@", exception);
+    logError(error, [NSString stringWithFormat:@"Failed to set argument %d",
+                                               index]);
+    return false;
+  }
+
+  return true;
+}
+
+// Get a pointer to the memory of the scalar member of an argument buffer with
+// the provided index ([[id(n)]] in the struct declaration). If any error is
+// encountered, this returns nil and sets an error message in error.
+void *argument_buffer_constant(int encoderId, int index, const char **error) {
+  id<MTLArgumentEncoder> encoder = cache_retrieve(encoderId);
+  if (encoder == nil) {
+    logError(error, @"Failed to retrieve argument buffer");
+    return nil;
+  }
+
+  // Metal throws an exception if there is no member at the index.
+  void *data = nil;
+  @try {
+    data = [encoder constantDataAtIndex:index];
+  } @catch (NSException *exception) {
+    NSLog(@"Failed to get argument: %@", exception);
+  }
+  if (data == nil) {
+    logError(error,
+             [NSString stringWithFormat:@"Failed to get argument %d", index]);
+  }
+
+  return data;
+}
+
+// Release the argument encoder with the provided Id. The argument buffer's
+// buffer is released separately, like any other buffer.
+void argument_buffer_release(int encoderId) {
+  id<MTLArgumentEncoder> encoder = cache_retrieve(encoderId);
+  if (encoder == nil) {
+    return;
+  }
+
+  cache_remove(encoderId);
+  [encoder release];
+}
@@ -0,0 +1,81 @@
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_checkArgumentCounts tests that checkArgumentCounts rejects more arguments than metal's
+// argument tables hold.
+func Test_checkArgumentCounts(t *testing.T) {
+	require.Nil(t, checkArgumentCounts(0, 0))
+	require.Nil(t, checkArgumentCounts(31, 16))
+
+	err := checkArgumentCounts(32, 0)
+	require.NotNil(t, err)
+	require.Equal(t, "Metal functions take at most 31 buffers instead of 32 (use an argument buffer for more)", err.Error())
+
+	err = checkArgumentCounts(1, 17)
+	require.NotNil(t, err)
+	require.Equal(t, "Metal functions take at most 16 samplers instead of 17", err.Error())
+}
+
+// Test_argumentMembers tests that the members of an argument buffer's struct only accept values of
+// their own kind and size.
+func Test_argumentMembers(t *testing.T) {
+	members := argumentMembers{
+		0: newArgumentMember("arrays[0]", mtlDataTypePointer),
+		1: newArgumentMember("arrays[1]", mtlDataTypePointer),
+		2: newArgumentMember("count", 33),
+		3: newArgumentMember("scale", 16),
+		4: newArgumentMember("offset", 6),
+		5: newArgumentMember("image", 58),
+	}
+
+	type scenario struct {
+		index   int
+		pointer bool
+		size    int
+		wantErr string
+	}
+
+	for _, s := range []scenario{
+		// Valid
+		{0, true, 0, ""},
+		{1, true, 0, ""},
+		{2, false, 4, ""},
+		{3, false, 2, ""},
+		{4, false, 16, ""},
+
+		// Invalid indexes
+		{-1, true, 0, "Invalid argument index -1"},
+		{6, true, 0, "Invalid argument index 6"},
+		{42, false, 4, "Invalid argument index 42"},
+
+		// Wrong kinds
+		{2, true, 0, "Argument 2 (count) is not a pointer to a buffer"},
+		{5, true, 0, "Argument 5 (image) is not a pointer to a buffer"},
+		{0, false, 8, "Argument 0 (arrays[0]) is not a scalar or vector"},
+		{5, false, 8, "Argument 5 (image) is not a scalar or vector"},
+
+		// Wrong sizes
+		{2, false, 8, "Argument 2 (count) is 4 bytes instead of 8 bytes"},
+		{3, false, 4, "Argument 3 (scale) is 2 bytes instead of 4 bytes"},
+		{4, false, 12, "Argument 4 (offset) is 16 bytes instead of 12 bytes"},
+	} {
+		var err error
+		if s.pointer {
+			err = members.checkPointer(s.index)
+		} else {
+			err = members.checkData(s.index, s.size)
+		}
+
+		if s.wantErr != "" {
+			require.NotNil(t, err, "%v", s)
+			require.Equal(t, s.wantErr, err.Error(), "%v", s)
+			continue
+		}
+		require.Nil(t, err, "%v", s)
+	}
+}
@@ -0,0 +1,260 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+/*
+#cgo LDFLAGS: -framework Metal -framework CoreGraphics -framework Foundation
+#include "metal.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"unsafe"
+)
+
+// An ArgumentBuffer holds the members of a struct that a metal function takes as a single buffer
+// argument. This gets around the limit of 31 buffers that can be supplied to a metal function
+// directly, for example for a function that sums any number of arrays:
+//
+//	struct Inputs {
+//	    device const float *arrays[64] [[id(0)]];
+//	    uint count [[id(64)]];
+//	};
+//
+//	kernel void sum(constant Inputs &inputs [[buffer(0)]], device float *result [[buffer(1)]],
+//	                uint pos [[thread_position_in_grid]]) { ... }
+//
+// Every member has the index of its [[id(n)]] attribute, and the elements of an array have
+// consecutive indexes. Pointers to buffers are set with SetBuffer and SetBuffers, and scalars and
+// vectors with SetArgument. The members are looked up in the metal function when the argument
+// buffer is created, so that setting a member that doesn't exist, or setting a member to a value of
+// the wrong kind or size, fails. Arrays of scalars can only be set through their first element,
+// and members of other types, such as textures and nested structs, can't be set at all. The element
+// types of pointers must still match the struct declaration, the same way that the types of
+// buffers must match the metal function.
+//
+// An ArgumentBuffer is supplied to RunResources like any other buffer, which also tells metal that
+// the function uses every buffer that the argument buffer references, so that they are accessible
+// to the GPU.
+//
+// The buffer that holds the members counts towards the memory budget (see SetMemoryBudget) until
+// it's released with Release.
+//
+// An ArgumentBuffer is not safe for concurrent use, and its members must not be changed while a
+// metal function that uses it is running.
+type ArgumentBuffer struct {
+	encoderId int
+	id        BufferId
+
+	// members holds the members of the struct by index.
+	members argumentMembers
+
+	// resources holds on to the resource at every index, so that RunResources can make them
+	// resident and resources such as ManagedBuffers aren't released while the argument buffer
+	// references them.
+	resources map[int]Resource
+
+	// ctx is the context that created the argument buffer, or nil for the default context.
+	ctx *Context
+}
+
+// NewArgumentBuffer creates an argument buffer for the struct that the metal function takes at
+// buffer index bufferIndex ([[buffer(n)]] in the function declaration). Its members start out as
+// zero.
+func NewArgumentBuffer(function FunctionId, bufferIndex int) (*ArgumentBuffer, error) {
+	if bufferIndex < 0 || bufferIndex >= maxBufferArguments {
+		return nil, fmt.Errorf("Invalid buffer index %d", bufferIndex)
+	}
+
+	done, err := use(int(function))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create argument buffer: %w", err)
+	}
+	defer done()
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	var bufferId, numMembers C.int
+	var cMembers *C.argument_member
+	encoderId := int(C.argument_buffer_new(C.int(function), C.int(bufferIndex), &bufferId, &cMembers,
+		&numMembers, &metalErr))
+	if encoderId == 0 {
+		return nil, metalErrToError(metalErr, "Unable to create argument buffer")
+	}
+
+	members := make(argumentMembers, int(numMembers))
+	if numMembers > 0 {
+		for _, m := range unsafe.Slice(cMembers, int(numMembers)) {
+			members[int(m.index)] = newArgumentMember(C.GoString(m.name), int(m.dataType))
+		}
+	}
+	C.argument_members_free(cMembers, numMembers)
+
+	a := &ArgumentBuffer{
+		encoderId: encoderId,
+		id:        BufferId(bufferId),
+		members:   members,
+		resources: make(map[int]Resource),
+	}
+
+	// The buffer is recorded like any other buffer, once its size is known.
+	numBytes := uint64(C.buffer_length(bufferId, &metalErr))
+	if err := memory.reserve(numBytes); err != nil {
+		C.argument_buffer_release(C.int(encoderId))
+		C.buffer_release(bufferId)
+		return nil, err
+	}
+	memory.add(int(bufferId), bufferRecord{
+		elemType: "metal.ArgumentBuffer",
+		storage:  StorageShared,
+		numBytes: numBytes,
+	})
+
+	return a, nil
+}
+
+// Id returns the Id of the buffer that holds the argument buffer's members.
+func (a *ArgumentBuffer) Id() BufferId {
+	return a.id
+}
+
+// Release releases the argument buffer. It must not be in use by a metal function that is running,
+// and neither it nor its Id can be used after this. The buffers that it references are not
+// released. It does nothing if the argument buffer was already released.
+func (a *ArgumentBuffer) Release() {
+	if a.encoderId == 0 {
+		return
+	}
+
+	C.argument_buffer_release(C.int(a.encoderId))
+	releaseBuffer(a.id)
+	a.encoderId = 0
+	a.resources = nil
+}
+
+// check checks that the argument buffer can still be used.
+func (a *ArgumentBuffer) check() error {
+	if a == nil || a.encoderId == 0 {
+		return errors.New("Argument buffer is released")
+	}
+
+	return nil
+}
+
+// SetBuffer sets the member at index to a pointer to resource, such as a BufferId, BufferView, or
+// Tensor. Views point to the start of the view, and tensors point to the start of their buffer, the
+// same way as when they are supplied to RunResources.
+func (a *ArgumentBuffer) SetBuffer(index int, resource Resource) error {
+	if err := a.check(); err != nil {
+		return err
+	}
+	if err := a.members.checkPointer(index); err != nil {
+		return err
+	}
+	if err := a.ctx.checkOwners(0, []Resource{resource}); err != nil {
+		return fmt.Errorf("Unable to set argument: %w", err)
+	}
+
+	done, err := useResources(0, []Resource{a, resource})
+	if err != nil {
+		return fmt.Errorf("Unable to set argument: %w", err)
+	}
+	defer done()
+
+	b, err := resourceRange(resource)
+	if err != nil {
+		return err
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	if ok := C.argument_buffer_set_buffer(C.int(a.encoderId), C.int(index), C.int(b.bufferId), C.ulonglong(b.offset), &metalErr); !ok {
+		return metalErrToError(metalErr, "Unable to set argument")
+	}
+	a.resources[index] = resource
+
+	return nil
+}
+
+// SetBuffers sets the members starting at index to pointers to resources, one after the other.
+// This is the same as calling SetBuffer for every resource, and it's the easiest way to fill in an
+// array of pointers.
+func (a *ArgumentBuffer) SetBuffers(index int, resources ...Resource) error {
+	for i, resource := range resources {
+		if err := a.SetBuffer(index+i, resource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetArgument sets the scalar member of the argument buffer at index to value.
+func SetArgument[T BufferType](a *ArgumentBuffer, index int, value T) error {
+	if err := a.check(); err != nil {
+		return err
+	}
+	if err := a.members.checkData(index, sizeof[T]()); err != nil {
+		return err
+	}
+
+	done, err := use(int(a.id))
+	if err != nil {
+		return fmt.Errorf("Unable to set argument: %w", err)
+	}
+	defer done()
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	ptr := C.argument_buffer_constant(C.int(a.encoderId), C.int(index), &metalErr)
+	if ptr == nil {
+		return metalErrToError(metalErr, "Unable to set argument")
+	}
+	*(*T)(ptr) = value
+
+	return nil
+}
+
+// binding supplies the argument buffer to the metal function, along with every buffer that it
+// references.
+func (a *ArgumentBuffer) binding() binding {
+	return binding{bufferId: a.id, uses: a.uses(map[*ArgumentBuffer]bool{a: true})}
+}
+
+// uses lists the buffers that the argument buffer references. Argument buffers can reference other
+// argument buffers, whose buffers are used too. Every argument buffer is only visited once, so that
+// argument buffers that reference each other don't recurse forever.
+func (a *ArgumentBuffer) uses(visited map[*ArgumentBuffer]bool) []BufferId {
+	indexes := make([]int, 0, len(a.resources))
+	for index := range a.resources {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var uses []BufferId
+	for _, index := range indexes {
+		resource := a.resources[index]
+		nested, ok := resource.(*ArgumentBuffer)
+		if !ok {
+			b := resource.binding()
+			uses = append(uses, b.bufferId)
+			uses = append(uses, b.uses...)
+			continue
+		}
+
+		uses = append(uses, nested.id)
+		if !visited[nested] {
+			visited[nested] = true
+			uses = append(uses, nested.uses(visited)...)
+		}
+	}
+
+	return uses
+}
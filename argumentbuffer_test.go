@@ -0,0 +1,135 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	_ "embed"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed test/sumArrays.metal
+var sourceSumArrays string
+
+// Test_ArgumentBuffer tests that metal functions can read more buffers through an argument buffer
+// than can be supplied to them directly.
+func Test_ArgumentBuffer(t *testing.T) {
+	functionId, err := NewFunction(sourceSumArrays, "sumArrays")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(functionId))
+
+	args, err := NewArgumentBuffer(functionId, 0)
+	require.Nil(t, err, "Unable to create argument buffer: %s", err)
+	addId()
+	require.True(t, validId(args.Id()))
+
+	// Set up more arrays than metal's limit of 31 buffers.
+	const numArrays, width = 40, 100
+	arrays := make([]Resource, numArrays)
+	for i := range arrays {
+		arrayId, array, err := NewBuffer1D[float32](width)
+		require.Nil(t, err, "Unable to create metal buffer: %s", err)
+		require.True(t, validId(arrayId))
+		for j := range array {
+			array[j] = float32(i + j)
+		}
+		arrays[i] = arrayId
+	}
+	require.Nil(t, args.SetBuffers(0, arrays...))
+	require.Nil(t, SetArgument(args, 40, uint32(numArrays)))
+	require.Nil(t, SetArgument(args, 41, float32(0.5)))
+
+	resultId, result, err := NewBuffer1D[float32](width)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(resultId))
+
+	err = functionId.RunResources(Grid{X: width}, args, resultId)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+	for j, v := range result {
+		// The sum of i + j for every array i.
+		want := float32(numArrays*(numArrays-1)/2+numArrays*j) * 0.5
+		require.Equal(t, want, v)
+	}
+
+	// Members can be changed between runs, and views point into their buffers.
+	view, _, err := View[float32](arrays[0].(BufferId), 50, 50)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	require.Nil(t, args.SetBuffer(0, view))
+	require.Nil(t, SetArgument(args, 40, uint32(1)))
+	require.Nil(t, SetArgument(args, 41, float32(1)))
+	err = functionId.RunResources(Grid{X: width / 2}, args, resultId)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+	for j := 0; j < width/2; j++ {
+		require.Equal(t, float32(50+j), result[j])
+	}
+
+	// The same works in a batch.
+	batch, err := NewBatch()
+	require.Nil(t, err, "Unable to create batch: %s", err)
+	addId()
+	require.Nil(t, SetArgument(args, 41, float32(2)))
+	require.Nil(t, batch.Run(functionId, Grid{X: width / 2}, args, resultId))
+	require.Nil(t, batch.Commit())
+	require.Equal(t, float32(100), result[0])
+
+	// Supplying the arrays directly exceeds metal's limit.
+	err = functionId.RunResources(Grid{X: width}, arrays...)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to run metal function: Metal functions take at most 31 buffers instead of 40 (use an argument buffer for more)", err.Error())
+
+	// Invalid arguments
+	err = args.SetBuffer(-1, resultId)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid argument index -1", err.Error())
+	err = args.SetBuffer(1, BufferId(0))
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid buffer Id", err.Error())
+	err = SetArgument(args, -2, uint32(1))
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid argument index -2", err.Error())
+	_, err = NewArgumentBuffer(functionId, 31)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid buffer index 31", err.Error())
+	_, err = NewArgumentBuffer(FunctionId(10000), 0)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to create argument buffer: Failed to retrieve function", err.Error())
+
+	// Members must exist and have the right kind and size.
+	err = args.SetBuffer(42, resultId)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid argument index 42", err.Error())
+	err = args.SetBuffer(40, resultId)
+	require.NotNil(t, err)
+	require.Equal(t, "Argument 40 (count) is not a pointer to a buffer", err.Error())
+	err = SetArgument(args, 0, uint32(1))
+	require.NotNil(t, err)
+	require.Equal(t, "Argument 0 (arrays[0]) is not a scalar or vector", err.Error())
+	err = SetArgument(args, 41, Float16(1))
+	require.NotNil(t, err)
+	require.Equal(t, "Argument 41 (scale) is 4 bytes instead of 2 bytes", err.Error())
+
+	// Argument buffers that reference each other are only visited once.
+	other, err := NewArgumentBuffer(functionId, 0)
+	require.Nil(t, err, "Unable to create argument buffer: %s", err)
+	addId()
+	require.True(t, validId(other.Id()))
+	require.Nil(t, args.SetBuffer(1, other))
+	require.Nil(t, other.SetBuffer(0, args))
+	b := args.binding()
+	require.Equal(t, args.Id(), b.bufferId)
+	require.Contains(t, b.uses, other.Id())
+	require.Contains(t, b.uses, args.Id())
+
+	// Argument buffers count towards the memory until they are released.
+	before := Memory()
+	other.Release()
+	other.Release()
+	require.Equal(t, before.Buffers-1, Memory().Buffers)
+	err = other.SetBuffer(0, resultId)
+	require.NotNil(t, err)
+	require.Equal(t, "Argument buffer is released", err.Error())
+	args.Release()
+	require.Equal(t, before.Buffers-2, Memory().Buffers)
+}
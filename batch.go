@@ -0,0 +1,368 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+/*
+#cgo LDFLAGS: -framework Metal -framework CoreGraphics -framework Foundation
+#include "metal.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// A Batch collects operations, such as running metal functions and copying and filling buffers,
+// and runs them together on the GPU. The operations run in the order they were added, and each one
+// sees the results of the ones before it, without any work on the CPU in between. Create one with
+// NewBatch, add operations to it, and then run them with Commit.
+//
+// A Batch that uses objects of a Context keeps the context from being closed until the batch is
+// committed or discarded.
+//
+// A Batch is not safe for concurrent use.
+type Batch struct {
+	// mu guards the batch against a Context discarding it in Close while it's being used.
+	mu sync.Mutex
+	id int
+
+	// resources holds on to every resource that the operations use until the batch is committed
+	// or discarded, so that resources such as ManagedBuffers aren't released while the GPU might
+	// still use them.
+	resources []Resource
+
+	// done ends the uses of context objects by the operations, once the batch is committed or
+	// discarded.
+	done []func()
+
+	// ctx is the context that created the batch, or nil for the default context.
+	ctx *Context
+}
+
+// NewBatch creates a new, empty batch. It must be committed with Commit or thrown away with
+// Discard.
+func NewBatch() (*Batch, error) {
+	return NewBatchOnDevice(Device{})
+}
+
+// NewBatchOnDevice creates a new, empty batch that runs on the provided device. It works the same
+// way as NewBatch otherwise. Every operation in the batch must use functions and buffers on the
+// same device.
+func NewBatchOnDevice(device Device) (*Batch, error) {
+	return newBatch(device, 0)
+}
+
+// newBatch creates a new, empty batch on the command queue with the provided Id, or on the device's
+// own queue if the Id is 0.
+func newBatch(device Device, queueId int) (*Batch, error) {
+	if err := ensureInit(); err != nil {
+		return nil, err
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	batchId := C.batch_new(C.int(device.index), C.int(queueId), &metalErr)
+	if int(batchId) == 0 {
+		return nil, metalErrToError(metalErr, "Unable to create batch")
+	}
+
+	return &Batch{id: int(batchId)}, nil
+}
+
+// Run adds a run of the metal function to the batch. It works the same way as FunctionId's
+// RunResources method, except that the function doesn't run until the batch is committed.
+func (b *Batch) Run(function FunctionId, grid Grid, resources ...Resource) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.check(); err != nil {
+		return err
+	}
+
+	if err := b.ctx.checkOwners(function, resources); err != nil {
+		return fmt.Errorf("Unable to run metal function: %w", err)
+	}
+
+	d, err := newDispatch(grid, resources)
+	if err != nil {
+		return fmt.Errorf("Unable to run metal function: %w", err)
+	}
+
+	done, err := useResources(function, resources)
+	if err != nil {
+		return fmt.Errorf("Unable to run metal function: %w", err)
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	if ok := C.batch_run(C.int(b.id), C.int(function), d.width, d.height, d.depth, d.bufferPtr(), d.offsetPtr(), C.int(len(d.bufferIds)), d.texturePtr(), C.int(len(d.textureIds)), d.samplerPtr(), C.int(len(d.samplerIds)), d.residentPtr(), C.int(len(d.residentIds)), &metalErr); !ok {
+		done()
+		return metalErrToError(metalErr, "Unable to run metal function")
+	}
+	b.resources = append(b.resources, resources...)
+	b.done = append(b.done, done)
+
+	return nil
+}
+
+// Copy adds a copy of n bytes from src to dst to the batch. The bytes are copied from srcOffset
+// bytes into src to dstOffset bytes into dst. Both offsets and n must be multiples of 4, and the
+// two ranges must not overlap.
+func (b *Batch) Copy(dst Resource, dstOffset int, src Resource, srcOffset int, n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.check(); err != nil {
+		return err
+	}
+
+	if err := b.ctx.checkOwners(0, []Resource{dst, src}); err != nil {
+		return fmt.Errorf("Unable to copy buffer: %w", err)
+	}
+
+	done, err := useResources(0, []Resource{dst, src})
+	if err != nil {
+		return fmt.Errorf("Unable to copy buffer: %w", err)
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			done()
+		}
+	}()
+
+	dstRange, err := resourceRange(dst)
+	if err != nil {
+		return err
+	}
+	srcRange, err := resourceRange(src)
+	if err != nil {
+		return err
+	}
+
+	if err := blitRange(dstOffset, n, dstRange.length); err != nil {
+		return fmt.Errorf("Unable to copy to buffer: %w", err)
+	}
+	if err := blitRange(srcOffset, n, srcRange.length); err != nil {
+		return fmt.Errorf("Unable to copy from buffer: %w", err)
+	}
+
+	dstStart, srcStart := dstRange.offset+uint64(dstOffset), srcRange.offset+uint64(srcOffset)
+	if dstRange.bufferId == srcRange.bufferId && rangesOverlap(dstStart, srcStart, uint64(n)) {
+		return errors.New("Unable to copy buffer: Source and destination overlap")
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	if ok = bool(C.batch_copy(C.int(b.id), C.int(srcRange.bufferId), C.ulonglong(srcStart), C.int(dstRange.bufferId), C.ulonglong(dstStart), C.ulonglong(n), &metalErr)); !ok {
+		return metalErrToError(metalErr, "Unable to copy buffer")
+	}
+	b.resources = append(b.resources, dst, src)
+	b.done = append(b.done, done)
+
+	return nil
+}
+
+// Fill adds a fill of every byte of buf with value to the batch. The length of buf (and its
+// offset, for views) must be a multiple of 4 bytes. Filling with 0 is the quickest way to clear a
+// buffer.
+func (b *Batch) Fill(buf Resource, value byte) error {
+	return b.fill(buf, []byte{value})
+}
+
+// BatchFillValue adds a fill of every element of buf with value to the batch. It is the same as
+// FillValue, except that the fill doesn't happen until the batch is committed.
+func BatchFillValue[T BufferType](b *Batch, buf Resource, value T) error {
+	return b.fill(buf, unsafe.Slice((*byte)(unsafe.Pointer(&value)), sizeof[T]()))
+}
+
+// fill is the common internal function for filling buf with a repeating pattern of bytes.
+func (b *Batch) fill(buf Resource, pattern []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.check(); err != nil {
+		return err
+	}
+
+	if err := b.ctx.checkOwners(0, []Resource{buf}); err != nil {
+		return fmt.Errorf("Unable to fill buffer: %w", err)
+	}
+
+	done, err := useResources(0, []Resource{buf})
+	if err != nil {
+		return fmt.Errorf("Unable to fill buffer: %w", err)
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			done()
+		}
+	}()
+
+	r, err := resourceRange(buf)
+	if err != nil {
+		return err
+	}
+
+	if err := blitRange(0, int(r.length), r.length); err != nil {
+		return fmt.Errorf("Unable to fill buffer: %w", err)
+	}
+	if r.offset%4 != 0 {
+		return fmt.Errorf("Unable to fill buffer: Offset of %d bytes is not a multiple of 4 bytes",
+			r.offset)
+	}
+	if r.length%uint64(len(pattern)) != 0 {
+		return fmt.Errorf("Unable to fill buffer: Length of %d bytes is not a multiple of the "+
+			"element size of %d bytes", r.length, len(pattern))
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	if ok = bool(C.batch_fill(C.int(b.id), C.int(r.bufferId), C.ulonglong(r.offset), C.ulonglong(r.length), unsafe.Pointer(&pattern[0]), C.int(len(pattern)), &metalErr)); !ok {
+		return metalErrToError(metalErr, "Unable to fill buffer")
+	}
+	b.resources = append(b.resources, buf)
+	b.done = append(b.done, done)
+
+	return nil
+}
+
+// Commit runs all of the operations in the batch on the GPU, in the order they were added, and
+// waits for them to finish. The batch can't be used after this.
+func (b *Batch) Commit() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.check(); err != nil {
+		return err
+	}
+
+	// The context can't be closed while the batch is running.
+	if err := b.ctx.begin(); err != nil {
+		return err
+	}
+	defer b.ctx.end()
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	batchId := b.id
+	b.id = 0
+	b.ctx.forget(b)
+
+	ok := C.batch_commit(C.int(batchId), &metalErr)
+
+	// The GPU is done with the resources now.
+	b.release()
+
+	if !ok {
+		return metalErrToError(metalErr, "Unable to commit batch")
+	}
+
+	return nil
+}
+
+// Discard throws away the batch without running any of its operations. It does nothing if the
+// batch was already committed or discarded.
+func (b *Batch) Discard() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.id != 0 {
+		C.batch_discard(C.int(b.id))
+		b.id = 0
+		b.release()
+		b.ctx.forget(b)
+	}
+}
+
+// release lets go of the resources that the operations use and ends their uses of context
+// objects. b.mu must be held.
+func (b *Batch) release() {
+	for _, done := range b.done {
+		done()
+	}
+	b.resources, b.done = nil, nil
+}
+
+// check checks that the batch can still be used.
+func (b *Batch) check() error {
+	if b == nil || b.id == 0 {
+		return errors.New("Batch is already committed or discarded")
+	}
+
+	return nil
+}
+
+// Copy copies n bytes from src to dst on the GPU and waits for the copy to finish. It works the
+// same way as Batch's Copy method. The copy runs on the device that the buffers are on.
+func Copy(dst Resource, dstOffset int, src Resource, srcOffset int, n int) error {
+	return runBatch(resourceDevice(dst, src), 0, func(b *Batch) error {
+		return b.Copy(dst, dstOffset, src, srcOffset, n)
+	})
+}
+
+// Fill sets every byte of buf to value on the GPU and waits for the fill to finish. It works the
+// same way as Batch's Fill method. The fill runs on the device that the buffer is on.
+func Fill(buf Resource, value byte) error {
+	return runBatch(resourceDevice(buf), 0, func(b *Batch) error {
+		return b.Fill(buf, value)
+	})
+}
+
+// FillValue sets every element of buf to value on the GPU and waits for the fill to finish. The
+// length of buf must be a multiple of the size of T, and both its offset and its length must be
+// multiples of 4 bytes. The fill runs on the device that the buffer is on.
+func FillValue[T BufferType](buf Resource, value T) error {
+	return runBatch(resourceDevice(buf), 0, func(b *Batch) error {
+		return BatchFillValue(b, buf, value)
+	})
+}
+
+// runBatch runs the operations that add adds to a new batch on the device, which is created on the
+// command queue with the provided Id, or on the device's own queue if the Id is 0.
+func runBatch(device Device, queueId int, add func(b *Batch) error) error {
+	b, err := newBatch(device, queueId)
+	if err != nil {
+		return err
+	}
+
+	if err := add(b); err != nil {
+		b.Discard()
+		return err
+	}
+
+	return b.Commit()
+}
+
+// resourceDevice returns the device that the first buffer among the resources is on, so that a
+// batch for them can be created on that device. It returns the default device if there is no such
+// buffer or it can't be retrieved, in which case the batch reports the problem.
+func resourceDevice(resources ...Resource) Device {
+	for _, resource := range resources {
+		if resource == nil {
+			continue
+		}
+		b := resource.binding()
+		if b.kind != bufferArgument || !b.bufferId.Valid() {
+			continue
+		}
+
+		device, err := bufferDevice(b.bufferId)
+		if err != nil {
+			return Device{}
+		}
+		return device
+	}
+
+	return Device{}
+}
@@ -0,0 +1,303 @@
+// go:build darwin
+//  +build darwin
+
+#include "cache.h"
+#include "device.h"
+#include "error.h"
+#import <Metal/Metal.h>
+
+// Defined in function.m. This can't be declared in metal.h because cgo can't
+// parse the Objective-C types.
+_Bool function_encode(id<MTLCommandBuffer> commandBuffer, int functionId,
+                      int width, int height, int depth, int *bufferIds,
+                      unsigned long long *bufferOffsets, int numBufferIds,
+                      int *textureIds, int numTextureIds, int *samplerIds,
+                      int numSamplerIds, int *residentIds, int numResidentIds,
+                      const char **error);
+
+// The largest number of bytes of a fill pattern that are copied at once.
+static const unsigned long long maxPatternChunk = 1 << 20;
+
+// Set up a new command queue on the GPU with the provided index (see
+// device_get), for batches that shouldn't share the GPU's own queue. This
+// returns an Id for the queue, which must be released with queue_release. If
+// any error is encountered setting up the queue, this returns 0 and sets an
+// error message in error.
+int queue_new(int deviceIndex, const char **error) {
+  id<MTLDevice> device = device_get(deviceIndex);
+  if (device == nil) {
+    logError(error, @"Failed to find device");
+    return 0;
+  }
+
+  id<MTLCommandQueue> queue = [device newCommandQueue];
+  if (queue == nil) {
+    logError(error, @"Failed to set up command queue");
+    return 0;
+  }
+
+  int queueId = cache_cache(queue);
+  if (queueId == 0) {
+    [queue release];
+    logError(error, @"Failed to cache command queue");
+    return 0;
+  }
+
+  return queueId;
+}
+
+// Release a command queue that was set up with queue_new. Every batch on the
+// queue must be committed or discarded first. The queue Id can't be used after
+// this.
+void queue_release(int queueId) {
+  id<MTLCommandQueue> queue = cache_retrieve(queueId);
+  if (queue == nil) {
+    return;
+  }
+
+  cache_remove(queueId);
+  [queue release];
+}
+
+// Set up a new command buffer that operations can be added to, one after the
+// other, before they are all run together on the GPU with the provided index
+// (see device_get). The command buffer comes from the queue with the provided
+// Id (see queue_new), or from the GPU's own queue if the Id is 0. This returns
+// an Id that must be used to add the operations. If any error is encountered
+// setting up the command buffer, this returns 0 and sets an error message in
+// error.
+int batch_new(int deviceIndex, int queueId, const char **error) {
+  id<MTLDevice> device = device_get(deviceIndex);
+  if (device == nil) {
+    logError(error, @"Failed to find device");
+    return 0;
+  }
+
+  id<MTLCommandQueue> queue = device_queue(device);
+  if (queueId != 0) {
+    queue = cache_retrieve(queueId);
+    if (queue == nil) {
+      logError(error, @"Failed to retrieve command queue");
+      return 0;
+    }
+  }
+
+  id<MTLCommandBuffer> commandBuffer = [queue commandBuffer];
+  if (commandBuffer == nil) {
+    logError(error, @"Failed to set up command buffer");
+    return 0;
+  }
+
+  // The command buffer is autoreleased. It needs to stay around until the
+  // batch is committed or discarded.
+  [commandBuffer retain];
+
+  int batchId = cache_cache(commandBuffer);
+  if (batchId == 0) {
+    [commandBuffer release];
+    logError(error, @"Failed to cache batch");
+    return 0;
+  }
+
+  return batchId;
+}
+
+// Add a run of a metal function to a batch. This works the same way as
+// function_run, except that the function doesn't run until the batch is
+// committed.
+_Bool batch_run(int batchId, int functionId, int width, int height, int depth,
+                int *bufferIds, unsigned long long *bufferOffsets,
+                int numBufferIds, int *textureIds, int numTextureIds,
+                int *samplerIds, int numSamplerIds, int *residentIds,
+                int numResidentIds, const char **error) {
+  id<MTLCommandBuffer> commandBuffer = cache_retrieve(batchId);
+  if (commandBuffer == nil) {
+    logError(error, @"Failed to retrieve batch");
+    return false;
+  }
+
+  return function_encode(commandBuffer, functionId, width, height, depth,
+                         bufferIds, bufferOffsets, numBufferIds, textureIds,
+                         numTextureIds, samplerIds, numSamplerIds, residentIds,
+                         numResidentIds, error);
+}
+
+// Add a copy of size bytes from one buffer to another to a batch. If any error
+// is encountered, this returns false and sets an error message in error.
+_Bool batch_copy(int batchId, int srcId, unsigned long long srcOffset,
+                 int dstId, unsigned long long dstOffset,
+                 unsigned long long size, const char **error) {
+  id<MTLCommandBuffer> commandBuffer = cache_retrieve(batchId);
+  if (commandBuffer == nil) {
+    logError(error, @"Failed to retrieve batch");
+    return false;
+  }
+
+  id<MTLBuffer> src = cache_retrieve(srcId);
+  id<MTLBuffer> dst = cache_retrieve(dstId);
+  if (src == nil || dst == nil) {
+    logError(error, @"Failed to retrieve buffer");
+    return false;
+  }
+  if (!device_same([src device], [commandBuffer device]) ||
+      !device_same([dst device], [commandBuffer device])) {
+    logError(error, @"Buffer is on a different device than the batch");
+    return false;
+  }
+
+  id<MTLBlitCommandEncoder> encoder = [commandBuffer blitCommandEncoder];
+  if (encoder == nil) {
+    logError(error, @"Failed to set up blit encoder");
+    return false;
+  }
+
+  // Managed buffers have a separate copy for the CPU, which needs to be kept in
+  // sync with the GPU's copy.
+  if ([src storageMode] == MTLStorageModeManaged) {
+    [src didModifyRange:NSMakeRange(srcOffset, size)];
+  }
+
+  [encoder copyFromBuffer:src
+             sourceOffset:(NSUInteger)srcOffset
+                 toBuffer:dst
+        destinationOffset:(NSUInteger)dstOffset
+                     size:(NSUInteger)size];
+  if ([dst storageMode] == MTLStorageModeManaged) {
+    [encoder synchronizeResource:dst];
+  }
+  [encoder endEncoding];
+
+  return true;
+}
+
+// Add a fill of size bytes of a buffer with a repeating pattern of patternLen
+// bytes to a batch. size must be a multiple of patternLen. Patterns that are
+// made up of a single repeated byte are filled directly. Other patterns are
+// repeated in a temporary buffer, which is then copied into the buffer as many
+// times as needed. If any error is encountered, this returns false and sets an
+// error message in error.
+_Bool batch_fill(int batchId, int bufferId, unsigned long long offset,
+                 unsigned long long size, const void *pattern, int patternLen,
+                 const char **error) {
+  id<MTLCommandBuffer> commandBuffer = cache_retrieve(batchId);
+  if (commandBuffer == nil) {
+    logError(error, @"Failed to retrieve batch");
+    return false;
+  }
+
+  id<MTLBuffer> buffer = cache_retrieve(bufferId);
+  if (buffer == nil) {
+    logError(error, @"Failed to retrieve buffer");
+    return false;
+  }
+  if (!device_same([buffer device], [commandBuffer device])) {
+    logError(error, @"Buffer is on a different device than the batch");
+    return false;
+  }
+
+  const unsigned char *bytes = pattern;
+  _Bool uniform = true;
+  for (int i = 1; i < patternLen; i++) {
+    if (bytes[i] != bytes[0]) {
+      uniform = false;
+      break;
+    }
+  }
+
+  id<MTLBuffer> chunk = nil;
+  unsigned long long chunkLen = 0;
+  if (!uniform) {
+    // The chunk has to hold a whole number of patterns and be a multiple of 4
+    // bytes long, the same as every copy.
+    unsigned long long step = patternLen;
+    while (step % 4 != 0) {
+      step += patternLen;
+    }
+    chunkLen = maxPatternChunk / step * step;
+    if (chunkLen > size) {
+      chunkLen = size;
+    }
+
+    chunk = [[buffer device] newBufferWithLength:(NSUInteger)chunkLen
+                                         options:MTLResourceStorageModeShared];
+    if (chunk == nil) {
+      logError(error, [NSString
+                          stringWithFormat:@"Failed to create buffer with %llu bytes",
+                                           chunkLen]);
+      return false;
+    }
+    for (unsigned long long i = 0; i < chunkLen; i += patternLen) {
+      memcpy((unsigned char *)[chunk contents] + i, pattern, patternLen);
+    }
+  }
+
+  id<MTLBlitCommandEncoder> encoder = [commandBuffer blitCommandEncoder];
+  if (encoder == nil) {
+    [chunk release];
+    logError(error, @"Failed to set up blit encoder");
+    return false;
+  }
+
+  if (uniform) {
+    [encoder fillBuffer:buffer
+                  range:NSMakeRange(offset, size)
+                  value:bytes[0]];
+  } else {
+    for (unsigned long long done = 0; done < size; done += chunkLen) {
+      unsigned long long n = size - done;
+      if (n > chunkLen) {
+        n = chunkLen;
+      }
+      [encoder copyFromBuffer:chunk
+                 sourceOffset:0
+                     toBuffer:buffer
+            destinationOffset:(NSUInteger)(offset + done)
+                         size:(NSUInteger)n];
+    }
+  }
+  if ([buffer storageMode] == MTLStorageModeManaged) {
+    [encoder synchronizeResource:buffer];
+  }
+  [encoder endEncoding];
+
+  // The command buffer keeps its own reference to the chunk until it's done.
+  [chunk release];
+
+  return true;
+}
+
+// Run all of the operations in a batch on the GPU, in the order they were
+// added, and wait for them to finish. The batch can't be used after this. If
+// any error is encountered, this returns false and sets an error message in
+// error.
+_Bool batch_commit(int batchId, const char **error) {
+  id<MTLCommandBuffer> commandBuffer = cache_retrieve(batchId);
+  if (commandBuffer == nil) {
+    logError(error, @"Failed to retrieve batch");
+    return false;
+  }
+  cache_remove(batchId);
+
+  [commandBuffer commit];
+  [commandBuffer waitUntilCompleted];
+
+  _Bool ok = [commandBuffer status] == MTLCommandBufferStatusCompleted;
+  if (!ok) {
+    logError(error, @"Failed to run batch (see console log)");
+    NSLog(@"Failed to run batch: %@", [commandBuffer error]);
+  }
+  [commandBuffer release];
+
+  return ok;
+}
+
+// Throw away a batch without running any of its operations.
+void batch_discard(int batchId) {
+  id<MTLCommandBuffer> commandBuffer = cache_retrieve(batchId);
+  if (commandBuffer == nil) {
+    return;
+  }
+  cache_remove(batchId);
+
+  [commandBuffer release];
+}
@@ -0,0 +1,227 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_Batch tests that a Batch runs metal functions, copies, and fills on the GPU in the order
+// they were added.
+func Test_Batch(t *testing.T) {
+	functionId, err := NewFunction(sourceTransfer1D, "transfer1D")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(functionId))
+
+	width := 1_000
+	inputId, input, err := NewBuffer1D[float32](width)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(inputId))
+	outputId, _, err := NewBufferWithOptions[float32](BufferOptions{Storage: StoragePrivate}, width)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(outputId))
+	resultId, result, err := NewBuffer1D[float32](width * 2)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(resultId))
+
+	for i := range input {
+		input[i] = float32(i) * 1.1
+	}
+
+	// Clear the result, copy the input into a buffer that only the GPU can access, run the
+	// function on it, and copy the output into the second half of the result.
+	batch, err := NewBatch()
+	require.Nil(t, err, "Unable to create batch: %s", err)
+	addId()
+
+	secondHalf, _, err := View[float32](resultId, width, width)
+	require.Nil(t, err, "Unable to create view: %s", err)
+
+	require.Nil(t, BatchFillValue(batch, resultId, float32(-1)))
+	require.Nil(t, batch.Run(functionId, Grid{X: width}, inputId, outputId))
+	require.Nil(t, batch.Copy(secondHalf, 0, outputId, 0, width*4))
+	require.Nil(t, batch.Fill(inputId, 0))
+
+	// Nothing happens before the batch is committed.
+	require.Equal(t, float32(1.1), input[1])
+	require.Equal(t, float32(0), result[0])
+
+	require.Nil(t, batch.Commit())
+	for i := 0; i < width; i++ {
+		require.Equal(t, float32(-1), result[i])
+		require.Equal(t, float32(i)*1.1, result[width+i])
+		require.Equal(t, float32(0), input[i])
+	}
+
+	// The batch can't be used after it's committed.
+	err = batch.Fill(inputId, 0)
+	require.NotNil(t, err)
+	require.Equal(t, "Batch is already committed or discarded", err.Error())
+	err = batch.Commit()
+	require.NotNil(t, err)
+	require.Equal(t, "Batch is already committed or discarded", err.Error())
+	batch.Discard()
+
+	// A discarded batch doesn't run anything.
+	batch, err = NewBatch()
+	require.Nil(t, err, "Unable to create batch: %s", err)
+	addId()
+	require.Nil(t, batch.Fill(resultId, 0xff))
+	batch.Discard()
+	require.Equal(t, float32(-1), result[0])
+	err = batch.Run(functionId, Grid{X: width}, inputId, outputId)
+	require.NotNil(t, err)
+	require.Equal(t, "Batch is already committed or discarded", err.Error())
+}
+
+// Test_Copy tests that Copy copies bytes between buffers on the GPU and rejects invalid ranges.
+func Test_Copy(t *testing.T) {
+	srcId, src, err := NewBuffer1D[int32](100)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(srcId))
+	dstId, dst, err := NewBuffer1D[int32](100)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(dstId))
+
+	for i := range src {
+		src[i] = int32(i)
+	}
+
+	require.Nil(t, Copy(dstId, 40, srcId, 0, 200))
+	addId()
+	for i := range dst {
+		if i >= 10 && i < 60 {
+			require.Equal(t, int32(i-10), dst[i])
+		} else {
+			require.Equal(t, int32(0), dst[i])
+		}
+	}
+
+	// Within the same buffer, between views
+	first, _, err := View[int32](srcId, 0, 50)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	second, _, err := View[int32](srcId, 50, 50)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	require.Nil(t, Copy(second, 0, first, 0, 200))
+	addId()
+	for i := 0; i < 50; i++ {
+		require.Equal(t, src[i], src[i+50])
+	}
+
+	type scenario struct {
+		dst, src             Resource
+		dstOffset, srcOffset int
+		n                    int
+		wantErr              string
+	}
+	for _, s := range []scenario{
+		{nil, srcId, 0, 0, 4, "Missing resource"},
+		{dstId, BufferId(0), 0, 0, 4, "Invalid buffer Id"},
+		{dstId, srcId, 0, 0, 0, "Unable to copy to buffer: Invalid length"},
+		{dstId, srcId, 2, 0, 4, "Unable to copy to buffer: Offset of 2 bytes is not a multiple of 4 bytes"},
+		{dstId, srcId, 0, 0, 6, "Unable to copy to buffer: Length of 6 bytes is not a multiple of 4 bytes"},
+		{dstId, srcId, 300, 0, 200, "Unable to copy to buffer: Range extends past the end of the buffer"},
+		{second, srcId, 0, 0, 204, "Unable to copy to buffer: Range extends past the end of the buffer"},
+		{dstId, second, 0, 4, 200, "Unable to copy from buffer: Range extends past the end of the buffer"},
+		{srcId, srcId, 0, 100, 200, "Unable to copy buffer: Source and destination overlap"},
+		{second, first, 0, 196, 8, "Unable to copy from buffer: Range extends past the end of the buffer"},
+	} {
+		err := Copy(s.dst, s.dstOffset, s.src, s.srcOffset, s.n)
+		require.NotNil(t, err, "%v", s)
+		require.Equal(t, s.wantErr, err.Error(), "%v", s)
+		addId()
+	}
+}
+
+// Test_FillValue tests that Fill and FillValue fill buffers on the GPU.
+func Test_FillValue(t *testing.T) {
+	bufferId, buffer, err := NewBuffer1D[uint32](1_000)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+
+	require.Nil(t, Fill(bufferId, 0xab))
+	addId()
+	for i := range buffer {
+		require.Equal(t, uint32(0xabababab), buffer[i])
+	}
+
+	require.Nil(t, FillValue(bufferId, uint32(0x12345678)))
+	addId()
+	for i := range buffer {
+		require.Equal(t, uint32(0x12345678), buffer[i])
+	}
+
+	// Part of a buffer
+	view, _, err := View[uint32](bufferId, 10, 20)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	require.Nil(t, Fill(view, 0))
+	addId()
+	for i := range buffer {
+		if i >= 10 && i < 30 {
+			require.Equal(t, uint32(0), buffer[i], i)
+		} else {
+			require.Equal(t, uint32(0x12345678), buffer[i], i)
+		}
+	}
+
+	// Larger than one chunk of the repeated pattern, with an element size that isn't a power of 2
+	vectorsId, vectors, err := NewBuffer1D[PackedFloat3](200_000)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(vectorsId))
+	want := PackedFloat3{1, 2, 3}
+	require.Nil(t, FillValue(vectorsId, want))
+	addId()
+	for i := range vectors {
+		require.Equal(t, want, vectors[i])
+	}
+
+	halvesId, halves, err := NewBuffer1D[Float16](10)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(halvesId))
+	require.Nil(t, FillValue(halvesId, NewFloat16(1.5)))
+	addId()
+	for i := range halves {
+		require.Equal(t, float32(1.5), halves[i].Float32())
+	}
+
+	// Lengths that aren't a multiple of 4 bytes
+	halvesId, _, err = NewBuffer1D[Float16](3)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(halvesId))
+	err = FillValue(halvesId, NewFloat16(1.5))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to fill buffer: Length of 6 bytes is not a multiple of 4 bytes", err.Error())
+	addId()
+
+	err = Fill(BufferId(0), 0)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid buffer Id", err.Error())
+	addId()
+}
+
+// Test_Copy_otherDevice tests that Copy, Fill, and FillValue run on the device that their buffers
+// are on, rather than on the default device.
+func Test_Copy_otherDevice(t *testing.T) {
+	device := otherDevice(t)
+
+	srcId, src, err := NewBufferOnDevice[uint32](device, BufferOptions{}, 10)
+	require.Nil(t, err, "Unable to create metal buffer on %s: %s", device, err)
+	require.True(t, validId(srcId))
+	dstId, dst, err := NewBufferOnDevice[uint32](device, BufferOptions{}, 10)
+	require.Nil(t, err, "Unable to create metal buffer on %s: %s", device, err)
+	require.True(t, validId(dstId))
+
+	require.Nil(t, Fill(srcId, 0x01))
+	addId()
+	require.Equal(t, uint32(0x01010101), src[0])
+
+	require.Nil(t, FillValue(srcId, uint32(7)))
+	addId()
+	require.Nil(t, Copy(dstId, 0, srcId, 0, 40))
+	addId()
+	require.Equal(t, src, dst)
+	require.Equal(t, uint32(7), dst[9])
+}
@@ -0,0 +1,128 @@
+package metal
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// A BFloat16 is a brain floating-point number (bfloat16). It is the Go equivalent of the metal
+// type bfloat, which is available starting with version 3.1 of the Metal Shading Language. A
+// BFloat16 is the upper half of a float32: it has the same range as a float32 but only 7 bits of
+// mantissa. The value is stored as its raw bit pattern.
+//
+// Because a BFloat16 has the same size as a uint16, it can be used as the type of a metal buffer.
+// Use NewBFloat16 and Float32 to convert values to and from float32.
+type BFloat16 uint16
+
+const (
+	bfloat16SignMask = 0x8000
+	bfloat16ExpMask  = 0x7f80
+	bfloat16MantMask = 0x007f
+	bfloat16QuietBit = 0x0040
+)
+
+// bfloatVersion is the first version of the Metal Shading Language that supports bfloat.
+var bfloatVersion = LanguageVersion{Major: 3, Minor: 1}
+
+// NewBFloat16 converts a float32 into the nearest BFloat16, rounding ties to even. Values too large
+// to be represented become infinity. NaNs stay NaNs and keep as much of their payload as fits, with
+// the quiet bit set.
+func NewBFloat16(f float32) BFloat16 {
+	bits := math.Float32bits(f)
+
+	if bits&0x7fffffff > 0x7f800000 {
+		// NaN. Simply truncating could drop the entire payload and turn the NaN into an infinity,
+		// so the quiet bit is always set.
+		return BFloat16(bits>>16) | bfloat16QuietBit
+	}
+
+	// Round the lower 16 bits away. Adding just under half of the dropped range, plus one if the
+	// kept part is odd, rounds to the nearest value and ties to even. A carry out of the mantissa
+	// correctly increments the exponent, up to and including infinity.
+	bits += 0x7fff + (bits>>16)&1
+
+	return BFloat16(bits >> 16)
+}
+
+// Float32 converts the BFloat16 into a float32. Every BFloat16 value is exactly representable as a
+// float32, so this never loses precision.
+func (b BFloat16) Float32() float32 {
+	return math.Float32frombits(uint32(b) << 16)
+}
+
+// IsNaN reports whether the BFloat16 is "not-a-number".
+func (b BFloat16) IsNaN() bool {
+	return b&bfloat16ExpMask == bfloat16ExpMask && b&bfloat16MantMask != 0
+}
+
+// IsInf reports whether the BFloat16 is an infinity, according to sign. If sign > 0, IsInf
+// reports whether the BFloat16 is positive infinity. If sign < 0, IsInf reports whether the
+// BFloat16 is negative infinity. If sign == 0, IsInf reports whether the BFloat16 is either
+// infinity.
+func (b BFloat16) IsInf(sign int) bool {
+	switch {
+	case b&^bfloat16SignMask != bfloat16ExpMask:
+		return false
+	case sign > 0:
+		return b&bfloat16SignMask == 0
+	case sign < 0:
+		return b&bfloat16SignMask != 0
+	default:
+		return true
+	}
+}
+
+// String returns the BFloat16 formatted as a float32.
+func (b BFloat16) String() string {
+	return strconv.FormatFloat(float64(b.Float32()), 'g', -1, 32)
+}
+
+// CopyToBFloat16 converts the float32 values in src into BFloat16 values in dst, such as a metal
+// buffer of type BFloat16. It works like the built-in copy function: it converts
+// min(len(dst), len(src)) values and returns that number.
+func CopyToBFloat16(dst []BFloat16, src []float32) int {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+
+	// Reslicing both sides to the same length lets the compiler drop the bounds checks in the loop
+	// below.
+	dst, src = dst[:n], src[:n]
+	for i := range src {
+		dst[i] = NewBFloat16(src[i])
+	}
+
+	return n
+}
+
+// CopyFromBFloat16 converts the BFloat16 values in src, such as a metal buffer of type BFloat16,
+// into float32 values in dst. It works like the built-in copy function: it converts
+// min(len(dst), len(src)) values and returns that number.
+func CopyFromBFloat16(dst []float32, src []BFloat16) int {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+
+	dst, src = dst[:n], src[:n]
+	for i := range src {
+		dst[i] = math.Float32frombits(uint32(src[i]) << 16)
+	}
+
+	return n
+}
+
+var (
+	// mslCommentRegex matches line and block comments in metal code.
+	mslCommentRegex = regexp.MustCompile(`(?s)//[^\n]*|/\*.*?\*/`)
+
+	// mslBFloatRegex matches the bfloat scalar, vector, and matrix types in metal code.
+	mslBFloatRegex = regexp.MustCompile(`\bbfloat[0-9x]*\b`)
+)
+
+// usesBFloat checks whether or not the metal code uses any of the bfloat types outside of comments.
+func usesBFloat(metalSource string) bool {
+	return mslBFloatRegex.MatchString(mslCommentRegex.ReplaceAllString(metalSource, ""))
+}
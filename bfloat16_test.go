@@ -0,0 +1,150 @@
+package metal
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_BFloat16_Float32 tests that every one of the 65,536 BFloat16 bit patterns is converted into
+// the float32 value with the same upper 16 bits, and that converting it back results in the same
+// bit pattern.
+func Test_BFloat16_Float32(t *testing.T) {
+	for i := 0; i <= math.MaxUint16; i++ {
+		b := BFloat16(i)
+		f := b.Float32()
+		require.Equal(t, uint32(i)<<16, math.Float32bits(f), "0x%04x", i)
+
+		fNaN := math.IsNaN(float64(f))
+		require.Equal(t, fNaN, b.IsNaN(), "0x%04x", i)
+		require.Equal(t, math.IsInf(float64(f), 0), b.IsInf(0), "0x%04x", i)
+		require.Equal(t, math.IsInf(float64(f), 1), b.IsInf(1), "0x%04x", i)
+		require.Equal(t, math.IsInf(float64(f), -1), b.IsInf(-1), "0x%04x", i)
+
+		if fNaN {
+			// Signaling NaNs are quieted, but otherwise keep their sign and payload.
+			require.Equal(t, b|0x0040, NewBFloat16(f), "0x%04x", i)
+		} else {
+			require.Equal(t, b, NewBFloat16(f), "0x%04x", i)
+		}
+	}
+}
+
+// Test_NewBFloat16_rounding tests that float32 values between two adjacent BFloat16 values are
+// rounded to the nearest one, with ties going to the one with an even mantissa.
+func Test_NewBFloat16_rounding(t *testing.T) {
+	// Run through every pair of adjacent finite values, including the pair of the largest finite
+	// value and infinity. Every float32 between the two can be built by filling in the lower 16
+	// bits of the smaller one.
+	for i := 0; i < 0x7f80; i++ {
+		for _, sign := range []uint32{0, 0x8000} {
+			lo := BFloat16(uint32(i) | sign)
+			hi := BFloat16(uint32(i+1) | sign)
+			loBits := uint32(lo) << 16
+
+			even := lo
+			if lo&1 == 1 {
+				even = hi
+			}
+
+			mid := math.Float32frombits(loBits | 0x8000)
+			below := math.Float32frombits(loBits | 0x7fff)
+			above := math.Float32frombits(loBits | 0x8001)
+
+			require.Equal(t, even, NewBFloat16(mid), "0x%04x: %v", lo, mid)
+			require.Equal(t, lo, NewBFloat16(below), "0x%04x: %v", lo, below)
+			require.Equal(t, hi, NewBFloat16(above), "0x%04x: %v", lo, above)
+		}
+	}
+}
+
+// Test_NewBFloat16_special tests that NewBFloat16 handles special values correctly.
+func Test_NewBFloat16_special(t *testing.T) {
+	type scenario struct {
+		input float32
+		want  BFloat16
+	}
+
+	for _, s := range []scenario{
+		{0, 0x0000},
+		{float32(math.Copysign(0, -1)), 0x8000},
+		{1, 0x3f80},
+		{-2, 0xc000},
+		{3.140625, 0x4049},
+		{math.MaxFloat32, 0x7f80},
+		{-math.MaxFloat32, 0xff80},
+		{float32(math.Inf(1)), 0x7f80},
+		{float32(math.Inf(-1)), 0xff80},
+		{math.SmallestNonzeroFloat32, 0x0000},
+	} {
+		require.Equal(t, s.want, NewBFloat16(s.input), "%v", s.input)
+	}
+
+	// A NaN whose payload lies entirely in the bits that are dropped must not turn into infinity.
+	for _, bits := range []uint32{0x7f800001, 0xff800001, 0x7fc00000, 0x7fffffff} {
+		b := NewBFloat16(math.Float32frombits(bits))
+		require.True(t, b.IsNaN(), "0x%08x", bits)
+		require.Equal(t, bits&0x80000000 != 0, b&0x8000 != 0, "0x%08x", bits)
+	}
+}
+
+// Test_BFloat16_String tests that a BFloat16 is formatted as its numeric value.
+func Test_BFloat16_String(t *testing.T) {
+	require.Equal(t, "1", BFloat16(0x3f80).String())
+	require.Equal(t, "-2", BFloat16(0xc000).String())
+	require.Equal(t, "3.140625", BFloat16(0x4049).String())
+	require.Equal(t, "-Inf", BFloat16(0xff80).String())
+	require.Equal(t, "NaN", BFloat16(0x7fc0).String())
+}
+
+// Test_CopyBFloat16 tests that CopyToBFloat16 and CopyFromBFloat16 convert slices of values and
+// behave like the built-in copy function.
+func Test_CopyBFloat16(t *testing.T) {
+	src := []float32{0, 1, -2, 3.140625, 1e10}
+	bfloats := make([]BFloat16, len(src))
+	require.Equal(t, len(src), CopyToBFloat16(bfloats, src))
+	require.Equal(t, []BFloat16{0x0000, 0x3f80, 0xc000, 0x4049, 0x5015}, bfloats)
+
+	floats := make([]float32, len(bfloats))
+	require.Equal(t, len(bfloats), CopyFromBFloat16(floats, bfloats))
+	require.Equal(t, []float32{0, 1, -2, 3.140625, 9999220736}, floats)
+
+	// Shorter destination
+	short := make([]BFloat16, 2)
+	require.Equal(t, 2, CopyToBFloat16(short, src))
+	require.Equal(t, []BFloat16{0x0000, 0x3f80}, short)
+	shortFloats := make([]float32, 3)
+	require.Equal(t, 3, CopyFromBFloat16(shortFloats, bfloats))
+	require.Equal(t, []float32{0, 1, -2}, shortFloats)
+
+	// Shorter source
+	long := make([]BFloat16, 10)
+	require.Equal(t, len(src), CopyToBFloat16(long, src))
+	require.Equal(t, BFloat16(0), long[len(src)])
+	require.Equal(t, 0, CopyFromBFloat16(nil, bfloats))
+}
+
+// Test_usesBFloat tests that usesBFloat detects the bfloat types in metal code.
+func Test_usesBFloat(t *testing.T) {
+	type scenario struct {
+		source string
+		want   bool
+	}
+
+	for _, s := range []scenario{
+		{"", false},
+		{"kernel void f(device float *a) {}", false},
+		{"kernel void f(device bfloat *a) {}", true},
+		{"kernel void f(device bfloat4 *a) {}", true},
+		{"kernel void f(device bfloat2x2 *a) {}", true},
+		{"kernel void f(device half *a) { bfloat b = a[0]; }", true},
+		{"kernel void f(device float *abfloat) {}", false},
+		{"kernel void f(device float *bfloats_) {}", false},
+		{"// bfloat would be faster\nkernel void f(device float *a) {}", false},
+		{"/* bfloat\n would be faster */ kernel void f(device float *a) {}", false},
+		{"/* float */ kernel void f(device bfloat *a) {}", true},
+	} {
+		require.Equal(t, s.want, usesBFloat(s.source), s.source)
+	}
+}
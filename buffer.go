@@ -14,7 +14,9 @@ import "C"
 
 import (
 	"errors"
-	"math"
+	"fmt"
+	"os"
+	"reflect"
 	"unsafe"
 )
 
@@ -27,9 +29,13 @@ func (id BufferId) Valid() bool {
 	return id > 0
 }
 
-// A BufferType is a type that can be used to create a new metal buffer.
+// A BufferType is a type that can be used to create a new metal buffer. Float16 and BFloat16
+// satisfy this constraint for buffers of the metal types half and bfloat, and the vector types
+// (Float2, Float3, Float4, etc.) satisfy it for buffers of the metal vector types.
 type BufferType interface {
-	~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~float32 | ~float64
+	~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~float32 | ~float64 |
+		Float2 | Float3 | Float4 | PackedFloat3 | Half2 | Half3 | Half4 |
+		Int2 | Int3 | Int4 | UInt2 | UInt3 | UInt4
 }
 
 // NewBuffer1D allocates a 1-dimensional block of memory that is accessible to both the CPU and GPU.
@@ -56,12 +62,22 @@ func NewBuffer1D[T BufferType](width int) (BufferId, []T, error) {
 // Only the contents of the slices should be modified. Their lengths and capacities and the pointers
 // to their underlying arrays should not be altered.
 func NewBuffer2D[T BufferType](width, height int) (BufferId, [][]T, error) {
-	bufferId, b1, err := newBuffer[T](width, height)
+	return NewBuffer2DWithLayout[T](ColumnMajor, width, height)
+}
+
+// NewBuffer2DWithLayout works the same way as NewBuffer2D, except that the memory is laid out in
+// the provided layout, and the slices are nested in the same order. With RowMajor, for example, the
+// returned slice has a length equal to height, and each of its elements has a length equal to
+// width, so that the element at (x, y) is at [y][x]. The layout is recorded on the buffer (see
+// BufferLayout).
+func NewBuffer2DWithLayout[T BufferType](layout Layout, width, height int) (BufferId, [][]T, error) {
+	bufferId, b1, err := newBufferWithLayout[T](BufferOptions{}, layout, width, height)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	b2 := fold(b1, width)
+	lens := layout.nestedLens(width, height)
+	b2 := fold(b1, lens[0])
 
 	return bufferId, b2, nil
 }
@@ -78,53 +94,581 @@ func NewBuffer2D[T BufferType](width, height int) (BufferId, [][]T, error) {
 // Only the contents of the slices should be modified. Their lengths and capacities and the pointers
 // to their underlying arrays should not be altered.
 func NewBuffer3D[T BufferType](width, height, depth int) (BufferId, [][][]T, error) {
-	bufferId, b1, err := newBuffer[T](width, height, depth)
+	return NewBuffer3DWithLayout[T](ColumnMajor, width, height, depth)
+}
+
+// NewBuffer3DWithLayout works the same way as NewBuffer3D, except that the memory is laid out in
+// the provided layout, and the slices are nested in the same order. With RowMajor, for example,
+// the element at (x, y, z) is at [z][y][x]. The layout is recorded on the buffer (see
+// BufferLayout).
+func NewBuffer3DWithLayout[T BufferType](layout Layout, width, height, depth int) (BufferId, [][][]T,
+	error) {
+	bufferId, b1, err := newBufferWithLayout[T](BufferOptions{}, layout, width, height, depth)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	b2 := fold(b1, width*height)
-	b3 := fold(b2, width)
+	lens := layout.nestedLens(width, height, depth)
+	b2 := fold(b1, lens[0]*lens[1])
+	b3 := fold(b2, lens[0])
 
 	return bufferId, b3, nil
 }
 
+// NewBufferFrom1D allocates a 1-dimensional block of memory that is accessible to both the CPU and
+// GPU and initializes it with a copy of src. Otherwise, it works the same way as NewBuffer1D, with
+// a width equal to the length of src.
+func NewBufferFrom1D[T BufferType](src []T) (BufferId, []T, error) {
+	return newBufferFrom(Device{}, src, ColumnMajor, len(src))
+}
+
+// NewBufferFrom2D allocates a 2-dimensional block of memory that is accessible to both the CPU and
+// GPU and initializes it with a copy of src. Otherwise, it works the same way as NewBuffer2D, with a
+// width equal to the length of src and a height equal to the length of its elements. Every element
+// of src must have the same length.
+func NewBufferFrom2D[T BufferType](src [][]T) (BufferId, [][]T, error) {
+	return NewBufferFrom2DWithLayout(ColumnMajor, src)
+}
+
+// NewBufferFrom2DWithLayout works the same way as NewBufferFrom2D, except that the memory is laid
+// out in the provided layout, like NewBuffer2DWithLayout. src is nested in the same order as the
+// returned slices: with RowMajor, for example, src holds rows, so the height is the length of src
+// and the width is the length of its elements.
+func NewBufferFrom2DWithLayout[T BufferType](layout Layout, src [][]T) (BufferId, [][]T, error) {
+	return newBufferFrom2D(Device{}, layout, src)
+}
+
+// newBufferFrom2D is the common internal function for creating a 2-dimensional buffer on the
+// provided device that is initialized with a copy of src.
+func newBufferFrom2D[T BufferType](device Device, layout Layout, src [][]T) (BufferId, [][]T, error) {
+	flat, lens, err := flatten2D(src)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := layout.order(len(lens)); err != nil {
+		return 0, nil, err
+	}
+
+	bufferId, b1, err := newBufferFrom(device, flat, layout, layout.dimLens(lens...)...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	b2 := fold(b1, lens[0])
+
+	return bufferId, b2, nil
+}
+
+// NewBufferFrom3D allocates a 3-dimensional block of memory that is accessible to both the CPU and
+// GPU and initializes it with a copy of src. Otherwise, it works the same way as NewBuffer3D, with a
+// width, height, and depth equal to the lengths of src, its elements, and their elements. The
+// slices at each level must all have the same length.
+func NewBufferFrom3D[T BufferType](src [][][]T) (BufferId, [][][]T, error) {
+	return NewBufferFrom3DWithLayout(ColumnMajor, src)
+}
+
+// NewBufferFrom3DWithLayout works the same way as NewBufferFrom3D, except that the memory is laid
+// out in the provided layout, like NewBuffer3DWithLayout. src is nested in the same order as the
+// returned slices: with RowMajor, for example, the element at (x, y, z) is src[z][y][x].
+func NewBufferFrom3DWithLayout[T BufferType](layout Layout, src [][][]T) (BufferId, [][][]T, error) {
+	return newBufferFrom3D(Device{}, layout, src)
+}
+
+// newBufferFrom3D is the common internal function for creating a 3-dimensional buffer on the
+// provided device that is initialized with a copy of src.
+func newBufferFrom3D[T BufferType](device Device, layout Layout, src [][][]T) (BufferId, [][][]T, error) {
+	flat, lens, err := flatten3D(src)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := layout.order(len(lens)); err != nil {
+		return 0, nil, err
+	}
+
+	bufferId, b1, err := newBufferFrom(device, flat, layout, layout.dimLens(lens...)...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	b2 := fold(b1, lens[0]*lens[1])
+	b3 := fold(b2, lens[0])
+
+	return bufferId, b3, nil
+}
+
+// NewBufferNoCopy creates a 1-dimensional buffer that wraps existing memory instead of allocating
+// new memory, which avoids copying large amounts of data. It returns a unique Id for the buffer and
+// a slice that wraps the memory and holds as many elements of type T as fit in it.
+//
+// Metal requires the memory to start on a page boundary, and its length must be a multiple of the
+// page size (see os.Getpagesize). This is the case for memory returned by mmap, for example. The
+// memory must not be managed by Go's garbage collector, and it must stay valid for as long as the
+// buffer is used. See MapFile for wrapping a memory-mapped file.
+//
+// Only the contents of the slice should be modified. Its length and capacity and the pointer to its
+// underlying array should not be altered.
+func NewBufferNoCopy[T BufferType](mem []byte) (BufferId, []T, error) {
+	return newBufferNoCopyOnDevice[T](Device{}, mem)
+}
+
+// newBufferNoCopyOnDevice creates a buffer on the provided device that wraps existing memory. It
+// works the same way as NewBufferNoCopy otherwise.
+func newBufferNoCopyOnDevice[T BufferType](device Device, mem []byte) (BufferId, []T, error) {
+	if len(mem) == 0 {
+		return 0, nil, errors.New("Missing memory")
+	}
+	if err := ensureInit(); err != nil {
+		return 0, nil, err
+	}
+
+	ptr := unsafe.Pointer(&mem[0])
+	if err := checkNoCopy(uintptr(ptr), len(mem), os.Getpagesize(), maxBufferLength()); err != nil {
+		return 0, nil, err
+	}
+
+	bufferId, err := newBufferNoCopy(device, ptr, len(mem))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return bufferId, toSlice[T](ptr, len(mem)/sizeof[T]()), nil
+}
+
+// NewBufferWithOptions allocates a block of memory with the provided dimensions and options. It
+// returns a unique Id for the buffer and a slice that wraps the new memory and holds every element
+// in row-major order: the last dimension changes the fastest.
+//
+// If the CPU can't access the memory, which is the case for StoragePrivate buffers, the slice is
+// nil. Use Upload and Download to copy data to and from these buffers instead.
+//
+// Only the contents of the slice should be modified. Its length and capacity and the pointer to its
+// underlying array should not be altered.
+func NewBufferWithOptions[T BufferType](opts BufferOptions, dimLens ...int) (BufferId, []T, error) {
+	return newBufferWithOptions[T](opts, dimLens...)
+}
+
+// NewBufferOnDevice allocates a block of memory on the provided device. It works the same way as
+// NewBufferWithOptions otherwise. The buffer can only be supplied to functions on the same device.
+func NewBufferOnDevice[T BufferType](device Device, opts BufferOptions, dimLens ...int) (BufferId, []T,
+	error) {
+	return newBufferOnDevice[T](device, opts, ColumnMajor, dimLens...)
+}
+
+// Upload copies the elements in src into the buffer, starting offset elements into the buffer.
+// This works for every buffer but is mainly intended for StoragePrivate buffers, whose memory the
+// CPU can't access directly. For these, the data is copied on the GPU, and Upload waits for the
+// copy to finish.
+func Upload[T BufferType](id BufferId, offset int, src []T) error {
+	return transfer(id, offset, src, true)
+}
+
+// Download copies elements from the buffer into dst, starting offset elements into the buffer. It
+// copies len(dst) elements. This works for every buffer but is mainly intended for StoragePrivate
+// buffers, whose memory the CPU can't access directly. For these, the data is copied on the GPU,
+// and Download waits for the copy to finish.
+func Download[T BufferType](id BufferId, offset int, dst []T) error {
+	return transfer(id, offset, dst, false)
+}
+
+// BufferLayout returns the layout and the dimensions, in the order X, Y, Z, that the buffer was
+// created with. Buffers created without a layout, including 1-dimensional buffers and the buffers
+// of tensors, are column-major. Buffers that wrap existing memory, such as those created with
+// NewBufferNoCopy and MapFile, have no recorded layout.
+func BufferLayout(id BufferId) (Layout, []int, error) {
+	rec, ok := memory.lookup(int(id))
+	if !ok {
+		return Layout{}, nil, errors.New("Buffer has no recorded layout")
+	}
+
+	return rec.layout, append([]int(nil), rec.dimLens...), nil
+}
+
+// CheckLayout checks that the buffer's memory is laid out the way that layout describes, for
+// example to catch a column-major buffer being supplied to a metal function that expects rows. It
+// returns an error that describes the mismatch if it isn't. Layouts that lay out the buffer the
+// same way match, such as ColumnMajor and RowMajor for a 1-dimensional buffer.
+func CheckLayout(id BufferId, layout Layout) error {
+	have, dimLens, err := BufferLayout(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := layout.order(len(dimLens)); err != nil {
+		return err
+	}
+	if !have.equal(layout, len(dimLens)) {
+		return fmt.Errorf("Buffer is %s instead of %s", have, layout)
+	}
+
+	return nil
+}
+
+// transfer is the common internal function for Upload and Download.
+func transfer[T BufferType](id BufferId, offset int, data []T, upload bool) error {
+	action := "download from"
+	if upload {
+		action = "upload to"
+	}
+
+	if !id.Valid() {
+		return errors.New("Invalid buffer Id")
+	}
+
+	done, err := use(int(id))
+	if err != nil {
+		return fmt.Errorf("Unable to %s buffer: %w", action, err)
+	}
+	defer done()
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	bufferLen := uint64(C.buffer_length(C.int(id), &metalErr))
+	if bufferLen == 0 {
+		return metalErrToError(metalErr, "Unable to retrieve buffer")
+	}
+
+	offsetBytes, numBytes, err := viewRange(sizeof[T](), offset, len(data), bufferLen)
+	if err != nil {
+		return fmt.Errorf("Unable to %s buffer: %w", action, err)
+	}
+
+	var ok C._Bool
+	if upload {
+		ok = C.buffer_upload(C.int(id), C.ulonglong(offsetBytes), unsafe.Pointer(&data[0]),
+			C.ulonglong(numBytes), &metalErr)
+	} else {
+		ok = C.buffer_download(C.int(id), C.ulonglong(offsetBytes), unsafe.Pointer(&data[0]),
+			C.ulonglong(numBytes), &metalErr)
+	}
+	if !ok {
+		return metalErrToError(metalErr, "Unable to "+action+" buffer")
+	}
+
+	return nil
+}
+
+// NewStructBuffer1D allocates a 1-dimensional block of memory that is accessible to both the CPU
+// and GPU, for an array of structs. It works the same way as NewBuffer1D.
+//
+// T must be a struct type whose fields are all of types that have a metal equivalent: the
+// BufferType types (except for float64), bool, and arrays and structs of these. The layout of T
+// must be exactly the same as the layout of the equivalent struct in metal. Most importantly,
+// fields of the 16-byte vector types like Float3 and Float4 are aligned to 16 bytes in metal but
+// only to 8 bytes in Go, which might need to be made up for with explicit padding fields (named
+// "_"). If the layouts differ, the returned error explains how.
+func NewStructBuffer1D[T any](width int) (BufferId, []T, error) {
+	if err := checkStructLayout(reflect.TypeOf((*T)(nil)).Elem()); err != nil {
+		return 0, nil, err
+	}
+
+	return newBuffer[T](width)
+}
+
+// A BufferView references a range of elements in a metal buffer. It can be supplied as an
+// argument to a metal function in place of the entire buffer, which lets one buffer hold several
+// arguments or lets a large buffer be processed in windows. Create one with View.
+type BufferView struct {
+	id     BufferId
+	offset uint64
+	length uint64
+}
+
+// View creates a view of length elements of type T that starts offset elements into the buffer.
+// It returns the view and a slice that wraps exactly that range of the buffer's memory. The view
+// must lie completely inside the buffer.
+//
+// Because the offset is counted in elements, the view always starts at the alignment that metal
+// functions need for arguments in the device address space. Arguments in the constant address space
+// need offsets that are a multiple of 256 bytes on macOS, which View doesn't check. (See Apple's
+// documentation for setBuffer:offset:atIndex: for details.)
+//
+// Only the contents of the slice should be modified. Its length and capacity and the pointer to its
+// underlying array should not be altered.
+func View[T BufferType](id BufferId, offset, length int) (BufferView, []T, error) {
+	if !id.Valid() {
+		return BufferView{}, nil, errors.New("Invalid buffer Id")
+	}
+
+	done, err := use(int(id))
+	if err != nil {
+		return BufferView{}, nil, err
+	}
+	defer done()
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	bufferLen := uint64(C.buffer_length(C.int(id), &metalErr))
+	if bufferLen == 0 {
+		return BufferView{}, nil, metalErrToError(metalErr, "Unable to retrieve buffer")
+	}
+
+	offsetBytes, numBytes, err := viewRange(sizeof[T](), offset, length, bufferLen)
+	if err != nil {
+		return BufferView{}, nil, err
+	}
+
+	contents := C.buffer_retrieve(C.int(id), &metalErr)
+	if contents == nil {
+		return BufferView{}, nil, metalErrToError(metalErr, "Unable to retrieve buffer")
+	}
+
+	view := BufferView{
+		id:     id,
+		offset: offsetBytes,
+		length: numBytes,
+	}
+
+	return view, toSlice[T](unsafe.Add(contents, offsetBytes), length), nil
+}
+
+// Id returns the Id of the buffer that the view references.
+func (v BufferView) Id() BufferId {
+	return v.id
+}
+
+// Offset returns where the view starts in the buffer, in bytes.
+func (v BufferView) Offset() int {
+	return int(v.offset)
+}
+
+// Len returns the length of the view, in bytes.
+func (v BufferView) Len() int {
+	return int(v.length)
+}
+
+// binding supplies the buffer to the metal function starting at the view's offset.
+func (v BufferView) binding() binding {
+	return binding{
+		bufferId: v.id,
+		offset:   v.offset,
+		length:   v.length,
+	}
+}
+
+// Reinterpret creates a view of the same memory as resource, such as a BufferId, BufferView, or
+// Tensor, but with elements of type U instead. It returns the view and a slice that wraps the
+// memory. The number of elements is recalculated from the number of bytes, which must be a
+// multiple of the size of U. The start of the memory must also be aligned to the metal type's
+// alignment. This makes it possible to work with the same data as, for example, both float32 and
+// uint32 values.
+//
+// For a BufferId or Tensor, the view covers the entire buffer.
+//
+// Only the contents of the slice should be modified. Its length and capacity and the pointer to its
+// underlying array should not be altered.
+func Reinterpret[U BufferType](resource Resource) (BufferView, []U, error) {
+	done, err := useResources(0, []Resource{resource})
+	if err != nil {
+		return BufferView{}, nil, err
+	}
+	defer done()
+
+	b, err := resourceRange(resource)
+	if err != nil {
+		return BufferView{}, nil, err
+	}
+	numBytes := b.length
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	contents := C.buffer_retrieve(C.int(b.bufferId), &metalErr)
+	if contents == nil {
+		return BufferView{}, nil, metalErrToError(metalErr, "Unable to retrieve buffer")
+	}
+	start := unsafe.Add(contents, b.offset)
+
+	elemAlign := mslAlign(reflect.TypeOf((*U)(nil)).Elem())
+	numElems, err := reinterpretLen(uintptr(start), numBytes, sizeof[U](), elemAlign)
+	if err != nil {
+		return BufferView{}, nil, fmt.Errorf("Unable to reinterpret buffer: %w", err)
+	}
+
+	view := BufferView{
+		id:     b.bufferId,
+		offset: b.offset,
+		length: numBytes,
+	}
+
+	return view, toSlice[U](start, numElems), nil
+}
+
+// resourceRange returns the binding of resource with the length filled in: for resources that
+// cover the rest of the buffer, this is the number of bytes after the binding's offset.
+func resourceRange(resource Resource) (binding, error) {
+	if resource == nil {
+		return binding{}, errors.New("Missing resource")
+	}
+
+	b := resource.binding()
+	if b.kind != bufferArgument {
+		return binding{}, errors.New("Resource is not a buffer")
+	}
+	if !b.bufferId.Valid() {
+		return binding{}, errors.New("Invalid buffer Id")
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	bufferLen := uint64(C.buffer_length(C.int(b.bufferId), &metalErr))
+	if bufferLen == 0 {
+		return binding{}, metalErrToError(metalErr, "Unable to retrieve buffer")
+	}
+
+	if b.length == 0 && b.offset < bufferLen {
+		b.length = bufferLen - b.offset
+	}
+	if b.offset+b.length > bufferLen {
+		return binding{}, errors.New("View extends past the end of the buffer")
+	}
+
+	return b, nil
+}
+
 // newBuffer is the common internal function for creating a new buffer with N dimensions.
-func newBuffer[T BufferType](dimLens ...int) (BufferId, []T, error) {
-	if len(dimLens) == 0 {
-		return 0, nil, errors.New("Missing dimension(s)")
+func newBuffer[T any](dimLens ...int) (BufferId, []T, error) {
+	return newBufferWithLayout[T](BufferOptions{}, ColumnMajor, dimLens...)
+}
+
+// newBufferWithOptions creates a new buffer with N dimensions and the provided options. If the CPU
+// can't access the buffer's memory, the returned slice is nil.
+func newBufferWithOptions[T any](opts BufferOptions, dimLens ...int) (BufferId, []T, error) {
+	return newBufferWithLayout[T](opts, ColumnMajor, dimLens...)
+}
+
+// newBufferWithLayout creates a new buffer with N dimensions, the provided options, and the
+// provided layout, which is recorded on the buffer. If the CPU can't access the buffer's memory,
+// the returned slice is nil.
+func newBufferWithLayout[T any](opts BufferOptions, layout Layout, dimLens ...int) (BufferId, []T,
+	error) {
+	return newBufferOnDevice[T](Device{}, opts, layout, dimLens...)
+}
+
+// newBufferOnDevice creates a new buffer on the provided device. It works the same way as
+// newBufferWithLayout otherwise.
+func newBufferOnDevice[T any](device Device, opts BufferOptions, layout Layout, dimLens ...int) (
+	BufferId, []T, error) {
+	if err := ensureInit(); err != nil {
+		return 0, nil, err
+	}
+
+	options, err := opts.resourceOptions()
+	if err != nil {
+		return 0, nil, err
 	}
 
 	// Calculate how many elements we'll need based on the dimensions provided, and also check that
-	// each dimension is valid and won't overflow the maximum bytes.
-	numElems := 1
-	numBytes := sizeof[T]()
-	for _, dimLen := range dimLens {
-		if dimLen < 1 {
-			return 0, nil, errors.New("Invalid dimension")
-		}
+	// each dimension is valid and won't exceed the maximum number of bytes the device supports.
+	maxLen := uint64(C.metal_max_buffer_length(C.int(device.index)))
+	numElems, numBytes, err := bufferSize(sizeof[T](), dimLens, maxLen)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := layout.order(len(dimLens)); err != nil {
+		return 0, nil, err
+	}
 
-		numElems *= dimLen
-		numBytes *= dimLen
-		if numBytes > math.MaxInt32 || numBytes < 0 {
-			return 0, nil, errors.New("Exceeded maximum number of bytes")
-		}
+	// Make sure the buffer fits in the memory budget before asking metal for it.
+	if err := memory.reserve(numBytes); err != nil {
+		return 0, nil, err
 	}
 
-	err := C.CString("")
-	defer C.free(unsafe.Pointer(err))
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
 
 	// Allocate memory for the new buffer.
-	bufferId := C.buffer_new(C.int(numBytes), &err)
+	bufferId := C.buffer_new(C.int(device.index), C.ulonglong(numBytes), C.ulonglong(options), &metalErr)
 	if int(bufferId) == 0 {
-		return 0, nil, metalErrToError(err, "Unable to create buffer")
+		memory.cancel(numBytes)
+		return 0, nil, metalErrToError(metalErr, "Unable to create buffer")
+	}
+	memory.add(int(bufferId), newBufferRecord[T](opts.Storage, numBytes, layout, dimLens))
+
+	if !opts.cpuAccessible() {
+		return BufferId(bufferId), nil, nil
 	}
 
 	// Retrieve a pointer to the beginning of the new memory using the buffer's Id.
-	newBuffer := C.buffer_retrieve(bufferId, &err)
+	newBuffer := C.buffer_retrieve(bufferId, &metalErr)
 	if newBuffer == nil {
-		return 0, nil, metalErrToError(err, "Unable to retrieve buffer")
+		releaseBuffer(BufferId(bufferId))
+		return 0, nil, metalErrToError(metalErr, "Unable to retrieve buffer")
 	}
 
 	return BufferId(bufferId), toSlice[T](newBuffer, numElems), nil
 }
+
+// newBufferFrom is the common internal function for creating a new buffer with N dimensions that
+// is initialized with a copy of data. data must hold exactly as many elements as the dimensions,
+// already in the provided layout. The buffer is created on the provided device.
+func newBufferFrom[T any](device Device, data []T, layout Layout, dimLens ...int) (BufferId, []T, error) {
+	if err := ensureInit(); err != nil {
+		return 0, nil, err
+	}
+
+	maxLen := uint64(C.metal_max_buffer_length(C.int(device.index)))
+	numElems, numBytes, err := bufferSize(sizeof[T](), dimLens, maxLen)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := memory.reserve(numBytes); err != nil {
+		return 0, nil, err
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	// Allocate memory for the new buffer and copy the data into it in one step.
+	bufferId := C.buffer_new_with_bytes(C.int(device.index), unsafe.Pointer(&data[0]), C.ulonglong(numBytes), &metalErr)
+	if int(bufferId) == 0 {
+		memory.cancel(numBytes)
+		return 0, nil, metalErrToError(metalErr, "Unable to create buffer")
+	}
+	memory.add(int(bufferId), newBufferRecord[T](StorageShared, numBytes, layout, dimLens))
+
+	// Retrieve a pointer to the beginning of the new memory using the buffer's Id.
+	newBuffer := C.buffer_retrieve(bufferId, &metalErr)
+	if newBuffer == nil {
+		releaseBuffer(BufferId(bufferId))
+		return 0, nil, metalErrToError(metalErr, "Unable to retrieve buffer")
+	}
+
+	return BufferId(bufferId), toSlice[T](newBuffer, numElems), nil
+}
+
+// newBufferNoCopy wraps numBytes bytes of memory at ptr, which must already have been checked with
+// checkNoCopy, in a new buffer on the provided device.
+func newBufferNoCopy(device Device, ptr unsafe.Pointer, numBytes int) (BufferId, error) {
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	bufferId := C.buffer_new_no_copy(C.int(device.index), ptr, C.ulonglong(numBytes), &metalErr)
+	if int(bufferId) == 0 {
+		return 0, metalErrToError(metalErr, "Unable to create buffer")
+	}
+
+	return BufferId(bufferId), nil
+}
+
+// bufferDevice returns the device that the buffer was created on.
+func bufferDevice(id BufferId) (Device, error) {
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	index := int(C.buffer_device(C.int(id), &metalErr))
+	if index == 0 {
+		return Device{}, metalErrToError(metalErr, "Unable to retrieve buffer")
+	}
+
+	return Device{index: index}, nil
+}
+
+// maxBufferLength returns the largest number of bytes that the device can allocate for a single
+// buffer.
+func maxBufferLength() uint64 {
+	return uint64(C.metal_max_buffer_length(0))
+}
@@ -2,25 +2,79 @@
 //  +build darwin
 
 #include "cache.h"
+#include "device.h"
 #include "error.h"
 #import <Metal/Metal.h>
 
 extern id<MTLDevice> device;
 
-// Allocate a block of memory accessible to both the CPU and GPU that is large
-// enough to hold the number of bytes specified. The buffer is cached and can be
-// retrieved with the buffer Id that's returned. A buffer can be supplied as an
-// argument to the metal function when the function is run. If any error is
-// encountered creating the buffer, this returns 0 and sets an error message in
-// error.
-int buffer_new(int size, const char **error) {
+// Allocate a block of memory that is large enough to hold the number of bytes
+// specified on the GPU with the provided index (see device_get). options is an
+// MTLResourceOptions value, which determines where the memory is located and
+// whether the CPU can access it. The buffer is cached and can be retrieved with
+// the buffer Id that's returned. A buffer can be supplied as an argument to the
+// metal function when the function is run. If any error is encountered creating
+// the buffer, this returns 0 and sets an error message in error.
+int buffer_new(int deviceIndex, unsigned long long size,
+               unsigned long long options, const char **error) {
+  id<MTLDevice> device = device_get(deviceIndex);
+  if (device == nil) {
+    logError(error, @"Failed to find device");
+    return 0;
+  }
+
+  if (size > [device maxBufferLength]) {
+    logError(error, [NSString stringWithFormat:@"Buffer size of %llu bytes "
+                                               @"exceeds maximum of %lu bytes",
+                                               size, [device maxBufferLength]]);
+    return 0;
+  }
+
+  id<MTLBuffer> buffer =
+      [device newBufferWithLength:(NSUInteger)size
+                          options:(MTLResourceOptions)options];
+  if (buffer == nil) {
+    logError(error, [NSString
+                        stringWithFormat:@"Failed to create buffer with %llu bytes",
+                                         size]);
+    return 0;
+  }
+
+  // Add the buffer to the buffer cache and return its unique Id.
+  int bufferId = cache_cache(buffer);
+  if (bufferId == 0) {
+    logError(error, @"Failed to cache buffer");
+    return 0;
+  }
+
+  return bufferId;
+}
+
+// Allocate a block of memory accessible to both the CPU and GPU and copy size
+// bytes from bytes into it. Otherwise, this works the same way as buffer_new.
+int buffer_new_with_bytes(int deviceIndex, const void *bytes,
+                          unsigned long long size, const char **error) {
+  id<MTLDevice> device = device_get(deviceIndex);
+  if (device == nil) {
+    logError(error, @"Failed to find device");
+    return 0;
+  }
+
+  if (size > [device maxBufferLength]) {
+    logError(error, [NSString stringWithFormat:@"Buffer size of %llu bytes "
+                                               @"exceeds maximum of %lu bytes",
+                                               size, [device maxBufferLength]]);
+    return 0;
+  }
+
   id<MTLBuffer> buffer =
-      [device newBufferWithLength:(size) options:MTLResourceStorageModeShared];
+      [device newBufferWithBytes:bytes
+                          length:(NSUInteger)size
+                         options:MTLResourceStorageModeShared];
   if (buffer == nil) {
-    logError(
-        error,
-        [NSString
-            stringWithFormat:@"Failed to create buffer with %d bytes", size]);
+    logError(error, [NSString
+                        stringWithFormat:@"Failed to create buffer with %llu bytes",
+                                         size]);
     return 0;
   }
 
@@ -34,8 +88,69 @@ int buffer_new(int size, const char **error) {
   return bufferId;
 }
 
+// Wrap size bytes of existing memory at bytes in a buffer without copying
+// them. The memory must be page-aligned, and size must be a multiple of the page
+// size. The memory is not freed when the buffer is released; it must stay valid
+// for as long as the buffer is used. Otherwise, this works the same way as
+// buffer_new.
+int buffer_new_no_copy(int deviceIndex, void *bytes, unsigned long long size,
+                       const char **error) {
+  id<MTLDevice> device = device_get(deviceIndex);
+  if (device == nil) {
+    logError(error, @"Failed to find device");
+    return 0;
+  }
+
+  if (size > [device maxBufferLength]) {
+    logError(error, [NSString stringWithFormat:@"Buffer size of %llu bytes "
+                                               @"exceeds maximum of %lu bytes",
+                                               size, [device maxBufferLength]]);
+    return 0;
+  }
+
+  id<MTLBuffer> buffer =
+      [device newBufferWithBytesNoCopy:bytes
+                                length:(NSUInteger)size
+                               options:MTLResourceStorageModeShared
+                           deallocator:nil];
+  if (buffer == nil) {
+    logError(error, [NSString
+                        stringWithFormat:@"Failed to create buffer with %llu bytes",
+                                         size]);
+    return 0;
+  }
+
+  // Add the buffer to the buffer cache and return its unique Id.
+  int bufferId = cache_cache(buffer);
+  if (bufferId == 0) {
+    logError(error, @"Failed to cache buffer");
+    return 0;
+  }
+
+  return bufferId;
+}
+
+// Get the 1-based index of the GPU that a buffer is on in the list of GPUs (see
+// device_get). If any error is encountered retrieving the buffer, this returns
+// 0 and sets an error message in error.
+int buffer_device(int bufferId, const char **error) {
+  id<MTLBuffer> buffer = cache_retrieve(bufferId);
+  if (buffer == nil) {
+    logError(error, @"Failed to retrieve buffer");
+    return 0;
+  }
+
+  int deviceIndex = device_index([buffer device]);
+  if (deviceIndex == 0) {
+    logError(error, @"Failed to find device");
+  }
+
+  return deviceIndex;
+}
+
 // Retrieve a buffer from the cache. If any error is encountered retrieving the
-// buffer, this returns nil and sets an error message in error.
+// buffer, or if the CPU can't access the buffer's memory, this returns nil and
+// sets an error message in error.
 void *buffer_retrieve(int bufferId, const char **error) {
   id<MTLBuffer> buffer = cache_retrieve(bufferId);
   if (buffer == nil) {
@@ -43,5 +158,145 @@ void *buffer_retrieve(int bufferId, const char **error) {
     return nil;
   }
 
+  if ([buffer storageMode] == MTLStorageModePrivate) {
+    logError(error, @"Buffer is not accessible to the CPU");
+    return nil;
+  }
+
   return [buffer contents];
 }
+
+// Copy size bytes from one buffer to another on the GPU and wait for the copy to
+// finish. Both buffers must be on the same GPU. If any error is encountered,
+// this returns false and sets an error message in error.
+static _Bool blit_copy(id<MTLBuffer> src, unsigned long long srcOffset,
+                       id<MTLBuffer> dst, unsigned long long dstOffset,
+                       unsigned long long size, const char **error) {
+  id<MTLCommandBuffer> commandBuffer =
+      [device_queue([src device]) commandBuffer];
+  if (commandBuffer == nil) {
+    logError(error, @"Failed to set up command buffer");
+    return false;
+  }
+
+  id<MTLBlitCommandEncoder> encoder = [commandBuffer blitCommandEncoder];
+  if (encoder == nil) {
+    logError(error, @"Failed to set up blit encoder");
+    return false;
+  }
+
+  [encoder copyFromBuffer:src
+             sourceOffset:(NSUInteger)srcOffset
+                 toBuffer:dst
+        destinationOffset:(NSUInteger)dstOffset
+                     size:(NSUInteger)size];
+  [encoder endEncoding];
+
+  [commandBuffer commit];
+  [commandBuffer waitUntilCompleted];
+
+  if ([commandBuffer status] != MTLCommandBufferStatusCompleted) {
+    logError(error, @"Failed to copy buffer (see console log)");
+    NSLog(@"Failed to copy buffer: %@", [commandBuffer error]);
+    return false;
+  }
+
+  return true;
+}
+
+// Copy size bytes from bytes into a buffer, starting offset bytes into the
+// buffer. Buffers that the CPU can't access are copied to through a temporary
+// buffer on the GPU. If any error is encountered, this returns false and sets
+// an error message in error.
+_Bool buffer_upload(int bufferId, unsigned long long offset, const void *bytes,
+                    unsigned long long size, const char **error) {
+  id<MTLBuffer> buffer = cache_retrieve(bufferId);
+  if (buffer == nil) {
+    logError(error, @"Failed to retrieve buffer");
+    return false;
+  }
+
+  if ([buffer storageMode] != MTLStorageModePrivate) {
+    memcpy((char *)[buffer contents] + offset, bytes, size);
+    if ([buffer storageMode] == MTLStorageModeManaged) {
+      [buffer didModifyRange:NSMakeRange(offset, size)];
+    }
+    return true;
+  }
+
+  id<MTLBuffer> staging =
+      [[buffer device] newBufferWithBytes:bytes
+                          length:(NSUInteger)size
+                         options:MTLResourceStorageModeShared];
+  if (staging == nil) {
+    logError(error, [NSString
+                        stringWithFormat:@"Failed to create buffer with %llu bytes",
+                                         size]);
+    return false;
+  }
+
+  _Bool ok = blit_copy(staging, 0, buffer, offset, size, error);
+  [staging release];
+
+  return ok;
+}
+
+// Copy size bytes from a buffer into bytes, starting offset bytes into the
+// buffer. Buffers that the CPU can't access are copied from through a temporary
+// buffer on the GPU. If any error is encountered, this returns false and sets
+// an error message in error.
+_Bool buffer_download(int bufferId, unsigned long long offset, void *bytes,
+                      unsigned long long size, const char **error) {
+  id<MTLBuffer> buffer = cache_retrieve(bufferId);
+  if (buffer == nil) {
+    logError(error, @"Failed to retrieve buffer");
+    return false;
+  }
+
+  if ([buffer storageMode] != MTLStorageModePrivate) {
+    memcpy(bytes, (char *)[buffer contents] + offset, size);
+    return true;
+  }
+
+  id<MTLBuffer> staging =
+      [[buffer device] newBufferWithLength:(NSUInteger)size
+                          options:MTLResourceStorageModeShared];
+  if (staging == nil) {
+    logError(error, [NSString
+                        stringWithFormat:@"Failed to create buffer with %llu bytes",
+                                         size]);
+    return false;
+  }
+
+  _Bool ok = blit_copy(buffer, offset, staging, 0, size, error);
+  if (ok) {
+    memcpy(bytes, [staging contents], size);
+  }
+  [staging release];
+
+  return ok;
+}
+
+// Get the length in bytes of a buffer. If any error is encountered retrieving
+// the buffer, this returns 0 and sets an error message in error.
+unsigned long long buffer_length(int bufferId, const char **error) {
+  id<MTLBuffer> buffer = cache_retrieve(bufferId);
+  if (buffer == nil) {
+    logError(error, @"Failed to retrieve buffer");
+    return 0;
+  }
+
+  return (unsigned long long)[buffer length];
+}
+
+// Remove a buffer from the cache and release it. Its Id can't be used after
+// this.
+void buffer_release(int bufferId) {
+  id<MTLBuffer> buffer = cache_retrieve(bufferId);
+  if (buffer == nil) {
+    return;
+  }
+
+  cache_remove(bufferId);
+  [buffer release];
+}
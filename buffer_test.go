@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"os"
 	"reflect"
 	"sort"
 	"sync"
+	"syscall"
 	"testing"
+	"unsafe"
 
 	"github.com/stretchr/testify/require"
 )
@@ -67,7 +70,7 @@ func Test_newBuffer_invalid(t *testing.T) {
 	require.Nil(t, buffer)
 
 	// Too many bytes in just one dimension
-	bufferId, buffer, err = newBuffer[float32](math.MaxInt32 + 1)
+	bufferId, buffer, err = newBuffer[float32](int(maxBufferLength()/4) + 1)
 	require.NotNil(t, err)
 	require.Equal(t, "Exceeded maximum number of bytes", err.Error())
 	require.Equal(t, BufferId(0), bufferId)
@@ -178,6 +181,17 @@ func Test_NewBuffer(t *testing.T) {
 	testNewBuffer(t, func(i int) int64 { return int64(-i) })
 	testNewBuffer(t, func(i int) float32 { return float32(i) * 1.1 })
 	testNewBuffer(t, func(i int) float64 { return float64(i) * 1.1 })
+	testNewBuffer(t, func(i int) Float16 { return NewFloat16(float32(i) * 1.1) })
+	testNewBuffer(t, func(i int) BFloat16 { return NewBFloat16(float32(i) * 1.1) })
+
+	// Test the vector types that satisfy the BufferType constraint.
+	testNewBuffer(t, func(i int) Float2 { return Float2{X: float32(i), Y: 1.1} })
+	testNewBuffer(t, func(i int) Float3 { return Float3{X: float32(i), Y: 1.1, Z: -2.2} })
+	testNewBuffer(t, func(i int) Float4 { return Float4{X: float32(i), Y: 1.1, Z: -2.2, W: 3.3} })
+	testNewBuffer(t, func(i int) PackedFloat3 { return PackedFloat3{X: float32(i), Y: 1.1, Z: -2.2} })
+	testNewBuffer(t, func(i int) Half4 { return Half4{X: NewFloat16(float32(i)), W: NewFloat16(1.5)} })
+	testNewBuffer(t, func(i int) Int3 { return Int3{X: int32(-i), Y: 1, Z: 2} })
+	testNewBuffer(t, func(i int) UInt4 { return UInt4{X: uint32(i), Y: 1, Z: 2, W: 3} })
 
 	// Test custom types that satisfy the BufferType constraint.
 	type MyByte byte
@@ -205,7 +219,7 @@ func Test_NewBuffer(t *testing.T) {
 	type MyFloat64 float64
 	testNewBuffer(t, func(i int) MyFloat64 { return MyFloat64(i) * 1.1 })
 
-	// Maximum number of bytes
+	// Maximum number of bytes for a 32-bit size
 	t.Run("maxSize_newBuffer", func(t *testing.T) {
 		bufferId, buffer, err := NewBuffer1D[byte](math.MaxInt32)
 		require.Nil(t, err, "Unable to create metal buffer: %s", err)
@@ -213,6 +227,419 @@ func Test_NewBuffer(t *testing.T) {
 		require.Len(t, buffer, math.MaxInt32)
 		require.Equal(t, cap(buffer), math.MaxInt32)
 	})
+
+	// More bytes than fit in a 32-bit size
+	t.Run("largeSize_newBuffer", func(t *testing.T) {
+		width := math.MaxInt32/4 + 1_000
+		if uint64(width)*4 > maxBufferLength() {
+			t.Skip("Device does not support buffers larger than 2 GiB")
+		}
+
+		bufferId, buffer, err := NewBuffer1D[float32](width)
+		require.Nil(t, err, "Unable to create metal buffer: %s", err)
+		require.True(t, validId(bufferId))
+		require.Len(t, buffer, width)
+		require.Equal(t, cap(buffer), width)
+
+		// Test that the memory past the 2 GiB mark can be used.
+		buffer[width-1] = 1.5
+		require.Equal(t, float32(1.5), buffer[width-1])
+	})
+}
+
+// Test_NewStructBuffer1D tests that NewStructBuffer1D creates a new metal buffer for struct types
+// that have the same layout in Go and metal and rejects all others.
+func Test_NewStructBuffer1D(t *testing.T) {
+	type particle struct {
+		Pos  Float3
+		Mass float32
+		_    [3]float32
+	}
+
+	bufferId, buffer, err := NewStructBuffer1D[particle](10)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Len(t, buffer, 10)
+	require.Equal(t, 10, cap(buffer))
+
+	// Test that every item in the buffer has its zero value and can be written to.
+	for i := range buffer {
+		require.True(t, reflect.ValueOf(buffer[i]).IsZero())
+		buffer[i].Pos.X = float32(i)
+		buffer[i].Mass = float32(i) * 1.1
+	}
+	for i := range buffer {
+		require.Equal(t, float32(i), buffer[i].Pos.X)
+		require.Equal(t, float32(i)*1.1, buffer[i].Mass)
+	}
+
+	// Invalid width
+	bufferId, buffer, err = NewStructBuffer1D[particle](0)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid dimension", err.Error())
+	require.Equal(t, BufferId(0), bufferId)
+	require.Nil(t, buffer)
+
+	// Missing padding
+	type unpadded struct {
+		Pos  Float3
+		Mass float32
+	}
+	bufferId, unpaddedBuffer, err := NewStructBuffer1D[unpadded](10)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "24 bytes long in Go but 32 bytes long in metal")
+	require.Equal(t, BufferId(0), bufferId)
+	require.Nil(t, unpaddedBuffer)
+
+	// Not a struct
+	bufferId, floatBuffer, err := NewStructBuffer1D[float32](10)
+	require.NotNil(t, err)
+	require.Equal(t, "float32 is not a struct", err.Error())
+	require.Equal(t, BufferId(0), bufferId)
+	require.Nil(t, floatBuffer)
+}
+
+// Test_NewBufferFrom tests that NewBufferFrom1D, NewBufferFrom2D, and NewBufferFrom3D create
+// buffers that hold a copy of the source data.
+func Test_NewBufferFrom(t *testing.T) {
+	// 1D
+	src1 := []float32{1.5, 2.5, 3.5, 4.5}
+	bufferId, b1, err := NewBufferFrom1D(src1)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Equal(t, src1, b1)
+
+	// The buffer is a copy.
+	b1[0] = 100
+	require.Equal(t, float32(1.5), src1[0])
+
+	// 2D
+	src2 := [][]int32{{1, 2, 3}, {4, 5, 6}}
+	bufferId, b2, err := NewBufferFrom2D(src2)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Equal(t, src2, b2)
+	require.Equal(t, 3, cap(b2[0]))
+
+	// 3D, from another buffer
+	bufferId, other, err := NewBuffer3D[Float2](2, 3, 4)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	for i := range other {
+		for j := range other[i] {
+			for k := range other[i][j] {
+				other[i][j][k] = Float2{X: float32(i), Y: float32(j*10 + k)}
+			}
+		}
+	}
+	bufferId, b3, err := NewBufferFrom3D(other)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Equal(t, other, b3)
+	require.NotSame(t, &other[0][0][0], &b3[0][0][0])
+
+	// The rows of NewBuffer3D lie next to each other in the buffer, but their capacity ends with the
+	// row, so flattening them copies them.
+	flat, dims, err := flatten3D(other)
+	require.Nil(t, err)
+	require.Equal(t, []int{2, 3, 4}, dims)
+	require.Len(t, flat, 24)
+	require.Equal(t, other[1][2][3], flat[23])
+	require.NotSame(t, &other[0][0][0], &flat[0])
+
+	// Invalid source data
+	_, _, err = NewBufferFrom1D([]float32{})
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid dimension", err.Error())
+	_, _, err = NewBufferFrom2D[float32](nil)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid dimension", err.Error())
+	_, _, err = NewBufferFrom2D([][]float32{{1, 2}, {3}})
+	require.NotNil(t, err)
+	require.Equal(t, "Slices are not rectangular: src[1] has length 1 instead of 2", err.Error())
+	_, _, err = NewBufferFrom3D([][][]float32{{{1}, {2}}, {{3}, {}}})
+	require.NotNil(t, err)
+	require.Equal(t, "Slices are not rectangular: src[1][1] has length 0 instead of 1", err.Error())
+}
+
+// Test_NewBufferNoCopy tests that NewBufferNoCopy wraps existing page-aligned memory in a buffer
+// without copying it.
+func Test_NewBufferNoCopy(t *testing.T) {
+	pageSize := os.Getpagesize()
+	mem, err := syscall.Mmap(-1, 0, pageSize*4, syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	require.Nil(t, err, "Unable to map memory: %s", err)
+	defer syscall.Munmap(mem)
+
+	bufferId, buffer, err := NewBufferNoCopy[float32](mem)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Len(t, buffer, pageSize)
+	require.Same(t, &mem[0], (*byte)(unsafe.Pointer(&buffer[0])))
+
+	// Elements that don't fit in the memory are left out.
+	bufferId, packed, err := NewBufferNoCopy[PackedFloat3](mem)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Len(t, packed, pageSize*4/12)
+
+	// The memory must be page-aligned.
+	_, _, err = NewBufferNoCopy[float32](nil)
+	require.NotNil(t, err)
+	require.Equal(t, "Missing memory", err.Error())
+	_, _, err = NewBufferNoCopy[float32](mem[4:])
+	require.NotNil(t, err)
+	require.Equal(t, fmt.Sprintf("Memory is not aligned to the page size of %d bytes", pageSize),
+		err.Error())
+	_, _, err = NewBufferNoCopy[float32](mem[:pageSize+4])
+	require.NotNil(t, err)
+	require.Equal(t, fmt.Sprintf("Length of %d bytes is not a multiple of the page size of %d bytes",
+		pageSize+4, pageSize), err.Error())
+}
+
+// Test_NewBufferWithOptions tests that NewBufferWithOptions creates buffers with different storage
+// modes and that Upload and Download copy data to and from them.
+func Test_NewBufferWithOptions(t *testing.T) {
+	functionId, err := NewFunction(sourceTransfer1D, "transfer1D")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(functionId))
+
+	width := 1_000
+	want := make([]float32, width)
+	for i := range want {
+		want[i] = float32(i) * 1.1
+	}
+
+	for _, opts := range []BufferOptions{
+		{},
+		{Storage: StorageManaged},
+		{Storage: StoragePrivate},
+		{CPUCache: CPUCacheWriteCombined},
+		{Storage: StoragePrivate, HazardTracking: HazardTrackingUntracked},
+		{HazardTracking: HazardTrackingTracked},
+	} {
+		inputId, input, err := NewBufferWithOptions[float32](opts, width)
+		require.Nil(t, err, "Unable to create metal buffer: %s", err)
+		require.True(t, validId(inputId))
+		outputId, output, err := NewBufferWithOptions[float32](opts, width)
+		require.Nil(t, err, "Unable to create metal buffer: %s", err)
+		require.True(t, validId(outputId))
+
+		if opts.Storage == StoragePrivate {
+			require.Nil(t, input)
+			require.Nil(t, output)
+			_, _, err = View[float32](inputId, 0, width)
+			require.NotNil(t, err)
+			require.Equal(t, "Unable to retrieve buffer: Buffer is not accessible to the CPU", err.Error())
+		} else {
+			require.Len(t, input, width)
+			require.Len(t, output, width)
+		}
+
+		require.Nil(t, Upload(inputId, 0, want), "%v", opts)
+
+		err = functionId.Run(Grid{X: width}, inputId, outputId)
+		require.Nil(t, err, "Unable to run metal function: %s", err)
+
+		got := make([]float32, width)
+		require.Nil(t, Download(outputId, 0, got), "%v", opts)
+		require.Equal(t, want, got, "%v", opts)
+		if output != nil {
+			require.Equal(t, want, output, "%v", opts)
+		}
+
+		// Part of a buffer
+		require.Nil(t, Upload(outputId, 10, []float32{-1, -2}), "%v", opts)
+		part := make([]float32, 4)
+		require.Nil(t, Download(outputId, 9, part), "%v", opts)
+		require.Equal(t, []float32{want[9], -1, -2, want[12]}, part, "%v", opts)
+	}
+
+	// 2-dimensional buffers are laid out in row-major order.
+	bufferId, buffer, err := NewBufferWithOptions[int32](BufferOptions{}, 3, 4)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Len(t, buffer, 12)
+
+	// Invalid options and arguments
+	_, _, err = NewBufferWithOptions[float32](BufferOptions{Storage: 3}, 10)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid storage mode", err.Error())
+	_, _, err = NewBufferWithOptions[float32](BufferOptions{Storage: StoragePrivate}, 0)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid dimension", err.Error())
+
+	err = Upload(bufferId, 10, []int32{1, 2, 3})
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to upload to buffer: View extends past the end of the buffer", err.Error())
+	err = Download(bufferId, -1, []int32{1})
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to download from buffer: Invalid offset", err.Error())
+	err = Upload(BufferId(0), 0, []int32{1})
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid buffer Id", err.Error())
+	err = Download(BufferId(100_000), 0, []int32{1})
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to retrieve buffer: Failed to retrieve buffer", err.Error())
+}
+
+// Test_View tests that View creates a view of a range of elements in a buffer and a slice that
+// wraps exactly that range.
+func Test_View(t *testing.T) {
+	bufferId, buffer, err := NewBuffer1D[float32](100)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+
+	view, viewBuffer, err := View[float32](bufferId, 10, 20)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	require.Equal(t, bufferId, view.Id())
+	require.Equal(t, 40, view.Offset())
+	require.Equal(t, 80, view.Len())
+	require.Len(t, viewBuffer, 20)
+	require.Equal(t, 20, cap(viewBuffer))
+
+	// The view's slice shares memory with the buffer.
+	for i := range viewBuffer {
+		viewBuffer[i] = float32(i) * 1.1
+	}
+	for i := range buffer {
+		if i >= 10 && i < 30 {
+			require.Equal(t, float32(i-10)*1.1, buffer[i])
+		} else {
+			require.Equal(t, float32(0), buffer[i])
+		}
+	}
+
+	// The whole buffer
+	view, viewBuffer, err = View[float32](bufferId, 0, 100)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	require.Equal(t, 0, view.Offset())
+	require.Equal(t, 400, view.Len())
+	require.Equal(t, buffer, viewBuffer)
+
+	// A different type with the same alignment
+	_, vectors, err := View[Float4](bufferId, 1, 24)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	require.Len(t, vectors, 24)
+	require.Equal(t, buffer[4], vectors[0].X)
+
+	type scenario struct {
+		id             BufferId
+		offset, length int
+		wantErr        string
+	}
+	for _, s := range []scenario{
+		{0, 0, 10, "Invalid buffer Id"},
+		{-1, 0, 10, "Invalid buffer Id"},
+		{bufferId, -1, 10, "Invalid offset"},
+		{bufferId, 0, 0, "Invalid length"},
+		{bufferId, 100, 1, "Offset is outside of the buffer"},
+		{bufferId, 90, 11, "View extends past the end of the buffer"},
+		{bufferId, 0, 101, "View extends past the end of the buffer"},
+	} {
+		view, viewBuffer, err := View[float32](s.id, s.offset, s.length)
+		require.NotNil(t, err, "%v", s)
+		require.Equal(t, s.wantErr, err.Error(), "%v", s)
+		require.Equal(t, BufferView{}, view)
+		require.Nil(t, viewBuffer)
+	}
+
+	// Views of other types, as long as they fit
+	_, float3s, err := View[Float3](bufferId, 0, 25)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	require.Len(t, float3s, 25)
+	_, packedFloat3s, err := View[PackedFloat3](bufferId, 1, 32)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	require.Len(t, packedFloat3s, 32)
+	_, _, err = View[Float4](bufferId, 0, 26)
+	require.NotNil(t, err)
+	require.Equal(t, "View extends past the end of the buffer", err.Error())
+
+	// Nonexistent buffer
+	_, _, err = View[float32](BufferId(100_000), 0, 1)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to retrieve buffer: Failed to retrieve buffer", err.Error())
+}
+
+// Test_Reinterpret tests that Reinterpret creates views of the same memory with a different
+// element type.
+func Test_Reinterpret(t *testing.T) {
+	bufferId, floats, err := NewBuffer1D[float32](100)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+
+	for i := range floats {
+		floats[i] = float32(i) - 50
+	}
+
+	// The whole buffer, as the bit patterns of the floats
+	view, bits, err := Reinterpret[uint32](bufferId)
+	require.Nil(t, err, "Unable to reinterpret buffer: %s", err)
+	require.Equal(t, bufferId, view.Id())
+	require.Equal(t, 0, view.Offset())
+	require.Equal(t, 400, view.Len())
+	require.Len(t, bits, 100)
+	for i := range floats {
+		require.Equal(t, math.Float32bits(floats[i]), bits[i])
+	}
+
+	// Changes through one slice show up in the other.
+	bits[0] ^= 0x80000000
+	require.Equal(t, float32(50), floats[0])
+
+	// A larger type
+	_, vectors, err := Reinterpret[Float4](bufferId)
+	require.Nil(t, err, "Unable to reinterpret buffer: %s", err)
+	require.Len(t, vectors, 25)
+	require.Equal(t, floats[4], vectors[1].X)
+	require.Equal(t, floats[7], vectors[1].W)
+
+	// A view keeps its offset and length.
+	floatView, _, err := View[float32](bufferId, 8, 16)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	view, halves, err := Reinterpret[Half2](floatView)
+	require.Nil(t, err, "Unable to reinterpret view: %s", err)
+	require.Equal(t, 32, view.Offset())
+	require.Equal(t, 64, view.Len())
+	require.Len(t, halves, 16)
+
+	// The new view can be reinterpreted again.
+	_, vectors, err = Reinterpret[Float4](view)
+	require.Nil(t, err, "Unable to reinterpret view: %s", err)
+	require.Len(t, vectors, 4)
+	require.Equal(t, floats[8], vectors[0].X)
+
+	// The byte length isn't a multiple of the new type's size.
+	byteView, _, err := View[uint8](bufferId, 0, 6)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	_, _, err = Reinterpret[uint32](byteView)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to reinterpret buffer: Length of 6 bytes is not a multiple of the element "+
+		"size of 4 bytes", err.Error())
+
+	// The start of the view isn't aligned for the new type.
+	byteView, _, err = View[uint8](bufferId, 2, 8)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	_, _, err = Reinterpret[float32](byteView)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to reinterpret buffer: Memory is not aligned to 4 bytes", err.Error())
+
+	floatView, _, err = View[float32](bufferId, 1, 4)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	_, _, err = Reinterpret[Float4](floatView)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to reinterpret buffer: Memory is not aligned to 16 bytes", err.Error())
+
+	// Invalid resources
+	_, _, err = Reinterpret[uint32](nil)
+	require.NotNil(t, err)
+	require.Equal(t, "Missing resource", err.Error())
+	_, _, err = Reinterpret[uint32](BufferId(0))
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid buffer Id", err.Error())
+	_, _, err = Reinterpret[uint32](BufferId(100_000))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to retrieve buffer: Failed to retrieve buffer", err.Error())
 }
 
 // testNewBuffer is a helper to test buffer creation for a variety of types.
@@ -437,3 +864,80 @@ func Test_NewBuffer_threadSafe(t *testing.T) {
 		require.Equal(t, nextMetalId-numIter+i, int(idList[i]))
 	}
 }
+
+// Test_NewBuffer2DWithLayout tests that buffers can be created in every layout and that the layout
+// is recorded on the buffer.
+func Test_NewBuffer2DWithLayout(t *testing.T) {
+	// Row-major buffers hold rows, so the element at (x, y) is at [y][x] and at y*width + x.
+	bufferId, rows, err := NewBuffer2DWithLayout[int32](RowMajor, 4, 3)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Len(t, rows, 3)
+	require.Len(t, rows[0], 4)
+	rows[2][1] = 42
+	flat := unsafe.Slice(&rows[0][0], 12)
+	require.Equal(t, int32(42), flat[RowMajor.Index([]int{4, 3}, 1, 2)])
+	require.Equal(t, int32(42), flat[2*4+1])
+
+	layout, dimLens, err := BufferLayout(bufferId)
+	require.Nil(t, err, "Unable to get buffer layout: %s", err)
+	require.Equal(t, RowMajor, layout)
+	require.Equal(t, []int{4, 3}, dimLens)
+	require.Nil(t, CheckLayout(bufferId, RowMajor))
+	require.Nil(t, CheckLayout(bufferId, AxisOrder(1, 0)))
+	err = CheckLayout(bufferId, ColumnMajor)
+	require.NotNil(t, err)
+	require.Equal(t, "Buffer is row-major instead of column-major", err.Error())
+
+	// Buffers created without a layout are column-major.
+	bufferId, _, err = NewBuffer2D[int32](4, 3)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Nil(t, CheckLayout(bufferId, ColumnMajor))
+	err = CheckLayout(bufferId, RowMajor)
+	require.NotNil(t, err)
+	require.Equal(t, "Buffer is column-major instead of row-major", err.Error())
+
+	// A custom order nests the slices in the same order.
+	bufferId, b3, err := NewBuffer3DWithLayout[float32](AxisOrder(2, 0, 1), 4, 3, 2)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Len(t, b3, 2)
+	require.Len(t, b3[0], 4)
+	require.Len(t, b3[0][0], 3)
+	b3[1][3][2] = 7
+	require.Equal(t, float32(7), unsafe.Slice(&b3[0][0][0], 24)[AxisOrder(2, 0, 1).Index([]int{4, 3, 2}, 3, 2, 1)])
+	err = CheckLayout(bufferId, RowMajor)
+	require.NotNil(t, err)
+	require.Equal(t, "Buffer is axis order [2 0 1] instead of row-major", err.Error())
+
+	// Source data is nested in the same order as the layout.
+	bufferId, b2, err := NewBufferFrom2DWithLayout(RowMajor, [][]float32{{1, 2, 3}, {4, 5, 6}})
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Equal(t, [][]float32{{1, 2, 3}, {4, 5, 6}}, b2)
+	_, dimLens, err = BufferLayout(bufferId)
+	require.Nil(t, err, "Unable to get buffer layout: %s", err)
+	require.Equal(t, []int{3, 2}, dimLens)
+
+	bufferId, b3, err = NewBufferFrom3DWithLayout(RowMajor, [][][]float32{{{1, 2}}, {{3, 4}}, {{5, 6}}})
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Equal(t, [][][]float32{{{1, 2}}, {{3, 4}}, {{5, 6}}}, b3)
+	_, dimLens, err = BufferLayout(bufferId)
+	require.Nil(t, err, "Unable to get buffer layout: %s", err)
+	require.Equal(t, []int{2, 1, 3}, dimLens)
+
+	// Invalid layouts
+	_, _, err = NewBuffer2DWithLayout[float32](AxisOrder(0, 1, 2), 4, 3)
+	require.NotNil(t, err)
+	require.Equal(t, "Axis order [0 1 2] doesn't match 2 dimensions", err.Error())
+	_, _, err = NewBufferFrom2DWithLayout(AxisOrder(0, 0), [][]float32{{1}})
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid axis order [0 0]", err.Error())
+	require.NotNil(t, CheckLayout(bufferId, AxisOrder(0, 1)))
+
+	_, _, err = BufferLayout(0)
+	require.NotNil(t, err)
+	require.Equal(t, "Buffer has no recorded layout", err.Error())
+}
@@ -11,8 +11,13 @@ int numItems = 0;
 // be touched for anything else.
 NSLock *cacheLock = nil;
 
-// Initialize the global cache.
-void cache_init() { cacheLock = [[NSLock alloc] init]; }
+// Initialize the global cache. This does nothing if the cache has already been
+// initialized.
+void cache_init() {
+  if (cacheLock == nil) {
+    cacheLock = [[NSLock alloc] init];
+  }
+}
 
 // Add an item to the cache. This returns 0 and logs a message if any error is
 // encountered and the item is not cached.
@@ -0,0 +1,542 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+/*
+#cgo LDFLAGS: -framework Metal -framework CoreGraphics -framework Foundation
+#include "metal.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// A Context owns a command queue on a device and the objects that are created through it:
+// functions, buffers, textures, samplers, argument buffers, buffer pools, and batches. They can all
+// be released together with Close, so that tests and libraries can clean up after themselves
+// instead of leaving their objects around for the rest of the program.
+//
+// Contexts don't have Ids of their own. Every object gets a unique Id from the same cache of metal
+// objects, no matter which context created it, so an Id of one context can be seen from anywhere.
+// What a Context keeps apart is ownership: which objects Close releases, and which objects its own
+// Run, argument buffers, and batches accept.
+//
+// The package-level functions, such as NewFunction and NewBuffer1D, act as a default context that
+// is never closed. A Context's Run, argument buffers, and batches accept objects of the default
+// context, but not objects of other contexts.
+//
+// Objects of a Context can still be used with the package-level functions, such as FunctionId's
+// RunResources method, Upload, and the batches of the default context, until the context is
+// closed. Close waits for every such use that is in progress, including batches that use the
+// context's objects and are neither committed nor discarded yet, and every use fails once the
+// context is closed.
+//
+// A Context is safe for concurrent use.
+type Context struct {
+	device  Device
+	queueId int
+
+	mu      sync.Mutex
+	closed  bool
+	batches map[*Batch]struct{}
+
+	// owned holds the Ids of the objects that the context owns, and releases holds the functions
+	// that release them, in the order that they were created.
+	owned    []int
+	releases []func()
+
+	// inFlight counts the objects being created and the work that uses the context's objects,
+	// which Close waits for.
+	inFlight sync.WaitGroup
+}
+
+var (
+	// contextOwners holds the context that owns every object created through a Context, by Id.
+	// Objects of the default context aren't in it.
+	contextOwners   = map[int]*Context{}
+	contextOwnersMu sync.Mutex
+)
+
+// NewContext creates a new context for the provided device. The zero Device stands for the default
+// device.
+func NewContext(device Device) (*Context, error) {
+	if err := ensureInit(); err != nil {
+		return nil, err
+	}
+	if device.index != 0 {
+		if _, ok := deviceAt(device.index); !ok {
+			return nil, errors.New("Invalid device")
+		}
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	queueId := int(C.queue_new(C.int(device.index), &metalErr))
+	if queueId == 0 {
+		return nil, metalErrToError(metalErr, "Unable to create context")
+	}
+
+	return &Context{
+		device:  device,
+		queueId: queueId,
+		batches: make(map[*Batch]struct{}),
+	}, nil
+}
+
+// Device returns the device that the context's objects are created on.
+func (c *Context) Device() Device {
+	return c.device
+}
+
+// NewFunction sets up a new function on the context's device. It works the same way as the
+// package-level NewFunction otherwise.
+func (c *Context) NewFunction(metalSource, funcName string) (FunctionId, error) {
+	if err := c.begin(); err != nil {
+		return 0, err
+	}
+	defer c.end()
+
+	id, err := NewFunctionOnDevice(c.device, metalSource, funcName)
+	if err != nil {
+		return 0, err
+	}
+	c.own(func() { C.function_release(C.int(id)) }, int(id))
+
+	return id, nil
+}
+
+// NewContextBuffer allocates a block of memory on the context's device. It works the same way as
+// NewBufferWithOptions otherwise. The memory is released when the context is closed, after which
+// neither the Id nor the slice can be used.
+func NewContextBuffer[T BufferType](c *Context, opts BufferOptions, dimLens ...int) (BufferId, []T,
+	error) {
+	return newContextBuffer(c, func() (BufferId, []T, error) {
+		return NewBufferOnDevice[T](c.device, opts, dimLens...)
+	})
+}
+
+// NewContextBufferFrom1D allocates a 1-dimensional block of memory on the context's device and
+// initializes it with a copy of src. It works the same way as NewBufferFrom1D otherwise. The memory
+// is released when the context is closed.
+func NewContextBufferFrom1D[T BufferType](c *Context, src []T) (BufferId, []T, error) {
+	return newContextBuffer(c, func() (BufferId, []T, error) {
+		return newBufferFrom(c.device, src, ColumnMajor, len(src))
+	})
+}
+
+// NewContextBufferFrom2D allocates a 2-dimensional block of memory on the context's device and
+// initializes it with a copy of src. It works the same way as NewBufferFrom2DWithLayout otherwise.
+// The memory is released when the context is closed.
+func NewContextBufferFrom2D[T BufferType](c *Context, layout Layout, src [][]T) (BufferId, [][]T, error) {
+	return newContextBuffer(c, func() (BufferId, [][]T, error) {
+		return newBufferFrom2D(c.device, layout, src)
+	})
+}
+
+// NewContextBufferFrom3D allocates a 3-dimensional block of memory on the context's device and
+// initializes it with a copy of src. It works the same way as NewBufferFrom3DWithLayout otherwise.
+// The memory is released when the context is closed.
+func NewContextBufferFrom3D[T BufferType](c *Context, layout Layout, src [][][]T) (BufferId, [][][]T,
+	error) {
+	return newContextBuffer(c, func() (BufferId, [][][]T, error) {
+		return newBufferFrom3D(c.device, layout, src)
+	})
+}
+
+// NewContextBufferNoCopy creates a buffer on the context's device that wraps existing memory. It
+// works the same way as NewBufferNoCopy otherwise. The buffer is released when the context is
+// closed, but the memory isn't.
+func NewContextBufferNoCopy[T BufferType](c *Context, mem []byte) (BufferId, []T, error) {
+	return newContextBuffer(c, func() (BufferId, []T, error) {
+		return newBufferNoCopyOnDevice[T](c.device, mem)
+	})
+}
+
+// newContextBuffer is the common internal function for creating a buffer through a context. create
+// creates the buffer on the context's device, and the context releases it when it's closed.
+func newContextBuffer[S any](c *Context, create func() (BufferId, S, error)) (BufferId, S, error) {
+	var none S
+	if err := c.begin(); err != nil {
+		return 0, none, err
+	}
+	defer c.end()
+
+	id, buffer, err := create()
+	if err != nil {
+		return 0, none, err
+	}
+	c.own(func() { releaseBuffer(id) }, int(id))
+
+	return id, buffer, nil
+}
+
+// MapContextFile maps a file into memory and wraps it in a buffer on the context's device. It works
+// the same way as MapFile otherwise. The file is closed when the context is closed, if it wasn't
+// already.
+func MapContextFile[T BufferType](c *Context, path string, writable bool) (*MappedFile[T], error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+	defer c.end()
+
+	m, err := mapFile[T](c.device, path, writable)
+	if err != nil {
+		return nil, err
+	}
+	c.own(func() { m.Close() }, int(m.id))
+
+	return m, nil
+}
+
+// NewContextTexture2D creates a 2-dimensional texture on the context's device. It works the same
+// way as NewTexture2D otherwise. The texture is released when the context is closed.
+func NewContextTexture2D[T TextureType](c *Context, width, height int, opts TextureOptions) (TextureId,
+	error) {
+	return newContextTexture[T](c, width, height, 0, opts)
+}
+
+// NewContextTexture3D creates a 3-dimensional texture on the context's device. It works the same
+// way as NewTexture3D otherwise. The texture is released when the context is closed.
+func NewContextTexture3D[T TextureType](c *Context, width, height, depth int, opts TextureOptions) (TextureId,
+	error) {
+	if depth < 1 {
+		return 0, errors.New("Invalid dimension")
+	}
+
+	return newContextTexture[T](c, width, height, depth, opts)
+}
+
+// newContextTexture is the common internal function for creating a texture through a context.
+func newContextTexture[T TextureType](c *Context, width, height, depth int, opts TextureOptions) (TextureId,
+	error) {
+	if err := c.begin(); err != nil {
+		return 0, err
+	}
+	defer c.end()
+
+	id, err := newTexture[T](c.device, width, height, depth, opts)
+	if err != nil {
+		return 0, err
+	}
+	c.own(id.Release, int(id))
+
+	return id, nil
+}
+
+// NewSampler creates a sampler on the context's device. It works the same way as the package-level
+// NewSampler otherwise. The sampler is released when the context is closed.
+func (c *Context) NewSampler(desc SamplerDescriptor) (SamplerId, error) {
+	if err := c.begin(); err != nil {
+		return 0, err
+	}
+	defer c.end()
+
+	id, err := NewSamplerOnDevice(c.device, desc)
+	if err != nil {
+		return 0, err
+	}
+	c.own(id.Release, int(id))
+
+	return id, nil
+}
+
+// NewArgumentBuffer creates an argument buffer for the metal function. It works the same way as the
+// package-level NewArgumentBuffer, except that the function can't belong to another context. The
+// argument buffer is released when the context is closed.
+func (c *Context) NewArgumentBuffer(function FunctionId, bufferIndex int) (*ArgumentBuffer, error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+	defer c.end()
+
+	if err := c.checkOwners(function, nil); err != nil {
+		return nil, fmt.Errorf("Unable to create argument buffer: %w", err)
+	}
+
+	a, err := NewArgumentBuffer(function, bufferIndex)
+	if err != nil {
+		return nil, err
+	}
+	a.ctx = c
+	c.own(a.Release, int(a.id))
+
+	return a, nil
+}
+
+// NewBufferPool creates a new, empty pool whose buffers are created on the context's device. It
+// works the same way as the package-level NewBufferPool otherwise. When the context is closed, the
+// pool is closed and every buffer that it created is released, including the buffers that are
+// still in use.
+func (c *Context) NewBufferPool(opts PoolOptions) (*BufferPool, error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+	defer c.end()
+
+	p, err := NewBufferPool(opts)
+	if err != nil {
+		return nil, err
+	}
+	p.device, p.ctx = c.device, c
+	c.own(p.closeAll)
+
+	return p, nil
+}
+
+// NewBatch creates a new, empty batch on the context's command queue. It works the same way as the
+// package-level NewBatch otherwise. Batches that are neither committed nor discarded when the
+// context is closed are discarded.
+func (c *Context) NewBatch() (*Batch, error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+	defer c.end()
+
+	b, err := newBatch(c.device, c.queueId)
+	if err != nil {
+		return nil, err
+	}
+	b.ctx = c
+
+	c.mu.Lock()
+	c.batches[b] = struct{}{}
+	c.mu.Unlock()
+
+	return b, nil
+}
+
+// Run executes the metal function on the GPU. It works the same way as FunctionId's RunResources
+// method, except that the function and resources can't belong to another context.
+func (c *Context) Run(function FunctionId, grid Grid, resources ...Resource) error {
+	if err := c.begin(); err != nil {
+		return err
+	}
+	defer c.end()
+
+	if err := c.checkOwners(function, resources); err != nil {
+		return fmt.Errorf("Unable to run metal function: %w", err)
+	}
+
+	return function.RunResources(grid, resources...)
+}
+
+// Close discards the context's open batches, waits for the work that uses the context's objects,
+// and then releases every object that the context created, along with its command queue. None of
+// them can be used after this, and neither can the context.
+func (c *Context) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errors.New("Context is closed")
+	}
+	c.closed = true
+	batches := make([]*Batch, 0, len(c.batches))
+	for b := range c.batches {
+		batches = append(batches, b)
+	}
+	c.mu.Unlock()
+
+	// Discarding a batch waits for a commit that is in progress, and ends the batch's use of the
+	// context's objects otherwise.
+	for _, b := range batches {
+		b.Discard()
+	}
+
+	c.inFlight.Wait()
+
+	// Nothing else changes the context once it's closed and idle. Objects are released in reverse
+	// order, so that argument buffers are released before the buffers that they reference.
+	for i := len(c.releases) - 1; i >= 0; i-- {
+		c.releases[i]()
+	}
+	C.queue_release(C.int(c.queueId))
+
+	contextOwnersMu.Lock()
+	for _, id := range c.owned {
+		delete(contextOwners, id)
+	}
+	contextOwnersMu.Unlock()
+
+	c.owned, c.releases, c.batches = nil, nil, nil
+
+	return nil
+}
+
+// begin marks the start of work that Close must wait for. It returns an error if the context is
+// closed. A nil context stands for the default context.
+func (c *Context) begin() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return errors.New("Context is closed")
+	}
+	c.inFlight.Add(1)
+
+	return nil
+}
+
+// end marks the end of work that was started with begin.
+func (c *Context) end() {
+	if c != nil {
+		c.inFlight.Done()
+	}
+}
+
+// queue returns the Id of the context's command queue, or 0 for the default context, whose batches
+// use the device's own queue.
+func (c *Context) queue() int {
+	if c == nil {
+		return 0
+	}
+
+	return c.queueId
+}
+
+// own records that the context owns the objects with the provided Ids, and that release releases
+// them when the context is closed. release can be nil for objects that something else that the
+// context owns releases. A nil context stands for the default context, which doesn't record
+// anything.
+func (c *Context) own(release func(), ids ...int) {
+	if c == nil {
+		return
+	}
+
+	contextOwnersMu.Lock()
+	for _, id := range ids {
+		contextOwners[id] = c
+	}
+	contextOwnersMu.Unlock()
+
+	c.mu.Lock()
+	c.owned = append(c.owned, ids...)
+	if release != nil {
+		c.releases = append(c.releases, release)
+	}
+	c.mu.Unlock()
+}
+
+// forget removes a batch that was committed or discarded from the context.
+func (c *Context) forget(b *Batch) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.batches, b)
+	c.mu.Unlock()
+}
+
+// checkOwners checks that neither the function (if any) nor the buffers, textures, and samplers
+// that the resources use belong to another context. A nil context stands for the default context,
+// which can use objects of any context.
+func (c *Context) checkOwners(function FunctionId, resources []Resource) error {
+	if c == nil {
+		return nil
+	}
+
+	contextOwnersMu.Lock()
+	defer contextOwnersMu.Unlock()
+
+	owned := func(id int) bool {
+		owner, ok := contextOwners[id]
+		return !ok || owner == c
+	}
+
+	if function.Valid() && !owned(int(function)) {
+		return fmt.Errorf("Function %d belongs to a different context", function)
+	}
+	for _, resource := range resources {
+		if resource == nil {
+			continue
+		}
+		b := resource.binding()
+		switch b.kind {
+		case textureArgument:
+			if !owned(int(b.textureId)) {
+				return fmt.Errorf("Texture %d belongs to a different context", b.textureId)
+			}
+		case samplerArgument:
+			if !owned(int(b.samplerId)) {
+				return fmt.Errorf("Sampler %d belongs to a different context", b.samplerId)
+			}
+		default:
+			for _, id := range append([]BufferId{b.bufferId}, b.uses...) {
+				if !owned(int(id)) {
+					return fmt.Errorf("Buffer %d belongs to a different context", id)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// use marks the start of work with the objects with the provided Ids, so that the contexts that own
+// any of them wait for the work in Close. It returns a function that marks the end of the work, or
+// an error if one of those contexts is closed. Objects of the default context are skipped.
+func use(ids ...int) (func(), error) {
+	contextOwnersMu.Lock()
+	var owners []*Context
+	for _, id := range ids {
+		owner, ok := contextOwners[id]
+		if !ok {
+			continue
+		}
+		seen := false
+		for _, o := range owners {
+			seen = seen || o == owner
+		}
+		if !seen {
+			owners = append(owners, owner)
+		}
+	}
+	contextOwnersMu.Unlock()
+
+	done := func() {
+		for _, owner := range owners {
+			owner.end()
+		}
+	}
+
+	for i, owner := range owners {
+		if err := owner.begin(); err != nil {
+			owners = owners[:i]
+			done()
+			return nil, err
+		}
+	}
+
+	return done, nil
+}
+
+// useResources is the same as use, for the function (if any) and the buffers, textures, and
+// samplers that the resources use.
+func useResources(function FunctionId, resources []Resource) (func(), error) {
+	var ids []int
+	if function.Valid() {
+		ids = append(ids, int(function))
+	}
+	for _, resource := range resources {
+		if resource == nil {
+			continue
+		}
+		b := resource.binding()
+		ids = append(ids, int(b.bufferId), int(b.textureId), int(b.samplerId))
+		for _, id := range b.uses {
+			ids = append(ids, int(id))
+		}
+	}
+
+	return use(ids...)
+}
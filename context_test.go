@@ -0,0 +1,294 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_Context tests that a context runs its own functions with its own buffers, keeps objects of
+// other contexts out, and releases everything when it's closed.
+func Test_Context(t *testing.T) {
+	before := Memory()
+
+	ctx, err := NewContext(Device{})
+	require.Nil(t, err, "Unable to create context: %s", err)
+	addId()
+	require.Equal(t, Device{}, ctx.Device())
+
+	functionId, err := ctx.NewFunction(sourceTransfer1D, "transfer1D")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(functionId))
+
+	inputId, input, err := NewContextBuffer[float32](ctx, BufferOptions{}, 10)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(inputId))
+	outputId, output, err := NewContextBuffer[float32](ctx, BufferOptions{}, 10)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(outputId))
+	require.Equal(t, before.Buffers+2, Memory().Buffers)
+
+	for i := range input {
+		input[i] = float32(i + 1)
+	}
+	err = ctx.Run(functionId, Grid{X: 10}, inputId, outputId)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+	require.Equal(t, input, output)
+
+	batch, err := ctx.NewBatch()
+	require.Nil(t, err, "Unable to create batch: %s", err)
+	addId()
+	require.Nil(t, batch.Fill(outputId, 0))
+	require.Nil(t, batch.Commit())
+	require.Equal(t, make([]float32, 10), output)
+
+	// Buffers of the default context can be used too.
+	defaultId, _, err := NewBuffer1D[float32](10)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(defaultId))
+	err = ctx.Run(functionId, Grid{X: 10}, inputId, defaultId)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+
+	// Objects of other contexts can't.
+	other, err := NewContext(Device{})
+	require.Nil(t, err, "Unable to create context: %s", err)
+	addId()
+	otherId, _, err := NewContextBuffer[float32](other, BufferOptions{}, 10)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(otherId))
+
+	err = ctx.Run(functionId, Grid{X: 10}, inputId, otherId)
+	require.NotNil(t, err)
+	require.Equal(t, fmt.Sprintf("Unable to run metal function: Buffer %d belongs to a different context", otherId), err.Error())
+	err = other.Run(functionId, Grid{X: 10}, otherId, otherId)
+	require.NotNil(t, err)
+	require.Equal(t, fmt.Sprintf("Unable to run metal function: Function %d belongs to a different context", functionId), err.Error())
+
+	openBatch, err := ctx.NewBatch()
+	require.Nil(t, err, "Unable to create batch: %s", err)
+	addId()
+	err = openBatch.Fill(otherId, 0)
+	require.NotNil(t, err)
+	require.Equal(t, fmt.Sprintf("Unable to fill buffer: Buffer %d belongs to a different context", otherId), err.Error())
+
+	// Closing the context releases its buffers and discards its open batches.
+	require.Nil(t, ctx.Close())
+	require.Equal(t, before.Buffers+2, Memory().Buffers)
+	err = openBatch.Commit()
+	require.NotNil(t, err)
+	require.Equal(t, "Batch is already committed or discarded", err.Error())
+
+	// The context can't be used anymore.
+	_, err = ctx.NewFunction(sourceTransfer1D, "transfer1D")
+	require.NotNil(t, err)
+	require.Equal(t, "Context is closed", err.Error())
+	_, _, err = NewContextBuffer[float32](ctx, BufferOptions{}, 10)
+	require.NotNil(t, err)
+	require.Equal(t, "Context is closed", err.Error())
+	err = ctx.Run(functionId, Grid{X: 10}, defaultId, defaultId)
+	require.NotNil(t, err)
+	require.Equal(t, "Context is closed", err.Error())
+	err = ctx.Close()
+	require.NotNil(t, err)
+	require.Equal(t, "Context is closed", err.Error())
+
+	// Neither can its function.
+	require.NotNil(t, functionId.Run(Grid{X: 10}, defaultId, defaultId))
+	require.Nil(t, other.Close())
+	require.Equal(t, before.Buffers+1, Memory().Buffers)
+
+	// Invalid devices
+	_, err = NewContext(Device{index: 10000})
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid device", err.Error())
+}
+
+// Test_Context_Objects tests that a context releases every kind of object that it creates when
+// it's closed, and that its argument buffers keep objects of other contexts out.
+func Test_Context_Objects(t *testing.T) {
+	before := Memory()
+
+	ctx, err := NewContext(Device{})
+	require.Nil(t, err, "Unable to create context: %s", err)
+	addId()
+
+	textureId, err := NewContextTexture2D[float32](ctx, 4, 4, TextureOptions{})
+	require.Nil(t, err, "Unable to create texture: %s", err)
+	require.True(t, validId(textureId))
+	volumeId, err := NewContextTexture3D[float32](ctx, 4, 4, 2, TextureOptions{})
+	require.Nil(t, err, "Unable to create texture: %s", err)
+	require.True(t, validId(volumeId))
+	samplerId, err := ctx.NewSampler(SamplerDescriptor{})
+	require.Nil(t, err, "Unable to create sampler: %s", err)
+	require.True(t, validId(samplerId))
+	require.Equal(t, before.Textures.Buffers+2, Memory().Textures.Buffers)
+
+	functionId, err := ctx.NewFunction(sourceSumArrays, "sumArrays")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(functionId))
+	args, err := ctx.NewArgumentBuffer(functionId, 0)
+	require.Nil(t, err, "Unable to create argument buffer: %s", err)
+	addId()
+	require.True(t, validId(args.Id()))
+
+	pool, err := ctx.NewBufferPool(PoolOptions{})
+	require.Nil(t, err, "Unable to create buffer pool: %s", err)
+	pooledId, _, err := PoolGet[float32](pool, 10)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.True(t, validId(pooledId))
+	require.Nil(t, args.SetBuffer(0, pooledId))
+
+	pageSize := os.Getpagesize()
+	mem, err := syscall.Mmap(-1, 0, pageSize, syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	require.Nil(t, err, "Unable to map memory: %s", err)
+	defer syscall.Munmap(mem)
+	noCopyId, _, err := NewContextBufferNoCopy[float32](ctx, mem)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(noCopyId))
+
+	path := filepath.Join(t.TempDir(), "data.bin")
+	require.Nil(t, os.WriteFile(path, make([]byte, 16), 0o644))
+	file, err := MapContextFile[float32](ctx, path, false)
+	require.Nil(t, err, "Unable to map file: %s", err)
+	require.True(t, validId(file.Id()))
+
+	// Argument buffers of a context can't reference buffers of other contexts.
+	other, err := NewContext(Device{})
+	require.Nil(t, err, "Unable to create context: %s", err)
+	addId()
+	otherId, _, err := NewContextBuffer[float32](other, BufferOptions{}, 10)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(otherId))
+	err = args.SetBuffer(1, otherId)
+	require.NotNil(t, err)
+	require.Equal(t, fmt.Sprintf("Unable to set argument: Buffer %d belongs to a different context", otherId), err.Error())
+	_, err = other.NewArgumentBuffer(functionId, 0)
+	require.NotNil(t, err)
+	require.Equal(t, fmt.Sprintf("Unable to create argument buffer: Function %d belongs to a different context", functionId), err.Error())
+	require.Nil(t, other.Close())
+
+	// Closing the context releases everything, including the pool's buffer that is still in use.
+	require.Nil(t, ctx.Close())
+	require.Equal(t, before.Allocation, Memory().Allocation)
+	require.Equal(t, before.Textures, Memory().Textures)
+	require.Equal(t, PoolStats{Misses: 1}, pool.Stats())
+	require.NotNil(t, DownloadTexture(textureId, Region{}, make([]float32, 16)))
+	err = SetArgument(args, 40, uint32(1))
+	require.NotNil(t, err)
+	require.Equal(t, "Argument buffer is released", err.Error())
+	err = file.Close()
+	require.NotNil(t, err)
+	require.Equal(t, "Mapped file is already closed", err.Error())
+	_, _, err = PoolGet[float32](pool, 10)
+	require.NotNil(t, err)
+	require.Equal(t, "Context is closed", err.Error())
+}
+
+// Test_Context_Close tests that Close waits for batches of other contexts that use the context's
+// objects, and that the objects can't be used once the context is closed.
+func Test_Context_Close(t *testing.T) {
+	ctx, err := NewContext(Device{})
+	require.Nil(t, err, "Unable to create context: %s", err)
+	addId()
+
+	bufferId, buffer, err := NewContextBuffer[float32](ctx, BufferOptions{}, 10)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+
+	batch, err := NewBatch()
+	require.Nil(t, err, "Unable to create batch: %s", err)
+	addId()
+	require.Nil(t, BatchFillValue(batch, bufferId, float32(2)))
+
+	closed := make(chan error)
+	go func() {
+		closed <- ctx.Close()
+	}()
+
+	// Close can't release the buffer until the batch that uses it is committed.
+	select {
+	case <-closed:
+		t.Fatal("Context was closed while a batch used its buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Nil(t, batch.Commit())
+	require.Equal(t, []float32{2, 2, 2, 2, 2, 2, 2, 2, 2, 2}, buffer)
+	require.Nil(t, <-closed)
+
+	// The buffer is released now.
+	require.NotNil(t, Upload(bufferId, 0, []float32{1}))
+	require.NotNil(t, Fill(bufferId, 0))
+	addId()
+}
+
+// Test_Context_BufferFrom tests that a context creates buffers that are initialized with a copy of
+// existing data, and releases them when it's closed.
+func Test_Context_BufferFrom(t *testing.T) {
+	before := Memory()
+
+	ctx, err := NewContext(Device{})
+	require.Nil(t, err, "Unable to create context: %s", err)
+	addId()
+
+	id1, b1, err := NewContextBufferFrom1D(ctx, []float32{1, 2, 3})
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(id1))
+	require.Equal(t, []float32{1, 2, 3}, b1)
+
+	src2 := [][]int32{{1, 2, 3}, {4, 5, 6}}
+	id2, b2, err := NewContextBufferFrom2D(ctx, RowMajor, src2)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(id2))
+	require.Equal(t, src2, b2)
+
+	src3 := [][][]uint8{{{1, 2}, {3, 4}}, {{5, 6}, {7, 8}}}
+	id3, b3, err := NewContextBufferFrom3D(ctx, ColumnMajor, src3)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(id3))
+	require.Equal(t, src3, b3)
+	require.Equal(t, before.Buffers+3, Memory().Buffers)
+
+	_, _, err = NewContextBufferFrom2D(ctx, RowMajor, [][]int32{{1, 2}, {3}})
+	require.NotNil(t, err)
+
+	require.Nil(t, ctx.Close())
+	require.Equal(t, before.Allocation, Memory().Allocation)
+	_, _, err = NewContextBufferFrom1D(ctx, []float32{1})
+	require.NotNil(t, err)
+	require.Equal(t, "Context is closed", err.Error())
+}
+
+// Test_Context_otherDevice tests that a context on a device other than the default device creates
+// its buffers, including those initialized with a copy of existing data, on that device.
+func Test_Context_otherDevice(t *testing.T) {
+	device := otherDevice(t)
+
+	ctx, err := NewContext(device)
+	require.Nil(t, err, "Unable to create context: %s", err)
+	addId()
+	defer ctx.Close()
+
+	functionId, err := ctx.NewFunction(sourceTransfer1D, "transfer1D")
+	require.Nil(t, err, "Unable to create metal function on %s: %s", device, err)
+	require.True(t, validId(functionId))
+
+	inputId, _, err := NewContextBufferFrom1D(ctx, []float32{1, 2, 3, 4})
+	require.Nil(t, err, "Unable to create metal buffer on %s: %s", device, err)
+	require.True(t, validId(inputId))
+	outputId, output, err := NewContextBuffer[float32](ctx, BufferOptions{}, 4)
+	require.Nil(t, err, "Unable to create metal buffer on %s: %s", device, err)
+	require.True(t, validId(outputId))
+
+	err = ctx.Run(functionId, Grid{X: 4}, inputId, outputId)
+	require.Nil(t, err, "Unable to run metal function on %s: %s", device, err)
+	require.Equal(t, []float32{1, 2, 3, 4}, output)
+}
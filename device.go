@@ -0,0 +1,44 @@
+package metal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoDevice is returned when the system has no GPU that metal can use, such as in most virtual
+// machines and on headless CI runners. Available checks for this ahead of time.
+var ErrNoDevice = errors.New("No metal device is available")
+
+// A Device is a GPU that metal functions can run on. Most Macs have one, but Mac Pros can have
+// several, and external GPUs can be plugged in. The zero value stands for the default device,
+// which is the one that everything runs on unless another device is chosen.
+type Device struct {
+	// Name is the name of the GPU, such as "Apple M2 Max".
+	Name string
+
+	// RegistryID uniquely identifies the GPU in the system for as long as it's running.
+	RegistryID uint64
+
+	// LowPower is true for GPUs that save energy at the expense of performance, such as the
+	// integrated GPU of a Mac that also has a discrete GPU.
+	LowPower bool
+
+	// Headless is true for GPUs that aren't connected to a display.
+	Headless bool
+
+	// Removable is true for external GPUs, which can be unplugged at any time.
+	Removable bool
+
+	// index is the device's 1-based position in the list of devices. 0 stands for the default
+	// device.
+	index int
+}
+
+// String returns the name and registry ID of the device, such as "Apple M2 Max (0x100000abc)".
+func (d Device) String() string {
+	if d.index == 0 && d.Name == "" {
+		return "default device"
+	}
+
+	return fmt.Sprintf("%s (%#x)", d.Name, d.RegistryID)
+}
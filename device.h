@@ -0,0 +1,14 @@
+// go:build darwin
+//  +build darwin
+
+#ifndef HEADER_DEVICE
+#define HEADER_DEVICE
+
+#import <Metal/Metal.h>
+
+id<MTLDevice> device_get(int deviceIndex);
+id<MTLCommandQueue> device_queue(id<MTLDevice> device);
+int device_index(id<MTLDevice> device);
+_Bool device_same(id<MTLDevice> a, id<MTLDevice> b);
+
+#endif
@@ -0,0 +1,13 @@
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_Device_String tests that devices are described by their name and registry ID.
+func Test_Device_String(t *testing.T) {
+	require.Equal(t, "default device", Device{}.String())
+	require.Equal(t, "Apple M2 Max (0x100000abc)", Device{Name: "Apple M2 Max", RegistryID: 0x100000abc, index: 1}.String())
+}
@@ -0,0 +1,85 @@
+package metal
+
+import (
+	"fmt"
+)
+
+// A GPUFamily is a group of GPUs with the same features. The values match Apple's MTLGPUFamily.
+// Apple's feature set tables list what every family supports.
+type GPUFamily int
+
+const (
+	GPUFamilyApple1 GPUFamily = 1001
+	GPUFamilyApple2 GPUFamily = 1002
+	GPUFamilyApple3 GPUFamily = 1003
+	GPUFamilyApple4 GPUFamily = 1004
+	GPUFamilyApple5 GPUFamily = 1005
+	GPUFamilyApple6 GPUFamily = 1006
+	GPUFamilyApple7 GPUFamily = 1007
+	GPUFamilyApple8 GPUFamily = 1008
+	GPUFamilyApple9 GPUFamily = 1009
+
+	GPUFamilyMac2 GPUFamily = 2002
+
+	GPUFamilyCommon1 GPUFamily = 3001
+	GPUFamilyCommon2 GPUFamily = 3002
+	GPUFamilyCommon3 GPUFamily = 3003
+
+	GPUFamilyMetal3 GPUFamily = 5001
+)
+
+// gpuFamilies lists every GPU family that a device is checked for.
+var gpuFamilies = []GPUFamily{
+	GPUFamilyApple1, GPUFamilyApple2, GPUFamilyApple3, GPUFamilyApple4, GPUFamilyApple5,
+	GPUFamilyApple6, GPUFamilyApple7, GPUFamilyApple8, GPUFamilyApple9,
+	GPUFamilyMac2,
+	GPUFamilyCommon1, GPUFamilyCommon2, GPUFamilyCommon3,
+	GPUFamilyMetal3,
+}
+
+// String returns the name of the family, such as "Apple7".
+func (f GPUFamily) String() string {
+	switch {
+	case f >= GPUFamilyApple1 && f <= GPUFamilyApple9:
+		return fmt.Sprintf("Apple%d", f-GPUFamilyApple1+1)
+	case f == GPUFamilyMac2:
+		return "Mac2"
+	case f >= GPUFamilyCommon1 && f <= GPUFamilyCommon3:
+		return fmt.Sprintf("Common%d", f-GPUFamilyCommon1+1)
+	case f == GPUFamilyMetal3:
+		return "Metal3"
+	}
+
+	return fmt.Sprintf("GPUFamily(%d)", int(f))
+}
+
+// languageVersions lists every version of the Metal Shading Language that macOS supports, from
+// oldest to newest.
+var languageVersions = []LanguageVersion{
+	{1, 1}, {1, 2}, {2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}, {3, 0}, {3, 1}, {3, 2},
+}
+
+// supportsNonUniformThreadgroups checks whether or not GPUs in the families support grids that
+// aren't a multiple of the threadgroup size, which Apple4 and Mac2 GPUs and newer do.
+func supportsNonUniformThreadgroups(families []GPUFamily) bool {
+	for _, f := range families {
+		if (f >= GPUFamilyApple4 && f <= GPUFamilyApple9) || f == GPUFamilyMac2 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// languageVersionsUpTo returns the versions of the Metal Shading Language up to and including
+// newest.
+func languageVersionsUpTo(newest LanguageVersion) []LanguageVersion {
+	var versions []LanguageVersion
+	for _, v := range languageVersions {
+		if newest.AtLeast(v) {
+			versions = append(versions, v)
+		}
+	}
+
+	return versions
+}
@@ -0,0 +1,38 @@
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_GPUFamily_String tests that GPU families are named the same way as in Apple's feature set
+// tables.
+func Test_GPUFamily_String(t *testing.T) {
+	require.Equal(t, "Apple1", GPUFamilyApple1.String())
+	require.Equal(t, "Apple9", GPUFamilyApple9.String())
+	require.Equal(t, "Mac2", GPUFamilyMac2.String())
+	require.Equal(t, "Common3", GPUFamilyCommon3.String())
+	require.Equal(t, "Metal3", GPUFamilyMetal3.String())
+	require.Equal(t, "GPUFamily(2001)", GPUFamily(2001).String())
+}
+
+// Test_supportsNonUniformThreadgroups tests that non-uniform threadgroups are supported from the
+// Apple4 and Mac2 families on.
+func Test_supportsNonUniformThreadgroups(t *testing.T) {
+	require.False(t, supportsNonUniformThreadgroups(nil))
+	require.False(t, supportsNonUniformThreadgroups([]GPUFamily{GPUFamilyApple1, GPUFamilyApple3, GPUFamilyCommon3}))
+	require.True(t, supportsNonUniformThreadgroups([]GPUFamily{GPUFamilyApple4}))
+	require.True(t, supportsNonUniformThreadgroups([]GPUFamily{GPUFamilyCommon1, GPUFamilyApple9}))
+	require.True(t, supportsNonUniformThreadgroups([]GPUFamily{GPUFamilyMac2}))
+}
+
+// Test_languageVersionsUpTo tests that languageVersionsUpTo lists every version up to the newest
+// one.
+func Test_languageVersionsUpTo(t *testing.T) {
+	require.Equal(t, []LanguageVersion{{1, 1}, {1, 2}, {2, 0}, {2, 1}, {2, 2}},
+		languageVersionsUpTo(LanguageVersion{2, 2}))
+	require.Equal(t, languageVersions, languageVersionsUpTo(LanguageVersion{3, 2}))
+	require.Equal(t, languageVersions, languageVersionsUpTo(LanguageVersion{4, 0}))
+	require.Nil(t, languageVersionsUpTo(LanguageVersion{1, 0}))
+}
@@ -0,0 +1,146 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+/*
+#cgo LDFLAGS: -framework Metal -framework CoreGraphics -framework Foundation
+#include "metal.h"
+*/
+import "C"
+
+// Devices returns every GPU in the system. The default device is one of them. Functions and
+// buffers can be created on a specific device with NewFunctionOnDevice and NewBufferOnDevice. If
+// there is no GPU (see Available), this returns nil.
+func Devices() []Device {
+	if err := ensureInit(); err != nil {
+		return nil
+	}
+
+	devices := make([]Device, 0, int(C.metal_device_count()))
+	for index := 1; index <= cap(devices); index++ {
+		if device, ok := deviceAt(index); ok {
+			devices = append(devices, device)
+		}
+	}
+
+	return devices
+}
+
+// DefaultDevice returns the GPU that everything runs on unless another device is chosen. It is the
+// same as the matching device in Devices. If there is no GPU (see Available), this returns the zero
+// Device.
+func DefaultDevice() Device {
+	if err := ensureInit(); err != nil {
+		return Device{}
+	}
+
+	device, _ := deviceAt(int(C.metal_default_device()))
+
+	return device
+}
+
+// DeviceInfo describes what a device can do, so that programs can pick algorithms and sizes of
+// threadgroups and tiles at run time.
+type DeviceInfo struct {
+	// Name is the name of the GPU.
+	Name string
+
+	// Families lists the GPU families that the device supports.
+	Families []GPUFamily
+
+	// MaxThreadsPerThreadgroup is the largest number of threads in each dimension of a
+	// threadgroup. A metal function's pipeline might support fewer threads in total.
+	MaxThreadsPerThreadgroup Grid
+
+	// MaxBufferLength is the largest number of bytes in a single buffer.
+	MaxBufferLength uint64
+
+	// MaxThreadgroupMemoryLength is the largest number of bytes of threadgroup memory.
+	MaxThreadgroupMemoryLength uint64
+
+	// HasUnifiedMemory is true if the CPU and GPU share memory, such as on Apple silicon.
+	HasUnifiedMemory bool
+
+	// RecommendedMaxWorkingSetSize is the number of bytes that the device can use without
+	// affecting performance.
+	RecommendedMaxWorkingSetSize uint64
+
+	// NonUniformThreadgroups is true if grids don't need to be a multiple of the threadgroup
+	// size. Run relies on this.
+	NonUniformThreadgroups bool
+
+	// LanguageVersions lists the versions of the Metal Shading Language that metal code can be
+	// compiled with, from oldest to newest.
+	LanguageVersions []LanguageVersion
+}
+
+// Supports checks whether or not the device supports the GPU family.
+func (i DeviceInfo) Supports(family GPUFamily) bool {
+	for _, f := range i.Families {
+		if f == family {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Info returns what the device can do. It returns the zero DeviceInfo if the device doesn't exist
+// or there is no GPU (see Available).
+func (d Device) Info() DeviceInfo {
+	if err := ensureInit(); err != nil {
+		return DeviceInfo{}
+	}
+
+	var limits C.device_limits
+	if ok := C.metal_device_limits(C.int(d.index), &limits); !ok {
+		return DeviceInfo{}
+	}
+
+	var families []GPUFamily
+	for _, family := range gpuFamilies {
+		if C.metal_device_supports_family(C.int(d.index), C.int(family)) {
+			families = append(families, family)
+		}
+	}
+
+	name := d.Name
+	if d.index == 0 {
+		name = DefaultDevice().Name
+	}
+
+	return DeviceInfo{
+		Name:     name,
+		Families: families,
+		MaxThreadsPerThreadgroup: Grid{
+			X: int(limits.maxThreadsWidth),
+			Y: int(limits.maxThreadsHeight),
+			Z: int(limits.maxThreadsDepth),
+		},
+		MaxBufferLength:              uint64(limits.maxBufferLength),
+		MaxThreadgroupMemoryLength:   uint64(limits.maxThreadgroupMemoryLength),
+		HasUnifiedMemory:             bool(limits.hasUnifiedMemory),
+		RecommendedMaxWorkingSetSize: uint64(limits.recommendedMaxWorkingSetSize),
+		NonUniformThreadgroups:       supportsNonUniformThreadgroups(families),
+		LanguageVersions:             languageVersionsUpTo(languageVersion()),
+	}
+}
+
+// deviceAt returns the device with the provided 1-based index in the list of devices. It returns
+// false if there is no such device.
+func deviceAt(index int) (Device, bool) {
+	var props C.device_properties
+	if ok := C.metal_device_properties(C.int(index), &props); !ok {
+		return Device{}, false
+	}
+
+	return Device{
+		Name:       C.GoString(props.name),
+		RegistryID: uint64(props.registryId),
+		LowPower:   bool(props.lowPower),
+		Headless:   bool(props.headless),
+		Removable:  bool(props.removable),
+		index:      index,
+	}, true
+}
@@ -0,0 +1,155 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_Devices tests that every device is listed, and that functions and buffers can be created and
+// run on each of them.
+func Test_Devices(t *testing.T) {
+	devices := Devices()
+	require.NotEmpty(t, devices)
+	require.Contains(t, devices, DefaultDevice())
+
+	registryIDs := map[uint64]bool{}
+	for _, device := range devices {
+		require.NotEmpty(t, device.Name)
+		registryIDs[device.RegistryID] = true
+	}
+	require.Len(t, registryIDs, len(devices))
+
+	for _, device := range devices {
+		functionId, err := NewFunctionOnDevice(device, sourceTransfer1D, "transfer1D")
+		require.Nil(t, err, "Unable to create metal function on %s: %s", device, err)
+		require.True(t, validId(functionId))
+
+		inputId, input, err := NewBufferOnDevice[float32](device, BufferOptions{}, 10)
+		require.Nil(t, err, "Unable to create metal buffer on %s: %s", device, err)
+		require.True(t, validId(inputId))
+		outputId, output, err := NewBufferOnDevice[float32](device, BufferOptions{}, 10)
+		require.Nil(t, err, "Unable to create metal buffer on %s: %s", device, err)
+		require.True(t, validId(outputId))
+
+		for i := range input {
+			input[i] = float32(i + 1)
+		}
+		err = functionId.Run(Grid{X: 10}, inputId, outputId)
+		require.Nil(t, err, "Unable to run metal function on %s: %s", device, err)
+		require.Equal(t, input, output)
+
+		batch, err := NewBatchOnDevice(device)
+		require.Nil(t, err, "Unable to create batch on %s: %s", device, err)
+		addId()
+		require.Nil(t, batch.Fill(outputId, 0))
+		require.Nil(t, batch.Commit())
+		require.Equal(t, make([]float32, 10), output)
+
+		textureId, err := NewTexture2DOnDevice[float32](device, 4, 1, TextureOptions{})
+		require.Nil(t, err, "Unable to create texture on %s: %s", device, err)
+		require.True(t, validId(textureId))
+		samplerId, err := NewSamplerOnDevice(device, SamplerDescriptor{})
+		require.Nil(t, err, "Unable to create sampler on %s: %s", device, err)
+		require.True(t, validId(samplerId))
+		textureId.Release()
+		samplerId.Release()
+	}
+
+	// Textures and samplers need a device that exists.
+	_, err := NewTexture3DOnDevice[float32](Device{index: 10000}, 2, 2, 2, TextureOptions{})
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to create texture: Failed to find device", err.Error())
+	_, err = NewSamplerOnDevice(Device{index: 10000}, SamplerDescriptor{})
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to create sampler: Failed to find device", err.Error())
+
+	// The default device is used when no device is chosen.
+	functionId, err := NewFunctionOnDevice(Device{}, sourceTransfer1D, "transfer1D")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(functionId))
+	bufferId, _, err := NewBufferOnDevice[float32](DefaultDevice(), BufferOptions{}, 10)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	require.Nil(t, functionId.Run(Grid{X: 10}, bufferId, bufferId))
+
+	// Objects on different devices can't be mixed.
+	if len(devices) < 2 {
+		return
+	}
+	var other Device
+	for _, device := range devices {
+		if device != DefaultDevice() {
+			other = device
+		}
+	}
+	otherId, _, err := NewBufferOnDevice[float32](other, BufferOptions{}, 10)
+	require.Nil(t, err, "Unable to create metal buffer on %s: %s", other, err)
+	require.True(t, validId(otherId))
+
+	err = functionId.Run(Grid{X: 10}, bufferId, otherId)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to run metal function: Buffer 2/2 is on a different device than the function", err.Error())
+
+	batch, err := NewBatch()
+	require.Nil(t, err, "Unable to create batch: %s", err)
+	addId()
+	err = batch.Fill(otherId, 0)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to fill buffer: Buffer is on a different device than the batch", err.Error())
+	batch.Discard()
+}
+
+// Test_DeviceInfo_Supports tests that Supports finds the families that a device supports.
+func Test_DeviceInfo_Supports(t *testing.T) {
+	info := DeviceInfo{Families: []GPUFamily{GPUFamilyApple7, GPUFamilyMac2, GPUFamilyMetal3}}
+	require.True(t, info.Supports(GPUFamilyApple7))
+	require.True(t, info.Supports(GPUFamilyMetal3))
+	require.False(t, info.Supports(GPUFamilyApple8))
+}
+
+// Test_Device_Info tests that every device reports what it can do.
+func Test_Device_Info(t *testing.T) {
+	for _, device := range Devices() {
+		info := device.Info()
+		require.Equal(t, device.Name, info.Name)
+		require.NotEmpty(t, info.Families, "No GPU families for %s", device)
+		require.Positive(t, info.MaxThreadsPerThreadgroup.X)
+		require.Positive(t, info.MaxThreadsPerThreadgroup.Y)
+		require.Positive(t, info.MaxThreadsPerThreadgroup.Z)
+		require.Positive(t, info.MaxBufferLength)
+		require.Positive(t, info.MaxThreadgroupMemoryLength)
+		require.Positive(t, info.RecommendedMaxWorkingSetSize)
+		require.Contains(t, info.LanguageVersions, languageVersion())
+		require.Equal(t, languageVersion(), info.LanguageVersions[len(info.LanguageVersions)-1])
+	}
+
+	// The zero Device is the default device.
+	require.Equal(t, DefaultDevice().Info(), Device{}.Info())
+	require.Equal(t, maxBufferLength(), Device{}.Info().MaxBufferLength)
+}
+
+// Test_Available tests that the GPUs are initialized on first use, and that checking for them again
+// is harmless.
+func Test_Available(t *testing.T) {
+	require.True(t, Available())
+	require.True(t, Available())
+	require.Nil(t, ensureInit())
+	require.NotEmpty(t, Devices())
+}
+
+// otherDevice returns a device other than the default device. It skips the test if there is only
+// one device.
+func otherDevice(t *testing.T) Device {
+	for _, device := range Devices() {
+		if device != DefaultDevice() {
+			return device
+		}
+	}
+	t.Skip("Only one device is present")
+
+	return Device{}
+}
@@ -64,14 +64,175 @@ This is the mapping
 of Go types
 to Metal types:
 
-	| Go      | Metal  |
-	| ------- | ------ |
-	| float32 | float  |
-	| N/A     | half   |
-	| int32   | int    |
-	| int16   | short  |
-	| uint32  | uint   |
-	| uint16  | ushort |
+	| Go       | Metal  |
+	| -------- | ------ |
+	| float32  | float  |
+	| Float16  | half   |
+	| BFloat16 | bfloat |
+	| int32    | int    |
+	| int16    | short  |
+	| uint32   | uint   |
+	| uint16   | ushort |
+
+The bfloat type requires version 3.1 or later of the Metal Shading Language (macOS 14).
+
+The vector types
+have the same size as their metal counterparts:
+
+	| Go           | Metal         | Size |
+	| ------------ | ------------- | ---- |
+	| Float2       | float2        | 8    |
+	| Float3       | float3        | 16   |
+	| Float4       | float4        | 16   |
+	| PackedFloat3 | packed_float3 | 12   |
+	| Half2        | half2         | 4    |
+	| Half3        | half3         | 8    |
+	| Half4        | half4         | 8    |
+	| Int2         | int2          | 8    |
+	| Int3         | int3          | 16   |
+	| Int4         | int4          | 16   |
+	| UInt2        | uint2         | 8    |
+	| UInt3        | uint3         | 16   |
+	| UInt4        | uint4         | 16   |
+
+Note that float3, int3, and uint3
+take up 16 bytes,
+not 12.
+Use PackedFloat3
+for tightly packed 3-component vectors.
+
+Buffers of structs
+can be created with NewStructBuffer1D,
+as long as the struct
+has the same layout in Go
+as in metal.
+MSLStruct generates the metal declaration
+of a Go struct,
+so that the Go type
+is the single source of truth
+for the layout.
+
+By default,
+the X dimension of a 2- or 3-dimensional buffer
+changes the slowest in memory,
+so a 2-dimensional buffer is indexed as [x][y].
+NewBuffer2DWithLayout and NewBuffer3DWithLayout
+take a Layout instead,
+such as RowMajor,
+which is indexed as [y][x]
+like most image and matrix code.
+The layout is recorded on the buffer,
+and CheckLayout detects mismatches.
+
+Image kernels
+can read textures instead of buffers,
+through samplers
+with hardware filtering,
+normalized coordinates,
+and address modes.
+NewTexture2D and NewTexture3D
+create textures whose pixel format
+matches their Go type,
+UploadTexture and DownloadTexture
+copy their texels,
+NewSampler
+creates samplers,
+and Release releases either of them.
+Textures and samplers
+are supplied to RunResources
+along with the buffers,
+and they are bound
+at their own [[texture(n)]] and [[sampler(n)]] indexes.
+
+Metal functions
+take at most 31 buffers directly.
+An ArgumentBuffer
+holds a struct of buffer pointers and scalars instead,
+so that a function
+can take any number of buffers
+through a single argument.
+
+Large data sets
+don't have to be copied into a new buffer.
+NewBufferNoCopy wraps existing page-aligned memory,
+and MapFile wraps a memory-mapped file,
+so that the GPU works directly on the file's contents.
+
+Buffers are accessible to both the CPU and GPU by default.
+NewBufferWithOptions creates buffers
+with other storage, CPU cache, and hazard tracking modes.
+Buffers in private storage
+are only accessible to the GPU,
+which makes them faster
+for intermediate results;
+their contents are copied
+with Upload and Download.
+
+Copy, Fill, and FillValue
+copy and fill buffers on the GPU,
+without a round trip through the CPU.
+A Batch
+runs any number of these operations
+and metal functions
+in order,
+all in one go.
+
+Everything runs on the default GPU
+unless another one is chosen.
+Devices lists every GPU,
+such as the GPUs of a Mac Pro
+or an external GPU,
+and NewFunctionOnDevice, NewBufferOnDevice, NewBatchOnDevice,
+NewTexture2DOnDevice, NewTexture3DOnDevice, and NewSamplerOnDevice
+create functions, buffers, batches, textures, and samplers
+on one of them.
+Objects on different GPUs
+can't be mixed.
+A device's Info
+reports its GPU families,
+its limits on threadgroups and memory,
+and the language versions it supports,
+so that programs can pick algorithms
+and tile sizes
+at run time.
+
+A Context
+owns a command queue
+and the functions, buffers, textures, samplers,
+argument buffers, pools, and batches
+created through it,
+and Close releases all of them
+once the work that uses them is done,
+so that tests and libraries
+can clean up after themselves.
+The package-level functions
+act as a default context
+that is never closed.
+
+A BufferPool
+hands out buffers by size class
+and takes them back with Put,
+so that short-lived buffers
+don't need new memory
+every time.
+A ManagedBuffer
+is released by the garbage collector
+once neither it nor its memory can be reached anymore,
+instead of living
+for the rest of the program.
+
+ReadNPY and WriteNPY
+read and write tensors
+in NumPy's .npy format,
+and ReadNPZ and WriteNPZ
+do the same for .npz archives,
+so that results can be checked
+against NumPy directly.
+NewTensorFromImage and ImageFromTensor
+convert between tensors and image.Image,
+with interleaved or planar channels,
+and ReadPFM, WritePFM, ReadPGM, and WritePGM
+handle float and gray images.
 
 # Limitations
 
@@ -79,16 +240,17 @@ to Metal types:
     technically supports only Apple GPUs
     that allow non-uniform threadgroup sizes.
     A table of GPUs and their feature sets can be found on [page 4 here].
-    Most support this feature.
+    Most support this feature,
+    which DeviceInfo reports as NonUniformThreadgroups.
     There has been no testing done on GPUs that don't support it.
-  - This library
-    currently
-    does not support non-standard buffers,
-    such as buffers
-    that are only accessible to the GPU.
-    All buffers
-    are currently created
-    with the same access and performance settings.
+  - The GPUs are initialized
+    the first time that they are needed.
+    On systems without a GPU that metal can use,
+    such as most virtual machines,
+    creating functions, buffers, textures, and batches
+    fails with ErrNoDevice.
+    Available checks for a GPU ahead of time,
+    so that programs can fall back to the CPU.
   - This library
     is intended specifically
     for running computations (as opposed to renderings).
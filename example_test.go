@@ -1,3 +1,6 @@
+//go:build darwin
+// +build darwin
+
 package metal_test
 
 import (
@@ -52,6 +55,27 @@ func ExampleNewBuffer3D() {
 	_ = buffer
 }
 
+func ExampleNewTensor() {
+	// Create a 4-dimensional tensor for a batch of 8 images with 3 channels of 32 x 32 pixels each.
+	// This will allocate 98,304 bytes (8 * 3 * 32 * 32 * sizeof(float32)).
+	tensor, err := metal.NewTensor[float32](8, 3, 32, 32)
+	if err != nil {
+		log.Fatalf("Unable to create tensor: %v", err)
+	}
+
+	// Elements are accessed by their position along every dimension.
+	tensor.Set(1.5, 7, 2, 31, 31)
+
+	// Views share the same buffer without copying any data.
+	image, err := tensor.Slice(0, 7, 8)
+	if err != nil {
+		log.Fatalf("Unable to slice tensor: %v", err)
+	}
+
+	fmt.Println(image.Shape(), image.At(0, 2, 31, 31))
+	// Output: [1 3 32 32] 1.5
+}
+
 func ExampleNewFunction() {
 	source := `
 		#include <metal_stdlib>
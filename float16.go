@@ -0,0 +1,180 @@
+package metal
+
+import (
+	"math"
+	"strconv"
+)
+
+// A Float16 is an IEEE 754 half-precision (binary16) floating-point number. It is the Go
+// equivalent of the metal type half. Go has no native 16-bit float, so the value is stored as its
+// raw bit pattern: 1 sign bit, 5 exponent bits, and 10 mantissa bits.
+//
+// Because a Float16 has the same size as a uint16, it can be used as the type of a metal buffer.
+// Use NewFloat16 and Float32 to convert values to and from float32, which is lossless in the
+// direction of float32.
+type Float16 uint16
+
+const (
+	float16SignMask     = 0x8000
+	float16ExpMask      = 0x7c00
+	float16MantMask     = 0x03ff
+	float16QuietBit     = 0x0200
+	float16MantBits     = 10
+	float16ExpBias      = 15
+	float32ExpBias      = 127
+	float32MantBits     = 23
+	float32MantMask     = 0x007fffff
+	float32ImplicitBit  = 0x00800000
+	float32To16MantDiff = float32MantBits - float16MantBits
+)
+
+// NewFloat16 converts a float32 into the nearest Float16, rounding ties to even. Values too large
+// to be represented become infinity, and values too small become (signed) zero or a subnormal
+// number. NaNs stay NaNs and keep as much of their payload as fits, with the quiet bit set.
+func NewFloat16(f float32) Float16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & float16SignMask
+	exp := int(bits>>float32MantBits) & 0xff
+	mant := bits & float32MantMask
+
+	// Infinity and NaN.
+	if exp == 0xff {
+		if mant == 0 {
+			return Float16(sign | float16ExpMask)
+		}
+		return Float16(sign | float16ExpMask | float16QuietBit | uint16(mant>>float32To16MantDiff))
+	}
+
+	// Rebias the exponent for a Float16.
+	exp = exp - float32ExpBias + float16ExpBias
+
+	switch {
+	case exp >= 0x1f:
+		// The value is too large and overflows to infinity.
+		return Float16(sign | float16ExpMask)
+
+	case exp <= 0:
+		// The value is a subnormal number in half precision (or too small to be anything but
+		// zero). Anything less than half of the smallest subnormal number rounds down to zero.
+		if exp < -float16MantBits {
+			return Float16(sign)
+		}
+
+		// Restore the implicit leading bit and shift the mantissa down into subnormal range.
+		mant |= float32ImplicitBit
+		shift := uint(float32To16MantDiff + 1 - exp)
+		return Float16(sign | uint16(roundShift(mant, shift)))
+
+	default:
+		// The value is a normal number. Rounding can carry into the exponent, which correctly
+		// turns the largest values into infinity.
+		v := uint32(exp)<<float32MantBits | mant
+		return Float16(sign | uint16(roundShift(v, float32To16MantDiff)))
+	}
+}
+
+// roundShift shifts v right by shift bits, rounding the result to the nearest integer with ties
+// going to the even value.
+func roundShift(v uint32, shift uint) uint32 {
+	half := uint32(1) << (shift - 1)
+	rem := v & (1<<shift - 1)
+	v >>= shift
+
+	if rem > half || (rem == half && v&1 == 1) {
+		v++
+	}
+
+	return v
+}
+
+// Float32 converts the Float16 into a float32. Every Float16 value, including subnormal numbers,
+// infinities, and NaNs, is exactly representable as a float32, so this never loses precision.
+func (h Float16) Float32() float32 {
+	sign := uint32(h&float16SignMask) << 16
+	exp := int(h&float16ExpMask) >> float16MantBits
+	mant := uint32(h & float16MantMask)
+
+	switch exp {
+	case 0x1f:
+		// Infinity and NaN. The NaN payload is carried over as is.
+		return math.Float32frombits(sign | 0xff<<float32MantBits | mant<<float32To16MantDiff)
+
+	case 0:
+		if mant == 0 {
+			// Signed zero.
+			return math.Float32frombits(sign)
+		}
+
+		// The value is a subnormal number in half precision, but a normal number in single
+		// precision. Shift the mantissa up until the leading bit becomes the implicit bit, and
+		// adjust the exponent to match.
+		exp = 1
+		for mant&(1<<float16MantBits) == 0 {
+			mant <<= 1
+			exp--
+		}
+		mant &= float16MantMask
+	}
+
+	exp = exp + float32ExpBias - float16ExpBias
+
+	return math.Float32frombits(sign | uint32(exp)<<float32MantBits | mant<<float32To16MantDiff)
+}
+
+// IsNaN reports whether the Float16 is "not-a-number".
+func (h Float16) IsNaN() bool {
+	return h&float16ExpMask == float16ExpMask && h&float16MantMask != 0
+}
+
+// IsInf reports whether the Float16 is an infinity, according to sign. If sign > 0, IsInf reports
+// whether the Float16 is positive infinity. If sign < 0, IsInf reports whether the Float16 is
+// negative infinity. If sign == 0, IsInf reports whether the Float16 is either infinity.
+func (h Float16) IsInf(sign int) bool {
+	switch {
+	case h&^float16SignMask != float16ExpMask:
+		return false
+	case sign > 0:
+		return h&float16SignMask == 0
+	case sign < 0:
+		return h&float16SignMask != 0
+	default:
+		return true
+	}
+}
+
+// String returns the Float16 formatted as a float32.
+func (h Float16) String() string {
+	return strconv.FormatFloat(float64(h.Float32()), 'g', -1, 32)
+}
+
+// CopyToFloat16 converts the float32 values in src into Float16 values in dst, such as a metal
+// buffer of type Float16. It works like the built-in copy function: it converts
+// min(len(dst), len(src)) values and returns that number.
+func CopyToFloat16(dst []Float16, src []float32) int {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+
+	for i := 0; i < n; i++ {
+		dst[i] = NewFloat16(src[i])
+	}
+
+	return n
+}
+
+// CopyFromFloat16 converts the Float16 values in src, such as a metal buffer of type Float16, into
+// float32 values in dst. It works like the built-in copy function: it converts
+// min(len(dst), len(src)) values and returns that number.
+func CopyFromFloat16(dst []float32, src []Float16) int {
+	n := len(src)
+	if len(dst) < n {
+		n = len(dst)
+	}
+
+	for i := 0; i < n; i++ {
+		dst[i] = src[i].Float32()
+	}
+
+	return n
+}
@@ -0,0 +1,191 @@
+package metal
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// float16Reference calculates the value of a half-precision bit pattern directly from its
+// definition in the IEEE 754 spec, without any bit manipulation.
+func float16Reference(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1.0
+	}
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	switch exp {
+	case 0x1f:
+		if mant == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	case 0:
+		return sign * math.Ldexp(mant/1024, -14)
+	default:
+		return sign * math.Ldexp(1+mant/1024, exp-15)
+	}
+}
+
+// Test_Float16_Float32 tests that every one of the 65,536 Float16 bit patterns is converted into
+// the exact float32 value it represents.
+func Test_Float16_Float32(t *testing.T) {
+	for i := 0; i <= math.MaxUint16; i++ {
+		h := Float16(i)
+		f := h.Float32()
+		want := float16Reference(uint16(i))
+
+		if math.IsNaN(want) {
+			require.True(t, math.IsNaN(float64(f)), "0x%04x", i)
+			require.True(t, h.IsNaN(), "0x%04x", i)
+			require.False(t, h.IsInf(0), "0x%04x", i)
+
+			// The payload and sign should be carried over.
+			bits := math.Float32bits(f)
+			require.Equal(t, uint32(i&0x3ff), (bits&0x7fffff)>>13, "0x%04x", i)
+			require.Equal(t, uint32(i&0x8000)<<16, bits&0x80000000, "0x%04x", i)
+			continue
+		}
+
+		require.Equal(t, want, float64(f), "0x%04x", i)
+		require.Equal(t, math.Signbit(want), math.Signbit(float64(f)), "0x%04x", i)
+		require.False(t, h.IsNaN(), "0x%04x", i)
+		require.Equal(t, math.IsInf(want, 0), h.IsInf(0), "0x%04x", i)
+		require.Equal(t, math.IsInf(want, 1), h.IsInf(1), "0x%04x", i)
+		require.Equal(t, math.IsInf(want, -1), h.IsInf(-1), "0x%04x", i)
+	}
+}
+
+// Test_NewFloat16_roundTrip tests that converting every one of the 65,536 Float16 bit patterns to
+// a float32 and back results in the same bit pattern.
+func Test_NewFloat16_roundTrip(t *testing.T) {
+	for i := 0; i <= math.MaxUint16; i++ {
+		h := Float16(i)
+		got := NewFloat16(h.Float32())
+
+		if h.IsNaN() {
+			// Signaling NaNs are quieted, but otherwise keep their sign and payload.
+			require.Equal(t, h|0x0200, got, "0x%04x", i)
+			continue
+		}
+
+		require.Equal(t, h, got, "0x%04x", i)
+	}
+}
+
+// Test_NewFloat16_rounding tests that float32 values between two adjacent Float16 values are
+// rounded to the nearest one, with ties going to the one with an even mantissa.
+func Test_NewFloat16_rounding(t *testing.T) {
+	// Run through every pair of adjacent finite values, including the pair of the largest finite
+	// value and infinity. Every midpoint is exactly representable as a float32.
+	for i := 0; i < 0x7c00; i++ {
+		for _, sign := range []int{0, 0x8000} {
+			lo := Float16(i | sign)
+			hi := Float16((i + 1) | sign)
+
+			var mid float32
+			if hi.IsInf(0) {
+				// The midpoint between the largest finite value and the next value that would exist
+				// if the exponent were large enough.
+				mid = float32(math.Copysign(65520, float64(lo.Float32())))
+			} else {
+				mid = (lo.Float32() + hi.Float32()) / 2
+			}
+
+			even := lo
+			if lo&1 == 1 {
+				even = hi
+			}
+
+			below := math.Nextafter32(mid, lo.Float32())
+			above := math.Nextafter32(mid, float32(math.Copysign(math.Inf(1), float64(mid))))
+
+			require.Equal(t, even, NewFloat16(mid), "0x%04x: %v", i|sign, mid)
+			require.Equal(t, lo, NewFloat16(below), "0x%04x: %v", i|sign, below)
+			require.Equal(t, hi, NewFloat16(above), "0x%04x: %v", i|sign, above)
+		}
+	}
+}
+
+// Test_NewFloat16_special tests that NewFloat16 handles values at and beyond the edges of the
+// half-precision range.
+func Test_NewFloat16_special(t *testing.T) {
+	type scenario struct {
+		input float32
+		want  Float16
+	}
+
+	for _, s := range []scenario{
+		{0, 0x0000},
+		{float32(math.Copysign(0, -1)), 0x8000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{65504, 0x7bff},
+		{-65504, 0xfbff},
+		{65519.99, 0x7bff},
+		{65520, 0x7c00},
+		{1e10, 0x7c00},
+		{-1e10, 0xfc00},
+		{math.MaxFloat32, 0x7c00},
+		{float32(math.Inf(1)), 0x7c00},
+		{float32(math.Inf(-1)), 0xfc00},
+		{float32(math.Ldexp(1, -14)), 0x0400},   // smallest normal
+		{float32(math.Ldexp(1, -24)), 0x0001},   // smallest subnormal
+		{float32(math.Ldexp(1, -25)), 0x0000},   // tie rounds to even (zero)
+		{float32(math.Ldexp(1.5, -25)), 0x0001}, // above the tie
+		{float32(math.Ldexp(-1, -26)), 0x8000},
+		{math.SmallestNonzeroFloat32, 0x0000},
+	} {
+		require.Equal(t, s.want, NewFloat16(s.input), "%v", s.input)
+	}
+
+	// NaNs stay NaNs and keep their sign.
+	nan := NewFloat16(float32(math.NaN()))
+	require.True(t, nan.IsNaN())
+	nan = NewFloat16(-float32(math.NaN()))
+	require.True(t, nan.IsNaN())
+
+	// A NaN whose payload lies entirely in the bits that are dropped must not turn into infinity.
+	nan = NewFloat16(math.Float32frombits(0x7f800001))
+	require.True(t, nan.IsNaN())
+	require.Equal(t, Float16(0x7e00), nan)
+}
+
+// Test_Float16_String tests that a Float16 is formatted as its numeric value.
+func Test_Float16_String(t *testing.T) {
+	require.Equal(t, "1", Float16(0x3c00).String())
+	require.Equal(t, "-2", Float16(0xc000).String())
+	require.Equal(t, "65504", Float16(0x7bff).String())
+	require.Equal(t, "+Inf", Float16(0x7c00).String())
+	require.Equal(t, "NaN", Float16(0x7e00).String())
+}
+
+// Test_CopyFloat16 tests that CopyToFloat16 and CopyFromFloat16 convert slices of values and
+// behave like the built-in copy function.
+func Test_CopyFloat16(t *testing.T) {
+	src := []float32{0, 1, -2, 0.5, 65504, 1e10}
+	halves := make([]Float16, len(src))
+	require.Equal(t, len(src), CopyToFloat16(halves, src))
+	require.Equal(t, []Float16{0x0000, 0x3c00, 0xc000, 0x3800, 0x7bff, 0x7c00}, halves)
+
+	floats := make([]float32, len(halves))
+	require.Equal(t, len(halves), CopyFromFloat16(floats, halves))
+	require.Equal(t, []float32{0, 1, -2, 0.5, 65504, float32(math.Inf(1))}, floats)
+
+	// Shorter destination
+	short := make([]Float16, 2)
+	require.Equal(t, 2, CopyToFloat16(short, src))
+	require.Equal(t, []Float16{0x0000, 0x3c00}, short)
+	shortFloats := make([]float32, 3)
+	require.Equal(t, 3, CopyFromFloat16(shortFloats, halves))
+	require.Equal(t, []float32{0, 1, -2}, shortFloats)
+
+	// Shorter source
+	long := make([]Float16, 10)
+	require.Equal(t, len(src), CopyToFloat16(long, src))
+	require.Equal(t, Float16(0), long[len(src)])
+	require.Equal(t, 0, CopyFromFloat16(nil, halves))
+}
@@ -13,13 +13,16 @@ package metal
 import "C"
 
 import (
+	"errors"
+	"fmt"
+	"runtime"
 	"unsafe"
 )
 
-func init() {
-	// Initialize the device that will be used to run the computations.
-	C.metal_init()
-}
+// ErrBFloat16Unsupported is returned when metal code uses the bfloat types but the version of the
+// Metal Shading Language that it would be compiled with does not support them.
+var ErrBFloat16Unsupported = errors.New("The bfloat types require Metal Shading Language " +
+	bfloatVersion.String() + " or later")
 
 // A FunctionId references a specific metal function created with NewFunction. It is used to run
 // computational processes with that function.
@@ -29,6 +32,25 @@ type FunctionId int
 // specified function in the provided metal code. This needs to be called only once for every
 // function.
 func NewFunction(metalSource, funcName string) (FunctionId, error) {
+	return NewFunctionOnDevice(Device{}, metalSource, funcName)
+}
+
+// NewFunctionOnDevice sets up a new function that will run on the provided device. It works the
+// same way as NewFunction otherwise. The function can only be run with buffers, textures, and
+// samplers on the same device, and it can only be added to batches on the same device.
+func NewFunctionOnDevice(device Device, metalSource, funcName string) (FunctionId, error) {
+	if err := ensureInit(); err != nil {
+		return 0, err
+	}
+
+	// Compiling code that uses bfloat with a language version that doesn't know about it produces a
+	// generic compiler error, so we check for it ourselves and return a more specific one.
+	if usesBFloat(metalSource) {
+		if version := languageVersion(); !version.AtLeast(bfloatVersion) {
+			return 0, fmt.Errorf("Unable to set up metal function: %w (have %s)", ErrBFloat16Unsupported, version)
+		}
+	}
+
 	src := C.CString(metalSource)
 	defer C.free(unsafe.Pointer(src))
 
@@ -38,7 +60,7 @@ func NewFunction(metalSource, funcName string) (FunctionId, error) {
 	err := C.CString("")
 	defer C.free(unsafe.Pointer(err))
 
-	id := int(C.function_new(src, name, &err))
+	id := int(C.function_new(C.int(device.index), src, name, &err))
 	if id == 0 {
 		return 0, metalErrToError(err, "Unable to set up metal function")
 	}
@@ -46,6 +68,12 @@ func NewFunction(metalSource, funcName string) (FunctionId, error) {
 	return FunctionId(id), nil
 }
 
+// languageVersion returns the version of the Metal Shading Language that metal code is compiled
+// with.
+func languageVersion() LanguageVersion {
+	return newLanguageVersion(int(C.metal_language_version()))
+}
+
 // Valid checks whether or not the function Id is valid and can be used to run a computational
 // process on the GPU.
 func (id FunctionId) Valid() bool {
@@ -58,6 +86,12 @@ func (id FunctionId) String() string {
 		return ""
 	}
 
+	done, err := use(int(id))
+	if err != nil {
+		return ""
+	}
+	defer done()
+
 	name := C.function_name(C.int(id))
 
 	return C.GoString(name)
@@ -93,43 +127,199 @@ type Grid struct {
 	Z int
 }
 
+// A Resource is anything that can be supplied as an argument to a metal function, such as a
+// BufferId, a Tensor, a TextureId, or a SamplerId.
+type Resource interface {
+	// binding describes how the resource is supplied to the metal function.
+	binding() binding
+}
+
+// A binding describes how a resource is supplied as an argument to a metal function.
+type binding struct {
+	// kind is the kind of argument. Buffers, textures, and samplers are numbered separately.
+	kind argumentKind
+
+	bufferId  BufferId
+	textureId TextureId
+	samplerId SamplerId
+
+	// offset is where the argument starts in the buffer, in bytes.
+	offset uint64
+
+	// length is the number of bytes in the argument. 0 means the rest of the buffer after offset.
+	length uint64
+
+	// uses lists the buffers that an argument buffer references. Metal must be told that the
+	// function uses them, because they aren't arguments themselves.
+	uses []BufferId
+}
+
+// An argumentKind is one of the kinds of arguments that a metal function takes.
+type argumentKind int
+
+const (
+	bufferArgument argumentKind = iota
+	textureArgument
+	samplerArgument
+)
+
+// binding supplies the entire buffer to the metal function.
+func (id BufferId) binding() binding {
+	return binding{bufferId: id}
+}
+
 // Run executes the computational function on the GPU. buffers is a list of buffers that have a
 // buffer Id, which is used to retrieve the correct block of memory for the buffer. Each buffer is
 // supplied as an argument to the metal function in the order given here. This can be called
 // multiple times for the same Function Id and/or same buffers and is safe for concurrent use.
+//
+// Use RunResources to supply views, tensors, textures, samplers, and other resources.
 func (id FunctionId) Run(grid Grid, buffers ...BufferId) error {
+	resources := make([]Resource, len(buffers))
+	for i, buffer := range buffers {
+		resources[i] = buffer
+	}
+
+	return id.RunResources(grid, resources...)
+}
+
+// RunResources executes the computational function on the GPU, the same way as Run. resources is a
+// list of buffers or other resources backed by a buffer, such as BufferViews, Tensors, and
+// ManagedBuffers, which are supplied as arguments to the metal function in the order given here.
+//
+// Textures and samplers can be mixed in with the buffers. Metal numbers them separately from the
+// buffers, so the first texture in resources is bound at [[texture(0)]], the second at
+// [[texture(1)]], and so on, and the same goes for samplers at [[sampler(n)]]. Buffers keep their
+// [[buffer(n)]] indexes no matter where the textures and samplers are in the list.
+func (id FunctionId) RunResources(grid Grid, resources ...Resource) error {
+	d, err := newDispatch(grid, resources)
+	if err != nil {
+		return fmt.Errorf("Unable to run metal function: %w", err)
+	}
+
+	// Objects of a Context can't be released while the function uses them.
+	done, err := useResources(id, resources)
+	if err != nil {
+		return fmt.Errorf("Unable to run metal function: %w", err)
+	}
+	defer done()
 
-	// Make a list of buffer Ids.
-	var bufferIds []C.int
-	for _, buffer := range buffers {
-		bufferIds = append(bufferIds, C.int(buffer))
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	// Run the computation on the GPU.
+	ok := C.function_run(C.int(id), d.width, d.height, d.depth, d.bufferPtr(), d.offsetPtr(), C.int(len(d.bufferIds)), d.texturePtr(), C.int(len(d.textureIds)), d.samplerPtr(), C.int(len(d.samplerIds)), d.residentPtr(), C.int(len(d.residentIds)), &metalErr)
+
+	// Resources such as ManagedBuffers must not be released while the GPU is still using them.
+	runtime.KeepAlive(resources)
+
+	if !ok {
+		return metalErrToError(metalErr, "Unable to run metal function")
 	}
 
-	// Get a pointer to the beginning of the list of buffer Ids (if we have any).
-	var bufferPtr *C.int
-	if len(bufferIds) > 0 {
-		bufferPtr = &bufferIds[0]
+	return nil
+}
+
+// A dispatch holds the arguments that metal needs to run a function.
+type dispatch struct {
+	bufferIds     []C.int
+	bufferOffsets []C.ulonglong
+	textureIds    []C.int
+	samplerIds    []C.int
+	residentIds   []C.int
+
+	width, height, depth C.int
+}
+
+// newDispatch converts the grid and resources that a function is run with into the arguments that
+// metal needs.
+func newDispatch(grid Grid, resources []Resource) (dispatch, error) {
+	var d dispatch
+
+	// Make a list of buffer Ids and where each one starts, and lists of texture and sampler Ids.
+	for i, resource := range resources {
+		if resource == nil {
+			return dispatch{}, fmt.Errorf("Missing resource %d", i+1)
+		}
+
+		b := resource.binding()
+		switch b.kind {
+		case textureArgument:
+			d.textureIds = append(d.textureIds, C.int(b.textureId))
+		case samplerArgument:
+			d.samplerIds = append(d.samplerIds, C.int(b.samplerId))
+		default:
+			d.bufferIds = append(d.bufferIds, C.int(b.bufferId))
+			d.bufferOffsets = append(d.bufferOffsets, C.ulonglong(b.offset))
+		}
+		for _, id := range b.uses {
+			d.residentIds = append(d.residentIds, C.int(id))
+		}
+	}
+	if err := checkArgumentCounts(len(d.bufferIds), len(d.samplerIds)); err != nil {
+		return dispatch{}, err
 	}
 
 	// Set up the dimensions of the grid. Every dimension must be at least one unit long.
-	width, height, depth := C.int(grid.X), C.int(grid.Y), C.int(grid.Z)
-	if width < 1 {
-		width = 1
+	d.width, d.height, d.depth = C.int(grid.X), C.int(grid.Y), C.int(grid.Z)
+	if d.width < 1 {
+		d.width = 1
 	}
-	if height < 1 {
-		height = 1
+	if d.height < 1 {
+		d.height = 1
 	}
-	if depth < 1 {
-		depth = 1
+	if d.depth < 1 {
+		d.depth = 1
 	}
 
-	err := C.CString("")
-	defer C.free(unsafe.Pointer(err))
+	return d, nil
+}
 
-	// Run the computation on the GPU.
-	if ok := C.function_run(C.int(id), width, height, depth, bufferPtr, C.int(len(bufferIds)), &err); !ok {
-		return metalErrToError(err, "Unable to run metal function")
+// bufferPtr returns a pointer to the beginning of the list of buffer Ids, or nil if there are none.
+func (d dispatch) bufferPtr() *C.int {
+	if len(d.bufferIds) == 0 {
+		return nil
 	}
 
-	return nil
+	return &d.bufferIds[0]
+}
+
+// offsetPtr returns a pointer to the beginning of the list of buffer offsets, or nil if there are
+// none.
+func (d dispatch) offsetPtr() *C.ulonglong {
+	if len(d.bufferOffsets) == 0 {
+		return nil
+	}
+
+	return &d.bufferOffsets[0]
+}
+
+// texturePtr returns a pointer to the beginning of the list of texture Ids, or nil if there are
+// none.
+func (d dispatch) texturePtr() *C.int {
+	if len(d.textureIds) == 0 {
+		return nil
+	}
+
+	return &d.textureIds[0]
+}
+
+// samplerPtr returns a pointer to the beginning of the list of sampler Ids, or nil if there are
+// none.
+func (d dispatch) samplerPtr() *C.int {
+	if len(d.samplerIds) == 0 {
+		return nil
+	}
+
+	return &d.samplerIds[0]
+}
+
+// residentPtr returns a pointer to the beginning of the list of buffers that argument buffers
+// reference, or nil if there are none.
+func (d dispatch) residentPtr() *C.int {
+	if len(d.residentIds) == 0 {
+		return nil
+	}
+
+	return &d.residentIds[0]
 }
@@ -5,11 +5,10 @@
 // https://developer.apple.com/documentation/metal/performing_calculations_on_a_gpu.
 
 #include "cache.h"
+#include "device.h"
 #include "error.h"
 #import <Metal/Metal.h>
 
-extern id<MTLDevice> device;
-
 // Structure of various metal resources needed to execute a computational
 // process on the GPU. We have to bundle this in a header that cgo doesn't
 // import because of a bug in LLVM that leads to a compilation error of "struct
@@ -21,11 +20,11 @@ typedef struct {
 } _function;
 
 // Set up a new pipeline for executing the specified function in the provided
-// MTL code on the default GPU. This returns an Id that must be used to actually
-// run the function. This should be called only once for every function. If any
-// error is encountered initializing the metal function, this returns 0 and sets
-// an error message in error.
-int function_new(const char *metalCode, const char *funcName,
+// MTL code on the GPU with the provided index (see device_get). This returns an
+// Id that must be used to actually run the function. This should be called only
+// once for every function. If any error is encountered initializing the metal
+// function, this returns 0 and sets an error message in error.
+int function_new(int deviceIndex, const char *metalCode, const char *funcName,
                  const char **error) {
   if (strlen(metalCode) == 0) {
     logError(error, @"Missing metal code");
@@ -36,6 +35,12 @@ int function_new(const char *metalCode, const char *funcName,
     return 0;
   }
 
+  id<MTLDevice> device = device_get(deviceIndex);
+  if (device == nil) {
+    logError(error, @"Failed to find device");
+    return 0;
+  }
+
   // Set up a new function object to hold the various resources for the
   // pipeline.
   _function *function = malloc(sizeof(_function));
@@ -102,27 +107,22 @@ int function_new(const char *metalCode, const char *funcName,
   return functionId;
 }
 
-// Execute the computational process on the GPU. Each buffer is supplied as an
-// argument to the metal code in the same order as the buffer Ids here. This is
-// not thread-safe. If any error is encountered running the metal function, this
-// returns false and sets an error message in error.
-_Bool function_run(int functionId, int width, int height, int depth,
-                   int *bufferIds, int numBufferIds, const char **error) {
-  // Fetch the function from the cache.
-  _function *function = cache_retrieve(functionId);
-  if (function == nil) {
-    logError(error, @"Failed to retrieve function");
-    return false;
-  }
-
-  // Create a command buffer from the command queue in the pipeline. This will
-  // hold the processing commands and move through the queue to the GPU.
-  id<MTLCommandBuffer> commandBuffer = [function->commandQueue commandBuffer];
-  if (commandBuffer == nil) {
-    logError(error, @"Failed to set up command buffer");
-    return false;
-  }
-
+// Encode the commands to execute the computational process into a command
+// buffer. Each buffer is supplied as an argument to the metal code in the same
+// order as the buffer Ids here, starting at the corresponding offset (in bytes)
+// into the buffer. Textures and samplers are supplied the same way, in the
+// order of their Ids, at their own argument indexes. The resident buffers are
+// the ones that argument buffers reference, which the function uses without
+// them being arguments themselves. If any error is encountered, this returns
+// false and sets an error message in error.
+static _Bool encode_function(id<MTLCommandBuffer> commandBuffer,
+                             _function *function, int width, int height,
+                             int depth, int *bufferIds,
+                             unsigned long long *bufferOffsets,
+                             int numBufferIds, int *textureIds,
+                             int numTextureIds, int *samplerIds,
+                             int numSamplerIds, int *residentIds,
+                             int numResidentIds, const char **error) {
   // Set up an encoder to actually write the (compute pass) commands and
   // parameters to the command buffer we just created.
   id<MTLComputeCommandEncoder> encoder = [commandBuffer computeCommandEncoder];
@@ -136,9 +136,9 @@ _Bool function_run(int functionId, int width, int height, int depth,
 
   // Set the buffers that will be passed as the arguments to the function. The
   // indexes for the buffers here need to match their order in the function
-  // declaration. We currently only support using the entire buffer without any
-  // offsets, which could be used to, say, use one part of a buffer for one
-  // function argument and the other part for a different argument.
+  // declaration. A buffer can start at an offset, which can be used to, say,
+  // use one part of a buffer for one function argument and the other part for a
+  // different argument.
   for (int i = 0; i < numBufferIds; i++) {
     // Retrieve the buffer for this Id.
     id<MTLBuffer> buffer = cache_retrieve(bufferIds[i]);
@@ -148,11 +148,120 @@ _Bool function_run(int functionId, int width, int height, int depth,
           [NSString
               stringWithFormat:@"Failed to retrieve buffer %d/%d using Id %d",
                                i + 1, numBufferIds, bufferIds[i]]);
+      [encoder endEncoding];
+      return false;
+    }
+
+    // Metal can't use a buffer on one GPU in a function on another.
+    if (!device_same([buffer device], [function->pipeline device])) {
+      logError(error, [NSString stringWithFormat:@"Buffer %d/%d is on a "
+                                                 @"different device than the "
+                                                 @"function",
+                                                 i + 1, numBufferIds]);
+      [encoder endEncoding];
       return false;
     }
 
+    // Make sure the offset is inside the buffer.
+    if (bufferOffsets[i] >= [buffer length]) {
+      logError(error,
+               [NSString stringWithFormat:@"Offset %llu for buffer %d/%d is "
+                                          @"outside of the buffer",
+                                          bufferOffsets[i], i + 1,
+                                          numBufferIds]);
+      [encoder endEncoding];
+      return false;
+    }
+
+    // Managed buffers have a separate copy for the CPU. Any changes the CPU made
+    // to it need to be sent to the GPU first.
+    if ([buffer storageMode] == MTLStorageModeManaged) {
+      [buffer didModifyRange:NSMakeRange(0, [buffer length])];
+    }
+
     // Add the buffer to the command with the appropriate index.
-    [encoder setBuffer:buffer offset:0 atIndex:i];
+    [encoder setBuffer:buffer offset:bufferOffsets[i] atIndex:i];
+  }
+
+  // Set the textures and samplers, which have their own indexes, separate from
+  // the buffers' ([[texture(n)]] and [[sampler(n)]] in the function
+  // declaration).
+  for (int i = 0; i < numTextureIds; i++) {
+    id<MTLTexture> texture = cache_retrieve(textureIds[i]);
+    if (texture == nil) {
+      logError(
+          error,
+          [NSString
+              stringWithFormat:@"Failed to retrieve texture %d/%d using Id %d",
+                               i + 1, numTextureIds, textureIds[i]]);
+      [encoder endEncoding];
+      return false;
+    }
+
+    if (!device_same([texture device], [function->pipeline device])) {
+      logError(error, [NSString stringWithFormat:@"Texture %d/%d is on a "
+                                                 @"different device than the "
+                                                 @"function",
+                                                 i + 1, numTextureIds]);
+      [encoder endEncoding];
+      return false;
+    }
+
+    [encoder setTexture:texture atIndex:i];
+  }
+  for (int i = 0; i < numSamplerIds; i++) {
+    id<MTLSamplerState> sampler = cache_retrieve(samplerIds[i]);
+    if (sampler == nil) {
+      logError(
+          error,
+          [NSString
+              stringWithFormat:@"Failed to retrieve sampler %d/%d using Id %d",
+                               i + 1, numSamplerIds, samplerIds[i]]);
+      [encoder endEncoding];
+      return false;
+    }
+
+    if (!device_same([sampler device], [function->pipeline device])) {
+      logError(error, [NSString stringWithFormat:@"Sampler %d/%d is on a "
+                                                 @"different device than the "
+                                                 @"function",
+                                                 i + 1, numSamplerIds]);
+      [encoder endEncoding];
+      return false;
+    }
+
+    [encoder setSamplerState:sampler atIndex:i];
+  }
+
+  // Buffers that are only referenced through argument buffers aren't bound to
+  // the function, so metal needs to be told that the function uses them.
+  for (int i = 0; i < numResidentIds; i++) {
+    id<MTLBuffer> buffer = cache_retrieve(residentIds[i]);
+    if (buffer == nil) {
+      logError(error, [NSString stringWithFormat:@"Failed to retrieve buffer "
+                                                 @"%d/%d in argument buffers "
+                                                 @"using Id %d",
+                                                 i + 1, numResidentIds,
+                                                 residentIds[i]]);
+      [encoder endEncoding];
+      return false;
+    }
+
+    if (!device_same([buffer device], [function->pipeline device])) {
+      logError(error, [NSString stringWithFormat:@"Buffer %d/%d in argument "
+                                                 @"buffers is on a different "
+                                                 @"device than the function",
+                                                 i + 1, numResidentIds]);
+      [encoder endEncoding];
+      return false;
+    }
+
+    if ([buffer storageMode] == MTLStorageModeManaged) {
+      [buffer didModifyRange:NSMakeRange(0, [buffer length])];
+    }
+
+    [encoder useResource:buffer
+                   usage:MTLResourceUsageRead | MTLResourceUsageWrite];
   }
 
   // Specify how many threads we need to perform all the calculations (one
@@ -189,6 +298,114 @@ _Bool function_run(int functionId, int width, int height, int depth,
   // function.
   [encoder endEncoding];
 
+  // Copy any changes the function made to managed buffers back to the CPU's copy.
+  id<MTLBlitCommandEncoder> blitEncoder = nil;
+  for (int i = 0; i < numBufferIds; i++) {
+    id<MTLBuffer> buffer = cache_retrieve(bufferIds[i]);
+    if ([buffer storageMode] != MTLStorageModeManaged) {
+      continue;
+    }
+    if (blitEncoder == nil) {
+      blitEncoder = [commandBuffer blitCommandEncoder];
+      if (blitEncoder == nil) {
+        logError(error, @"Failed to set up blit encoder");
+        return false;
+      }
+    }
+    [blitEncoder synchronizeResource:buffer];
+  }
+  for (int i = 0; i < numTextureIds; i++) {
+    id<MTLTexture> texture = cache_retrieve(textureIds[i]);
+    if ([texture storageMode] != MTLStorageModeManaged) {
+      continue;
+    }
+    if (blitEncoder == nil) {
+      blitEncoder = [commandBuffer blitCommandEncoder];
+      if (blitEncoder == nil) {
+        logError(error, @"Failed to set up blit encoder");
+        return false;
+      }
+    }
+    [blitEncoder synchronizeResource:texture];
+  }
+  for (int i = 0; i < numResidentIds; i++) {
+    id<MTLBuffer> buffer = cache_retrieve(residentIds[i]);
+    if ([buffer storageMode] != MTLStorageModeManaged) {
+      continue;
+    }
+    if (blitEncoder == nil) {
+      blitEncoder = [commandBuffer blitCommandEncoder];
+      if (blitEncoder == nil) {
+        logError(error, @"Failed to set up blit encoder");
+        return false;
+      }
+    }
+    [blitEncoder synchronizeResource:buffer];
+  }
+  [blitEncoder endEncoding];
+
+  return true;
+}
+
+// Encode the commands to execute the computational process with the provided
+// function Id into a command buffer, which can be committed along with other
+// commands. This works the same way as function_run otherwise.
+_Bool function_encode(id<MTLCommandBuffer> commandBuffer, int functionId,
+                      int width, int height, int depth, int *bufferIds,
+                      unsigned long long *bufferOffsets, int numBufferIds,
+                      int *textureIds, int numTextureIds, int *samplerIds,
+                      int numSamplerIds, int *residentIds, int numResidentIds,
+                      const char **error) {
+  // Fetch the function from the cache.
+  _function *function = cache_retrieve(functionId);
+  if (function == nil) {
+    logError(error, @"Failed to retrieve function");
+    return false;
+  }
+  if (!device_same([commandBuffer device], [function->pipeline device])) {
+    logError(error, @"Function is on a different device than the batch");
+    return false;
+  }
+
+  return encode_function(commandBuffer, function, width, height, depth,
+                         bufferIds, bufferOffsets, numBufferIds, textureIds,
+                         numTextureIds, samplerIds, numSamplerIds, residentIds,
+                         numResidentIds, error);
+}
+
+// Execute the computational process on the GPU. Each buffer is supplied as an
+// argument to the metal code in the same order as the buffer Ids here, starting
+// at the corresponding offset (in bytes) into the buffer, and so are the
+// textures and samplers. This is not thread-safe. If any error is encountered
+// running the metal function, this returns false and sets an error message in
+// error.
+_Bool function_run(int functionId, int width, int height, int depth,
+                   int *bufferIds, unsigned long long *bufferOffsets,
+                   int numBufferIds, int *textureIds, int numTextureIds,
+                   int *samplerIds, int numSamplerIds, int *residentIds,
+                   int numResidentIds, const char **error) {
+  // Fetch the function from the cache.
+  _function *function = cache_retrieve(functionId);
+  if (function == nil) {
+    logError(error, @"Failed to retrieve function");
+    return false;
+  }
+
+  // Create a command buffer from the command queue in the pipeline. This will
+  // hold the processing commands and move through the queue to the GPU.
+  id<MTLCommandBuffer> commandBuffer = [function->commandQueue commandBuffer];
+  if (commandBuffer == nil) {
+    logError(error, @"Failed to set up command buffer");
+    return false;
+  }
+
+  if (!encode_function(commandBuffer, function, width, height, depth,
+                       bufferIds, bufferOffsets, numBufferIds, textureIds,
+                       numTextureIds, samplerIds, numSamplerIds, residentIds,
+                       numResidentIds, error)) {
+    return false;
+  }
+
   // Commit the command buffer to the command queue so that it gets picked up
   // and run on the GPU, and then wait for the calculations to finish.
   [commandBuffer commit];
@@ -197,6 +414,17 @@ _Bool function_run(int functionId, int width, int height, int depth,
   return true;
 }
 
+// Get the metal function with the provided function Id, or nil on error. This
+// is used to set up argument buffers for the function's arguments.
+id<MTLFunction> function_retrieve(int functionId) {
+  _function *function = cache_retrieve(functionId);
+  if (function == nil) {
+    return nil;
+  }
+
+  return function->function;
+}
+
 // Get the name of the metal function with the provided function Id, or nil on
 // error.
 const char *function_name(int functionId) {
@@ -208,4 +436,19 @@ const char *function_name(int functionId) {
   }
 
   return [[function->function name] UTF8String];
-}
\ No newline at end of file
+}
+
+// Release the metal function with the provided function Id, along with its
+// pipeline and command queue. The function Id can't be used after this.
+void function_release(int functionId) {
+  _function *function = cache_retrieve(functionId);
+  if (function == nil) {
+    return;
+  }
+
+  cache_remove(functionId);
+  [function->commandQueue release];
+  [function->pipeline release];
+  [function->function release];
+  free(function);
+}
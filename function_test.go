@@ -29,6 +29,8 @@ var (
 	sourceSine string
 	//go:embed test/transferType.metal
 	sourceTransferType string
+	//go:embed test/particles.metal
+	sourceParticles string
 )
 
 var (
@@ -40,7 +42,7 @@ var (
 )
 
 // validId tests that the Id has the expected value.
-func validId[T FunctionId | BufferId](id T) bool {
+func validId[T FunctionId | BufferId | TextureId | SamplerId](id T) bool {
 	ok := int(id) == nextMetalId
 	if ok {
 		nextMetalId++
@@ -398,6 +400,95 @@ func Test_FunctionId_Run_3D(t *testing.T) {
 	}
 }
 
+// Test_FunctionId_Run_struct tests that FunctionId's Run method correctly runs a metal function
+// with a buffer of structs.
+func Test_FunctionId_Run_struct(t *testing.T) {
+	type Particle struct {
+		Pos  Float3
+		Mass float32
+		_    [3]float32
+	}
+
+	// Generate the struct declaration from the Go type.
+	decl, err := MSLStruct[Particle]()
+	require.Nil(t, err, "Unable to generate metal struct: %s", err)
+
+	functionId, err := NewFunction(fmt.Sprintf(sourceParticles, decl), "particles")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(functionId))
+
+	bufferId, buffer, err := NewStructBuffer1D[Particle](100)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+
+	for i := range buffer {
+		buffer[i].Pos = Float3{X: float32(i), Y: 1, Z: -2}
+		buffer[i].Mass = float32(i % 4)
+	}
+
+	err = functionId.Run(Grid{X: len(buffer)}, bufferId)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+
+	for i := range buffer {
+		mass := float32(i % 4)
+		require.Equal(t, float32(i)*mass, buffer[i].Pos.X)
+		require.Equal(t, mass, buffer[i].Pos.Y)
+		require.Equal(t, -2*mass, buffer[i].Pos.Z)
+		require.Equal(t, mass+1, buffer[i].Mass)
+	}
+}
+
+// Test_FunctionId_Run_view tests that FunctionId's Run method correctly supplies views of a buffer
+// to a metal function.
+func Test_FunctionId_Run_view(t *testing.T) {
+	functionId, err := NewFunction(sourceTransfer1D, "transfer1D")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(functionId))
+
+	// Pack the input and the output into one buffer.
+	width := 1_000
+	bufferId, buffer, err := NewBuffer1D[float32](width * 2)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+
+	inputView, input, err := View[float32](bufferId, 0, width)
+	require.Nil(t, err, "Unable to create view: %s", err)
+	outputView, output, err := View[float32](bufferId, width, width)
+	require.Nil(t, err, "Unable to create view: %s", err)
+
+	for i := range input {
+		input[i] = float32(i) * 1.1
+	}
+
+	err = functionId.RunResources(Grid{X: width}, inputView, outputView)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+	require.Equal(t, input, output)
+	require.Equal(t, buffer[:width], buffer[width:])
+
+	// Process the buffer in windows to shift all of its contents over by one window. This goes
+	// backwards so that every window of input is read before it is overwritten.
+	for i := range buffer {
+		buffer[i] = float32(i)
+	}
+	window := 100
+	for start := len(buffer) - 2*window; start >= 0; start -= window {
+		inputView, _, err := View[float32](bufferId, start, window)
+		require.Nil(t, err, "Unable to create view: %s", err)
+		outputView, _, err := View[float32](bufferId, start+window, window)
+		require.Nil(t, err, "Unable to create view: %s", err)
+
+		err = functionId.RunResources(Grid{X: window}, inputView, outputView)
+		require.Nil(t, err, "Unable to run metal function: %s", err)
+	}
+	for i := range buffer {
+		if i < window {
+			require.Equal(t, float32(i), buffer[i])
+		} else {
+			require.Equal(t, float32(i-window), buffer[i])
+		}
+	}
+}
+
 // Test_FunctionId_Run_threadSafe tests that FunctionId's Run method can handle multiple parallel
 // invocations and still operate on the correct set of buffers.
 func Test_FunctionId_Run_threadSafe(t *testing.T) {
@@ -475,17 +566,35 @@ func Test_FunctionId_types(t *testing.T) {
 	for _, metalType := range []string{
 		"float",
 		"half",
+		"bfloat",
 		"int",
 		"short",
 		"uint",
 		"ushort",
+		"float2",
+		"float3",
+		"packed_float3",
+		"half4",
+		"int4",
+		"uint3",
 	} {
 		switch metalType {
 		case "float":
 			testType[float32](t, metalType, false, func(i int) float32 { return float32(i) * 1.1 })
 			testType[float64](t, metalType, true, func(i int) float64 { return float64(i) * 1.1 })
 		case "half":
-			// Go doesn't currently have an equivalent "float16" type
+			testType[Float16](t, metalType, false, func(i int) Float16 { return NewFloat16(float32(i) * 1.1) })
+			testType[float32](t, metalType, true, func(i int) float32 { return float32(i) * 1.1 })
+		case "bfloat":
+			if !languageVersion().AtLeast(bfloatVersion) {
+				// This version of the OS can't compile bfloat, so we should get the error for that.
+				source := fmt.Sprintf(sourceTransferType, metalType, metalType)
+				functionId, err := NewFunction(source, "transferType")
+				require.ErrorIs(t, err, ErrBFloat16Unsupported)
+				require.Equal(t, FunctionId(0), functionId)
+				continue
+			}
+			testType[BFloat16](t, metalType, false, func(i int) BFloat16 { return NewBFloat16(float32(i) * 1.1) })
 			testType[float32](t, metalType, true, func(i int) float32 { return float32(i) * 1.1 })
 		case "int":
 			testType[int32](t, metalType, false, func(i int) int32 { return int32(-i) })
@@ -499,6 +608,20 @@ func Test_FunctionId_types(t *testing.T) {
 		case "ushort":
 			testType[uint16](t, metalType, false, func(i int) uint16 { return uint16(i) })
 			testType[uint32](t, metalType, true, func(i int) uint32 { return uint32(i) })
+		case "float2":
+			testType[Float2](t, metalType, false, func(i int) Float2 { return Float2{X: float32(i), Y: -1.1} })
+		case "float3":
+			testType[Float3](t, metalType, false, func(i int) Float3 { return Float3{X: float32(i), Y: -1.1, Z: 2.2} })
+		case "packed_float3":
+			// A float3 is padded to 16 bytes, so it shouldn't line up with the packed type.
+			testType[PackedFloat3](t, metalType, false, func(i int) PackedFloat3 { return PackedFloat3{X: float32(i), Y: -1.1, Z: 2.2} })
+			testType[Float3](t, metalType, true, func(i int) Float3 { return Float3{X: float32(i), Y: -1.1, Z: 2.2} })
+		case "half4":
+			testType[Half4](t, metalType, false, func(i int) Half4 { return Half4{X: NewFloat16(float32(i)), W: NewFloat16(-1.5)} })
+		case "int4":
+			testType[Int4](t, metalType, false, func(i int) Int4 { return Int4{X: int32(-i), Y: 1, Z: 2, W: 3} })
+		case "uint3":
+			testType[UInt3](t, metalType, false, func(i int) UInt3 { return UInt3{X: uint32(i), Y: 1, Z: 2} })
 		}
 	}
 }
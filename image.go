@@ -0,0 +1,260 @@
+package metal
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// An ImageType is a type that can hold the channels of an image in a tensor. A uint8 holds a
+// channel from 0 to 255, and a float32 holds a normalized channel from 0 to 1.
+type ImageType interface {
+	uint8 | float32
+}
+
+// An ImageLayout is the order in which the pixels of an image are laid out in a tensor.
+type ImageLayout int
+
+const (
+	// ImageInterleaved keeps the channels of every pixel together, so the tensor has the shape
+	// (height, width, channels). This is how image.RGBA and most image formats lay out pixels.
+	ImageInterleaved ImageLayout = iota
+
+	// ImagePlanar keeps every channel in a separate plane, so the tensor has the shape (channels,
+	// height, width). Many machine learning models expect this layout.
+	ImagePlanar
+)
+
+// ImageOptions describes how the pixels of an image are laid out in a tensor.
+type ImageOptions struct {
+	// Channels is the number of channels for every pixel: 1 for gray, 3 for red, green, and blue,
+	// or 4 for red, green, blue, and alpha. The default of 0 uses 1 for gray images and 4 for all
+	// other images. Colors are never premultiplied by alpha.
+	Channels int
+
+	// Layout is the order of the pixels in the tensor. The default is ImageInterleaved.
+	Layout ImageLayout
+}
+
+// check checks that the options are valid and returns the number of channels to use for img.
+func (o ImageOptions) check(img image.Image) (int, error) {
+	if o.Layout != ImageInterleaved && o.Layout != ImagePlanar {
+		return 0, errors.New("Invalid image layout")
+	}
+
+	switch o.Channels {
+	case 0:
+		if model := img.ColorModel(); model == color.GrayModel || model == color.Gray16Model {
+			return 1, nil
+		}
+		return 4, nil
+	case 1, 3, 4:
+		return o.Channels, nil
+	}
+
+	return 0, fmt.Errorf("Unsupported number of channels %d", o.Channels)
+}
+
+// imageShape returns the shape of a tensor that holds an image with the provided dimensions and
+// number of channels in the provided layout.
+func imageShape(width, height, channels int, layout ImageLayout) []int {
+	if layout == ImagePlanar {
+		return []int{channels, height, width}
+	}
+
+	return []int{height, width, channels}
+}
+
+// imageStrides returns the number of elements to skip to move one pixel down, one pixel right, and
+// one channel along in a contiguous tensor with the provided layout.
+func imageStrides(width, height, channels int, layout ImageLayout) (yStride, xStride, cStride int) {
+	if layout == ImagePlanar {
+		return width, 1, width * height
+	}
+
+	return width * channels, channels, 1
+}
+
+// imagePixels copies the pixels of img into dst, which is a contiguous tensor with the shape from
+// imageShape.
+func imagePixels[T ImageType](img image.Image, channels int, layout ImageLayout, dst []T) {
+	b := img.Bounds()
+	yStride, xStride, cStride := imageStrides(b.Dx(), b.Dy(), channels, layout)
+
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			i := y*yStride + x*xStride
+
+			if channels == 1 {
+				gray := color.Gray16Model.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray16)
+				dst[i] = fromUint16[T](gray.Y)
+				continue
+			}
+
+			c := nrgba64At(img, b.Min.X+x, b.Min.Y+y)
+			rgba := [4]uint16{c.R, c.G, c.B, c.A}
+			for j, v := range rgba[:channels] {
+				dst[i+j*cStride] = fromUint16[T](v)
+			}
+		}
+	}
+}
+
+// nrgba64At returns the non-premultiplied color of the pixel at (x, y). Images that already store
+// non-premultiplied colors are read directly, because converting through premultiplied colors loses
+// precision for pixels that aren't opaque.
+func nrgba64At(img image.Image, x, y int) color.NRGBA64 {
+	switch img := img.(type) {
+	case *image.NRGBA:
+		c := img.NRGBAAt(x, y)
+		return color.NRGBA64{
+			R: uint16(c.R) * 0x101,
+			G: uint16(c.G) * 0x101,
+			B: uint16(c.B) * 0x101,
+			A: uint16(c.A) * 0x101,
+		}
+	case *image.NRGBA64:
+		return img.NRGBA64At(x, y)
+	}
+
+	return color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+}
+
+// fromUint16 converts a 16-bit channel to a channel of type T.
+func fromUint16[T ImageType](v uint16) T {
+	var t T
+	if _, ok := any(t).(float32); ok {
+		return T(float32(v) / 0xffff)
+	}
+
+	return T(v >> 8)
+}
+
+// toUint16 converts a channel of type T to a 16-bit channel. Normalized channels outside of the
+// range 0 to 1 are clamped.
+func toUint16[T ImageType](v T) uint16 {
+	f, ok := any(v).(float32)
+	if !ok {
+		return uint16(v) * 0x101
+	}
+
+	switch {
+	case !(f > 0):
+		return 0
+	case f >= 1:
+		return 0xffff
+	}
+
+	return uint16(f*0xffff + 0.5)
+}
+
+// newImage wraps the elements of a tensor with the provided offset, shape, and strides as an image.
+// The shape is (height, width) for a gray image, or as described by layout for an image with 1, 3,
+// or 4 channels. The image shares memory with the tensor.
+func newImage[T ImageType](data []T, offset int, shape, strides []int, layout ImageLayout) (image.Image,
+	error) {
+	if layout != ImageInterleaved && layout != ImagePlanar {
+		return nil, errors.New("Invalid image layout")
+	}
+
+	m := &tensorImage[T]{data: data, offset: offset, channels: 1}
+	switch {
+	case len(shape) == 2:
+		m.rect = image.Rect(0, 0, shape[1], shape[0])
+		m.yStride, m.xStride = strides[0], strides[1]
+	case len(shape) == 3 && layout == ImagePlanar:
+		m.channels = shape[0]
+		m.rect = image.Rect(0, 0, shape[2], shape[1])
+		m.cStride, m.yStride, m.xStride = strides[0], strides[1], strides[2]
+	case len(shape) == 3:
+		m.channels = shape[2]
+		m.rect = image.Rect(0, 0, shape[1], shape[0])
+		m.yStride, m.xStride, m.cStride = strides[0], strides[1], strides[2]
+	default:
+		return nil, fmt.Errorf("Image tensor must have 2 or 3 dimensions instead of %d", len(shape))
+	}
+
+	if m.channels != 1 && m.channels != 3 && m.channels != 4 {
+		return nil, fmt.Errorf("Unsupported number of channels %d", m.channels)
+	}
+
+	// Interleaved bytes can be wrapped by the standard library's own image types.
+	pix, ok := any(data).([]uint8)
+	width, height := m.rect.Dx(), m.rect.Dy()
+	if ok && m.xStride == m.channels && m.yStride == width*m.channels && (m.channels == 1 ||
+		m.cStride == 1) {
+		n := width * height * m.channels
+		pix = pix[offset : offset+n : offset+n]
+
+		switch m.channels {
+		case 1:
+			return &image.Gray{Pix: pix, Stride: m.yStride, Rect: m.rect}, nil
+		case 4:
+			return &image.NRGBA{Pix: pix, Stride: m.yStride, Rect: m.rect}, nil
+		}
+	}
+
+	return m, nil
+}
+
+// A tensorImage is an image whose pixels are the elements of a tensor.
+type tensorImage[T ImageType] struct {
+	data                      []T
+	offset                    int
+	channels                  int
+	rect                      image.Rectangle
+	yStride, xStride, cStride int
+}
+
+// ColorModel returns the gray model for images with 1 channel, and the non-premultiplied color
+// model for all other images.
+func (m *tensorImage[T]) ColorModel() color.Model {
+	if m.channels == 1 {
+		return color.Gray16Model
+	}
+
+	return color.NRGBA64Model
+}
+
+// Bounds returns the rectangle that holds the pixels of the image, which starts at (0, 0).
+func (m *tensorImage[T]) Bounds() image.Rectangle {
+	return m.rect
+}
+
+// At returns the color of the pixel at (x, y). Images with 3 channels are opaque.
+func (m *tensorImage[T]) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(m.rect)) {
+		if m.channels == 1 {
+			return color.Gray16{}
+		}
+		return color.NRGBA64{}
+	}
+
+	i := m.offset + y*m.yStride + x*m.xStride
+	channel := func(c int) uint16 {
+		return toUint16(m.data[i+c*m.cStride])
+	}
+
+	switch m.channels {
+	case 1:
+		return color.Gray16{Y: channel(0)}
+	case 3:
+		return color.NRGBA64{R: channel(0), G: channel(1), B: channel(2), A: 0xffff}
+	}
+
+	return color.NRGBA64{R: channel(0), G: channel(1), B: channel(2), A: channel(3)}
+}
+
+// interleavedShape splits the shape of a tensor that holds an interleaved image into its height,
+// width, and number of channels.
+func interleavedShape(shape []int) (height, width, channels int, err error) {
+	switch len(shape) {
+	case 2:
+		return shape[0], shape[1], 1, nil
+	case 3:
+		return shape[0], shape[1], shape[2], nil
+	}
+
+	return 0, 0, 0, fmt.Errorf("Image tensor must have 2 or 3 dimensions instead of %d", len(shape))
+}
@@ -0,0 +1,203 @@
+package metal
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testImage returns a 3x2 image whose pixels are all different, with bounds that don't start at
+// (0, 0).
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(10, 20, 13, 22))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			img.SetNRGBA(10+x, 20+y, color.NRGBA{R: uint8(10 * x), G: uint8(100 + 10*y), B: 255, A: uint8(200 + x + y)})
+		}
+	}
+
+	return img
+}
+
+// Test_ImageOptions_check tests that check picks the number of channels for an image and rejects
+// invalid options.
+func Test_ImageOptions_check(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 1, 1))
+	gray16 := image.NewGray16(image.Rect(0, 0, 1, 1))
+	rgba := image.NewRGBA(image.Rect(0, 0, 1, 1))
+
+	type scenario struct {
+		opts    ImageOptions
+		img     image.Image
+		want    int
+		wantErr string
+	}
+
+	for _, s := range []scenario{
+		{ImageOptions{}, gray, 1, ""},
+		{ImageOptions{}, gray16, 1, ""},
+		{ImageOptions{}, rgba, 4, ""},
+		{ImageOptions{Layout: ImagePlanar}, rgba, 4, ""},
+		{ImageOptions{Channels: 1}, rgba, 1, ""},
+		{ImageOptions{Channels: 3}, gray, 3, ""},
+		{ImageOptions{Channels: 4}, gray, 4, ""},
+		{ImageOptions{Channels: 2}, gray, 0, "Unsupported number of channels 2"},
+		{ImageOptions{Channels: -1}, gray, 0, "Unsupported number of channels -1"},
+		{ImageOptions{Layout: 2}, gray, 0, "Invalid image layout"},
+	} {
+		channels, err := s.opts.check(s.img)
+		if s.wantErr != "" {
+			require.NotNil(t, err)
+			require.Equal(t, s.wantErr, err.Error())
+			continue
+		}
+		require.Nil(t, err, "Unable to check options: %s", err)
+		require.Equal(t, s.want, channels)
+	}
+}
+
+// Test_imagePixels tests that imagePixels lays out the pixels of an image in either layout.
+func Test_imagePixels(t *testing.T) {
+	img := testImage()
+
+	// Interleaved bytes are the same as the pixels of an image.NRGBA.
+	require.Equal(t, []int{2, 3, 4}, imageShape(3, 2, 4, ImageInterleaved))
+	bytes := make([]uint8, 24)
+	imagePixels(img, 4, ImageInterleaved, bytes)
+	require.Equal(t, img.Pix, bytes)
+
+	// Planar channels have every channel on its own.
+	require.Equal(t, []int{3, 2, 3}, imageShape(3, 2, 3, ImagePlanar))
+	planar := make([]uint8, 18)
+	imagePixels(img, 3, ImagePlanar, planar)
+	require.Equal(t, []uint8{
+		0, 10, 20, 0, 10, 20,
+		100, 100, 100, 110, 110, 110,
+		255, 255, 255, 255, 255, 255,
+	}, planar)
+
+	// Floats are normalized.
+	floats := make([]float32, 24)
+	imagePixels(img, 4, ImageInterleaved, floats)
+	require.InDelta(t, 10.0/255, floats[4], 1e-6)
+	require.Equal(t, float32(1), floats[2])
+	require.InDelta(t, 203.0/255, floats[23], 1e-6)
+
+	// A gray channel takes the luminance of color pixels.
+	gray := make([]uint8, 6)
+	imagePixels(img, 1, ImageInterleaved, gray)
+	for i, v := range gray {
+		want := color.GrayModel.Convert(img.At(10+i%3, 20+i/3)).(color.Gray).Y
+		require.InDelta(t, want, v, 1)
+	}
+}
+
+// Test_toUint16 tests that channels are converted to 16 bits and back.
+func Test_toUint16(t *testing.T) {
+	require.Equal(t, uint16(0), toUint16(uint8(0)))
+	require.Equal(t, uint16(0x8080), toUint16(uint8(0x80)))
+	require.Equal(t, uint16(0xffff), toUint16(uint8(0xff)))
+	require.Equal(t, uint16(0), toUint16(float32(0)))
+	require.Equal(t, uint16(0x8000), toUint16(float32(0.5)))
+	require.Equal(t, uint16(0xffff), toUint16(float32(1)))
+	require.Equal(t, uint16(0), toUint16(float32(-2)))
+	require.Equal(t, uint16(0xffff), toUint16(float32(7)))
+	require.Equal(t, uint16(0), toUint16(float32(math.NaN())))
+
+	for i := 0; i < 256; i++ {
+		require.Equal(t, uint8(i), fromUint16[uint8](toUint16(uint8(i))))
+	}
+	require.Equal(t, float32(1), fromUint16[float32](0xffff))
+	require.Equal(t, float32(0), fromUint16[float32](0))
+}
+
+// Test_newImage tests that newImage wraps tensors of every layout as images.
+func Test_newImage(t *testing.T) {
+	img := testImage()
+	b := img.Bounds()
+
+	// Interleaved bytes with 4 channels become an image.NRGBA that shares memory with the tensor.
+	pix := append([]uint8{9, 9}, img.Pix...)
+	shape := imageShape(3, 2, 4, ImageInterleaved)
+	wrapped, err := newImage(pix, 2, shape, contiguousStrides(shape), ImageInterleaved)
+	require.Nil(t, err, "Unable to wrap image: %s", err)
+	nrgba, ok := wrapped.(*image.NRGBA)
+	require.True(t, ok)
+	require.Equal(t, image.Rect(0, 0, 3, 2), nrgba.Bounds())
+	require.Equal(t, &pix[2], &nrgba.Pix[0])
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			require.Equal(t, img.At(b.Min.X+x, b.Min.Y+y), wrapped.At(x, y))
+		}
+	}
+
+	// So do gray bytes.
+	shape = []int{2, 3}
+	wrapped, err = newImage([]uint8{1, 2, 3, 4, 5, 6}, 0, shape, contiguousStrides(shape), ImageInterleaved)
+	require.Nil(t, err, "Unable to wrap image: %s", err)
+	_, ok = wrapped.(*image.Gray)
+	require.True(t, ok)
+	require.Equal(t, color.Gray{Y: 6}, wrapped.At(2, 1))
+
+	// Planar floats are read channel by channel.
+	planar := make([]float32, 24)
+	imagePixels(img, 4, ImagePlanar, planar)
+	shape = imageShape(3, 2, 4, ImagePlanar)
+	wrapped, err = newImage(planar, 0, shape, contiguousStrides(shape), ImagePlanar)
+	require.Nil(t, err, "Unable to wrap image: %s", err)
+	require.Equal(t, color.NRGBA64Model, wrapped.ColorModel())
+	require.Equal(t, image.Rect(0, 0, 3, 2), wrapped.Bounds())
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			require.Equal(t, nrgba64At(img, b.Min.X+x, b.Min.Y+y), wrapped.At(x, y))
+		}
+	}
+	require.Equal(t, color.NRGBA64{}, wrapped.At(3, 0))
+
+	// Images with 3 channels are opaque.
+	rgb := make([]uint8, 18)
+	imagePixels(img, 3, ImageInterleaved, rgb)
+	shape = imageShape(3, 2, 3, ImageInterleaved)
+	wrapped, err = newImage(rgb, 0, shape, contiguousStrides(shape), ImageInterleaved)
+	require.Nil(t, err, "Unable to wrap image: %s", err)
+	require.Equal(t, color.NRGBA64{R: 0x1414, G: 0x6e6e, B: 0xffff, A: 0xffff}, wrapped.At(2, 1))
+
+	// Views that aren't contiguous work too, such as a transposed gray image.
+	gray, err := newImage([]float32{0, 0.25, 0.5, 0.75, 1, 2}, 0, []int{3, 2}, []int{1, 3}, ImageInterleaved)
+	require.Nil(t, err, "Unable to wrap image: %s", err)
+	require.Equal(t, color.Gray16Model, gray.ColorModel())
+	require.Equal(t, image.Rect(0, 0, 2, 3), gray.Bounds())
+	require.Equal(t, color.Gray16{Y: 0xbfff}, gray.At(1, 0))
+	require.Equal(t, color.Gray16{Y: 0xffff}, gray.At(1, 2))
+	require.Equal(t, color.Gray16{}, gray.At(-1, 0))
+
+	_, err = newImage(pix, 0, []int{24}, []int{1}, ImageInterleaved)
+	require.NotNil(t, err)
+	require.Equal(t, "Image tensor must have 2 or 3 dimensions instead of 1", err.Error())
+
+	_, err = newImage(pix, 0, []int{2, 6, 2}, contiguousStrides([]int{2, 6, 2}), ImageInterleaved)
+	require.NotNil(t, err)
+	require.Equal(t, "Unsupported number of channels 2", err.Error())
+
+	_, err = newImage(pix, 0, []int{2, 3}, []int{3, 1}, ImageLayout(-1))
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid image layout", err.Error())
+}
+
+// Test_interleavedShape tests that interleavedShape splits the shapes of interleaved images.
+func Test_interleavedShape(t *testing.T) {
+	height, width, channels, err := interleavedShape([]int{4, 5})
+	require.Nil(t, err)
+	require.Equal(t, []int{4, 5, 1}, []int{height, width, channels})
+
+	height, width, channels, err = interleavedShape([]int{4, 5, 3})
+	require.Nil(t, err)
+	require.Equal(t, []int{4, 5, 3}, []int{height, width, channels})
+
+	_, _, _, err = interleavedShape([]int{2, 4, 5, 3})
+	require.NotNil(t, err)
+	require.Equal(t, "Image tensor must have 2 or 3 dimensions instead of 4", err.Error())
+}
@@ -0,0 +1,120 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+)
+
+// NewTensorFromImage allocates a block of memory that is accessible to both the CPU and GPU and
+// copies the pixels of img into it. The tensor's shape depends on opts.Layout: (height, width,
+// channels) for interleaved pixels, or (channels, height, width) for planar pixels. The pixel at
+// the top left corner of the image's bounds is at (0, 0), no matter where the bounds start.
+//
+// A uint8 tensor holds every channel from 0 to 255, and a float32 tensor holds every channel from
+// 0 to 1. Colors are never premultiplied by alpha.
+func NewTensorFromImage[T ImageType](img image.Image, opts ImageOptions) (*Tensor[T], error) {
+	channels, err := opts.check(img)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	t, err := NewTensor[T](imageShape(b.Dx(), b.Dy(), channels, opts.Layout)...)
+	if err != nil {
+		return nil, err
+	}
+
+	imagePixels(img, channels, opts.Layout, t.data)
+
+	return t, nil
+}
+
+// ImageFromTensor wraps the tensor as an image, for example to encode it with png.Encode. The
+// tensor's shape is (height, width) for a gray image, or as described by layout for an image with
+// 1 (gray), 3 (red, green, and blue), or 4 (red, green, blue, and alpha) channels. Its channels are
+// the same as for NewTensorFromImage. Normalized channels outside of the range 0 to 1 are clamped.
+//
+// The image isn't a copy: it shows the tensor's current elements. For a contiguous uint8 tensor in
+// the interleaved layout with 1 or 4 channels, the image is an *image.Gray or *image.NRGBA that
+// shares memory with the tensor.
+func ImageFromTensor[T ImageType](t *Tensor[T], layout ImageLayout) (image.Image, error) {
+	return newImage(t.data, t.offset, t.shape, t.strides, layout)
+}
+
+// ReadPFM reads a PFM (Portable Float Map) image from r into a new tensor with the shape (height,
+// width, channels), where channels is 1 for gray images and 3 for color images. PFM stores the rows
+// from the bottom to the top, but the tensor holds them from the top to the bottom, like every
+// other image.
+func ReadPFM(r io.Reader) (*Tensor[float32], error) {
+	br := bufio.NewReader(r)
+	h, err := readPFMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := NewTensor[float32](h.height, h.width, h.channels)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := readPFMData(br, h, t.data); err != nil {
+		releaseBuffer(t.id)
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// WritePFM writes the tensor to w as a PFM (Portable Float Map) image. The tensor's shape must be
+// (height, width) or (height, width, 1) for a gray image, or (height, width, 3) for a color image.
+func WritePFM(w io.Writer, t *Tensor[float32]) error {
+	height, width, channels, err := interleavedShape(t.shape)
+	if err != nil {
+		return err
+	}
+
+	return writePFM(w, width, height, channels, contiguousData(t))
+}
+
+// ReadPGM reads a binary PGM (Portable Gray Map) image from r into a new tensor with the shape
+// (height, width). Every pixel is normalized to the range 0 to 1 by dividing it by the image's
+// maximum value.
+func ReadPGM(r io.Reader) (*Tensor[float32], error) {
+	br := bufio.NewReader(r)
+	h, err := readPGMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := NewTensor[float32](h.height, h.width)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := readPGMData(br, h, t.data); err != nil {
+		releaseBuffer(t.id)
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// WritePGM writes the tensor to w as a binary PGM (Portable Gray Map) image. The tensor's shape must
+// be (height, width) or (height, width, 1). Every pixel is clamped to the range 0 to 1 and scaled
+// to maxValue, which is 255 for 8-bit images or up to 65535 for 16-bit images.
+func WritePGM(w io.Writer, t *Tensor[float32], maxValue int) error {
+	height, width, channels, err := interleavedShape(t.shape)
+	if err != nil {
+		return err
+	}
+	if channels != 1 {
+		return fmt.Errorf("Unsupported number of channels %d for a PGM image", channels)
+	}
+
+	return writePGM(w, width, height, maxValue, contiguousData(t))
+}
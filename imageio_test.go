@@ -0,0 +1,114 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_NewTensorFromImage tests that images can be copied into tensors and wrapped again for
+// encoding.
+func Test_NewTensorFromImage(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(60 * x), G: uint8(100 * y), B: 50, A: 255})
+		}
+	}
+
+	// Interleaved bytes are wrapped without being copied again.
+	tensor, err := NewTensorFromImage[uint8](img, ImageOptions{})
+	require.Nil(t, err, "Unable to create tensor: %s", err)
+	require.True(t, validId(tensor.Id()))
+	require.Equal(t, []int{3, 4, 4}, tensor.Shape())
+	require.Equal(t, img.Pix, tensor.Data())
+
+	wrapped, err := ImageFromTensor(tensor, ImageInterleaved)
+	require.Nil(t, err, "Unable to wrap tensor: %s", err)
+	require.Equal(t, img, wrapped)
+	tensor.Set(7, 0, 0, 0)
+	require.Equal(t, color.NRGBA{R: 7, G: 0, B: 50, A: 255}, wrapped.At(0, 0))
+
+	// Planar floats survive a round trip through PNG.
+	planar, err := NewTensorFromImage[float32](img, ImageOptions{Channels: 3, Layout: ImagePlanar})
+	require.Nil(t, err, "Unable to create tensor: %s", err)
+	require.True(t, validId(planar.Id()))
+	require.Equal(t, []int{3, 3, 4}, planar.Shape())
+	require.InDelta(t, 180.0/255, planar.At(0, 2, 3), 1e-6)
+	require.InDelta(t, 200.0/255, planar.At(1, 2, 3), 1e-6)
+
+	wrapped, err = ImageFromTensor(planar, ImagePlanar)
+	require.Nil(t, err, "Unable to wrap tensor: %s", err)
+	var buf bytes.Buffer
+	require.Nil(t, png.Encode(&buf, wrapped))
+	decoded, err := png.Decode(&buf)
+	require.Nil(t, err, "Unable to decode image: %s", err)
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			r, g, b, a := decoded.At(x, y).RGBA()
+			require.Equal(t, []uint32{uint32(60*x) * 0x101, uint32(100*y) * 0x101, 50 * 0x101, 0xffff},
+				[]uint32{r, g, b, a})
+		}
+	}
+
+	_, err = NewTensorFromImage[uint8](img, ImageOptions{Channels: 2})
+	require.NotNil(t, err)
+	require.Equal(t, "Unsupported number of channels 2", err.Error())
+
+	_, err = ImageFromTensor(planar, ImageInterleaved)
+	require.NotNil(t, err)
+	require.Equal(t, "Unsupported number of channels 4", err.Error())
+}
+
+// Test_ReadPFM tests that tensors written with WritePFM and WritePGM can be read back with ReadPFM
+// and ReadPGM.
+func Test_ReadPFM(t *testing.T) {
+	tensor, err := NewTensor[float32](2, 3, 3)
+	require.Nil(t, err, "Unable to create tensor: %s", err)
+	require.True(t, validId(tensor.Id()))
+	for i := range tensor.Data() {
+		tensor.Data()[i] = float32(i) / 10
+	}
+
+	var buf bytes.Buffer
+	require.Nil(t, WritePFM(&buf, tensor))
+	got, err := ReadPFM(&buf)
+	require.Nil(t, err, "Unable to read PFM image: %s", err)
+	require.True(t, validId(got.Id()))
+	require.Equal(t, []int{2, 3, 3}, got.Shape())
+	require.Equal(t, tensor.Data(), got.Data())
+
+	// One channel of the image is a gray image.
+	red, err := tensor.Slice(2, 0, 1)
+	require.Nil(t, err, "Unable to slice tensor: %s", err)
+	buf.Reset()
+	require.Nil(t, WritePGM(&buf, red, 255))
+	gray, err := ReadPGM(&buf)
+	require.Nil(t, err, "Unable to read PGM image: %s", err)
+	require.True(t, validId(gray.Id()))
+	require.Equal(t, []int{2, 3}, gray.Shape())
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			require.InDelta(t, red.At(y, x, 0), gray.At(y, x), 0.5/255)
+		}
+	}
+
+	err = WritePGM(&buf, tensor, 255)
+	require.NotNil(t, err)
+	require.Equal(t, "Unsupported number of channels 3 for a PGM image", err.Error())
+
+	// An image that ends early doesn't leave a buffer behind.
+	before := Memory()
+	_, err = ReadPFM(bytes.NewReader([]byte("Pf\n2 2\n-1.0\n\x00\x00\x00\x00")))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to read PFM data: unexpected EOF", err.Error())
+	addId()
+	require.Equal(t, before.Allocation, Memory().Allocation)
+}
@@ -0,0 +1,57 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+/*
+#cgo LDFLAGS: -framework Metal -framework CoreGraphics -framework Foundation
+#include "metal.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+var (
+	// initialized is set once the GPUs have been initialized. Until then, initMu guards
+	// initialization, which is tried again every time until it succeeds.
+	initialized atomic.Bool
+	initMu      sync.Mutex
+)
+
+// Available checks whether or not the system has a GPU that metal can use. Programs can call this
+// to fall back to running on the CPU, instead of handling ErrNoDevice from the first function or
+// buffer that they create. A GPU that isn't available is looked for again on the next call.
+func Available() bool {
+	return ensureInit() == nil
+}
+
+// ensureInit initializes the GPUs the first time that it's called. Nothing that uses a GPU can be
+// created before then. If there is no GPU, this returns an error that wraps ErrNoDevice, and the
+// next call tries again.
+func ensureInit() error {
+	if initialized.Load() {
+		return nil
+	}
+
+	initMu.Lock()
+	defer initMu.Unlock()
+
+	if initialized.Load() {
+		return nil
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	if ok := C.metal_init(&metalErr); !ok {
+		return fmt.Errorf("%w: %s", ErrNoDevice, metalErrToError(metalErr, "Unable to initialize metal"))
+	}
+	initialized.Store(true)
+
+	return nil
+}
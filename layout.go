@@ -0,0 +1,289 @@
+package metal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// scalarTypes maps the kinds of Go's scalar types to their metal equivalents. Go's int, uint, and
+// uintptr are left out because their size depends on the platform, and float64 is left out
+// because metal doesn't support double-precision numbers.
+var scalarTypes = map[reflect.Kind]mslType{
+	reflect.Bool:    {"bool", 1, 1},
+	reflect.Int8:    {"char", 1, 1},
+	reflect.Uint8:   {"uchar", 1, 1},
+	reflect.Int16:   {"short", 2, 2},
+	reflect.Uint16:  {"ushort", 2, 2},
+	reflect.Int32:   {"int", 4, 4},
+	reflect.Uint32:  {"uint", 4, 4},
+	reflect.Int64:   {"long", 8, 8},
+	reflect.Uint64:  {"ulong", 8, 8},
+	reflect.Float32: {"float", 4, 4},
+}
+
+// namedTypes maps Go types that stand in for metal types with no Go equivalent. They take
+// precedence over scalarTypes.
+var namedTypes = map[reflect.Type]mslType{
+	reflect.TypeOf(Float16(0)):  {"half", 2, 2},
+	reflect.TypeOf(BFloat16(0)): {"bfloat", 2, 2},
+}
+
+// checkStructLayout checks that the struct type t has exactly the same layout in Go as the
+// equivalent struct would have in metal, so that a slice of t can be shared with metal code. If it
+// doesn't, the returned error explains every difference.
+func checkStructLayout(t reflect.Type) error {
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("%s is not a struct", t)
+	}
+
+	var problems []string
+	mslStructLayout(t, "", &problems)
+	if len(problems) > 0 {
+		return errors.New("Struct " + t.String() + " has a different layout in Go than in metal:\n  - " +
+			strings.Join(problems, "\n  - "))
+	}
+
+	return nil
+}
+
+// mslAlign returns the alignment in bytes of the metal equivalent of the Go type t. For types with
+// no metal equivalent, this is the alignment in Go.
+func mslAlign(t reflect.Type) int {
+	return mslLayout(t, "", new([]string)).align
+}
+
+// mslLayout calculates the size and alignment of the metal equivalent of the Go type t. Any
+// reason why t can't be used with metal is added to problems, prefixed with path.
+func mslLayout(t reflect.Type, path string, problems *[]string) mslType {
+	if msl, ok := vectorTypes[t]; ok {
+		return msl
+	}
+	if msl, ok := namedTypes[t]; ok {
+		return msl
+	}
+
+	switch t.Kind() {
+	case reflect.Array:
+		elem := mslLayout(t.Elem(), path, problems)
+		return mslType{
+			name:  arrayTypeName(elem.name, t.Len()),
+			size:  elem.size * t.Len(),
+			align: elem.align,
+		}
+
+	case reflect.Struct:
+		msl, _ := mslStructLayout(t, path, problems)
+		return msl
+	}
+
+	if msl, ok := scalarTypes[t.Kind()]; ok {
+		return msl
+	}
+
+	*problems = append(*problems, fmt.Sprintf("%s%s has no metal equivalent", fieldPrefix(path), t))
+
+	return mslType{name: t.String(), size: int(t.Size()), align: t.Align()}
+}
+
+// An mslField describes a field of a struct in metal.
+type mslField struct {
+	// name is the name of the field in Go.
+	name string
+
+	// msl is the metal type of the field. For arrays, this includes the dimensions.
+	msl mslType
+
+	// offset is the offset of the field in Go. This is the same as the offset in metal if the
+	// struct has the same layout in both.
+	offset int
+}
+
+// mslStructLayout calculates the layout of the metal equivalent of the Go struct type t. This
+// follows the same rules as C: every field is placed at the next offset that is a multiple of its
+// alignment, the struct is aligned to its most-aligned field, and its size is rounded up to a
+// multiple of its alignment. Any difference from the Go layout is added to problems.
+//
+// A field's metal type can be overridden with a struct tag, such as `metal:"packed_float3"`, as
+// long as the metal type has the same size as the Go type. For arrays, the tag can instead
+// override the type of the innermost elements.
+func mslStructLayout(t reflect.Type, path string, problems *[]string) (mslType, []mslField) {
+	var fields []mslField
+	offset, align := 0, 1
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		// Zero-length fields don't exist in metal. If they change the layout in Go, then that
+		// will show up as a difference in the offset of the next field or the size of the struct.
+		if field.Type.Size() == 0 {
+			continue
+		}
+
+		fieldPath := path + field.Name
+		msl := mslLayout(field.Type, fieldPath+".", problems)
+		if tag, ok := field.Tag.Lookup("metal"); ok {
+			msl = mslTagType(field, tag, msl, fieldPath, problems)
+		}
+
+		offset = alignUp(offset, msl.align)
+		if goOffset := int(field.Offset); goOffset != offset {
+			problem := fmt.Sprintf("field %s (%s) is at offset %d in Go but at offset %d in metal",
+				fieldPath, field.Type, goOffset, offset)
+			if goOffset < offset && msl.align > field.Type.Align() {
+				problem += fmt.Sprintf(" because %s is aligned to %d bytes in metal; add %d bytes of "+
+					"padding before it", msl.name, msl.align, offset-goOffset)
+			}
+			*problems = append(*problems, problem)
+		}
+
+		fields = append(fields, mslField{
+			name:   field.Name,
+			msl:    msl,
+			offset: int(field.Offset),
+		})
+
+		offset += msl.size
+		if msl.align > align {
+			align = msl.align
+		}
+	}
+
+	if len(fields) == 0 {
+		*problems = append(*problems, fmt.Sprintf("%s%s has no fields", fieldPrefix(path), t))
+	}
+
+	size := alignUp(offset, align)
+	if goSize := int(t.Size()); goSize != size {
+		problem := fmt.Sprintf("%s%s is %d bytes long in Go but %d bytes long in metal",
+			fieldPrefix(path), t, goSize, size)
+		if goSize < size {
+			problem += fmt.Sprintf("; add %d bytes of padding to the end", size-goSize)
+		}
+		*problems = append(*problems, problem)
+	}
+
+	return mslType{name: t.Name(), size: size, align: align}, fields
+}
+
+// mslTagType determines the metal type of a field from the type named in its struct tag. msl is
+// the type that the field would have without the tag.
+func mslTagType(field reflect.StructField, tag string, msl mslType, path string,
+	problems *[]string) mslType {
+	override, ok := mslTypeByName(tag)
+	if !ok {
+		*problems = append(*problems, fmt.Sprintf("field %s: %s in the struct tag is not a supported "+
+			"metal type", path, tag))
+		return msl
+	}
+
+	goSize := int(field.Type.Size())
+	if override.size == goSize {
+		return override
+	}
+
+	// For arrays, the tag can apply to the innermost elements instead. The dimensions stay the
+	// same.
+	elem := field.Type
+	for elem.Kind() == reflect.Array {
+		elem = elem.Elem()
+	}
+	if elem != field.Type && override.size == int(elem.Size()) {
+		_, dims, _ := strings.Cut(msl.name, "[")
+		return mslType{
+			name:  override.name + "[" + dims,
+			size:  goSize,
+			align: override.align,
+		}
+	}
+
+	*problems = append(*problems, fmt.Sprintf("field %s: %s in the struct tag is %d bytes long but "+
+		"%s is %d bytes long", path, tag, override.size, field.Type, goSize))
+
+	return msl
+}
+
+// mslScalarTypes maps the names of metal's scalar types to their descriptions.
+var mslScalarTypes = func() map[string]mslType {
+	types := map[string]mslType{
+		"atomic_bool":  {"atomic_bool", 1, 1},
+		"atomic_int":   {"atomic_int", 4, 4},
+		"atomic_uint":  {"atomic_uint", 4, 4},
+		"atomic_float": {"atomic_float", 4, 4},
+	}
+	for _, msl := range scalarTypes {
+		types[msl.name] = msl
+	}
+	for _, msl := range namedTypes {
+		types[msl.name] = msl
+	}
+
+	return types
+}()
+
+// mslTypeByName describes the metal scalar or vector type with the provided name, such as "float",
+// "half4", or "packed_float3". It reports false if there is no such type.
+func mslTypeByName(name string) (mslType, bool) {
+	base := strings.TrimPrefix(name, "packed_")
+	packed := base != name
+	if base == "" {
+		return mslType{}, false
+	}
+
+	// Split off the number of components.
+	n := 1
+	if last := base[len(base)-1]; last >= '2' && last <= '4' {
+		n = int(last - '0')
+		base = base[:len(base)-1]
+	}
+
+	scalar, ok := mslScalarTypes[base]
+	if !ok || strings.HasPrefix(base, "atomic_") && n > 1 {
+		return mslType{}, false
+	}
+
+	switch {
+	case n == 1 && !packed:
+		return scalar, true
+	case n == 1:
+		return mslType{}, false
+	case packed:
+		// Packed vectors are exactly as long as their components and are aligned like them.
+		return mslType{name, scalar.size * n, scalar.align}, true
+	case n == 3:
+		// Vectors with 3 components take up as much space as vectors with 4 components.
+		return mslType{name, scalar.size * 4, scalar.size * 4}, true
+	default:
+		return mslType{name, scalar.size * n, scalar.size * n}, true
+	}
+}
+
+// arrayTypeName adds a dimension to the name of a metal type for an array of n elements of that
+// type. The new dimension is the outermost one, so it comes before any existing ones.
+func arrayTypeName(elem string, n int) string {
+	base, dims, _ := strings.Cut(elem, "[")
+	if dims != "" {
+		dims = "[" + dims
+	}
+
+	return fmt.Sprintf("%s[%d]%s", base, n, dims)
+}
+
+// fieldPrefix formats the path to a field for use at the start of a problem.
+func fieldPrefix(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	return "field " + strings.TrimSuffix(path, ".") + ": "
+}
+
+// alignUp rounds n up to the next multiple of align.
+func alignUp(n, align int) int {
+	if align <= 1 {
+		return n
+	}
+
+	return (n + align - 1) / align * align
+}
@@ -0,0 +1,211 @@
+package metal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_checkStructLayout tests that checkStructLayout accepts struct types that have the same
+// layout in Go and metal and explains the differences for those that don't.
+func Test_checkStructLayout(t *testing.T) {
+	type scalars struct {
+		A bool
+		B int8
+		C uint8
+		D int16
+		E uint16
+		F int32
+		G uint32
+		H int64
+		I uint64
+		J float32
+		K Float16
+		L BFloat16
+	}
+	type padded struct {
+		A int8
+		B int32 // 3 bytes of padding before this in both Go and metal
+		C int16
+		// 2 bytes of padding at the end in both Go and metal
+	}
+	type particle struct {
+		Pos  Float3
+		Mass float32
+		_    [3]float32
+	}
+	type packedParticle struct {
+		Pos  PackedFloat3
+		Mass float32
+	}
+	type arrays struct {
+		A [3]float32
+		B [2]Float2
+		C [2][2]int16
+	}
+	type inner struct {
+		V Float2
+		N int32
+	}
+	type nested struct {
+		A int32
+		B inner
+		C [2]inner
+	}
+	type blank struct {
+		A float32
+		_ float32
+		B Float2
+	}
+
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf(scalars{}),
+		reflect.TypeOf(padded{}),
+		reflect.TypeOf(particle{}),
+		reflect.TypeOf(packedParticle{}),
+		reflect.TypeOf(arrays{}),
+		reflect.TypeOf(nested{}),
+		reflect.TypeOf(blank{}),
+		reflect.TypeOf(Float4{}),
+	} {
+		require.Nil(t, checkStructLayout(typ), typ.String())
+	}
+}
+
+// Test_checkStructLayout_invalid tests that checkStructLayout explains every difference between
+// the Go and metal layouts of a struct type.
+func Test_checkStructLayout_invalid(t *testing.T) {
+	// Not a struct
+	err := checkStructLayout(reflect.TypeOf(float32(0)))
+	require.NotNil(t, err)
+	require.Equal(t, "float32 is not a struct", err.Error())
+
+	// No fields
+	type empty struct{}
+	err = checkStructLayout(reflect.TypeOf(empty{}))
+	require.NotNil(t, err)
+	require.Equal(t, "Struct metal.empty has a different layout in Go than in metal:\n"+
+		"  - metal.empty has no fields", err.Error())
+
+	// A float3 needs to be padded at the end.
+	type particle struct {
+		Pos  Float3
+		Mass float32
+	}
+	err = checkStructLayout(reflect.TypeOf(particle{}))
+	require.NotNil(t, err)
+	require.Equal(t, "Struct metal.particle has a different layout in Go than in metal:\n"+
+		"  - metal.particle is 24 bytes long in Go but 32 bytes long in metal; add 8 bytes of padding to the end", err.Error())
+
+	// A float4 is aligned to 16 bytes in metal.
+	type aligned struct {
+		Weight float32
+		Color  Float4
+		Index  int32
+	}
+	err = checkStructLayout(reflect.TypeOf(aligned{}))
+	require.NotNil(t, err)
+	require.Equal(t, "Struct metal.aligned has a different layout in Go than in metal:\n"+
+		"  - field Color (metal.Float4) is at offset 8 in Go but at offset 16 in metal because float4 is aligned to 16 bytes in metal; add 8 bytes of padding before it\n"+
+		"  - field Index (int32) is at offset 24 in Go but at offset 32 in metal\n"+
+		"  - metal.aligned is 32 bytes long in Go but 48 bytes long in metal; add 16 bytes of padding to the end", err.Error())
+
+	// Nested structs are checked too.
+	type inner struct {
+		A float32
+		B Int4
+	}
+	type outer struct {
+		A int32
+		B inner
+	}
+	err = checkStructLayout(reflect.TypeOf(outer{}))
+	require.NotNil(t, err)
+	require.Equal(t, "Struct metal.outer has a different layout in Go than in metal:\n"+
+		"  - field B.B (metal.Int4) is at offset 8 in Go but at offset 16 in metal because int4 is aligned to 16 bytes in metal; add 8 bytes of padding before it\n"+
+		"  - field B: metal.inner is 24 bytes long in Go but 32 bytes long in metal; add 8 bytes of padding to the end\n"+
+		"  - field B (metal.inner) is at offset 8 in Go but at offset 16 in metal because inner is aligned to 16 bytes in metal; add 8 bytes of padding before it\n"+
+		"  - metal.outer is 32 bytes long in Go but 48 bytes long in metal; add 16 bytes of padding to the end", err.Error())
+
+	// Types without a metal equivalent
+	type unsupported struct {
+		A float64
+		B int
+		C string
+		D *float32
+		E []float32
+		F [2]uintptr
+	}
+	err = checkStructLayout(reflect.TypeOf(unsupported{}))
+	require.NotNil(t, err)
+	require.Equal(t, "Struct metal.unsupported has a different layout in Go than in metal:\n"+
+		"  - field A: float64 has no metal equivalent\n"+
+		"  - field B: int has no metal equivalent\n"+
+		"  - field C: string has no metal equivalent\n"+
+		"  - field D: *float32 has no metal equivalent\n"+
+		"  - field E: []float32 has no metal equivalent\n"+
+		"  - field F: uintptr has no metal equivalent", err.Error())
+}
+
+// Test_alignUp tests that alignUp rounds numbers up to a multiple of the alignment.
+func Test_alignUp(t *testing.T) {
+	require.Equal(t, 0, alignUp(0, 4))
+	require.Equal(t, 4, alignUp(1, 4))
+	require.Equal(t, 4, alignUp(4, 4))
+	require.Equal(t, 16, alignUp(9, 16))
+	require.Equal(t, 7, alignUp(7, 1))
+	require.Equal(t, 7, alignUp(7, 0))
+}
+
+// Test_mslTypeByName tests that mslTypeByName describes metal types correctly.
+func Test_mslTypeByName(t *testing.T) {
+	type scenario struct {
+		name  string
+		size  int
+		align int
+	}
+
+	for _, s := range []scenario{
+		{"bool", 1, 1},
+		{"char", 1, 1},
+		{"uchar4", 4, 4},
+		{"short2", 4, 4},
+		{"ushort3", 8, 8},
+		{"int", 4, 4},
+		{"uint3", 16, 16},
+		{"long2", 16, 16},
+		{"float", 4, 4},
+		{"float3", 16, 16},
+		{"half", 2, 2},
+		{"half3", 8, 8},
+		{"bfloat4", 8, 8},
+		{"packed_float3", 12, 4},
+		{"packed_half3", 6, 2},
+		{"packed_char2", 2, 1},
+		{"atomic_uint", 4, 4},
+	} {
+		msl, ok := mslTypeByName(s.name)
+		require.True(t, ok, s.name)
+		require.Equal(t, mslType{s.name, s.size, s.align}, msl)
+	}
+
+	for _, name := range []string{"", "packed_", "double", "float8", "packed_float", "atomic_int2", "vec3", "2"} {
+		_, ok := mslTypeByName(name)
+		require.False(t, ok, name)
+	}
+
+	// The vector types must agree.
+	for _, msl := range vectorTypes {
+		byName, ok := mslTypeByName(msl.name)
+		require.True(t, ok, msl.name)
+		require.Equal(t, msl, byName)
+	}
+}
+
+// Test_arrayTypeName tests that arrayTypeName adds dimensions in the right order.
+func Test_arrayTypeName(t *testing.T) {
+	require.Equal(t, "float[3]", arrayTypeName("float", 3))
+	require.Equal(t, "float[2][3]", arrayTypeName("float[3]", 2))
+	require.Equal(t, "int[4][2][3]", arrayTypeName("int[2][3]", 4))
+}
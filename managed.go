@@ -0,0 +1,104 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"os"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// finalizerReleases counts the buffers that were released by the garbage collector.
+var finalizerReleases atomic.Uint64
+
+// A ManagedBuffer is a 1-dimensional buffer that is released automatically by the garbage
+// collector once neither the ManagedBuffer nor any slice of its memory can be reached anymore. Its
+// memory is allocated on Go's heap and shared with metal without being copied. Create one with
+// NewManagedBuffer.
+//
+// A ManagedBuffer should be supplied to metal functions and batches as is, rather than by its Id,
+// because the Id alone doesn't keep the buffer alive. Running a metal function or committing a
+// batch keeps every ManagedBuffer involved alive until the GPU is done with it.
+type ManagedBuffer[T BufferType] struct {
+	id   BufferId
+	data []T
+}
+
+// NewManagedBuffer allocates a 1-dimensional block of memory that is accessible to both the CPU and
+// GPU and is large enough to hold width elements of type T. The memory is released automatically
+// once the ManagedBuffer can't be reached anymore. It counts towards the memory budget (see
+// SetMemoryBudget) until then.
+func NewManagedBuffer[T BufferType](width int) (*ManagedBuffer[T], error) {
+	if err := ensureInit(); err != nil {
+		return nil, err
+	}
+
+	_, numBytes, err := bufferSize(sizeof[T](), []int{width}, maxBufferLength())
+	if err != nil {
+		return nil, err
+	}
+
+	// Metal requires memory that it doesn't allocate itself to start on a page boundary and to be
+	// a whole number of pages long, so one extra page is allocated to leave room for moving the
+	// start up to a page boundary.
+	pageSize := os.Getpagesize()
+	bufferLen := alignUp(int(numBytes), pageSize)
+
+	if err := memory.reserve(uint64(bufferLen)); err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, bufferLen+pageSize)
+	rawStart := int(uintptr(unsafe.Pointer(&raw[0])))
+	start := alignUp(rawStart, pageSize) - rawStart
+	mem := raw[start : start+bufferLen]
+
+	bufferId, err := newBufferNoCopy(Device{}, unsafe.Pointer(&mem[0]), len(mem))
+	if err != nil {
+		memory.cancel(uint64(bufferLen))
+		return nil, err
+	}
+	memory.add(int(bufferId), newBufferRecord[T](StorageShared, uint64(bufferLen), ColumnMajor, []int{width}))
+
+	// Both the ManagedBuffer and every slice of its memory point into raw, so raw can only be
+	// finalized once none of them can be reached. Go's garbage collector doesn't move heap
+	// objects, so the memory stays where metal expects it until then, and metal is done with it
+	// once the buffer is released.
+	runtime.SetFinalizer(&raw[0], func(*byte) {
+		releaseBuffer(bufferId)
+		finalizerReleases.Add(1)
+	})
+
+	return &ManagedBuffer[T]{
+		id:   bufferId,
+		data: unsafe.Slice((*T)(unsafe.Pointer(&mem[0])), width),
+	}, nil
+}
+
+// Id returns the Id of the buffer. The Id alone doesn't keep the buffer alive.
+func (b *ManagedBuffer[T]) Id() BufferId {
+	return b.id
+}
+
+// Data returns a slice that wraps the buffer's memory. The slice keeps the buffer alive, the same
+// way as the ManagedBuffer itself.
+//
+// Only the contents of the slice should be modified. Its length and capacity and the pointer to its
+// underlying array should not be altered.
+func (b *ManagedBuffer[T]) Data() []T {
+	return b.data
+}
+
+// binding supplies the entire buffer to the metal function.
+func (b *ManagedBuffer[T]) binding() binding {
+	return binding{bufferId: b.id}
+}
+
+// FinalizerReleases returns the number of buffers that the garbage collector has released so far.
+// This is meant for debugging: code that creates a lot of short-lived ManagedBuffers might be
+// better off with a BufferPool.
+func FinalizerReleases() uint64 {
+	return finalizerReleases.Load()
+}
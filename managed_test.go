@@ -0,0 +1,129 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_ManagedBuffer tests that a ManagedBuffer can be used like any other buffer.
+func Test_ManagedBuffer(t *testing.T) {
+	functionId, err := NewFunction(sourceTransfer1D, "transfer1D")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(functionId))
+
+	width := 10_001
+	input, err := NewManagedBuffer[float32](width)
+	require.Nil(t, err, "Unable to create managed buffer: %s", err)
+	require.True(t, validId(input.Id()))
+	output, err := NewManagedBuffer[float32](width)
+	require.Nil(t, err, "Unable to create managed buffer: %s", err)
+	require.True(t, validId(output.Id()))
+
+	require.Len(t, input.Data(), width)
+	require.Zero(t, uintptr(unsafe.Pointer(&input.Data()[0]))%uintptr(os.Getpagesize()))
+
+	for i := range input.Data() {
+		input.Data()[i] = float32(i) * 1.1
+	}
+
+	err = functionId.RunResources(Grid{X: width}, input, output)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+	require.Equal(t, input.Data(), output.Data())
+
+	_, err = NewManagedBuffer[float32](0)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid dimension", err.Error())
+}
+
+// Test_ManagedBuffer_finalizer tests that a ManagedBuffer is released once it can't be reached
+// anymore, but not while it's still reachable or a pending batch still uses it.
+func Test_ManagedBuffer_finalizer(t *testing.T) {
+	before := Memory()
+	released := FinalizerReleases()
+
+	// The buffer stays alive as long as the ManagedBuffer does, and its memory counts towards the
+	// allocation until then.
+	buffer, err := NewManagedBuffer[float32](1_000)
+	require.Nil(t, err, "Unable to create managed buffer: %s", err)
+	require.True(t, validId(buffer.Id()))
+	gc()
+	require.Equal(t, released, FinalizerReleases())
+	require.Equal(t, before.Buffers+1, Memory().Buffers)
+	require.Equal(t, before.Bytes+uint64(os.Getpagesize()), Memory().Bytes)
+	buffer.Data()[0] = 1
+	runtime.KeepAlive(buffer)
+	buffer = nil
+
+	waitForReleases(t, released+1)
+	require.Equal(t, before.Allocation, Memory().Allocation)
+
+	// The slice keeps the buffer alive without the ManagedBuffer.
+	buffer, err = NewManagedBuffer[float32](1_000)
+	require.Nil(t, err, "Unable to create managed buffer: %s", err)
+	require.True(t, validId(buffer.Id()))
+	data := buffer.Data()
+	buffer = nil
+	gc()
+	require.Equal(t, released+1, FinalizerReleases())
+	require.Equal(t, before.Buffers+1, Memory().Buffers)
+	for i := range data {
+		data[i] = float32(i)
+	}
+	for i, v := range data {
+		require.Equal(t, float32(i), v)
+	}
+	runtime.KeepAlive(data)
+	data = nil
+
+	waitForReleases(t, released+2)
+	require.Equal(t, before.Allocation, Memory().Allocation)
+
+	// A batch keeps its buffers alive until it's committed.
+	buffer, err = NewManagedBuffer[float32](1_000)
+	require.Nil(t, err, "Unable to create managed buffer: %s", err)
+	require.True(t, validId(buffer.Id()))
+	batch, err := NewBatch()
+	require.Nil(t, err, "Unable to create batch: %s", err)
+	addId()
+	require.Nil(t, BatchFillValue(batch, buffer, float32(2)))
+	buffer = nil
+
+	gc()
+	require.Equal(t, released+2, FinalizerReleases())
+	require.Nil(t, batch.Commit())
+
+	waitForReleases(t, released+3)
+	require.Equal(t, before.Allocation, Memory().Allocation)
+
+	// The budget applies to managed buffers.
+	SetMemoryBudget(Memory().Bytes + 1)
+	defer SetMemoryBudget(0)
+	_, err = NewManagedBuffer[float32](1_000)
+	require.NotNil(t, err)
+	require.ErrorIs(t, err, ErrMemoryBudget)
+}
+
+// gc runs the garbage collector enough times for unreachable objects to be finalized.
+func gc() {
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForReleases waits for the garbage collector to release buffers until FinalizerReleases
+// reports want.
+func waitForReleases(t *testing.T, want uint64) {
+	for i := 0; i < 100 && FinalizerReleases() < want; i++ {
+		gc()
+	}
+	require.Equal(t, want, FinalizerReleases())
+}
@@ -0,0 +1,60 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+/*
+#cgo LDFLAGS: -framework Metal -framework CoreGraphics -framework Foundation
+#include "metal.h"
+*/
+import "C"
+
+import (
+	"reflect"
+)
+
+// memory keeps track of every buffer that this package allocates.
+var memory memoryRegistry
+
+// SetMemoryBudget sets a limit on the total size of all buffers that this package allocates. Once
+// the limit is reached, creating another buffer fails right away with an error that wraps
+// ErrMemoryBudget, instead of asking the device for more memory than the system can comfortably
+// provide. A budget of 0 removes the limit. Buffers that already exist are not affected.
+//
+// Buffers that wrap memory that this package doesn't allocate, such as those created with
+// NewBufferNoCopy and MapFile, don't count towards the budget. ManagedBuffers do.
+func SetMemoryBudget(numBytes uint64) {
+	memory.setBudget(numBytes)
+}
+
+// Memory returns statistics about the memory that is allocated for buffers, both by this package
+// and by the device as a whole. The device's statistics are zero if there is no GPU (see
+// Available).
+func Memory() MemoryStats {
+	stats := memory.stats()
+	if err := ensureInit(); err != nil {
+		return stats
+	}
+	stats.DeviceAllocated = uint64(C.metal_current_allocated_size())
+	stats.DeviceRecommendedMax = uint64(C.metal_recommended_max_working_set_size())
+
+	return stats
+}
+
+// newBufferRecord describes a new buffer of elements of type T for the memory registry.
+func newBufferRecord[T any](storage StorageMode, numBytes uint64, layout Layout, dimLens []int) bufferRecord {
+	return bufferRecord{
+		elemType: reflect.TypeOf((*T)(nil)).Elem().String(),
+		storage:  storage,
+		numBytes: numBytes,
+		layout:   layout,
+		dimLens:  append([]int(nil), dimLens...),
+	}
+}
+
+// releaseBuffer releases a buffer and removes it from the memory registry. Its Id can't be used
+// after this.
+func releaseBuffer(id BufferId) {
+	C.buffer_release(C.int(id))
+	memory.remove(int(id))
+}
@@ -0,0 +1,77 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_Memory tests that Memory keeps track of the buffers that are allocated and released.
+func Test_Memory(t *testing.T) {
+	before := Memory()
+	require.Greater(t, before.DeviceRecommendedMax, uint64(0))
+
+	bufferId, _, err := NewBuffer1D[float32](1_000)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	privateId, _, err := NewBufferWithOptions[Float4](BufferOptions{Storage: StoragePrivate}, 10)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(privateId))
+
+	after := Memory()
+	require.Equal(t, before.Buffers+2, after.Buffers)
+	require.Equal(t, before.Bytes+4_160, after.Bytes)
+	require.Equal(t, before.ByType["float32"].Bytes+4_000, after.ByType["float32"].Bytes)
+	require.Equal(t, before.ByType["metal.Float4"].Bytes+160, after.ByType["metal.Float4"].Bytes)
+	require.Equal(t, before.ByStorage[StoragePrivate].Buffers+1, after.ByStorage[StoragePrivate].Buffers)
+	require.GreaterOrEqual(t, after.DeviceAllocated, after.Bytes-before.Bytes)
+
+	// Released buffers are no longer counted.
+	pool, err := NewBufferPool(PoolOptions{})
+	require.Nil(t, err, "Unable to create buffer pool: %s", err)
+	pooledId, _, err := PoolGet[float32](pool, 10)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.True(t, validId(pooledId))
+	require.Equal(t, after.ByType["uint8"].Bytes+4096, Memory().ByType["uint8"].Bytes)
+	require.Nil(t, pool.Put(pooledId))
+	pool.Close()
+	require.Equal(t, after.Allocation, Memory().Allocation)
+}
+
+// Test_SetMemoryBudget tests that buffers can't be created once the memory budget is used up.
+func Test_SetMemoryBudget(t *testing.T) {
+	defer SetMemoryBudget(0)
+
+	inUse := Memory().Bytes
+	SetMemoryBudget(inUse + 4_000)
+	require.Equal(t, inUse+4_000, Memory().Budget)
+
+	bufferId, _, err := NewBuffer1D[float32](700)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+
+	// This fails before metal is asked for the memory.
+	_, _, err = NewBuffer2D[float32](20, 20)
+	require.NotNil(t, err)
+	require.True(t, errors.Is(err, ErrMemoryBudget))
+	require.Contains(t, err.Error(), "Unable to create buffer: Memory budget exceeded (1600 bytes requested")
+
+	_, _, err = NewBufferFrom1D(make([]float32, 301))
+	require.NotNil(t, err)
+	require.True(t, errors.Is(err, ErrMemoryBudget))
+
+	// What's left still fits.
+	bufferId, _, err = NewBufferFrom1D(make([]float32, 300))
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+
+	// Removing the budget removes the limit.
+	SetMemoryBudget(0)
+	bufferId, _, err = NewBuffer2D[float32](20, 20)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+}
@@ -6,20 +6,126 @@
 
 #include <stdlib.h>
 
-// Functions that must be called once for every application
-void metal_init();
+// Functions that must be called before anything else. Initialization can be
+// retried if it fails.
+_Bool metal_init(const char **);
+
+// Functions for listing the GPUs. A device index is a GPU's 1-based position
+// in the list, and 0 stands for the default GPU.
+typedef struct {
+  const char *name;
+  unsigned long long registryId;
+  _Bool lowPower;
+  _Bool headless;
+  _Bool removable;
+} device_properties;
+
+int metal_device_count();
+int metal_default_device();
+_Bool metal_device_properties(int deviceIndex, device_properties *);
+
+// Functions for querying what a GPU can do
+typedef struct {
+  unsigned long long maxThreadsWidth;
+  unsigned long long maxThreadsHeight;
+  unsigned long long maxThreadsDepth;
+  unsigned long long maxBufferLength;
+  unsigned long long maxThreadgroupMemoryLength;
+  unsigned long long recommendedMaxWorkingSetSize;
+  _Bool hasUnifiedMemory;
+} device_limits;
+
+_Bool metal_device_limits(int deviceIndex, device_limits *);
+_Bool metal_device_supports_family(int deviceIndex, int family);
+
+// Functions for querying data on the GPU
+int metal_language_version();
+unsigned long long metal_max_buffer_length(int deviceIndex);
+unsigned long long metal_current_allocated_size();
+unsigned long long metal_recommended_max_working_set_size();
 
 // Functions that must be called once for every metal function
-int function_new(const char *metalCode, const char *funcName, const char **);
+int function_new(int deviceIndex, const char *metalCode, const char *funcName,
+                 const char **);
 _Bool function_run(int functionId, int width, int height, int depth,
-                   int *bufferIds, int numBufferIds, const char **);
+                   int *bufferIds, unsigned long long *bufferOffsets,
+                   int numBufferIds, int *textureIds, int numTextureIds,
+                   int *samplerIds, int numSamplerIds, int *residentIds,
+                   int numResidentIds, const char **);
+void function_release(int functionId);
 
 // Functions for querying data on a metal function
 const char *function_name(int);
 
 // Functions that must be called once for every buffer used as an argument to
 // a metal function
-int buffer_new(int size, const char **);
+int buffer_new(int deviceIndex, unsigned long long size,
+               unsigned long long options, const char **);
+int buffer_new_with_bytes(int deviceIndex, const void *bytes,
+                          unsigned long long size, const char **);
+int buffer_new_no_copy(int deviceIndex, void *bytes, unsigned long long size,
+                       const char **);
 void *buffer_retrieve(int bufferId, const char **);
+int buffer_device(int bufferId, const char **);
+unsigned long long buffer_length(int bufferId, const char **);
+_Bool buffer_upload(int bufferId, unsigned long long offset, const void *bytes,
+                    unsigned long long size, const char **);
+_Bool buffer_download(int bufferId, unsigned long long offset, void *bytes,
+                      unsigned long long size, const char **);
+void buffer_release(int bufferId);
+
+// Functions for textures and samplers, which are supplied as arguments to a
+// metal function separately from buffers
+int texture_new(int deviceIndex, int pixelFormat, int width, int height,
+                int depth, unsigned long long usage,
+                unsigned long long storage, const char **);
+_Bool texture_upload(int textureId, int x, int y, int z, int width, int height,
+                     int depth, const void *bytes,
+                     unsigned long long bytesPerRow,
+                     unsigned long long bytesPerImage, const char **);
+_Bool texture_download(int textureId, int x, int y, int z, int width,
+                       int height, int depth, void *bytes,
+                       unsigned long long bytesPerRow,
+                       unsigned long long bytesPerImage, const char **);
+void texture_release(int textureId);
+int sampler_new(int deviceIndex, int minFilter, int magFilter,
+                int addressModeS, int addressModeT, int addressModeR,
+                _Bool normalized, const char **);
+void sampler_release(int samplerId);
+
+// Functions for argument buffers, which hold the arguments of a struct that a
+// metal function takes as a single buffer
+typedef struct {
+  const char *name;
+  int index;
+  int dataType;
+} argument_member;
+
+int argument_buffer_new(int functionId, int bufferIndex, int *bufferId,
+                        argument_member **members, int *numMembers,
+                        const char **);
+void argument_members_free(argument_member *members, int numMembers);
+_Bool argument_buffer_set_buffer(int encoderId, int index, int bufferId,
+                                 unsigned long long offset, const char **);
+void *argument_buffer_constant(int encoderId, int index, const char **);
+void argument_buffer_release(int encoderId);
+
+// Functions for running several operations together on the GPU
+int queue_new(int deviceIndex, const char **);
+void queue_release(int queueId);
+int batch_new(int deviceIndex, int queueId, const char **);
+_Bool batch_run(int batchId, int functionId, int width, int height, int depth,
+                int *bufferIds, unsigned long long *bufferOffsets,
+                int numBufferIds, int *textureIds, int numTextureIds,
+                int *samplerIds, int numSamplerIds, int *residentIds,
+                int numResidentIds, const char **);
+_Bool batch_copy(int batchId, int srcId, unsigned long long srcOffset,
+                 int dstId, unsigned long long dstOffset,
+                 unsigned long long size, const char **);
+_Bool batch_fill(int batchId, int bufferId, unsigned long long offset,
+                 unsigned long long size, const void *pattern, int patternLen,
+                 const char **);
+_Bool batch_commit(int batchId, const char **);
+void batch_discard(int batchId);
 
 #endif
\ No newline at end of file
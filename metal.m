@@ -3,15 +3,229 @@
 
 #include "metal.h"
 #include "cache.h"
+#include "device.h"
 #include "error.h"
 
 id<MTLDevice> device;
 
-// Initialize the default GPU. This should be called only once for the lifetime
-// of the app.
-void metal_init() {
+// The command queue for work that isn't tied to a specific metal function, such
+// as copying data to and from buffers.
+id<MTLCommandQueue> commandQueue;
+
+// Every GPU in the system, and a command queue for each of them, in the same
+// order. The default GPU is one of them.
+NSMutableArray<id<MTLDevice>> *allDevices;
+NSMutableArray<id<MTLCommandQueue>> *allQueues;
+
+// Release the default GPU and the list of GPUs, so that initialization can be
+// tried again.
+static void metal_reset() {
+  [allQueues release];
+  allQueues = nil;
+  [allDevices release];
+  allDevices = nil;
+  [commandQueue release];
+  commandQueue = nil;
+  [device release];
+  device = nil;
+}
+
+// Initialize the default GPU and list the others. This does nothing if the GPUs
+// have already been initialized. If any error is encountered, such as when the
+// system has no GPU, this returns false, sets an error message in error, and
+// leaves everything uninitialized, so that it can be called again later.
+_Bool metal_init(const char **error) {
+  if (device != nil) {
+    return true;
+  }
+
   // Get the default MTLDevice (each GPU is assigned its own device).
   device = MTLCreateSystemDefaultDevice();
-  NSCAssert(device != nil, @"Failed to find default GPU");
+  if (device == nil) {
+    logError(error, @"Failed to find default GPU");
+    return false;
+  }
+  commandQueue = [device newCommandQueue];
+  if (commandQueue == nil) {
+    metal_reset();
+    logError(error, @"Failed to set up command queue");
+    return false;
+  }
+
+  // List every GPU, such as the several GPUs of a Mac Pro or an external GPU.
+  // The default GPU keeps its own device object and command queue, so that it's
+  // the same no matter whether it's selected explicitly or not.
+  NSArray<id<MTLDevice>> *devices = MTLCopyAllDevices();
+  allDevices = [NSMutableArray new];
+  allQueues = [NSMutableArray new];
+  _Bool foundDefault = false;
+  for (id<MTLDevice> d in devices) {
+    if (device_same(d, device)) {
+      [allDevices addObject:device];
+      [allQueues addObject:commandQueue];
+      foundDefault = true;
+      continue;
+    }
+
+    id<MTLCommandQueue> queue = [d newCommandQueue];
+    if (queue == nil) {
+      [devices release];
+      metal_reset();
+      logError(error, @"Failed to set up command queue");
+      return false;
+    }
+    [allDevices addObject:d];
+    [allQueues addObject:queue];
+    [queue release];
+  }
+  if (!foundDefault) {
+    [allDevices addObject:device];
+    [allQueues addObject:commandQueue];
+  }
+  [devices release];
+
   cache_init();
+
+  return true;
+}
+
+// Get the GPU with the provided 1-based index in the list of GPUs, or the
+// default GPU for index 0. This returns nil if there is no such GPU.
+id<MTLDevice> device_get(int deviceIndex) {
+  if (deviceIndex == 0) {
+    return device;
+  }
+  if (deviceIndex < 0 || deviceIndex > (int)[allDevices count]) {
+    return nil;
+  }
+
+  return allDevices[deviceIndex - 1];
+}
+
+// Get the command queue for work on a GPU that isn't tied to a specific metal
+// function, such as copying data to and from buffers.
+id<MTLCommandQueue> device_queue(id<MTLDevice> d) {
+  for (NSUInteger i = 0; i < [allDevices count]; i++) {
+    if (device_same(allDevices[i], d)) {
+      return allQueues[i];
+    }
+  }
+
+  return commandQueue;
+}
+
+// Get the 1-based index of a GPU in the list of GPUs, or 0 if it isn't in the
+// list.
+int device_index(id<MTLDevice> d) {
+  for (NSUInteger i = 0; i < [allDevices count]; i++) {
+    if (device_same(allDevices[i], d)) {
+      return (int)i + 1;
+    }
+  }
+
+  return 0;
+}
+
+// Check whether or not two device objects refer to the same GPU.
+_Bool device_same(id<MTLDevice> a, id<MTLDevice> b) {
+  return [a registryID] == [b registryID];
+}
+
+// Get the number of GPUs in the system.
+int metal_device_count() { return (int)[allDevices count]; }
+
+// Get the 1-based index of the default GPU in the list of GPUs.
+int metal_default_device() {
+  for (NSUInteger i = 0; i < [allDevices count]; i++) {
+    if (allDevices[i] == device) {
+      return (int)i + 1;
+    }
+  }
+
+  return 0;
+}
+
+// Fill in the properties of the GPU with the provided index (see device_get).
+// This returns false if there is no such GPU.
+_Bool metal_device_properties(int deviceIndex, device_properties *properties) {
+  id<MTLDevice> d = device_get(deviceIndex);
+  if (d == nil) {
+    return false;
+  }
+
+  properties->name = [[d name] UTF8String];
+  properties->registryId = [d registryID];
+  properties->lowPower = [d isLowPower];
+  properties->headless = [d isHeadless];
+  properties->removable = [d isRemovable];
+
+  return true;
+}
+
+// Fill in the limits of the GPU with the provided index (see device_get). This
+// returns false if there is no such GPU.
+_Bool metal_device_limits(int deviceIndex, device_limits *limits) {
+  id<MTLDevice> d = device_get(deviceIndex);
+  if (d == nil) {
+    return false;
+  }
+
+  MTLSize maxThreads = [d maxThreadsPerThreadgroup];
+  limits->maxThreadsWidth = maxThreads.width;
+  limits->maxThreadsHeight = maxThreads.height;
+  limits->maxThreadsDepth = maxThreads.depth;
+  limits->maxBufferLength = [d maxBufferLength];
+  limits->maxThreadgroupMemoryLength = [d maxThreadgroupMemoryLength];
+  limits->recommendedMaxWorkingSetSize = [d recommendedMaxWorkingSetSize];
+  limits->hasUnifiedMemory = [d hasUnifiedMemory];
+
+  return true;
+}
+
+// Check whether or not the GPU with the provided index (see device_get)
+// supports the GPU family, whose value is an MTLGPUFamily. This returns false
+// if there is no such GPU or the OS doesn't know the family.
+_Bool metal_device_supports_family(int deviceIndex, int family) {
+  return [device_get(deviceIndex) supportsFamily:(MTLGPUFamily)family];
+}
+
+// Get the largest number of bytes that the GPU with the provided index (see
+// device_get) can allocate for a single buffer, or 0 if there is no such GPU.
+unsigned long long metal_max_buffer_length(int deviceIndex) {
+  return (unsigned long long)[device_get(deviceIndex) maxBufferLength];
+}
+
+// Get the total number of bytes that the GPU has allocated for this process.
+unsigned long long metal_current_allocated_size() {
+  return (unsigned long long)[device currentAllocatedSize];
+}
+
+// Get the number of bytes that the GPU can use without affecting performance.
+unsigned long long metal_recommended_max_working_set_size() {
+  return (unsigned long long)[device recommendedMaxWorkingSetSize];
+}
+
+// Get the newest version of the Metal Shading Language that the OS can compile
+// metal code for. This is the version that metal code is compiled with by
+// default. The version is packed the same way as MTLLanguageVersion, with the
+// major version in the upper 16 bits and the minor version in the lower 16
+// bits. (The values are spelled out because older SDKs don't define the newer
+// enum cases.)
+int metal_language_version() {
+  if (@available(macOS 15.0, *)) {
+    return (3 << 16) + 2;
+  }
+  if (@available(macOS 14.0, *)) {
+    return (3 << 16) + 1;
+  }
+  if (@available(macOS 13.0, *)) {
+    return (3 << 16) + 0;
+  }
+  if (@available(macOS 12.0, *)) {
+    return (2 << 16) + 4;
+  }
+  if (@available(macOS 11.0, *)) {
+    return (2 << 16) + 3;
+  }
+  return (2 << 16) + 2;
 }
\ No newline at end of file
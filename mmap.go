@@ -0,0 +1,131 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// A MappedFile is a file that is mapped into memory and wrapped by a metal buffer without being
+// copied, so that even very large files take up no extra memory. Changes to the contents of a file
+// that is mapped read-write are written back to the file. Create one with MapFile.
+//
+// A MappedFile can be supplied to a metal function as an argument. The metal function receives the
+// entire file.
+type MappedFile[T BufferType] struct {
+	id   BufferId
+	data []T
+	mem  []byte
+}
+
+// MapFile maps the file at path into memory and wraps it in a metal buffer that holds elements of
+// type T. The size of the file must be a multiple of the size of T. If writable is false, the file
+// is mapped read-only, and neither the slice returned by Data nor any metal function may write to
+// it.
+//
+// The MappedFile must be closed with Close once the buffer is no longer used.
+func MapFile[T BufferType](path string, writable bool) (*MappedFile[T], error) {
+	return mapFile[T](Device{}, path, writable)
+}
+
+// mapFile maps the file at path into memory and wraps it in a buffer on the provided device. It
+// works the same way as MapFile otherwise.
+func mapFile[T BufferType](device Device, path string, writable bool) (*MappedFile[T], error) {
+	if err := ensureInit(); err != nil {
+		return nil, err
+	}
+
+	flag, prot := os.O_RDONLY, syscall.PROT_READ
+	if writable {
+		flag, prot = os.O_RDWR, syscall.PROT_READ|syscall.PROT_WRITE
+	}
+
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	fileSize, elemSize := info.Size(), int64(sizeof[T]())
+	switch {
+	case fileSize == 0:
+		return nil, errors.New("Unable to map empty file")
+	case fileSize%elemSize != 0:
+		return nil, fmt.Errorf("Size of %d bytes is not a multiple of the element size of %d bytes",
+			fileSize, elemSize)
+	case uint64(fileSize) > maxBufferLength():
+		return nil, errors.New("Exceeded maximum number of bytes")
+	}
+
+	// The mapping is rounded up to a whole number of pages, as metal requires. The part of the last
+	// page after the end of the file is filled with zeros and isn't part of the slice.
+	pageSize := os.Getpagesize()
+	mapLen := alignUp(int(fileSize), pageSize)
+
+	mem, err := syscall.Mmap(int(f.Fd()), 0, mapLen, prot, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to map file: %w", err)
+	}
+
+	ptr := unsafe.Pointer(&mem[0])
+	if err := checkNoCopy(uintptr(ptr), len(mem), pageSize, maxBufferLength()); err != nil {
+		syscall.Munmap(mem)
+		return nil, err
+	}
+
+	bufferId, err := newBufferNoCopy(device, ptr, len(mem))
+	if err != nil {
+		syscall.Munmap(mem)
+		return nil, err
+	}
+
+	return &MappedFile[T]{
+		id:   bufferId,
+		data: toSlice[T](ptr, int(fileSize/elemSize)),
+		mem:  mem,
+	}, nil
+}
+
+// Id returns the Id of the buffer that wraps the file.
+func (m *MappedFile[T]) Id() BufferId {
+	return m.id
+}
+
+// Data returns a slice that wraps the contents of the file.
+//
+// Only the contents of the slice should be modified, and only if the file is mapped read-write.
+// Its length and capacity and the pointer to its underlying array should not be altered. The slice
+// must not be used after the MappedFile is closed.
+func (m *MappedFile[T]) Data() []T {
+	return m.data
+}
+
+// Close releases the buffer and unmaps the file. Neither the buffer Id nor the slice returned by
+// Data can be used after this.
+func (m *MappedFile[T]) Close() error {
+	if m.mem == nil {
+		return errors.New("Mapped file is already closed")
+	}
+
+	releaseBuffer(m.id)
+	err := syscall.Munmap(m.mem)
+
+	m.id, m.data, m.mem = 0, nil, nil
+
+	return err
+}
+
+// binding supplies the buffer that wraps the file to the metal function.
+func (m *MappedFile[T]) binding() binding {
+	return binding{bufferId: m.id}
+}
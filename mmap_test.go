@@ -0,0 +1,85 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_MapFile tests that MapFile wraps the contents of a file in a buffer without copying them.
+func Test_MapFile(t *testing.T) {
+	// Write a file with an odd number of elements, so that it doesn't end on a page boundary.
+	width := 10_001
+	want := make([]float32, width)
+	contents := make([]byte, width*4)
+	for i := range want {
+		want[i] = float32(i) * 1.1
+		binary.LittleEndian.PutUint32(contents[i*4:], math.Float32bits(want[i]))
+	}
+
+	path := filepath.Join(t.TempDir(), "data.bin")
+	require.Nil(t, os.WriteFile(path, contents, 0o600))
+
+	// Read-only
+	mapped, err := MapFile[float32](path, false)
+	require.Nil(t, err, "Unable to map file: %s", err)
+	require.True(t, validId(mapped.Id()))
+	require.Equal(t, want, mapped.Data())
+
+	// The mapped file can be supplied to a metal function.
+	functionId, err := NewFunction(sourceTransfer1D, "transfer1D")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(functionId))
+
+	outputId, output, err := NewBuffer1D[float32](width)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(outputId))
+
+	err = functionId.RunResources(Grid{X: width}, mapped, outputId)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+	require.Equal(t, want, output)
+
+	require.Nil(t, mapped.Close())
+	require.Nil(t, mapped.Data())
+	err = mapped.Close()
+	require.NotNil(t, err)
+	require.Equal(t, "Mapped file is already closed", err.Error())
+
+	// Read-write, with the changes written back to the file
+	mapped, err = MapFile[float32](path, true)
+	require.Nil(t, err, "Unable to map file: %s", err)
+	require.True(t, validId(mapped.Id()))
+
+	err = functionId.RunResources(Grid{X: width}, outputId, mapped)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+	mapped.Data()[0] = 100
+	require.Nil(t, mapped.Close())
+
+	contents, err = os.ReadFile(path)
+	require.Nil(t, err)
+	require.Len(t, contents, width*4)
+	require.Equal(t, float32(100), math.Float32frombits(binary.LittleEndian.Uint32(contents)))
+	require.Equal(t, want[1], math.Float32frombits(binary.LittleEndian.Uint32(contents[4:])))
+
+	// Invalid files
+	_, err = MapFile[float32](filepath.Join(t.TempDir(), "missing.bin"), false)
+	require.NotNil(t, err)
+	require.True(t, os.IsNotExist(err))
+
+	empty := filepath.Join(t.TempDir(), "empty.bin")
+	require.Nil(t, os.WriteFile(empty, nil, 0o600))
+	_, err = MapFile[float32](empty, false)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to map empty file", err.Error())
+
+	_, err = MapFile[Float4](path, false)
+	require.NotNil(t, err)
+	require.Equal(t, "Size of 40004 bytes is not a multiple of the element size of 16 bytes", err.Error())
+}
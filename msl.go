@@ -0,0 +1,109 @@
+package metal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// MSLStruct generates the declaration of the metal struct that is equivalent to the Go struct type
+// T, along with the declarations of any structs that T contains. The declarations can be added to
+// the start of the metal code for a function, which makes the Go type the single source of truth
+// for the layout of the data that is passed to the function.
+//
+// The struct and its fields have the same names as in Go. Fields named "_" and any padding that Go
+// adds between or after fields become explicit padding fields named "_pad0", "_pad1", etc. The
+// metal type of a field can be overridden with a struct tag, such as `metal:"packed_float3"` on a
+// [3]float32 field, as long as the metal type has the same size as the Go type. For arrays, the
+// tag can instead override the type of the innermost elements.
+//
+// T must be usable with NewStructBuffer1D. If it isn't, the returned error explains why.
+func MSLStruct[T any]() (string, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if err := checkStructLayout(t); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := writeMSLStruct(&b, t, make(map[string]reflect.Type)); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// writeMSLStruct writes the declaration of the metal equivalent of the Go struct type t to b,
+// preceded by the declarations of the structs that t contains and that haven't been declared yet.
+// declared tracks the struct types that have already been declared, by name.
+func writeMSLStruct(b *strings.Builder, t reflect.Type, declared map[string]reflect.Type) error {
+	name := t.Name()
+	if name == "" {
+		return fmt.Errorf("Anonymous struct %s can't be declared in metal", t)
+	}
+	if other, ok := declared[name]; ok {
+		if other != t {
+			return fmt.Errorf("Structs %s and %s have the same name", other, t)
+		}
+		return nil
+	}
+	declared[name] = t
+
+	// Declare any structs in the fields first, because metal needs them to be declared before they
+	// are used.
+	for i := 0; i < t.NumField(); i++ {
+		elem := t.Field(i).Type
+		for elem.Kind() == reflect.Array {
+			elem = elem.Elem()
+		}
+
+		if _, ok := vectorTypes[elem]; ok || elem.Kind() != reflect.Struct {
+			continue
+		}
+		if err := writeMSLStruct(b, elem, declared); err != nil {
+			return err
+		}
+	}
+
+	// The layout has already been checked, so there aren't any problems to collect here.
+	_, fields := mslStructLayout(t, "", new([]string))
+
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(b, "struct %s {\n", name)
+
+	offset, numPads := 0, 0
+	writePadding := func(n int) {
+		fmt.Fprintf(b, "    uchar _pad%d[%d];\n", numPads, n)
+		numPads++
+	}
+
+	for _, field := range fields {
+		if field.offset > offset {
+			writePadding(field.offset - offset)
+		}
+
+		fieldName := field.name
+		if fieldName == "_" {
+			fieldName = fmt.Sprintf("_pad%d", numPads)
+			numPads++
+		}
+
+		// Array dimensions go after the field name.
+		typeName, dims, _ := strings.Cut(field.msl.name, "[")
+		if dims != "" {
+			dims = "[" + dims
+		}
+		fmt.Fprintf(b, "    %s %s%s;\n", typeName, fieldName, dims)
+
+		offset = field.offset + field.msl.size
+	}
+
+	if size := int(t.Size()); size > offset {
+		writePadding(size - offset)
+	}
+
+	b.WriteString("};\n")
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_MSLStruct tests that MSLStruct generates the metal declarations for a variety of structs.
+func Test_MSLStruct(t *testing.T) {
+	type Particle struct {
+		Pos  Float3
+		Mass float32
+		_    [3]float32
+	}
+	decl, err := MSLStruct[Particle]()
+	require.Nil(t, err)
+	require.Equal(t, `struct Particle {
+    float3 Pos;
+    float Mass;
+    float _pad0[3];
+};
+`, decl)
+
+	// Padding that Go adds implicitly becomes explicit.
+	type Padded struct {
+		A int8
+		B int32
+		C [2][3]int16
+		D bool
+	}
+	decl, err = MSLStruct[Padded]()
+	require.Nil(t, err)
+	require.Equal(t, `struct Padded {
+    char A;
+    uchar _pad0[3];
+    int B;
+    short C[2][3];
+    bool D;
+    uchar _pad1[3];
+};
+`, decl)
+
+	// Struct tags override the metal type.
+	type Tagged struct {
+		Pos    [3]float32  `metal:"packed_float3"`
+		Mass   float32     `metal:"float"`
+		Counts [4][2]int32 `metal:"atomic_int"`
+		Colors [2]Half4    `metal:"packed_half4"`
+		Normal Float3
+	}
+	decl, err = MSLStruct[Tagged]()
+	require.Nil(t, err)
+	require.Equal(t, `struct Tagged {
+    packed_float3 Pos;
+    float Mass;
+    atomic_int Counts[4][2];
+    packed_half4 Colors[2];
+    float3 Normal;
+};
+`, decl)
+
+	// Nested structs are declared first, and only once.
+	type Inner struct {
+		V Half2
+		B BFloat16
+	}
+	type Outer struct {
+		A     Inner
+		B     [2]Inner
+		Count uint64
+		Flag  bool
+	}
+	decl, err = MSLStruct[Outer]()
+	require.Nil(t, err)
+	require.Equal(t, `struct Inner {
+    half2 V;
+    bfloat B;
+    uchar _pad0[2];
+};
+
+struct Outer {
+    Inner A;
+    Inner B[2];
+    ulong Count;
+    bool Flag;
+    uchar _pad0[7];
+};
+`, decl)
+}
+
+// Test_MSLStruct_invalid tests that MSLStruct returns an error for structs that can't be declared
+// in metal.
+func Test_MSLStruct_invalid(t *testing.T) {
+	// Different layout
+	type Unpadded struct {
+		Pos  Float3
+		Mass float32
+	}
+	decl, err := MSLStruct[Unpadded]()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "24 bytes long in Go but 32 bytes long in metal")
+	require.Equal(t, "", decl)
+
+	// Not a struct
+	decl, err = MSLStruct[int32]()
+	require.NotNil(t, err)
+	require.Equal(t, "int32 is not a struct", err.Error())
+	require.Equal(t, "", decl)
+
+	// Anonymous struct
+	type Anonymous struct {
+		A struct{ B int32 }
+	}
+	decl, err = MSLStruct[Anonymous]()
+	require.NotNil(t, err)
+	require.Equal(t, "Anonymous struct struct { B int32 } can't be declared in metal", err.Error())
+	require.Equal(t, "", decl)
+
+	// Invalid tags
+	type BadTag struct {
+		Pos [3]float32 `metal:"float3"`
+	}
+	decl, err = MSLStruct[BadTag]()
+	require.NotNil(t, err)
+	require.Equal(t, "Struct metal.BadTag has a different layout in Go than in metal:\n"+
+		"  - field Pos: float3 in the struct tag is 16 bytes long but [3]float32 is 12 bytes long", err.Error())
+	require.Equal(t, "", decl)
+
+	type UnknownTag struct {
+		Pos [3]float32 `metal:"vec3"`
+	}
+	decl, err = MSLStruct[UnknownTag]()
+	require.NotNil(t, err)
+	require.Equal(t, "Struct metal.UnknownTag has a different layout in Go than in metal:\n"+
+		"  - field Pos: vec3 in the struct tag is not a supported metal type", err.Error())
+	require.Equal(t, "", decl)
+}
@@ -0,0 +1,580 @@
+package metal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// npyMagic is the string that every .npy file starts with.
+const npyMagic = "\x93NUMPY"
+
+// npyMaxHeaderLen is the longest .npy header that is read. Real headers are only longer than 64 KiB
+// for arrays with many thousands of dimensions, so anything longer than this is treated as a
+// corrupt file rather than allocated.
+const npyMaxHeaderLen = 1 << 20
+
+// npyAlign is the alignment of the data in an .npy file, including the magic string and the header.
+const npyAlign = 64
+
+// An npyDtype describes how the elements of a Go type are stored in an .npy file. Every element has
+// one or more components, which are all of the same NumPy type. The vector types have one component
+// for every field, and their arrays have an extra, last dimension for the components.
+type npyDtype struct {
+	kind       byte // 'i' for signed integers, 'u' for unsigned integers, 'f' for floats
+	size       int  // size in bytes of one component
+	components int
+	elemSize   int // size in bytes of the Go type, including any padding after the components
+}
+
+// npyDtypeOf finds the NumPy type of the components of the Go type t.
+func npyDtypeOf(t reflect.Type) (npyDtype, error) {
+	switch t {
+	case reflect.TypeOf(Float16(0)):
+		return npyDtype{kind: 'f', size: 2, components: 1, elemSize: 2}, nil
+	case reflect.TypeOf(BFloat16(0)):
+		return npyDtype{}, fmt.Errorf("NumPy has no data type for %s", t)
+	}
+
+	if _, ok := vectorTypes[t]; ok {
+		// The components are the exported fields. The blank fields only align the type or pad it.
+		var component reflect.Type
+		numComponents := 0
+		for i := 0; i < t.NumField(); i++ {
+			if field := t.Field(i); field.IsExported() {
+				component = field.Type
+				numComponents++
+			}
+		}
+
+		dtype, err := npyDtypeOf(component)
+		if err != nil {
+			return npyDtype{}, err
+		}
+		dtype.components = numComponents
+		dtype.elemSize = int(t.Size())
+
+		return dtype, nil
+	}
+
+	var kind byte
+	switch t.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		kind = 'i'
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		kind = 'u'
+	case reflect.Float32, reflect.Float64:
+		kind = 'f'
+	default:
+		return npyDtype{}, fmt.Errorf("NumPy has no data type for %s", t)
+	}
+
+	return npyDtype{kind: kind, size: int(t.Size()), components: 1, elemSize: int(t.Size())}, nil
+}
+
+// descr returns the little-endian NumPy type string for the components, such as "<f4".
+func (d npyDtype) descr() string {
+	order := byte('<')
+	if d.size == 1 {
+		order = '|'
+	}
+
+	return fmt.Sprintf("%c%c%d", order, d.kind, d.size)
+}
+
+// padded checks whether or not the Go type has padding after its components.
+func (d npyDtype) padded() bool {
+	return d.components*d.size != d.elemSize
+}
+
+// An npyArray describes the array in an .npy file after its header has been checked against the
+// Go type of the elements.
+type npyArray struct {
+	// shape is the shape of the array in elements. For vector types, it doesn't include the last
+	// dimension of the array in the file, which holds the components.
+	shape        []int
+	fortranOrder bool
+	swap         bool // whether or not the components are big-endian and need their bytes swapped
+	dtype        npyDtype
+}
+
+// readNPYHeader reads the magic string, version, and header of an .npy file from r and checks that
+// the array's data type matches T. The reader is left at the start of the data.
+func readNPYHeader[T any](r io.Reader) (npyArray, error) {
+	var prefix [len(npyMagic) + 2]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return npyArray{}, fmt.Errorf("Unable to read .npy header: %w", err)
+	}
+	if string(prefix[:len(npyMagic)]) != npyMagic {
+		return npyArray{}, errors.New("Missing .npy magic string")
+	}
+
+	var headerLen uint32
+	switch major, minor := prefix[len(npyMagic)], prefix[len(npyMagic)+1]; major {
+	case 1:
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return npyArray{}, fmt.Errorf("Unable to read .npy header: %w", err)
+		}
+		headerLen = uint32(n)
+	case 2, 3:
+		if err := binary.Read(r, binary.LittleEndian, &headerLen); err != nil {
+			return npyArray{}, fmt.Errorf("Unable to read .npy header: %w", err)
+		}
+	default:
+		return npyArray{}, fmt.Errorf("Unsupported .npy version %d.%d", major, minor)
+	}
+	if headerLen > npyMaxHeaderLen {
+		return npyArray{}, fmt.Errorf("Header of %d bytes is too long for an .npy file", headerLen)
+	}
+
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return npyArray{}, fmt.Errorf("Unable to read .npy header: %w", err)
+	}
+
+	descr, fortranOrder, shape, err := parseNPYHeader(string(header))
+	if err != nil {
+		return npyArray{}, err
+	}
+
+	var t T
+	dtype, err := npyDtypeOf(reflect.TypeOf(t))
+	if err != nil {
+		return npyArray{}, err
+	}
+
+	// The byte order doesn't matter for single bytes, and "=" is the native byte order, which is
+	// always little-endian on the machines that run metal.
+	if len(descr) < 3 || !strings.ContainsRune("<>|=", rune(descr[0])) ||
+		descr[1:] != dtype.descr()[1:] {
+		return npyArray{}, fmt.Errorf("Data type %q doesn't match the element type %s", descr,
+			reflect.TypeOf(t))
+	}
+
+	if dtype.components > 1 {
+		if len(shape) == 0 || shape[len(shape)-1] != dtype.components {
+			return npyArray{}, fmt.Errorf("Shape %v doesn't end with the %d components of %s",
+				shape, dtype.components, reflect.TypeOf(t))
+		}
+		shape = shape[:len(shape)-1]
+	}
+
+	// A 0-dimensional array holds a single element.
+	if len(shape) == 0 {
+		shape = []int{1}
+	}
+
+	return npyArray{
+		shape:        shape,
+		fortranOrder: fortranOrder,
+		swap:         descr[0] == '>' && dtype.size > 1,
+		dtype:        dtype,
+	}, nil
+}
+
+// parseNPYHeader parses the header of an .npy file, which is a Python dictionary literal such as
+// {'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }.
+func parseNPYHeader(header string) (descr string, fortranOrder bool, shape []int, err error) {
+	invalid := errors.New("Invalid .npy header")
+
+	p := npyHeaderParser{s: header}
+	if !p.consume('{') {
+		return "", false, nil, invalid
+	}
+
+	seen := map[string]bool{}
+	for !p.consume('}') {
+		key, ok := p.str()
+		if !ok || seen[key] || !p.consume(':') {
+			return "", false, nil, invalid
+		}
+		seen[key] = true
+
+		switch key {
+		case "descr":
+			if descr, ok = p.str(); !ok {
+				// Structured data types are lists of fields instead of strings.
+				return "", false, nil, errors.New("Unsupported structured data type in .npy header")
+			}
+		case "fortran_order":
+			switch p.word() {
+			case "True":
+				fortranOrder = true
+			case "False":
+				fortranOrder = false
+			default:
+				return "", false, nil, invalid
+			}
+		case "shape":
+			if shape, ok = p.tuple(); !ok {
+				return "", false, nil, invalid
+			}
+		default:
+			return "", false, nil, fmt.Errorf("Unknown key %q in .npy header", key)
+		}
+
+		if !p.consume(',') && !p.peek('}') {
+			return "", false, nil, invalid
+		}
+	}
+
+	for _, key := range []string{"descr", "fortran_order", "shape"} {
+		if !seen[key] {
+			return "", false, nil, fmt.Errorf("Missing key %q in .npy header", key)
+		}
+	}
+
+	return descr, fortranOrder, shape, nil
+}
+
+// An npyHeaderParser parses the small subset of Python literals used in .npy headers.
+type npyHeaderParser struct {
+	s   string
+	pos int
+}
+
+// skipSpace moves past any whitespace.
+func (p *npyHeaderParser) skipSpace() {
+	for p.pos < len(p.s) && strings.ContainsRune(" \t\r\n", rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek checks whether or not the next character after any whitespace is c, without consuming it.
+func (p *npyHeaderParser) peek(c byte) bool {
+	p.skipSpace()
+	return p.pos < len(p.s) && p.s[p.pos] == c
+}
+
+// consume moves past the next character after any whitespace if it's c.
+func (p *npyHeaderParser) consume(c byte) bool {
+	if !p.peek(c) {
+		return false
+	}
+	p.pos++
+
+	return true
+}
+
+// str parses a string in single or double quotes. Escape sequences aren't supported, because no
+// valid key or data type needs them.
+func (p *npyHeaderParser) str() (string, bool) {
+	p.skipSpace()
+	if p.pos >= len(p.s) || (p.s[p.pos] != '\'' && p.s[p.pos] != '"') {
+		return "", false
+	}
+
+	quote := p.s[p.pos]
+	end := strings.IndexByte(p.s[p.pos+1:], quote)
+	if end < 0 {
+		return "", false
+	}
+
+	s := p.s[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+
+	return s, true
+}
+
+// word parses a run of letters and digits, such as True or 42.
+func (p *npyHeaderParser) word() string {
+	p.skipSpace()
+
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+
+	return p.s[start:p.pos]
+}
+
+// tuple parses a tuple of non-negative integers, such as (), (3,), or (2, 3).
+func (p *npyHeaderParser) tuple() ([]int, bool) {
+	if !p.consume('(') {
+		return nil, false
+	}
+
+	shape := []int{}
+	for !p.consume(')') {
+		dimLen, err := strconv.Atoi(p.word())
+		if err != nil || dimLen < 0 {
+			return nil, false
+		}
+		shape = append(shape, dimLen)
+
+		if !p.consume(',') && !p.peek(')') {
+			return nil, false
+		}
+	}
+
+	return shape, true
+}
+
+// readNPYData reads the data of the array described by a from r into dst, which must hold exactly
+// as many elements as the array. The elements end up in row-major order with native byte order, no
+// matter how they are stored in the file.
+func readNPYData[T any](r io.Reader, a npyArray, dst []T) error {
+	if len(dst) == 0 {
+		return errors.New("Invalid dimension")
+	}
+	if len(dst) != shapeLen(a.shape) {
+		return fmt.Errorf("Buffer of %d elements doesn't match the %d elements of the array",
+			len(dst), shapeLen(a.shape))
+	}
+
+	d := a.dtype
+	dstBytes := unsafe.Slice((*byte)(unsafe.Pointer(&dst[0])), len(dst)*d.elemSize)
+
+	// In the common case, the file holds the elements exactly as they are laid out in memory.
+	if !a.fortranOrder && !a.swap && !d.padded() {
+		if _, err := io.ReadFull(r, dstBytes); err != nil {
+			return fmt.Errorf("Unable to read .npy data: %w", err)
+		}
+		return nil
+	}
+
+	raw := make([]byte, len(dst)*d.components*d.size)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return fmt.Errorf("Unable to read .npy data: %w", err)
+	}
+
+	if a.swap {
+		for i := 0; i < len(raw); i += d.size {
+			component := raw[i : i+d.size]
+			for j, k := 0, len(component)-1; j < k; j, k = j+1, k-1 {
+				component[j], component[k] = component[k], component[j]
+			}
+		}
+	}
+
+	// Go through the components in row-major order, and find each one in the file.
+	fullShape := a.shape
+	if d.components > 1 {
+		fullShape = append(append([]int(nil), a.shape...), d.components)
+	}
+	srcIndex := identityIndex
+	if a.fortranOrder {
+		srcIndex = fortranIndex(fullShape)
+	}
+
+	for i, n := 0, len(dst)*d.components; i < n; i++ {
+		elem, component := i/d.components, i%d.components
+		dstStart := elem*d.elemSize + component*d.size
+		srcStart := srcIndex(i) * d.size
+		copy(dstBytes[dstStart:dstStart+d.size], raw[srcStart:srcStart+d.size])
+	}
+
+	return nil
+}
+
+// identityIndex returns i, for arrays whose elements are already in row-major order.
+func identityIndex(i int) int {
+	return i
+}
+
+// fortranIndex returns a function that maps the row-major index of every element in an array with
+// the provided shape to its index in column-major (Fortran) order. It must be called with the
+// indexes 0, 1, 2, and so on in turn.
+func fortranIndex(shape []int) func(i int) int {
+	// Column-major strides: the first axis changes the fastest.
+	strides := make([]int, len(shape))
+	stride := 1
+	for axis := range shape {
+		strides[axis] = stride
+		stride *= shape[axis]
+	}
+
+	pos := make([]int, len(shape))
+	index := 0
+
+	return func(i int) int {
+		if i == 0 {
+			return 0
+		}
+
+		// Move to the next position in row-major order, like an odometer.
+		for axis := len(shape) - 1; axis >= 0; axis-- {
+			pos[axis]++
+			index += strides[axis]
+			if pos[axis] < shape[axis] {
+				break
+			}
+			index -= pos[axis] * strides[axis]
+			pos[axis] = 0
+		}
+
+		return index
+	}
+}
+
+// writeNPY writes data, which holds the elements of an array with the provided shape in row-major
+// order, to w as an .npy file.
+func writeNPY[T any](w io.Writer, shape []int, data []T) error {
+	var t T
+	d, err := npyDtypeOf(reflect.TypeOf(t))
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("Invalid dimension")
+	}
+	if len(data) != shapeLen(shape) {
+		return fmt.Errorf("Shape %v doesn't match the %d elements", shape, len(data))
+	}
+
+	if d.components > 1 {
+		shape = append(append([]int(nil), shape...), d.components)
+	}
+
+	if err := writeNPYHeader(w, d.descr(), shape); err != nil {
+		return err
+	}
+
+	dataBytes := unsafe.Slice((*byte)(unsafe.Pointer(&data[0])), len(data)*d.elemSize)
+	if !d.padded() {
+		_, err := w.Write(dataBytes)
+		return err
+	}
+
+	// Leave out the padding at the end of every element.
+	packed := make([]byte, 0, len(data)*d.components*d.size)
+	for i := 0; i < len(dataBytes); i += d.elemSize {
+		packed = append(packed, dataBytes[i:i+d.components*d.size]...)
+	}
+	_, err = w.Write(packed)
+
+	return err
+}
+
+// writeNPYHeader writes the magic string, version, and header of an .npy file for a row-major array
+// with the provided NumPy type string and shape. The header is padded so that the data starts on a
+// multiple of 64 bytes.
+func writeNPYHeader(w io.Writer, descr string, shape []int) error {
+	dims := make([]string, len(shape))
+	for i, dimLen := range shape {
+		dims[i] = strconv.Itoa(dimLen)
+	}
+	tuple := "(" + strings.Join(dims, ", ") + ")"
+	if len(shape) == 1 {
+		tuple = "(" + dims[0] + ",)"
+	}
+
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': %s, }", descr, tuple)
+
+	// Version 1.0 stores the length of the header in 2 bytes, and version 2.0 in 4.
+	version, prefixLen := byte(1), len(npyMagic)+2+2
+	if prefixLen+len(header)+npyAlign > 1<<16 {
+		version, prefixLen = 2, len(npyMagic)+2+4
+	}
+
+	padLen := alignUp(prefixLen+len(header)+1, npyAlign) - prefixLen - len(header) - 1
+	header += strings.Repeat(" ", padLen) + "\n"
+
+	var buf bytes.Buffer
+	buf.WriteString(npyMagic)
+	buf.Write([]byte{version, 0})
+	if version == 1 {
+		binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+	} else {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(header)))
+	}
+	buf.WriteString(header)
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// An NPZReader reads arrays from an .npz archive, which is a zip file of .npy files that NumPy
+// creates with savez and savez_compressed. Create one with NewNPZReader, and read its arrays with
+// ReadNPZ.
+type NPZReader struct {
+	files map[string]*zip.File
+}
+
+// NewNPZReader creates a reader for the .npz archive in r, which has size bytes.
+func NewNPZReader(r io.ReaderAt, size int64) (*NPZReader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read .npz archive: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[strings.TrimSuffix(f.Name, ".npy")] = f
+	}
+
+	return &NPZReader{files: files}, nil
+}
+
+// Names returns the names of the arrays in the archive, in sorted order. These are the keyword
+// names that were supplied to savez, or arr_0, arr_1, and so on for arrays that had none.
+func (z *NPZReader) Names() []string {
+	names := make([]string, 0, len(z.files))
+	for name := range z.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// open opens the .npy file of the array with the provided name.
+func (z *NPZReader) open(name string) (io.ReadCloser, error) {
+	f, ok := z.files[name]
+	if !ok {
+		return nil, fmt.Errorf("Missing array %q in .npz archive", name)
+	}
+
+	return f.Open()
+}
+
+// An NPZWriter writes arrays to an .npz archive that NumPy can load with load. Create one with
+// NewNPZWriter, add arrays to it with WriteNPZ, and finish the archive with Close.
+type NPZWriter struct {
+	zw    *zip.Writer
+	names map[string]bool
+}
+
+// NewNPZWriter creates a writer that writes an .npz archive to w. The arrays are stored without
+// compression, like NumPy's savez does.
+func NewNPZWriter(w io.Writer) *NPZWriter {
+	return &NPZWriter{
+		zw:    zip.NewWriter(w),
+		names: map[string]bool{},
+	}
+}
+
+// create starts the .npy file of a new array with the provided name.
+func (z *NPZWriter) create(name string) (io.Writer, error) {
+	if name == "" {
+		return nil, errors.New("Missing array name")
+	}
+	if z.names[name] {
+		return nil, fmt.Errorf("Duplicate array %q in .npz archive", name)
+	}
+	z.names[name] = true
+
+	return z.zw.CreateHeader(&zip.FileHeader{
+		Name:   name + ".npy",
+		Method: zip.Store,
+	})
+}
+
+// Close finishes writing the archive. It doesn't close the underlying writer.
+func (z *NPZWriter) Close() error {
+	return z.zw.Close()
+}
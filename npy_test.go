@@ -0,0 +1,359 @@
+package metal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// npyFile builds an .npy file with version 1.0 from a header and the raw data.
+func npyFile(header string, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(npyMagic)
+	buf.Write([]byte{1, 0})
+	binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	buf.Write(data)
+
+	return buf.Bytes()
+}
+
+// float32Bytes returns the raw bytes of values in the provided byte order.
+func float32Bytes(order binary.ByteOrder, values ...float32) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, order, values)
+
+	return buf.Bytes()
+}
+
+// Test_npyDtypeOf tests that npyDtypeOf maps Go types to the matching NumPy types.
+func Test_npyDtypeOf(t *testing.T) {
+	type scenario struct {
+		value      any
+		wantDescr  string
+		wantComps  int
+		wantPadded bool
+		wantErr    string
+	}
+
+	for _, s := range []scenario{
+		{int8(0), "|i1", 1, false, ""},
+		{int16(0), "<i2", 1, false, ""},
+		{int32(0), "<i4", 1, false, ""},
+		{int64(0), "<i8", 1, false, ""},
+		{uint8(0), "|u1", 1, false, ""},
+		{uint16(0), "<u2", 1, false, ""},
+		{uint32(0), "<u4", 1, false, ""},
+		{uint64(0), "<u8", 1, false, ""},
+		{float32(0), "<f4", 1, false, ""},
+		{float64(0), "<f8", 1, false, ""},
+		{Float16(0), "<f2", 1, false, ""},
+		{Float2{}, "<f4", 2, false, ""},
+		{Float3{}, "<f4", 3, true, ""},
+		{Float4{}, "<f4", 4, false, ""},
+		{PackedFloat3{}, "<f4", 3, false, ""},
+		{Half3{}, "<f2", 3, true, ""},
+		{Int3{}, "<i4", 3, true, ""},
+		{UInt4{}, "<u4", 4, false, ""},
+		{BFloat16(0), "", 0, false, "NumPy has no data type for metal.BFloat16"},
+		{true, "", 0, false, "NumPy has no data type for bool"},
+		{struct{ X float32 }{}, "", 0, false, "NumPy has no data type for struct { X float32 }"},
+	} {
+		dtype, err := npyDtypeOf(reflect.TypeOf(s.value))
+		if s.wantErr != "" {
+			require.NotNil(t, err)
+			require.Equal(t, s.wantErr, err.Error())
+			continue
+		}
+		require.Nil(t, err, "%T: %s", s.value, err)
+		require.Equal(t, s.wantDescr, dtype.descr(), "%T", s.value)
+		require.Equal(t, s.wantComps, dtype.components, "%T", s.value)
+		require.Equal(t, s.wantPadded, dtype.padded(), "%T", s.value)
+		require.Equal(t, int(reflect.TypeOf(s.value).Size()), dtype.elemSize, "%T", s.value)
+	}
+}
+
+// Test_parseNPYHeader tests that parseNPYHeader parses valid headers and rejects invalid ones.
+func Test_parseNPYHeader(t *testing.T) {
+	descr, fortranOrder, shape, err := parseNPYHeader(
+		"{'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }" + strings.Repeat(" ", 10) + "\n")
+	require.Nil(t, err, "Unable to parse header: %s", err)
+	require.Equal(t, "<f4", descr)
+	require.False(t, fortranOrder)
+	require.Equal(t, []int{2, 3}, shape)
+
+	// The order of the keys doesn't matter, and neither do the quotes or the trailing comma.
+	descr, fortranOrder, shape, err = parseNPYHeader(`{"shape": (5,), "fortran_order": True, "descr": ">i8"}`)
+	require.Nil(t, err, "Unable to parse header: %s", err)
+	require.Equal(t, ">i8", descr)
+	require.True(t, fortranOrder)
+	require.Equal(t, []int{5}, shape)
+
+	_, _, shape, err = parseNPYHeader("{'descr': '|u1', 'fortran_order': False, 'shape': (), }")
+	require.Nil(t, err, "Unable to parse header: %s", err)
+	require.Equal(t, []int{}, shape)
+
+	type scenario struct {
+		header  string
+		wantErr string
+	}
+
+	for _, s := range []scenario{
+		{"", "Invalid .npy header"},
+		{"{'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), ", "Invalid .npy header"},
+		{"{'descr': '<f4' 'fortran_order': False, 'shape': (2, 3)}", "Invalid .npy header"},
+		{"{'descr': '<f4', 'fortran_order': false, 'shape': (2, 3)}", "Invalid .npy header"},
+		{"{'descr': '<f4', 'fortran_order': False, 'shape': (2, -3)}", "Invalid .npy header"},
+		{"{'descr': '<f4', 'fortran_order': False, 'shape': (2 3)}", "Invalid .npy header"},
+		{"{'descr': '<f4', 'descr': '<f4', 'fortran_order': False, 'shape': (2,)}", "Invalid .npy header"},
+		{"{'descr': [('x', '<f4')], 'fortran_order': False, 'shape': (2,)}",
+			"Unsupported structured data type in .npy header"},
+		{"{'descr': '<f4', 'fortran_order': False, 'shape': (2,), 'extra': 1}",
+			"Unknown key \"extra\" in .npy header"},
+		{"{'descr': '<f4', 'fortran_order': False}", "Missing key \"shape\" in .npy header"},
+	} {
+		_, _, _, err := parseNPYHeader(s.header)
+		require.NotNil(t, err, s.header)
+		require.Equal(t, s.wantErr, err.Error(), s.header)
+	}
+}
+
+// Test_readNPYHeader tests that readNPYHeader checks the file's format and data type.
+func Test_readNPYHeader(t *testing.T) {
+	// This is the header that NumPy writes for an array of float32 with shape (2, 3).
+	header := "{'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }" +
+		strings.Repeat(" ", 58) + "\n"
+	a, err := readNPYHeader[float32](bytes.NewReader(npyFile(header, nil)))
+	require.Nil(t, err, "Unable to read header: %s", err)
+	require.Equal(t, []int{2, 3}, a.shape)
+	require.False(t, a.fortranOrder)
+	require.False(t, a.swap)
+
+	// Big-endian data needs to be swapped, but single bytes don't.
+	a, err = readNPYHeader[int32](bytes.NewReader(npyFile("{'descr': '>i4', 'fortran_order': False, 'shape': (4,), }\n", nil)))
+	require.Nil(t, err, "Unable to read header: %s", err)
+	require.True(t, a.swap)
+	a, err = readNPYHeader[uint8](bytes.NewReader(npyFile("{'descr': '|u1', 'fortran_order': False, 'shape': (4,), }\n", nil)))
+	require.Nil(t, err, "Unable to read header: %s", err)
+	require.False(t, a.swap)
+
+	// The last dimension of a vector array holds the components.
+	a, err = readNPYHeader[Float3](bytes.NewReader(npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (5, 3), }\n", nil)))
+	require.Nil(t, err, "Unable to read header: %s", err)
+	require.Equal(t, []int{5}, a.shape)
+	_, err = readNPYHeader[Float3](bytes.NewReader(npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (5, 4), }\n", nil)))
+	require.NotNil(t, err)
+	require.Equal(t, "Shape [5 4] doesn't end with the 3 components of metal.Float3", err.Error())
+
+	// A 0-dimensional array holds one element.
+	a, err = readNPYHeader[float64](bytes.NewReader(npyFile("{'descr': '<f8', 'fortran_order': False, 'shape': (), }\n", nil)))
+	require.Nil(t, err, "Unable to read header: %s", err)
+	require.Equal(t, []int{1}, a.shape)
+
+	// Version 2.0 stores the length of the header in 4 bytes.
+	var buf bytes.Buffer
+	buf.WriteString(npyMagic + "\x02\x00")
+	v2Header := "{'descr': '<f2', 'fortran_order': True, 'shape': (7,), }\n"
+	binary.Write(&buf, binary.LittleEndian, uint32(len(v2Header)))
+	buf.WriteString(v2Header)
+	a, err = readNPYHeader[Float16](&buf)
+	require.Nil(t, err, "Unable to read header: %s", err)
+	require.Equal(t, []int{7}, a.shape)
+	require.True(t, a.fortranOrder)
+
+	_, err = readNPYHeader[float32](bytes.NewReader(npyFile(header, nil)[:5]))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to read .npy header: unexpected EOF", err.Error())
+
+	_, err = readNPYHeader[float32](strings.NewReader("PK\x03\x04 not an npy file"))
+	require.NotNil(t, err)
+	require.Equal(t, "Missing .npy magic string", err.Error())
+
+	_, err = readNPYHeader[float32](strings.NewReader(npyMagic + "\x04\x00\x00\x00"))
+	require.NotNil(t, err)
+	require.Equal(t, "Unsupported .npy version 4.0", err.Error())
+
+	_, err = readNPYHeader[float32](strings.NewReader(npyMagic + "\x02\x00\xff\xff\xff\xff"))
+	require.NotNil(t, err)
+	require.Equal(t, "Header of 4294967295 bytes is too long for an .npy file", err.Error())
+
+	_, err = readNPYHeader[float64](bytes.NewReader(npyFile(header, nil)))
+	require.NotNil(t, err)
+	require.Equal(t, "Data type \"<f4\" doesn't match the element type float64", err.Error())
+
+	_, err = readNPYHeader[int32](bytes.NewReader(npyFile(header, nil)))
+	require.NotNil(t, err)
+	require.Equal(t, "Data type \"<f4\" doesn't match the element type int32", err.Error())
+
+	_, err = readNPYHeader[BFloat16](bytes.NewReader(npyFile(header, nil)))
+	require.NotNil(t, err)
+	require.Equal(t, "NumPy has no data type for metal.BFloat16", err.Error())
+}
+
+// Test_readNPYData tests that readNPYData reads the elements into row-major order with native byte
+// order.
+func Test_readNPYData(t *testing.T) {
+	values := []float32{0, 1.5, 2, 3, 4, 5}
+
+	// Little-endian, row-major data is read as is.
+	dst := make([]float32, 6)
+	a := npyArray{shape: []int{2, 3}, dtype: npyDtype{'f', 4, 1, 4}}
+	err := readNPYData(bytes.NewReader(float32Bytes(binary.LittleEndian, values...)), a, dst)
+	require.Nil(t, err, "Unable to read data: %s", err)
+	require.Equal(t, values, dst)
+
+	// Big-endian data is swapped.
+	dst = make([]float32, 6)
+	a.swap = true
+	err = readNPYData(bytes.NewReader(float32Bytes(binary.BigEndian, values...)), a, dst)
+	require.Nil(t, err, "Unable to read data: %s", err)
+	require.Equal(t, values, dst)
+
+	// Column-major data is reordered.
+	dst = make([]float32, 6)
+	a.swap, a.fortranOrder = false, true
+	err = readNPYData(bytes.NewReader(float32Bytes(binary.LittleEndian, 0, 3, 1.5, 4, 2, 5)), a, dst)
+	require.Nil(t, err, "Unable to read data: %s", err)
+	require.Equal(t, values, dst)
+
+	// Padded vectors get their components spread out.
+	vectors := make([]Float3, 2)
+	a = npyArray{shape: []int{2}, dtype: npyDtype{'f', 4, 3, 16}}
+	err = readNPYData(bytes.NewReader(float32Bytes(binary.LittleEndian, values...)), a, vectors)
+	require.Nil(t, err, "Unable to read data: %s", err)
+	require.Equal(t, []Float3{{X: 0, Y: 1.5, Z: 2}, {X: 3, Y: 4, Z: 5}}, vectors)
+
+	// Column-major vectors have the components as their slowest axis.
+	vectors = make([]Float3, 2)
+	a.fortranOrder = true
+	err = readNPYData(bytes.NewReader(float32Bytes(binary.LittleEndian, 0, 3, 1.5, 4, 2, 5)), a, vectors)
+	require.Nil(t, err, "Unable to read data: %s", err)
+	require.Equal(t, []Float3{{X: 0, Y: 1.5, Z: 2}, {X: 3, Y: 4, Z: 5}}, vectors)
+
+	a = npyArray{shape: []int{2, 3}, dtype: npyDtype{'f', 4, 1, 4}}
+	err = readNPYData(bytes.NewReader(float32Bytes(binary.LittleEndian, values[:5]...)), a, make([]float32, 6))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to read .npy data: unexpected EOF", err.Error())
+
+	err = readNPYData(bytes.NewReader(nil), a, make([]float32, 5))
+	require.NotNil(t, err)
+	require.Equal(t, "Buffer of 5 elements doesn't match the 6 elements of the array", err.Error())
+}
+
+// Test_fortranIndex tests that fortranIndex maps row-major indexes to column-major ones.
+func Test_fortranIndex(t *testing.T) {
+	index := fortranIndex([]int{2, 3})
+	for i, want := range []int{0, 2, 4, 1, 3, 5} {
+		require.Equal(t, want, index(i))
+	}
+
+	index = fortranIndex([]int{2, 3, 4})
+	var got []int
+	for i := 0; i < 24; i++ {
+		got = append(got, index(i))
+	}
+	// The element at (i, j, k) is at i + 2j + 6k in column-major order.
+	var want []int
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 4; k++ {
+				want = append(want, i+2*j+6*k)
+			}
+		}
+	}
+	require.Equal(t, want, got)
+}
+
+// Test_writeNPY tests that writeNPY writes files that NumPy, and readNPYHeader and readNPYData,
+// can read.
+func Test_writeNPY(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeNPY(&buf, []int{2, 3}, []float32{0, 1.5, 2, 3, 4, 5})
+	require.Nil(t, err, "Unable to write file: %s", err)
+
+	// This is exactly what NumPy writes.
+	header := "{'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }" +
+		strings.Repeat(" ", 58) + "\n"
+	require.Equal(t, npyFile(header, float32Bytes(binary.LittleEndian, 0, 1.5, 2, 3, 4, 5)), buf.Bytes())
+
+	// The padding of vectors is left out.
+	buf.Reset()
+	vectors := []Int3{{X: 1, Y: 2, Z: 3}, {X: 4, Y: 5, Z: 6}}
+	err = writeNPY(&buf, []int{2}, vectors)
+	require.Nil(t, err, "Unable to write file: %s", err)
+	require.Equal(t, 0, (buf.Len()-24)%npyAlign)
+
+	a, err := readNPYHeader[Int3](&buf)
+	require.Nil(t, err, "Unable to read header: %s", err)
+	require.Equal(t, []int{2}, a.shape)
+	require.Equal(t, 24, buf.Len())
+	got := make([]Int3, 2)
+	require.Nil(t, readNPYData(&buf, a, got))
+	require.Equal(t, vectors, got)
+
+	// Headers that don't fit in 2 bytes need version 2.0.
+	buf.Reset()
+	shape := make([]int, 30_000)
+	for i := range shape {
+		shape[i] = 1
+	}
+	err = writeNPY(&buf, shape, []uint8{42})
+	require.Nil(t, err, "Unable to write file: %s", err)
+	require.Equal(t, byte(2), buf.Bytes()[len(npyMagic)])
+	require.Equal(t, 0, (buf.Len()-1)%npyAlign)
+	a, err = readNPYHeader[uint8](&buf)
+	require.Nil(t, err, "Unable to read header: %s", err)
+	require.Equal(t, shape, a.shape)
+
+	err = writeNPY(io.Discard, []int{2, 2}, []float32{1, 2, 3})
+	require.NotNil(t, err)
+	require.Equal(t, "Shape [2 2] doesn't match the 3 elements", err.Error())
+
+	err = writeNPY(io.Discard, []int{1}, []BFloat16{1})
+	require.NotNil(t, err)
+	require.Equal(t, "NumPy has no data type for metal.BFloat16", err.Error())
+}
+
+// Test_NPZ tests that arrays written to an .npz archive can be read back by name.
+func Test_NPZ(t *testing.T) {
+	var buf bytes.Buffer
+	zw := NewNPZWriter(&buf)
+	for _, name := range []string{"weights", "bias"} {
+		f, err := zw.create(name)
+		require.Nil(t, err, "Unable to add array: %s", err)
+		require.Nil(t, writeNPY(f, []int{3}, []float32{1, 2, float32(len(name))}))
+	}
+	_, err := zw.create("bias")
+	require.NotNil(t, err)
+	require.Equal(t, "Duplicate array \"bias\" in .npz archive", err.Error())
+	_, err = zw.create("")
+	require.NotNil(t, err)
+	require.Equal(t, "Missing array name", err.Error())
+	require.Nil(t, zw.Close())
+
+	zr, err := NewNPZReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.Nil(t, err, "Unable to read archive: %s", err)
+	require.Equal(t, []string{"bias", "weights"}, zr.Names())
+
+	f, err := zr.open("weights")
+	require.Nil(t, err, "Unable to open array: %s", err)
+	defer f.Close()
+	a, err := readNPYHeader[float32](f)
+	require.Nil(t, err, "Unable to read header: %s", err)
+	got := make([]float32, 3)
+	require.Nil(t, readNPYData(f, a, got))
+	require.Equal(t, []float32{1, 2, 7}, got)
+
+	_, err = zr.open("missing")
+	require.NotNil(t, err)
+	require.Equal(t, "Missing array \"missing\" in .npz archive", err.Error())
+
+	_, err = NewNPZReader(strings.NewReader("not a zip file"), 14)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to read .npz archive: zip: not a valid zip file", err.Error())
+}
@@ -0,0 +1,76 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"io"
+)
+
+// ReadNPY reads an array in NumPy's .npy format from r into a new tensor with the same shape. The
+// data type of the array must match T: int8 through int64, uint8 through uint64, float32, and
+// float64 match the NumPy types of the same names, and Float16 matches float16. An array for one of
+// the vector types has an extra, last dimension with one entry for every component, such as (N, 4)
+// for N Float4s, which becomes the tensor's shape of (N).
+//
+// Arrays in either byte order and in either row-major (C) or column-major (Fortran) order are
+// supported. The tensor always holds its elements in row-major order.
+func ReadNPY[T BufferType](r io.Reader) (*Tensor[T], error) {
+	a, err := readNPYHeader[T](r)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := NewTensor[T](a.shape...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := readNPYData(r, a, t.data); err != nil {
+		releaseBuffer(t.id)
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// WriteNPY writes the elements of the tensor to w in NumPy's .npy format, with the tensor's shape.
+// This works for any view, whether or not its elements are contiguous. See ReadNPY for how the
+// element types map to NumPy types. BFloat16 has no NumPy equivalent and can't be written.
+func WriteNPY[T BufferType](w io.Writer, t *Tensor[T]) error {
+	return writeNPY(w, t.shape, contiguousData(t))
+}
+
+// WriteNPYData writes data, such as the slice returned by NewBuffer1D, to w in NumPy's .npy format.
+// The elements are in row-major order, and the shape must match their number. With no shape, the
+// array has 1 dimension.
+func WriteNPYData[T BufferType](w io.Writer, data []T, shape ...int) error {
+	if len(shape) == 0 {
+		shape = []int{len(data)}
+	}
+
+	return writeNPY(w, shape, data)
+}
+
+// ReadNPZ reads the array with the provided name from an .npz archive into a new tensor, the same
+// way that ReadNPY does.
+func ReadNPZ[T BufferType](z *NPZReader, name string) (*Tensor[T], error) {
+	f, err := z.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadNPY[T](f)
+}
+
+// WriteNPZ adds the tensor to an .npz archive as an array with the provided name, the same way that
+// WriteNPY writes it. Every name can only be used once.
+func WriteNPZ[T BufferType](z *NPZWriter, name string, t *Tensor[T]) error {
+	f, err := z.create(name)
+	if err != nil {
+		return err
+	}
+
+	return WriteNPY(f, t)
+}
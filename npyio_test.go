@@ -0,0 +1,134 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_ReadNPY tests that tensors written with WriteNPY can be read back with ReadNPY.
+func Test_ReadNPY(t *testing.T) {
+	tensor, err := NewTensor[float32](2, 3)
+	require.Nil(t, err, "Unable to create tensor: %s", err)
+	require.True(t, validId(tensor.Id()))
+	for i := range tensor.Data() {
+		tensor.Data()[i] = float32(i) * 1.5
+	}
+
+	var buf bytes.Buffer
+	require.Nil(t, WriteNPY(&buf, tensor))
+
+	got, err := ReadNPY[float32](&buf)
+	require.Nil(t, err, "Unable to read .npy file: %s", err)
+	require.True(t, validId(got.Id()))
+	require.Equal(t, []int{2, 3}, got.Shape())
+	require.Equal(t, tensor.Data(), got.Data())
+
+	// Views that aren't contiguous are written in row-major order.
+	transposed, err := tensor.Transpose()
+	require.Nil(t, err, "Unable to transpose tensor: %s", err)
+	buf.Reset()
+	require.Nil(t, WriteNPY(&buf, transposed))
+
+	got, err = ReadNPY[float32](&buf)
+	require.Nil(t, err, "Unable to read .npy file: %s", err)
+	require.True(t, validId(got.Id()))
+	require.Equal(t, []int{3, 2}, got.Shape())
+	require.Equal(t, []float32{0, 4.5, 1.5, 6, 3, 7.5}, got.Data())
+
+	// Vectors get an extra dimension for their components.
+	vectors, err := NewTensor[Float3](2)
+	require.Nil(t, err, "Unable to create tensor: %s", err)
+	require.True(t, validId(vectors.Id()))
+	vectors.Set(Float3{X: 1, Y: 2, Z: 3}, 0)
+	vectors.Set(Float3{X: 4, Y: 5, Z: 6}, 1)
+	buf.Reset()
+	require.Nil(t, WriteNPY(&buf, vectors))
+	require.Contains(t, buf.String(), "'shape': (2, 3)")
+
+	gotVectors, err := ReadNPY[Float3](&buf)
+	require.Nil(t, err, "Unable to read .npy file: %s", err)
+	require.True(t, validId(gotVectors.Id()))
+	require.Equal(t, vectors.Data(), gotVectors.Data())
+
+	// Slices from the other buffer functions can be written too.
+	bufferId, data, err := NewBuffer1D[int16](4)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(bufferId))
+	copy(data, []int16{1, -2, 3, -4})
+	buf.Reset()
+	require.Nil(t, WriteNPYData(&buf, data, 2, 2))
+
+	gotInts, err := ReadNPY[int16](&buf)
+	require.Nil(t, err, "Unable to read .npy file: %s", err)
+	require.True(t, validId(gotInts.Id()))
+	require.Equal(t, []int{2, 2}, gotInts.Shape())
+	require.Equal(t, data, gotInts.Data())
+
+	// The data type must match.
+	buf.Reset()
+	require.Nil(t, WriteNPY(&buf, tensor))
+	_, err = ReadNPY[int32](&buf)
+	require.NotNil(t, err)
+	require.Equal(t, "Data type \"<f4\" doesn't match the element type int32", err.Error())
+
+	// A file that ends early doesn't leave a buffer behind.
+	before := Memory()
+	buf.Reset()
+	require.Nil(t, WriteNPY(&buf, tensor))
+	_, err = ReadNPY[float32](bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to read .npy data: unexpected EOF", err.Error())
+	addId()
+	require.Equal(t, before.Allocation, Memory().Allocation)
+
+	_, err = ReadNPY[float32](strings.NewReader("not an npy file"))
+	require.NotNil(t, err)
+	require.Equal(t, "Missing .npy magic string", err.Error())
+}
+
+// Test_ReadNPZ tests that tensors written to an .npz archive with WriteNPZ can be read back with
+// ReadNPZ.
+func Test_ReadNPZ(t *testing.T) {
+	weights, err := NewTensor[float32](4, 2)
+	require.Nil(t, err, "Unable to create tensor: %s", err)
+	require.True(t, validId(weights.Id()))
+	for i := range weights.Data() {
+		weights.Data()[i] = float32(i)
+	}
+	bias, err := NewTensor[Float16](2)
+	require.Nil(t, err, "Unable to create tensor: %s", err)
+	require.True(t, validId(bias.Id()))
+	bias.Set(NewFloat16(0.5), 0)
+	bias.Set(NewFloat16(-1), 1)
+
+	var buf bytes.Buffer
+	zw := NewNPZWriter(&buf)
+	require.Nil(t, WriteNPZ(zw, "weights", weights))
+	require.Nil(t, WriteNPZ(zw, "bias", bias))
+	require.Nil(t, zw.Close())
+
+	zr, err := NewNPZReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.Nil(t, err, "Unable to read .npz archive: %s", err)
+	require.Equal(t, []string{"bias", "weights"}, zr.Names())
+
+	gotWeights, err := ReadNPZ[float32](zr, "weights")
+	require.Nil(t, err, "Unable to read array: %s", err)
+	require.True(t, validId(gotWeights.Id()))
+	require.Equal(t, []int{4, 2}, gotWeights.Shape())
+	require.Equal(t, weights.Data(), gotWeights.Data())
+
+	gotBias, err := ReadNPZ[Float16](zr, "bias")
+	require.Nil(t, err, "Unable to read array: %s", err)
+	require.True(t, validId(gotBias.Id()))
+	require.Equal(t, bias.Data(), gotBias.Data())
+
+	_, err = ReadNPZ[float32](zr, "missing")
+	require.NotNil(t, err)
+	require.Equal(t, "Missing array \"missing\" in .npz archive", err.Error())
+}
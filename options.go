@@ -0,0 +1,84 @@
+package metal
+
+import (
+	"errors"
+)
+
+// A StorageMode determines where the memory for a buffer is located and whether the CPU, the GPU,
+// or both can access it. The values match Apple's MTLStorageMode.
+type StorageMode int
+
+const (
+	// StorageShared buffers are stored in memory that both the CPU and GPU can access. This is the
+	// default.
+	StorageShared StorageMode = 0
+
+	// StorageManaged buffers have one copy for the CPU and one for the GPU, which are kept in sync
+	// whenever a metal function is run. On Apple silicon, this is the same as StorageShared.
+	StorageManaged StorageMode = 1
+
+	// StoragePrivate buffers are stored in memory that only the GPU can access. They are the fastest
+	// choice for intermediate results that the CPU never needs. Their contents can be copied to and
+	// from the CPU with Upload and Download.
+	StoragePrivate StorageMode = 2
+)
+
+// A CPUCacheMode determines how the CPU caches a buffer's memory. The values match Apple's
+// MTLCPUCacheMode.
+type CPUCacheMode int
+
+const (
+	// CPUCacheDefault guarantees that the CPU's reads and writes happen in order. This is the
+	// default.
+	CPUCacheDefault CPUCacheMode = 0
+
+	// CPUCacheWriteCombined is optimized for buffers that the CPU writes to but never reads from.
+	// Reading from them on the CPU is very slow.
+	CPUCacheWriteCombined CPUCacheMode = 1
+)
+
+// A HazardTrackingMode determines whether or not metal prevents functions from accessing a buffer
+// at the same time. The values match Apple's MTLHazardTrackingMode.
+type HazardTrackingMode int
+
+const (
+	// HazardTrackingDefault uses metal's default, which is to track buffers. This is the default.
+	HazardTrackingDefault HazardTrackingMode = 0
+
+	// HazardTrackingUntracked leaves it up to the caller to avoid conflicting access to the buffer.
+	HazardTrackingUntracked HazardTrackingMode = 1
+
+	// HazardTrackingTracked makes metal prevent conflicting access to the buffer.
+	HazardTrackingTracked HazardTrackingMode = 2
+)
+
+// BufferOptions are the settings for creating a buffer with NewBufferWithOptions. The zero value
+// is the same as the settings that NewBuffer1D, NewBuffer2D, and NewBuffer3D use.
+type BufferOptions struct {
+	Storage        StorageMode
+	CPUCache       CPUCacheMode
+	HazardTracking HazardTrackingMode
+}
+
+// resourceOptions checks the options and packs them into an MTLResourceOptions value. The CPU
+// cache mode is stored in bits 0-3, the storage mode in bits 4-7, and the hazard tracking mode in
+// bits 8-9.
+func (o BufferOptions) resourceOptions() (uint64, error) {
+	if o.Storage < StorageShared || o.Storage > StoragePrivate {
+		return 0, errors.New("Invalid storage mode")
+	}
+	if o.CPUCache < CPUCacheDefault || o.CPUCache > CPUCacheWriteCombined {
+		return 0, errors.New("Invalid CPU cache mode")
+	}
+	if o.HazardTracking < HazardTrackingDefault || o.HazardTracking > HazardTrackingTracked {
+		return 0, errors.New("Invalid hazard tracking mode")
+	}
+
+	return uint64(o.CPUCache) | uint64(o.Storage)<<4 | uint64(o.HazardTracking)<<8, nil
+}
+
+// cpuAccessible checks whether or not the CPU can access the memory of a buffer created with these
+// options.
+func (o BufferOptions) cpuAccessible() bool {
+	return o.Storage != StoragePrivate
+}
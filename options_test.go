@@ -0,0 +1,52 @@
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_BufferOptions_resourceOptions tests that resourceOptions packs the options the same way as
+// MTLResourceOptions and rejects invalid options.
+func Test_BufferOptions_resourceOptions(t *testing.T) {
+	type scenario struct {
+		options BufferOptions
+		want    uint64
+		wantErr string
+	}
+
+	for _, s := range []scenario{
+		// MTLResourceStorageModeShared | MTLResourceCPUCacheModeDefaultCache
+		{BufferOptions{}, 0, ""},
+		// MTLResourceStorageModeManaged
+		{BufferOptions{Storage: StorageManaged}, 0x10, ""},
+		// MTLResourceStorageModePrivate
+		{BufferOptions{Storage: StoragePrivate}, 0x20, ""},
+		// MTLResourceCPUCacheModeWriteCombined
+		{BufferOptions{CPUCache: CPUCacheWriteCombined}, 0x1, ""},
+		// MTLResourceHazardTrackingModeUntracked
+		{BufferOptions{HazardTracking: HazardTrackingUntracked}, 0x100, ""},
+		// MTLResourceHazardTrackingModeTracked
+		{BufferOptions{HazardTracking: HazardTrackingTracked}, 0x200, ""},
+		{BufferOptions{StoragePrivate, CPUCacheWriteCombined, HazardTrackingUntracked}, 0x121, ""},
+
+		{BufferOptions{Storage: -1}, 0, "Invalid storage mode"},
+		{BufferOptions{Storage: 3}, 0, "Invalid storage mode"},
+		{BufferOptions{CPUCache: 2}, 0, "Invalid CPU cache mode"},
+		{BufferOptions{HazardTracking: 3}, 0, "Invalid hazard tracking mode"},
+	} {
+		got, err := s.options.resourceOptions()
+		if s.wantErr != "" {
+			require.NotNil(t, err, "%v", s)
+			require.Equal(t, s.wantErr, err.Error(), "%v", s)
+			continue
+		}
+
+		require.Nil(t, err, "%v", s)
+		require.Equal(t, s.want, got, "%v", s)
+	}
+
+	require.True(t, BufferOptions{}.cpuAccessible())
+	require.True(t, BufferOptions{Storage: StorageManaged}.cpuAccessible())
+	require.False(t, BufferOptions{Storage: StoragePrivate}.cpuAccessible())
+}
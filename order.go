@@ -0,0 +1,167 @@
+package metal
+
+import (
+	"fmt"
+)
+
+// A Layout is the order in which the dimensions of a multi-dimensional buffer are laid out in
+// memory. The dimensions are numbered in the order they are supplied to the constructors: 0 for X
+// (width), 1 for Y (height), and 2 for Z (depth). The zero value is ColumnMajor.
+//
+// The slices returned for a buffer are nested in the same order as its layout: the outermost slice
+// is indexed by the dimension that changes the slowest in memory.
+type Layout struct {
+	major layoutMajor
+	axes  []int
+}
+
+// A layoutMajor is one of the kinds of layout.
+type layoutMajor int
+
+const (
+	columnMajor layoutMajor = iota
+	rowMajor
+	customOrder
+)
+
+var (
+	// ColumnMajor lays out X as the dimension that changes the slowest and the last dimension as the
+	// one that changes the fastest, so the element at (x, y, z) is at index (x*height + y)*depth + z
+	// and the slices are indexed as [x][y][z]. Every column of a 2-dimensional buffer is contiguous.
+	// This is the default.
+	ColumnMajor = Layout{major: columnMajor}
+
+	// RowMajor lays out X as the dimension that changes the fastest, so the element at (x, y, z) is
+	// at index (z*height + y)*width + x and the slices are indexed as [z][y][x]. Every row of a
+	// 2-dimensional buffer is contiguous, which is the usual convention for images and matrices.
+	RowMajor = Layout{major: rowMajor}
+)
+
+// AxisOrder creates a layout with a custom order of dimensions. axes lists every dimension once,
+// from the one that changes the slowest in memory to the one that changes the fastest. For 3
+// dimensions, ColumnMajor is the same as AxisOrder(0, 1, 2), and RowMajor is the same as
+// AxisOrder(2, 1, 0).
+func AxisOrder(axes ...int) Layout {
+	return Layout{major: customOrder, axes: append([]int(nil), axes...)}
+}
+
+// String returns a description of the layout, such as "row-major".
+func (l Layout) String() string {
+	switch l.major {
+	case columnMajor:
+		return "column-major"
+	case rowMajor:
+		return "row-major"
+	}
+
+	return fmt.Sprintf("axis order %v", l.axes)
+}
+
+// order returns the dimensions of a buffer with numDims dimensions from the one that changes the
+// slowest in memory to the one that changes the fastest. It checks that a custom order lists every
+// dimension exactly once.
+func (l Layout) order(numDims int) ([]int, error) {
+	axes := make([]int, numDims)
+	for i := range axes {
+		switch l.major {
+		case columnMajor:
+			axes[i] = i
+		case rowMajor:
+			axes[i] = numDims - 1 - i
+		}
+	}
+	if l.major != customOrder {
+		return axes, nil
+	}
+
+	if len(l.axes) != numDims {
+		return nil, fmt.Errorf("Axis order %v doesn't match %d dimensions", l.axes, numDims)
+	}
+	seen := make([]bool, numDims)
+	for _, axis := range l.axes {
+		if axis < 0 || axis >= numDims || seen[axis] {
+			return nil, fmt.Errorf("Invalid axis order %v", l.axes)
+		}
+		seen[axis] = true
+	}
+
+	return append(axes[:0], l.axes...), nil
+}
+
+// equal checks whether or not two layouts lay out a buffer with numDims dimensions the same way.
+// For example, ColumnMajor and RowMajor are the same for 1 dimension.
+func (l Layout) equal(other Layout, numDims int) bool {
+	a, errA := l.order(numDims)
+	b, errB := other.order(numDims)
+	if errA != nil || errB != nil {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Strides returns the number of elements to skip in memory to move one position along every
+// dimension of a buffer with the provided dimensions and this layout. Both the dimensions and the
+// strides are in the order X, Y, Z. The strides can be supplied to a metal function to find the
+// index of an element as x*strides[0] + y*strides[1] + z*strides[2].
+func (l Layout) Strides(dimLens ...int) ([]int, error) {
+	axes, err := l.order(len(dimLens))
+	if err != nil {
+		return nil, err
+	}
+
+	strides := make([]int, len(dimLens))
+	stride := 1
+	for i := len(axes) - 1; i >= 0; i-- {
+		strides[axes[i]] = stride
+		stride *= dimLens[axes[i]]
+	}
+
+	return strides, nil
+}
+
+// Index returns the index in memory of the element at position pos in a buffer with the provided
+// dimensions and this layout. Both the dimensions and the position are in the order X, Y, Z. It
+// panics if the layout doesn't fit the dimensions or the position is out of range, the same way
+// that indexing a slice out of range does.
+func (l Layout) Index(dimLens []int, pos ...int) int {
+	strides, err := l.Strides(dimLens...)
+	if err != nil {
+		panic("metal: " + err.Error())
+	}
+
+	return elementIndex(0, dimLens, strides, pos)
+}
+
+// nestedLens returns the lengths of the nested slices for a buffer with the provided dimensions
+// and this layout, from the outermost slice to the innermost. The layout must already have been
+// checked.
+func (l Layout) nestedLens(dimLens ...int) []int {
+	axes, _ := l.order(len(dimLens))
+
+	lens := make([]int, len(axes))
+	for i, axis := range axes {
+		lens[i] = dimLens[axis]
+	}
+
+	return lens
+}
+
+// dimLens is the reverse of nestedLens: it returns the dimensions, in the order X, Y, Z, for nested
+// slices with the provided lengths. The layout must already have been checked.
+func (l Layout) dimLens(nestedLens ...int) []int {
+	axes, _ := l.order(len(nestedLens))
+
+	dimLens := make([]int, len(axes))
+	for i, axis := range axes {
+		dimLens[axis] = nestedLens[i]
+	}
+
+	return dimLens
+}
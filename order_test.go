@@ -0,0 +1,112 @@
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_Layout_order tests that order resolves every layout to an order of dimensions and rejects
+// invalid custom orders.
+func Test_Layout_order(t *testing.T) {
+	type scenario struct {
+		layout  Layout
+		numDims int
+		want    []int
+		wantErr string
+	}
+
+	for _, s := range []scenario{
+		{ColumnMajor, 1, []int{0}, ""},
+		{ColumnMajor, 3, []int{0, 1, 2}, ""},
+		{ColumnMajor, 4, []int{0, 1, 2, 3}, ""},
+		{Layout{}, 2, []int{0, 1}, ""},
+		{RowMajor, 1, []int{0}, ""},
+		{RowMajor, 2, []int{1, 0}, ""},
+		{RowMajor, 3, []int{2, 1, 0}, ""},
+		{AxisOrder(1, 2, 0), 3, []int{1, 2, 0}, ""},
+		{AxisOrder(0), 1, []int{0}, ""},
+		{AxisOrder(1, 0), 3, nil, "Axis order [1 0] doesn't match 3 dimensions"},
+		{AxisOrder(1, 1, 0), 3, nil, "Invalid axis order [1 1 0]"},
+		{AxisOrder(0, 1, 3), 3, nil, "Invalid axis order [0 1 3]"},
+		{AxisOrder(-1, 0), 2, nil, "Invalid axis order [-1 0]"},
+	} {
+		axes, err := s.layout.order(s.numDims)
+		if s.wantErr != "" {
+			require.NotNil(t, err, s.layout.String())
+			require.Equal(t, s.wantErr, err.Error())
+			continue
+		}
+		require.Nil(t, err, "%s: %s", s.layout, err)
+		require.Equal(t, s.want, axes, s.layout.String())
+	}
+
+	// AxisOrder keeps its own copy of the axes.
+	axes := []int{0, 1}
+	layout := AxisOrder(axes...)
+	axes[0] = 1
+	require.Equal(t, "axis order [0 1]", layout.String())
+}
+
+// Test_Layout_equal tests that layouts are equal when they lay out the dimensions the same way.
+func Test_Layout_equal(t *testing.T) {
+	require.True(t, ColumnMajor.equal(RowMajor, 1))
+	require.False(t, ColumnMajor.equal(RowMajor, 2))
+	require.True(t, RowMajor.equal(AxisOrder(1, 0), 2))
+	require.True(t, ColumnMajor.equal(AxisOrder(0, 1, 2), 3))
+	require.False(t, RowMajor.equal(AxisOrder(2, 0, 1), 3))
+	require.False(t, AxisOrder(1, 0).equal(AxisOrder(1, 0), 3))
+}
+
+// Test_Layout_Strides tests that Strides and Index find elements in every layout.
+func Test_Layout_Strides(t *testing.T) {
+	dimLens := []int{4, 3, 2}
+
+	strides, err := ColumnMajor.Strides(dimLens...)
+	require.Nil(t, err)
+	require.Equal(t, []int{6, 2, 1}, strides)
+
+	strides, err = RowMajor.Strides(dimLens...)
+	require.Nil(t, err)
+	require.Equal(t, []int{1, 4, 12}, strides)
+
+	strides, err = AxisOrder(1, 0, 2).Strides(dimLens...)
+	require.Nil(t, err)
+	require.Equal(t, []int{2, 8, 1}, strides)
+
+	_, err = AxisOrder(1, 0).Strides(dimLens...)
+	require.NotNil(t, err)
+	require.Equal(t, "Axis order [1 0] doesn't match 3 dimensions", err.Error())
+
+	// The element at (x, y) of a row-major image is at y*width + x.
+	require.Equal(t, 2*4+3, RowMajor.Index([]int{4, 3}, 3, 2))
+	require.Equal(t, 3*3+2, ColumnMajor.Index([]int{4, 3}, 3, 2))
+
+	// Every position maps to a different index.
+	for _, layout := range []Layout{ColumnMajor, RowMajor, AxisOrder(2, 0, 1)} {
+		seen := map[int]bool{}
+		for x := 0; x < 4; x++ {
+			for y := 0; y < 3; y++ {
+				for z := 0; z < 2; z++ {
+					seen[layout.Index(dimLens, x, y, z)] = true
+				}
+			}
+		}
+		require.Len(t, seen, 24, layout.String())
+	}
+
+	require.Panics(t, func() { RowMajor.Index(dimLens, 4, 0, 0) })
+	require.Panics(t, func() { AxisOrder(0, 1).Index(dimLens, 0, 0, 0) })
+}
+
+// Test_Layout_nestedLens tests that nestedLens and dimLens convert between dimensions and the
+// lengths of nested slices.
+func Test_Layout_nestedLens(t *testing.T) {
+	require.Equal(t, []int{4, 3, 2}, ColumnMajor.nestedLens(4, 3, 2))
+	require.Equal(t, []int{2, 3, 4}, RowMajor.nestedLens(4, 3, 2))
+	require.Equal(t, []int{3, 2, 4}, AxisOrder(1, 2, 0).nestedLens(4, 3, 2))
+
+	for _, layout := range []Layout{ColumnMajor, RowMajor, AxisOrder(1, 2, 0)} {
+		require.Equal(t, []int{4, 3, 2}, layout.dimLens(layout.nestedLens(4, 3, 2)...))
+	}
+}
@@ -0,0 +1,127 @@
+package metal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// A TextureType is a type that can be used for the channels of a texture. Every texel (texture
+// element) has 1, 2, or 4 channels of this type.
+type TextureType interface {
+	uint8 | int8 | uint16 | int16 | uint32 | int32 | Float16 | float32
+}
+
+// A TextureUsage determines what metal functions can do with a texture. The values match Apple's
+// MTLTextureUsage and can be combined.
+type TextureUsage int
+
+const (
+	// TextureRead textures can be read and sampled.
+	TextureRead TextureUsage = 1
+
+	// TextureWrite textures can be written to.
+	TextureWrite TextureUsage = 2
+)
+
+// TextureOptions are the settings for creating a texture with NewTexture2D or NewTexture3D. The
+// zero value creates a single-channel texture in StorageShared memory that metal functions can
+// both read and write.
+type TextureOptions struct {
+	// Channels is the number of channels of every texel: 1, 2, or 4. 0 means 1.
+	Channels int
+
+	// Usage is what metal functions can do with the texture. 0 means TextureRead|TextureWrite.
+	Usage TextureUsage
+
+	// Storage is where the texture's memory is located. The CPU can't upload to or download from
+	// StoragePrivate textures.
+	Storage StorageMode
+}
+
+// check checks the options and returns the number of channels and the MTLTextureUsage value.
+func (o TextureOptions) check() (int, uint64, error) {
+	channels := o.Channels
+	if channels == 0 {
+		channels = 1
+	}
+	if channels != 1 && channels != 2 && channels != 4 {
+		return 0, 0, fmt.Errorf("Unsupported number of channels %d", o.Channels)
+	}
+
+	usage := o.Usage
+	if usage == 0 {
+		usage = TextureRead | TextureWrite
+	}
+	if usage&^(TextureRead|TextureWrite) != 0 {
+		return 0, 0, errors.New("Invalid texture usage")
+	}
+
+	if o.Storage < StorageShared || o.Storage > StoragePrivate {
+		return 0, 0, errors.New("Invalid storage mode")
+	}
+
+	return channels, uint64(usage), nil
+}
+
+// A textureFormat describes how the texels of a texture are stored.
+type textureFormat struct {
+	// pixelFormat is Apple's MTLPixelFormat value.
+	pixelFormat int
+
+	// name is the name of the MTLPixelFormat value without its prefix, such as "rgba8Unorm".
+	name string
+
+	// texelSize is the number of bytes of one texel.
+	texelSize int
+}
+
+// textureFormats maps the Go types of a texture's channels to the formats for 1, 2, and 4 channels.
+// The integer types with 8 and 16 bits are normalized, so that metal functions read them as
+// floating-point values between 0 and 1 (unsigned) or -1 and 1 (signed), the same way as image
+// data. The integer types with 32 bits are read as integers.
+var textureFormats = map[reflect.Type][3]textureFormat{
+	reflect.TypeOf(uint8(0)): {
+		{10, "r8Unorm", 1}, {30, "rg8Unorm", 2}, {70, "rgba8Unorm", 4},
+	},
+	reflect.TypeOf(int8(0)): {
+		{12, "r8Snorm", 1}, {32, "rg8Snorm", 2}, {72, "rgba8Snorm", 4},
+	},
+	reflect.TypeOf(uint16(0)): {
+		{20, "r16Unorm", 2}, {60, "rg16Unorm", 4}, {110, "rgba16Unorm", 8},
+	},
+	reflect.TypeOf(int16(0)): {
+		{22, "r16Snorm", 2}, {62, "rg16Snorm", 4}, {112, "rgba16Snorm", 8},
+	},
+	reflect.TypeOf(uint32(0)): {
+		{53, "r32Uint", 4}, {103, "rg32Uint", 8}, {123, "rgba32Uint", 16},
+	},
+	reflect.TypeOf(int32(0)): {
+		{54, "r32Sint", 4}, {104, "rg32Sint", 8}, {124, "rgba32Sint", 16},
+	},
+	reflect.TypeOf(Float16(0)): {
+		{25, "r16Float", 2}, {65, "rg16Float", 4}, {115, "rgba16Float", 8},
+	},
+	reflect.TypeOf(float32(0)): {
+		{55, "r32Float", 4}, {105, "rg32Float", 8}, {125, "rgba32Float", 16},
+	},
+}
+
+// textureFormatOf returns the format of a texture with channels channels of type elemType.
+func textureFormatOf(elemType reflect.Type, channels int) (textureFormat, error) {
+	formats, ok := textureFormats[elemType]
+	if !ok {
+		return textureFormat{}, fmt.Errorf("Metal has no pixel format for %s", elemType)
+	}
+
+	switch channels {
+	case 1:
+		return formats[0], nil
+	case 2:
+		return formats[1], nil
+	case 4:
+		return formats[2], nil
+	}
+
+	return textureFormat{}, fmt.Errorf("Unsupported number of channels %d", channels)
+}
@@ -0,0 +1,82 @@
+package metal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_TextureOptions_check tests that check fills in the defaults and rejects invalid options.
+func Test_TextureOptions_check(t *testing.T) {
+	type scenario struct {
+		opts         TextureOptions
+		wantChannels int
+		wantUsage    uint64
+		wantErr      string
+	}
+
+	for _, s := range []scenario{
+		{TextureOptions{}, 1, 3, ""},
+		{TextureOptions{Channels: 2, Usage: TextureRead}, 2, 1, ""},
+		{TextureOptions{Channels: 4, Usage: TextureWrite, Storage: StoragePrivate}, 4, 2, ""},
+		{TextureOptions{Channels: 3}, 0, 0, "Unsupported number of channels 3"},
+		{TextureOptions{Channels: -1}, 0, 0, "Unsupported number of channels -1"},
+		{TextureOptions{Usage: 4}, 0, 0, "Invalid texture usage"},
+		{TextureOptions{Storage: 3}, 0, 0, "Invalid storage mode"},
+	} {
+		channels, usage, err := s.opts.check()
+		if s.wantErr != "" {
+			require.NotNil(t, err)
+			require.Equal(t, s.wantErr, err.Error())
+			continue
+		}
+		require.Nil(t, err, "Unable to check options: %s", err)
+		require.Equal(t, s.wantChannels, channels)
+		require.Equal(t, s.wantUsage, usage)
+	}
+}
+
+// Test_textureFormatOf tests that textureFormatOf maps Go types to the matching pixel formats.
+func Test_textureFormatOf(t *testing.T) {
+	type scenario struct {
+		elemType reflect.Type
+		channels int
+		want     textureFormat
+		wantErr  string
+	}
+
+	for _, s := range []scenario{
+		{reflect.TypeOf(uint8(0)), 1, textureFormat{10, "r8Unorm", 1}, ""},
+		{reflect.TypeOf(uint8(0)), 4, textureFormat{70, "rgba8Unorm", 4}, ""},
+		{reflect.TypeOf(int8(0)), 2, textureFormat{32, "rg8Snorm", 2}, ""},
+		{reflect.TypeOf(uint16(0)), 4, textureFormat{110, "rgba16Unorm", 8}, ""},
+		{reflect.TypeOf(int16(0)), 1, textureFormat{22, "r16Snorm", 2}, ""},
+		{reflect.TypeOf(uint32(0)), 2, textureFormat{103, "rg32Uint", 8}, ""},
+		{reflect.TypeOf(int32(0)), 4, textureFormat{124, "rgba32Sint", 16}, ""},
+		{reflect.TypeOf(Float16(0)), 1, textureFormat{25, "r16Float", 2}, ""},
+		{reflect.TypeOf(Float16(0)), 4, textureFormat{115, "rgba16Float", 8}, ""},
+		{reflect.TypeOf(float32(0)), 1, textureFormat{55, "r32Float", 4}, ""},
+		{reflect.TypeOf(float32(0)), 2, textureFormat{105, "rg32Float", 8}, ""},
+		{reflect.TypeOf(float32(0)), 4, textureFormat{125, "rgba32Float", 16}, ""},
+		{reflect.TypeOf(float32(0)), 3, textureFormat{}, "Unsupported number of channels 3"},
+		{reflect.TypeOf(BFloat16(0)), 1, textureFormat{}, "Metal has no pixel format for metal.BFloat16"},
+		{reflect.TypeOf(float64(0)), 1, textureFormat{}, "Metal has no pixel format for float64"},
+	} {
+		format, err := textureFormatOf(s.elemType, s.channels)
+		if s.wantErr != "" {
+			require.NotNil(t, err, s.elemType.String())
+			require.Equal(t, s.wantErr, err.Error())
+			continue
+		}
+		require.Nil(t, err, "%s: %s", s.elemType, err)
+		require.Equal(t, s.want, format)
+	}
+
+	// Every texel is as large as its channels.
+	for elemType, formats := range textureFormats {
+		for i, channels := range []int{1, 2, 4} {
+			require.Equal(t, int(elemType.Size())*channels, formats[i].texelSize, formats[i].name)
+		}
+	}
+}
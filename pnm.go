@@ -0,0 +1,257 @@
+package metal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// A pnmHeader describes an image in one of the Netpbm formats that are read: PFM (Portable Float
+// Map) and binary PGM (Portable Gray Map).
+type pnmHeader struct {
+	width, height int
+	channels      int
+	maxValue      int              // PGM only: the value of a white pixel
+	order         binary.ByteOrder // PFM only: the byte order of the floats
+}
+
+// readPFMHeader reads the header of a PFM image, which is "PF" for color images or "Pf" for gray
+// images, then the width and height, and then a scale whose sign is the byte order of the data.
+func readPFMHeader(r *bufio.Reader) (pnmHeader, error) {
+	var h pnmHeader
+
+	magic, err := pnmToken(r)
+	if err != nil {
+		return h, err
+	}
+	switch magic {
+	case "PF":
+		h.channels = 3
+	case "Pf":
+		h.channels = 1
+	default:
+		return h, errors.New("Missing PFM magic number")
+	}
+
+	if h.width, h.height, err = pnmSize(r); err != nil {
+		return h, err
+	}
+
+	token, err := pnmToken(r)
+	if err != nil {
+		return h, err
+	}
+	scale, err := strconv.ParseFloat(token, 32)
+	if err != nil || scale == 0 || math.IsNaN(scale) {
+		return h, fmt.Errorf("Invalid scale %q in PFM header", token)
+	}
+
+	h.order = binary.BigEndian
+	if scale < 0 {
+		h.order = binary.LittleEndian
+	}
+
+	return h, nil
+}
+
+// readPFMData reads the floats of the PFM image described by h from r into dst, which must hold
+// width x height x channels elements. PFM stores the rows from the bottom to the top, so they are
+// flipped to end up in the same order as every other image.
+func readPFMData(r io.Reader, h pnmHeader, dst []float32) error {
+	rowLen := h.width * h.channels
+	if len(dst) != rowLen*h.height {
+		return fmt.Errorf("Buffer of %d elements doesn't match the %d elements of the image",
+			len(dst), rowLen*h.height)
+	}
+
+	for y := h.height - 1; y >= 0; y-- {
+		if err := binary.Read(r, h.order, dst[y*rowLen:(y+1)*rowLen]); err != nil {
+			return fmt.Errorf("Unable to read PFM data: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writePFM writes an image with the provided dimensions and 1 or 3 channels, whose floats are in
+// data from the top row to the bottom, to w as a little-endian PFM image.
+func writePFM(w io.Writer, width, height, channels int, data []float32) error {
+	magic := "Pf"
+	switch channels {
+	case 1:
+	case 3:
+		magic = "PF"
+	default:
+		return fmt.Errorf("Unsupported number of channels %d for a PFM image", channels)
+	}
+	if len(data) != width*height*channels {
+		return fmt.Errorf("Image of %d x %d x %d doesn't match the %d elements", width, height,
+			channels, len(data))
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\n%d %d\n-1.0\n", magic, width, height)
+
+	rowLen := width * channels
+	for y := height - 1; y >= 0; y-- {
+		if err := binary.Write(bw, binary.LittleEndian, data[y*rowLen:(y+1)*rowLen]); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// readPGMHeader reads the header of a binary PGM image, which is "P5", then the width and height,
+// and then the maximum value, which is at most 65535.
+func readPGMHeader(r *bufio.Reader) (pnmHeader, error) {
+	h := pnmHeader{channels: 1}
+
+	magic, err := pnmToken(r)
+	if err != nil {
+		return h, err
+	}
+	switch magic {
+	case "P5":
+	case "P2":
+		return h, errors.New("Unsupported plain PGM format, only binary PGM (P5) is supported")
+	default:
+		return h, errors.New("Missing PGM magic number")
+	}
+
+	if h.width, h.height, err = pnmSize(r); err != nil {
+		return h, err
+	}
+
+	token, err := pnmToken(r)
+	if err != nil {
+		return h, err
+	}
+	if h.maxValue, err = strconv.Atoi(token); err != nil || h.maxValue < 1 || h.maxValue > 0xffff {
+		return h, fmt.Errorf("Invalid maximum value %q in PGM header", token)
+	}
+
+	return h, nil
+}
+
+// readPGMData reads the pixels of the PGM image described by h from r into dst, which must hold
+// width x height elements. Every pixel is normalized to the range 0 to 1. Pixels take up 1 byte if
+// the maximum value is less than 256, and 2 big-endian bytes otherwise.
+func readPGMData(r io.Reader, h pnmHeader, dst []float32) error {
+	if len(dst) != h.width*h.height {
+		return fmt.Errorf("Buffer of %d elements doesn't match the %d elements of the image",
+			len(dst), h.width*h.height)
+	}
+
+	pixelSize := 1
+	if h.maxValue > 0xff {
+		pixelSize = 2
+	}
+
+	row := make([]byte, h.width*pixelSize)
+	for y := 0; y < h.height; y++ {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return fmt.Errorf("Unable to read PGM data: %w", err)
+		}
+
+		for x := range dst[y*h.width : (y+1)*h.width] {
+			v := int(row[x])
+			if pixelSize == 2 {
+				v = int(binary.BigEndian.Uint16(row[2*x:]))
+			}
+			dst[y*h.width+x] = float32(v) / float32(h.maxValue)
+		}
+	}
+
+	return nil
+}
+
+// writePGM writes a gray image with the provided dimensions, whose pixels are in data from the top
+// row to the bottom, to w as a binary PGM image with the provided maximum value. Every pixel is
+// clamped to the range 0 to 1 and scaled to the maximum value.
+func writePGM(w io.Writer, width, height, maxValue int, data []float32) error {
+	if maxValue < 1 || maxValue > 0xffff {
+		return fmt.Errorf("Invalid maximum value %d for a PGM image", maxValue)
+	}
+	if len(data) != width*height {
+		return fmt.Errorf("Image of %d x %d doesn't match the %d elements", width, height, len(data))
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "P5\n%d %d\n%d\n", width, height, maxValue)
+
+	for _, f := range data {
+		v := 0
+		switch {
+		case !(f > 0):
+		case f >= 1:
+			v = maxValue
+		default:
+			v = int(f*float32(maxValue) + 0.5)
+		}
+
+		if maxValue > 0xff {
+			bw.WriteByte(byte(v >> 8))
+		}
+		bw.WriteByte(byte(v))
+	}
+
+	return bw.Flush()
+}
+
+// pnmSize reads the width and height from a Netpbm header.
+func pnmSize(r *bufio.Reader) (width, height int, err error) {
+	for _, dimLen := range []*int{&width, &height} {
+		token, err := pnmToken(r)
+		if err != nil {
+			return 0, 0, err
+		}
+		if *dimLen, err = strconv.Atoi(token); err != nil || *dimLen < 1 {
+			return 0, 0, fmt.Errorf("Invalid dimension %q in image header", token)
+		}
+	}
+
+	return width, height, nil
+}
+
+// pnmToken reads the next field of a Netpbm header. Fields are separated by whitespace, and
+// comments run from # to the end of the line. The single whitespace character after the field is
+// consumed as well, because the last field of a header is followed by exactly one before the data.
+func pnmToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", fmt.Errorf("Unable to read image header: %w", noEOF(err))
+		}
+
+		switch {
+		case c == '#' && len(token) == 0:
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", fmt.Errorf("Unable to read image header: %w", noEOF(err))
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			if len(token) >= 32 {
+				return "", errors.New("Invalid image header")
+			}
+			token = append(token, c)
+		}
+	}
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF, for data that ends in the middle.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
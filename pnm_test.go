@@ -0,0 +1,164 @@
+package metal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_readPFMHeader tests that readPFMHeader reads valid headers and rejects invalid ones.
+func Test_readPFMHeader(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PF\n3 2\n-1.0\n\x00"))
+	h, err := readPFMHeader(r)
+	require.Nil(t, err, "Unable to read header: %s", err)
+	require.Equal(t, pnmHeader{width: 3, height: 2, channels: 3, order: binary.LittleEndian}, h)
+
+	// Exactly one whitespace character follows the header.
+	rest, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, []byte{0}, rest)
+
+	h, err = readPFMHeader(bufio.NewReader(strings.NewReader("Pf 7 5 2.5 ")))
+	require.Nil(t, err, "Unable to read header: %s", err)
+	require.Equal(t, pnmHeader{width: 7, height: 5, channels: 1, order: binary.BigEndian}, h)
+
+	type scenario struct {
+		header  string
+		wantErr string
+	}
+
+	for _, s := range []scenario{
+		{"", "Unable to read image header: unexpected EOF"},
+		{"P5\n3 2\n255\n", "Missing PFM magic number"},
+		{"PF\n3 0\n-1.0\n", "Invalid dimension \"0\" in image header"},
+		{"PF\nthree 2\n-1.0\n", "Invalid dimension \"three\" in image header"},
+		{"PF\n3 2\n0\n", "Invalid scale \"0\" in PFM header"},
+		{"PF\n3 2\nnan\n", "Invalid scale \"nan\" in PFM header"},
+		{"PF\n3 2\n-1.0", "Unable to read image header: unexpected EOF"},
+		{"PF\n" + strings.Repeat("1", 40) + " 2\n-1.0\n", "Invalid image header"},
+	} {
+		_, err := readPFMHeader(bufio.NewReader(strings.NewReader(s.header)))
+		require.NotNil(t, err, s.header)
+		require.Equal(t, s.wantErr, err.Error(), s.header)
+	}
+}
+
+// Test_writePFM tests that images written with writePFM can be read back with readPFMHeader and
+// readPFMData.
+func Test_writePFM(t *testing.T) {
+	data := []float32{0, 0.5, 1, 1.5, -2, 3}
+
+	var buf bytes.Buffer
+	require.Nil(t, writePFM(&buf, 3, 2, 1, data))
+	require.True(t, strings.HasPrefix(buf.String(), "Pf\n3 2\n-1.0\n"))
+
+	// The bottom row comes first.
+	var firstRow [3]float32
+	require.Nil(t, binary.Read(bytes.NewReader(buf.Bytes()[len("Pf\n3 2\n-1.0\n"):]), binary.LittleEndian, &firstRow))
+	require.Equal(t, [3]float32{1.5, -2, 3}, firstRow)
+
+	r := bufio.NewReader(&buf)
+	h, err := readPFMHeader(r)
+	require.Nil(t, err, "Unable to read header: %s", err)
+	got := make([]float32, 6)
+	require.Nil(t, readPFMData(r, h, got))
+	require.Equal(t, data, got)
+
+	// Big-endian images are read too.
+	buf.Reset()
+	buf.WriteString("PF\n1 2\n1.0\n")
+	binary.Write(&buf, binary.BigEndian, []float32{4, 5, 6, 1, 2, 3})
+	r = bufio.NewReader(&buf)
+	h, err = readPFMHeader(r)
+	require.Nil(t, err, "Unable to read header: %s", err)
+	got = make([]float32, 6)
+	require.Nil(t, readPFMData(r, h, got))
+	require.Equal(t, []float32{1, 2, 3, 4, 5, 6}, got)
+
+	err = readPFMData(bytes.NewReader(make([]byte, 20)), pnmHeader{width: 3, height: 2, channels: 1,
+		order: binary.LittleEndian}, make([]float32, 6))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to read PFM data: unexpected EOF", err.Error())
+
+	err = readPFMData(bytes.NewReader(nil), pnmHeader{width: 3, height: 2, channels: 1}, make([]float32, 5))
+	require.NotNil(t, err)
+	require.Equal(t, "Buffer of 5 elements doesn't match the 6 elements of the image", err.Error())
+
+	err = writePFM(io.Discard, 3, 2, 4, make([]float32, 24))
+	require.NotNil(t, err)
+	require.Equal(t, "Unsupported number of channels 4 for a PFM image", err.Error())
+
+	err = writePFM(io.Discard, 3, 2, 3, data)
+	require.NotNil(t, err)
+	require.Equal(t, "Image of 3 x 2 x 3 doesn't match the 6 elements", err.Error())
+}
+
+// Test_readPGMHeader tests that readPGMHeader reads valid headers and rejects invalid ones.
+func Test_readPGMHeader(t *testing.T) {
+	h, err := readPGMHeader(bufio.NewReader(strings.NewReader("P5\n# created by hand\n4 3 # size\n65535\n")))
+	require.Nil(t, err, "Unable to read header: %s", err)
+	require.Equal(t, pnmHeader{width: 4, height: 3, channels: 1, maxValue: 65535}, h)
+
+	type scenario struct {
+		header  string
+		wantErr string
+	}
+
+	for _, s := range []scenario{
+		{"P2\n4 3\n255\n", "Unsupported plain PGM format, only binary PGM (P5) is supported"},
+		{"P6\n4 3\n255\n", "Missing PGM magic number"},
+		{"P5\n4 -3\n255\n", "Invalid dimension \"-3\" in image header"},
+		{"P5\n4 3\n0\n", "Invalid maximum value \"0\" in PGM header"},
+		{"P5\n4 3\n65536\n", "Invalid maximum value \"65536\" in PGM header"},
+		{"P5\n# no end", "Unable to read image header: unexpected EOF"},
+	} {
+		_, err := readPGMHeader(bufio.NewReader(strings.NewReader(s.header)))
+		require.NotNil(t, err, s.header)
+		require.Equal(t, s.wantErr, err.Error(), s.header)
+	}
+}
+
+// Test_writePGM tests that images written with writePGM can be read back with readPGMHeader and
+// readPGMData.
+func Test_writePGM(t *testing.T) {
+	data := []float32{0, 0.2, 0.4, 0.6, 0.8, 1}
+
+	// 8-bit images have 1 byte for every pixel, and values outside of the range 0 to 1 are clamped.
+	var buf bytes.Buffer
+	require.Nil(t, writePGM(&buf, 3, 2, 255, []float32{0, 0.2, 0.4, 0.6, 2, -1}))
+	require.Equal(t, "P5\n3 2\n255\n\x00\x33\x66\x99\xff\x00", buf.String())
+
+	// 16-bit images have 2 big-endian bytes for every pixel.
+	buf.Reset()
+	require.Nil(t, writePGM(&buf, 3, 2, 1000, data))
+	require.Equal(t, "P5\n3 2\n1000\n", buf.String()[:12])
+	require.Equal(t, 12+12, buf.Len())
+
+	r := bufio.NewReader(&buf)
+	h, err := readPGMHeader(r)
+	require.Nil(t, err, "Unable to read header: %s", err)
+	got := make([]float32, 6)
+	require.Nil(t, readPGMData(r, h, got))
+	require.Equal(t, data, got)
+
+	err = readPGMData(strings.NewReader("\x00\x01"), pnmHeader{width: 3, height: 1, maxValue: 255}, make([]float32, 3))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to read PGM data: unexpected EOF", err.Error())
+
+	err = readPGMData(bytes.NewReader(nil), pnmHeader{width: 3, height: 1, maxValue: 255}, make([]float32, 2))
+	require.NotNil(t, err)
+	require.Equal(t, "Buffer of 2 elements doesn't match the 3 elements of the image", err.Error())
+
+	err = writePGM(io.Discard, 3, 2, 0, data)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid maximum value 0 for a PGM image", err.Error())
+
+	err = writePGM(io.Discard, 2, 2, 255, data)
+	require.NotNil(t, err)
+	require.Equal(t, "Image of 2 x 2 doesn't match the 6 elements", err.Error())
+}
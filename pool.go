@@ -0,0 +1,302 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+/*
+#cgo LDFLAGS: -framework Metal -framework CoreGraphics -framework Foundation
+#include "metal.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// PoolOptions are the settings for a BufferPool.
+type PoolOptions struct {
+	// Buffer is the settings for every buffer that the pool creates.
+	Buffer BufferOptions
+
+	// Zero makes the pool clear the contents of buffers before they are reused. New buffers are
+	// always empty.
+	Zero bool
+
+	// IdleTimeout is how long a buffer can stay idle in the pool before it is released. Idle
+	// buffers are checked every time a buffer is taken from or returned to the pool, and whenever
+	// Trim is called. If IdleTimeout is 0, idle buffers are kept until the pool is closed.
+	IdleTimeout time.Duration
+}
+
+// PoolStats are statistics about how a BufferPool has been used.
+type PoolStats struct {
+	// Hits is the number of buffers that were reused.
+	Hits uint64
+
+	// Misses is the number of buffers that had to be created.
+	Misses uint64
+
+	// BytesHeld is the total size of the buffers that belong to the pool, both in use and idle.
+	BytesHeld uint64
+
+	// BytesIdle is the total size of the idle buffers in the pool.
+	BytesIdle uint64
+}
+
+// A BufferPool reuses buffers instead of creating a new buffer every time one is needed. This
+// avoids the cost of allocating memory for buffers that are only needed for a short time. Buffers
+// are grouped into size classes, which are powers of 2, so a buffer from the pool can be larger
+// than requested. Take buffers from the pool with PoolGet and return them with Put.
+//
+// A BufferPool is safe for concurrent use.
+type BufferPool struct {
+	opts PoolOptions
+
+	// device is the device that the pool creates buffers on, and ctx is the context that created
+	// the pool, or nil for the default context.
+	device Device
+	ctx    *Context
+
+	mu     sync.Mutex
+	idle   idleBuffers
+	inUse  map[BufferId]uint64
+	stats  PoolStats
+	closed bool
+}
+
+// NewBufferPool creates a new, empty pool with the provided options.
+func NewBufferPool(opts PoolOptions) (*BufferPool, error) {
+	if _, err := opts.Buffer.resourceOptions(); err != nil {
+		return nil, err
+	}
+	if opts.IdleTimeout < 0 {
+		return nil, errors.New("Invalid idle timeout")
+	}
+
+	return &BufferPool{
+		opts:  opts,
+		inUse: make(map[BufferId]uint64),
+	}, nil
+}
+
+// PoolGet takes a buffer that can hold width elements of type T from the pool, or creates a new
+// one if there is no idle buffer of the right size class. It returns the buffer's Id and a slice
+// that wraps the first width elements of the buffer's memory. If the CPU can't access the memory,
+// the slice is nil.
+//
+// The buffer must be returned to the pool with Put once it is no longer needed, after which
+// neither the Id nor the slice can be used. Only the contents of the slice should be modified. Its
+// length and capacity and the pointer to its underlying array should not be altered.
+func PoolGet[T BufferType](p *BufferPool, width int) (BufferId, []T, error) {
+	if err := ensureInit(); err != nil {
+		return 0, nil, err
+	}
+
+	_, numBytes, err := bufferSize(sizeof[T](), []int{width}, maxBufferLength())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	bufferId, contents, err := p.get(numBytes)
+	if err != nil {
+		return 0, nil, err
+	}
+	if contents == nil {
+		return bufferId, nil, nil
+	}
+
+	return bufferId, toSlice[T](contents, width), nil
+}
+
+// get takes a buffer that can hold numBytes bytes from the pool, or creates a new one. It returns
+// the buffer's Id and a pointer to its memory, which is nil if the CPU can't access it.
+func (p *BufferPool) get(numBytes uint64) (BufferId, unsafe.Pointer, error) {
+	class := sizeClass(numBytes, maxBufferLength())
+
+	// The context can't release the pool's buffers while a buffer is being taken.
+	if err := p.ctx.begin(); err != nil {
+		return 0, nil, err
+	}
+	defer p.ctx.end()
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return 0, nil, errors.New("Buffer pool is closed")
+	}
+	expired := p.expireLocked()
+	id, ok := p.idle.take(class)
+	if ok {
+		p.stats.Hits++
+		p.stats.BytesIdle -= class
+		p.inUse[BufferId(id)] = class
+	} else {
+		p.stats.Misses++
+	}
+	p.mu.Unlock()
+
+	releaseIdle(expired)
+
+	if ok {
+		bufferId := BufferId(id)
+		contents, err := p.prepare(bufferId, class)
+		if err != nil {
+			p.Put(bufferId)
+			return 0, nil, err
+		}
+		return bufferId, contents, nil
+	}
+
+	bufferId, mem, err := newBufferOnDevice[byte](p.device, p.opts.Buffer, ColumnMajor, int(class))
+	if err != nil {
+		return 0, nil, err
+	}
+	p.ctx.own(nil, int(bufferId))
+
+	p.mu.Lock()
+	p.inUse[bufferId] = class
+	p.stats.BytesHeld += class
+	p.mu.Unlock()
+
+	if mem == nil {
+		return bufferId, nil, nil
+	}
+
+	return bufferId, unsafe.Pointer(&mem[0]), nil
+}
+
+// prepare gets a reused buffer ready to be handed out again, clearing it if the pool is set to. It
+// returns a pointer to the buffer's memory, which is nil if the CPU can't access it.
+func (p *BufferPool) prepare(bufferId BufferId, class uint64) (unsafe.Pointer, error) {
+	if !p.opts.Buffer.cpuAccessible() {
+		if p.opts.Zero {
+			return nil, runBatch(p.device, p.ctx.queue(), func(b *Batch) error {
+				return b.Fill(bufferId, 0)
+			})
+		}
+		return nil, nil
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	contents := C.buffer_retrieve(C.int(bufferId), &metalErr)
+	if contents == nil {
+		return nil, metalErrToError(metalErr, "Unable to retrieve buffer")
+	}
+
+	if p.opts.Zero {
+		mem := toSlice[byte](contents, int(class))
+		for i := range mem {
+			mem[i] = 0
+		}
+	}
+
+	return contents, nil
+}
+
+// Put returns a buffer that was taken from the pool with PoolGet, so that it can be reused. Neither
+// the buffer Id nor any slice of the buffer's memory can be used after this. If the pool is closed,
+// the buffer is released instead.
+func (p *BufferPool) Put(bufferId BufferId) error {
+	p.mu.Lock()
+	class, ok := p.inUse[bufferId]
+	if !ok {
+		p.mu.Unlock()
+		return errors.New("Buffer is not in use from this pool")
+	}
+	delete(p.inUse, bufferId)
+
+	if p.closed {
+		p.stats.BytesHeld -= class
+		p.mu.Unlock()
+		releaseBuffer(bufferId)
+		return nil
+	}
+
+	p.idle.put(int(bufferId), class, time.Now())
+	p.stats.BytesIdle += class
+	expired := p.expireLocked()
+	p.mu.Unlock()
+
+	releaseIdle(expired)
+
+	return nil
+}
+
+// Trim releases every buffer that has been idle for longer than the pool's idle timeout.
+func (p *BufferPool) Trim() {
+	p.mu.Lock()
+	expired := p.expireLocked()
+	p.mu.Unlock()
+
+	releaseIdle(expired)
+}
+
+// Stats returns statistics about how the pool has been used.
+func (p *BufferPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.stats
+}
+
+// Close releases every idle buffer in the pool. Buffers that are still in use are released when
+// they are returned with Put. No more buffers can be taken from the pool after this.
+func (p *BufferPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	all := p.idle.removeAll()
+	for _, b := range all {
+		p.stats.BytesIdle -= b.class
+		p.stats.BytesHeld -= b.class
+	}
+	p.mu.Unlock()
+
+	releaseIdle(all)
+}
+
+// closeAll closes the pool and releases every buffer that it created, including the buffers that
+// are still in use. The context that created the pool calls this when it's closed.
+func (p *BufferPool) closeAll() {
+	p.Close()
+
+	p.mu.Lock()
+	inUse := p.inUse
+	p.inUse = make(map[BufferId]uint64)
+	for _, class := range inUse {
+		p.stats.BytesHeld -= class
+	}
+	p.mu.Unlock()
+
+	for bufferId := range inUse {
+		releaseBuffer(bufferId)
+	}
+}
+
+// expireLocked removes the buffers that have been idle for longer than the idle timeout from the
+// pool and returns them, so that they can be released once the lock is no longer held. p.mu must
+// be held.
+func (p *BufferPool) expireLocked() []idleBuffer {
+	if p.opts.IdleTimeout == 0 || p.idle.numIdle == 0 {
+		return nil
+	}
+
+	expired := p.idle.expire(time.Now().Add(-p.opts.IdleTimeout))
+	for _, b := range expired {
+		p.stats.BytesIdle -= b.class
+		p.stats.BytesHeld -= b.class
+	}
+
+	return expired
+}
+
+// releaseIdle releases buffers that were removed from a pool.
+func releaseIdle(buffers []idleBuffer) {
+	for _, b := range buffers {
+		releaseBuffer(BufferId(b.id))
+	}
+}
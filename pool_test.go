@@ -0,0 +1,190 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_BufferPool tests that a BufferPool reuses buffers by size class and keeps track of its
+// statistics.
+func Test_BufferPool(t *testing.T) {
+	pool, err := NewBufferPool(PoolOptions{})
+	require.Nil(t, err, "Unable to create buffer pool: %s", err)
+
+	// The first buffer of every size class has to be created.
+	id1, buffer1, err := PoolGet[float32](pool, 1_000)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.True(t, validId(id1))
+	require.Len(t, buffer1, 1_000)
+	require.Equal(t, PoolStats{Misses: 1, BytesHeld: 4096}, pool.Stats())
+
+	id2, buffer2, err := PoolGet[float32](pool, 1_025)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.True(t, validId(id2))
+	require.Len(t, buffer2, 1_025)
+	require.Equal(t, PoolStats{Misses: 2, BytesHeld: 4096 + 8192}, pool.Stats())
+
+	for i := range buffer1 {
+		buffer1[i] = float32(i)
+	}
+
+	// Returned buffers are reused for any type that fits in the same size class.
+	require.Nil(t, pool.Put(id1))
+	require.Equal(t, PoolStats{Misses: 2, BytesHeld: 4096 + 8192, BytesIdle: 4096}, pool.Stats())
+
+	id3, buffer3, err := PoolGet[int16](pool, 2_000)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.Equal(t, id1, id3)
+	require.Len(t, buffer3, 2_000)
+	require.Equal(t, PoolStats{Hits: 1, Misses: 2, BytesHeld: 4096 + 8192}, pool.Stats())
+
+	// Without zeroing, the old contents are still there.
+	require.Nil(t, pool.Put(id3))
+	_, buffer4, err := PoolGet[float32](pool, 10)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.Equal(t, float32(5), buffer4[5])
+
+	// Buffers can only be returned once, and only to the pool they came from.
+	err = pool.Put(BufferId(100_000))
+	require.NotNil(t, err)
+	require.Equal(t, "Buffer is not in use from this pool", err.Error())
+	require.Nil(t, pool.Put(id2))
+	err = pool.Put(id2)
+	require.NotNil(t, err)
+	require.Equal(t, "Buffer is not in use from this pool", err.Error())
+
+	// Closing the pool releases idle buffers right away and buffers in use once they're returned.
+	pool.Close()
+	require.Equal(t, PoolStats{Hits: 2, Misses: 2, BytesHeld: 4096}, pool.Stats())
+	_, _, err = PoolGet[float32](pool, 10)
+	require.NotNil(t, err)
+	require.Equal(t, "Buffer pool is closed", err.Error())
+	require.Nil(t, pool.Put(id1))
+	require.Equal(t, PoolStats{Hits: 2, Misses: 2}, pool.Stats())
+	_, _, err = View[float32](id1, 0, 1)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to retrieve buffer: Failed to retrieve buffer", err.Error())
+
+	// Invalid options and arguments
+	_, err = NewBufferPool(PoolOptions{IdleTimeout: -time.Second})
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid idle timeout", err.Error())
+	_, err = NewBufferPool(PoolOptions{Buffer: BufferOptions{Storage: 5}})
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid storage mode", err.Error())
+	pool, err = NewBufferPool(PoolOptions{})
+	require.Nil(t, err, "Unable to create buffer pool: %s", err)
+	_, _, err = PoolGet[float32](pool, 0)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid dimension", err.Error())
+}
+
+// Test_BufferPool_zero tests that a BufferPool clears buffers before reusing them if it is set to.
+func Test_BufferPool_zero(t *testing.T) {
+	pool, err := NewBufferPool(PoolOptions{Zero: true})
+	require.Nil(t, err, "Unable to create buffer pool: %s", err)
+	defer pool.Close()
+
+	id, buffer, err := PoolGet[uint8](pool, 100)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.True(t, validId(id))
+	for i := range buffer {
+		buffer[i] = 0xff
+	}
+	require.Nil(t, pool.Put(id))
+
+	// The whole buffer is cleared, not just the part that was used.
+	reusedId, reused, err := PoolGet[uint32](pool, 1_024)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.Equal(t, id, reusedId)
+	for i := range reused {
+		require.Equal(t, uint32(0), reused[i])
+	}
+	require.Nil(t, pool.Put(reusedId))
+
+	// Private buffers are cleared on the GPU.
+	private, err := NewBufferPool(PoolOptions{Buffer: BufferOptions{Storage: StoragePrivate}, Zero: true})
+	require.Nil(t, err, "Unable to create buffer pool: %s", err)
+	defer private.Close()
+
+	id, buffer, err = PoolGet[uint8](private, 100)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.True(t, validId(id))
+	require.Nil(t, buffer)
+	require.Nil(t, Upload(id, 0, []uint8{1, 2, 3, 4}))
+	require.Nil(t, private.Put(id))
+
+	reusedId, _, err = PoolGet[uint8](private, 100)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.Equal(t, id, reusedId)
+	addId()
+	got := make([]uint8, 4)
+	require.Nil(t, Download(reusedId, 0, got))
+	require.Equal(t, []uint8{0, 0, 0, 0}, got)
+}
+
+// Test_BufferPool_Trim tests that a BufferPool releases buffers that have been idle for too long.
+func Test_BufferPool_Trim(t *testing.T) {
+	pool, err := NewBufferPool(PoolOptions{IdleTimeout: 50 * time.Millisecond})
+	require.Nil(t, err, "Unable to create buffer pool: %s", err)
+	defer pool.Close()
+
+	id1, _, err := PoolGet[float32](pool, 10)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.True(t, validId(id1))
+	id2, _, err := PoolGet[float32](pool, 10_000)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.True(t, validId(id2))
+
+	require.Nil(t, pool.Put(id1))
+	pool.Trim()
+	require.Equal(t, PoolStats{Misses: 2, BytesHeld: 4096 + 65536, BytesIdle: 4096}, pool.Stats())
+
+	time.Sleep(100 * time.Millisecond)
+	require.Nil(t, pool.Put(id2))
+	require.Equal(t, PoolStats{Misses: 2, BytesHeld: 65536, BytesIdle: 65536}, pool.Stats())
+
+	time.Sleep(100 * time.Millisecond)
+	pool.Trim()
+	require.Equal(t, PoolStats{Misses: 2}, pool.Stats())
+
+	// A trimmed buffer has to be created again.
+	id3, _, err := PoolGet[float32](pool, 10)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.True(t, validId(id3))
+	require.Equal(t, PoolStats{Misses: 3, BytesHeld: 4096}, pool.Stats())
+	require.Nil(t, pool.Put(id3))
+}
+
+// Test_BufferPool_otherDevice tests that a pool of a context on a device other than the default
+// device clears its private buffers on that device.
+func Test_BufferPool_otherDevice(t *testing.T) {
+	device := otherDevice(t)
+
+	ctx, err := NewContext(device)
+	require.Nil(t, err, "Unable to create context: %s", err)
+	addId()
+	defer ctx.Close()
+
+	pool, err := ctx.NewBufferPool(PoolOptions{Buffer: BufferOptions{Storage: StoragePrivate}, Zero: true})
+	require.Nil(t, err, "Unable to create buffer pool: %s", err)
+
+	id, _, err := PoolGet[uint8](pool, 100)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.True(t, validId(id))
+	require.Nil(t, Upload(id, 0, []uint8{1, 2, 3, 4}))
+	require.Nil(t, pool.Put(id))
+
+	reusedId, _, err := PoolGet[uint8](pool, 100)
+	require.Nil(t, err, "Unable to get buffer: %s", err)
+	require.Equal(t, id, reusedId)
+	addId()
+	got := make([]uint8, 4)
+	require.Nil(t, Download(reusedId, 0, got))
+	require.Equal(t, []uint8{0, 0, 0, 0}, got)
+}
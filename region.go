@@ -0,0 +1,54 @@
+package metal
+
+import (
+	"fmt"
+)
+
+// A Region is a box of texels in a texture, which starts at (X, Y, Z) and is Width texels wide,
+// Height texels high, and Depth texels deep. The zero value covers the entire texture. A Depth of 0
+// is the same as 1, so that regions of 2-dimensional textures can leave it out.
+type Region struct {
+	X, Y, Z              int
+	Width, Height, Depth int
+}
+
+// String returns a description of the region, such as "3x2x1 at (1, 0, 0)".
+func (r Region) String() string {
+	return fmt.Sprintf("%dx%dx%d at (%d, %d, %d)", r.Width, r.Height, r.Depth, r.X, r.Y, r.Z)
+}
+
+// resolve checks that the region lies within a texture with the provided dimensions and returns it
+// with the defaults filled in.
+func (r Region) resolve(width, height, depth int) (Region, error) {
+	if r == (Region{}) {
+		return Region{Width: width, Height: height, Depth: depth}, nil
+	}
+	if r.Depth == 0 {
+		r.Depth = 1
+	}
+
+	for _, dim := range [][3]int{{r.X, r.Width, width}, {r.Y, r.Height, height}, {r.Z, r.Depth, depth}} {
+		start, length, textureLen := dim[0], dim[1], dim[2]
+		if start < 0 || length < 1 || length > textureLen || start > textureLen-length {
+			return Region{}, fmt.Errorf("Region %s is outside of the %dx%dx%d texture", r, width,
+				height, depth)
+		}
+	}
+
+	return r, nil
+}
+
+// numTexels returns the number of texels in the region.
+func (r Region) numTexels() int {
+	return r.Width * r.Height * r.Depth
+}
+
+// regionBytes returns how the texels of a region with texels of texelSize bytes are laid out in CPU
+// memory: the number of bytes in one row, the number of bytes in one 2-dimensional image (all the
+// rows at one depth), and the total number of bytes. Rows are tightly packed, and so are images.
+func regionBytes(r Region, texelSize int) (bytesPerRow, bytesPerImage, numBytes int) {
+	bytesPerRow = r.Width * texelSize
+	bytesPerImage = bytesPerRow * r.Height
+
+	return bytesPerRow, bytesPerImage, bytesPerImage * r.Depth
+}
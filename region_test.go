@@ -0,0 +1,49 @@
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_Region_resolve tests that resolve fills in the defaults of a region and rejects regions
+// outside of the texture.
+func Test_Region_resolve(t *testing.T) {
+	type scenario struct {
+		region  Region
+		want    Region
+		wantErr string
+	}
+
+	for _, s := range []scenario{
+		{Region{}, Region{Width: 4, Height: 3, Depth: 2}, ""},
+		{Region{Width: 4, Height: 3}, Region{Width: 4, Height: 3, Depth: 1}, ""},
+		{Region{X: 1, Y: 2, Z: 1, Width: 3, Height: 1, Depth: 1}, Region{X: 1, Y: 2, Z: 1, Width: 3, Height: 1, Depth: 1}, ""},
+		{Region{X: 3, Width: 2, Height: 1}, Region{}, "Region 2x1x1 at (3, 0, 0) is outside of the 4x3x2 texture"},
+		{Region{Y: -1, Width: 1, Height: 1}, Region{}, "Region 1x1x1 at (0, -1, 0) is outside of the 4x3x2 texture"},
+		{Region{Z: 1, Width: 1, Height: 1, Depth: 2}, Region{}, "Region 1x1x2 at (0, 0, 1) is outside of the 4x3x2 texture"},
+		{Region{X: 1}, Region{}, "Region 0x0x1 at (1, 0, 0) is outside of the 4x3x2 texture"},
+		{Region{Width: 5, Height: 1}, Region{}, "Region 5x1x1 at (0, 0, 0) is outside of the 4x3x2 texture"},
+	} {
+		r, err := s.region.resolve(4, 3, 2)
+		if s.wantErr != "" {
+			require.NotNil(t, err, s.region.String())
+			require.Equal(t, s.wantErr, err.Error())
+			continue
+		}
+		require.Nil(t, err, "%s: %s", s.region, err)
+		require.Equal(t, s.want, r)
+	}
+}
+
+// Test_regionBytes tests that regionBytes lays out the rows and images of a region back to back.
+func Test_regionBytes(t *testing.T) {
+	r := Region{X: 1, Y: 1, Width: 3, Height: 2, Depth: 4}
+	require.Equal(t, 24, r.numTexels())
+
+	bytesPerRow, bytesPerImage, numBytes := regionBytes(r, 16)
+	require.Equal(t, 48, bytesPerRow)
+	require.Equal(t, 96, bytesPerImage)
+	require.Equal(t, 384, numBytes)
+	require.Equal(t, r.numTexels()*16, numBytes)
+}
@@ -0,0 +1,90 @@
+package metal
+
+import (
+	"errors"
+)
+
+// A Filter determines how a sampler combines texels when a metal function reads from a texture
+// between texels. The values match Apple's MTLSamplerMinMagFilter.
+type Filter int
+
+const (
+	// FilterNearest reads the texel that is closest to the position. This is the default.
+	FilterNearest Filter = 0
+
+	// FilterLinear interpolates between the texels around the position.
+	FilterLinear Filter = 1
+)
+
+// An AddressMode determines what a sampler reads for positions outside of a texture. The values
+// match Apple's MTLSamplerAddressMode.
+type AddressMode int
+
+const (
+	// AddressClampToEdge reads the texel at the closest edge of the texture. This is the default.
+	AddressClampToEdge AddressMode = 0
+
+	// AddressMirrorClampToEdge mirrors the texture once around its edges and then clamps to the
+	// edges of the mirrored texture.
+	AddressMirrorClampToEdge AddressMode = 1
+
+	// AddressRepeat wraps around to the other side of the texture.
+	AddressRepeat AddressMode = 2
+
+	// AddressMirrorRepeat repeats the texture, mirroring every other repetition.
+	AddressMirrorRepeat AddressMode = 3
+
+	// AddressClampToZero reads 0 for every channel (and 1 for alpha in formats without it).
+	AddressClampToZero AddressMode = 4
+)
+
+// A SamplerDescriptor describes how a sampler created with NewSampler reads from textures. The
+// zero value reads the nearest texel at normalized coordinates and clamps positions to the edges
+// of the texture, the same as metal's defaults.
+type SamplerDescriptor struct {
+	// MinFilter is used when a texel covers less than one pixel, and MagFilter when it covers more.
+	MinFilter Filter
+	MagFilter Filter
+
+	// AddressModeS, AddressModeT, and AddressModeR are the address modes for the width, height, and
+	// depth coordinates.
+	AddressModeS AddressMode
+	AddressModeT AddressMode
+	AddressModeR AddressMode
+
+	// PixelCoordinates makes the sampler take coordinates in texels, from 0 to the width, height,
+	// or depth of the texture, instead of normalized coordinates from 0 to 1. Samplers with pixel
+	// coordinates must use the same MinFilter and MagFilter and can only clamp to the edge or to 0.
+	PixelCoordinates bool
+}
+
+// check checks that metal can create a sampler with this descriptor.
+func (d SamplerDescriptor) check() error {
+	for _, filter := range []Filter{d.MinFilter, d.MagFilter} {
+		if filter < FilterNearest || filter > FilterLinear {
+			return errors.New("Invalid filter")
+		}
+	}
+
+	modes := []AddressMode{d.AddressModeS, d.AddressModeT, d.AddressModeR}
+	for _, mode := range modes {
+		if mode < AddressClampToEdge || mode > AddressClampToZero {
+			return errors.New("Invalid address mode")
+		}
+	}
+
+	if !d.PixelCoordinates {
+		return nil
+	}
+	if d.MinFilter != d.MagFilter {
+		return errors.New("Pixel coordinates require the same min and mag filter")
+	}
+	for _, mode := range modes {
+		if mode != AddressClampToEdge && mode != AddressClampToZero {
+			return errors.New("Pixel coordinates only support the clamp-to-edge and clamp-to-zero " +
+				"address modes")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_SamplerDescriptor_check tests that check accepts the descriptors that metal can create a
+// sampler for and rejects the others.
+func Test_SamplerDescriptor_check(t *testing.T) {
+	type scenario struct {
+		desc    SamplerDescriptor
+		wantErr string
+	}
+
+	for _, s := range []scenario{
+		{SamplerDescriptor{}, ""},
+		{SamplerDescriptor{MinFilter: FilterLinear, AddressModeS: AddressRepeat, AddressModeT: AddressMirrorRepeat}, ""},
+		{SamplerDescriptor{MagFilter: 2}, "Invalid filter"},
+		{SamplerDescriptor{AddressModeR: 5}, "Invalid address mode"},
+		{SamplerDescriptor{AddressModeS: -1}, "Invalid address mode"},
+		{SamplerDescriptor{PixelCoordinates: true}, ""},
+		{SamplerDescriptor{PixelCoordinates: true, MinFilter: FilterLinear, MagFilter: FilterLinear, AddressModeT: AddressClampToZero}, ""},
+		{SamplerDescriptor{PixelCoordinates: true, MagFilter: FilterLinear}, "Pixel coordinates require the same min and mag filter"},
+		{SamplerDescriptor{PixelCoordinates: true, AddressModeS: AddressRepeat}, "Pixel coordinates only support the clamp-to-edge and clamp-to-zero address modes"},
+	} {
+		err := s.desc.check()
+		if s.wantErr != "" {
+			require.NotNil(t, err, "%+v", s.desc)
+			require.Equal(t, s.wantErr, err.Error())
+			continue
+		}
+		require.Nil(t, err, "%+v: %s", s.desc, err)
+	}
+}
@@ -0,0 +1,259 @@
+package metal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// shapeLen returns the number of elements in a shape.
+func shapeLen(shape []int) int {
+	n := 1
+	for _, dimLen := range shape {
+		n *= dimLen
+	}
+
+	return n
+}
+
+// contiguousStrides calculates the strides, in elements, for a shape whose elements are laid out
+// contiguously in row-major order: the last axis changes the fastest.
+func contiguousStrides(shape []int) []int {
+	strides := make([]int, len(shape))
+
+	stride := 1
+	for axis := len(shape) - 1; axis >= 0; axis-- {
+		strides[axis] = stride
+		stride *= shape[axis]
+	}
+
+	return strides
+}
+
+// isContiguous checks whether or not a shape with the provided strides covers one contiguous block
+// of elements in row-major order. Axes with a length of 1 can have any stride, because it's never
+// used.
+func isContiguous(shape, strides []int) bool {
+	stride := 1
+	for axis := len(shape) - 1; axis >= 0; axis-- {
+		if shape[axis] != 1 && strides[axis] != stride {
+			return false
+		}
+		stride *= shape[axis]
+	}
+
+	return true
+}
+
+// elementIndex calculates the index of the element at position idx in a shape with the provided
+// offset and strides. It panics if idx doesn't have one valid position for every axis, the same
+// way that indexing a slice out of range does.
+func elementIndex(offset int, shape, strides, idx []int) int {
+	if len(idx) != len(shape) {
+		panic(fmt.Sprintf("metal: %d indexes provided for a tensor with %d dimensions", len(idx),
+			len(shape)))
+	}
+
+	index := offset
+	for axis, i := range idx {
+		if i < 0 || i >= shape[axis] {
+			panic(fmt.Sprintf("metal: index %d out of range for axis %d with length %d", i, axis,
+				shape[axis]))
+		}
+		index += i * strides[axis]
+	}
+
+	return index
+}
+
+// reshape checks that newShape can hold exactly numElems elements and returns a copy of it. One
+// dimension can be -1, in which case its length is calculated from numElems and the other
+// dimensions.
+func reshape(numElems int, newShape []int) ([]int, error) {
+	if len(newShape) == 0 {
+		return nil, errors.New("Missing dimension(s)")
+	}
+
+	shape := make([]int, len(newShape))
+	copy(shape, newShape)
+
+	inferred := -1
+	known := 1
+	for axis, dimLen := range shape {
+		switch {
+		case dimLen == -1 && inferred == -1:
+			inferred = axis
+		case dimLen == -1:
+			return nil, errors.New("Only one dimension can be inferred")
+		case dimLen < 1:
+			return nil, errors.New("Invalid dimension")
+		default:
+			known *= dimLen
+		}
+	}
+
+	if inferred != -1 {
+		if numElems%known != 0 {
+			return nil, fmt.Errorf("Unable to infer dimension: %d elements don't divide into %d",
+				numElems, known)
+		}
+		shape[inferred] = numElems / known
+		known = numElems
+	}
+
+	if known != numElems {
+		return nil, fmt.Errorf("Shape %v holds %d elements, not %d", shape, known, numElems)
+	}
+
+	return shape, nil
+}
+
+// permute reorders shape and strides so that new axis i is old axis axes[i]. If axes is empty, the
+// order of the axes is reversed. axes must otherwise contain every axis exactly once.
+func permute(shape, strides, axes []int) ([]int, []int, error) {
+	if len(axes) == 0 {
+		axes = make([]int, len(shape))
+		for i := range axes {
+			axes[i] = len(shape) - 1 - i
+		}
+	}
+
+	if len(axes) != len(shape) {
+		return nil, nil, fmt.Errorf("%d axes provided for a tensor with %d dimensions", len(axes),
+			len(shape))
+	}
+
+	newShape := make([]int, len(shape))
+	newStrides := make([]int, len(strides))
+	seen := make([]bool, len(shape))
+	for i, axis := range axes {
+		if axis < 0 || axis >= len(shape) || seen[axis] {
+			return nil, nil, fmt.Errorf("Invalid axes %v", axes)
+		}
+		seen[axis] = true
+
+		newShape[i] = shape[axis]
+		newStrides[i] = strides[axis]
+	}
+
+	return newShape, newStrides, nil
+}
+
+// sliceAxis restricts axis to the elements from start up to (but not including) end. It returns
+// the new offset and shape. The strides stay the same.
+func sliceAxis(offset int, shape, strides []int, axis, start, end int) (int, []int, error) {
+	if axis < 0 || axis >= len(shape) {
+		return 0, nil, fmt.Errorf("Invalid axis %d for a tensor with %d dimensions", axis, len(shape))
+	}
+	if start < 0 || end > shape[axis] || start >= end {
+		return 0, nil, fmt.Errorf("Invalid range [%d:%d] for axis %d with length %d", start, end, axis,
+			shape[axis])
+	}
+
+	newShape := make([]int, len(shape))
+	copy(newShape, shape)
+	newShape[axis] = end - start
+
+	return offset + start*strides[axis], newShape, nil
+}
+
+// flatten2D checks that every slice in src has the same length and returns the dimensions of src
+// along with its elements in one contiguous slice, in the same order as NewBuffer2D lays them out.
+// If the elements already lie one after another in memory, as they do for the slices returned by
+// NewBuffer2D, the returned slice shares memory with src instead of being a copy.
+func flatten2D[T any](src [][]T) ([]T, []int, error) {
+	height := 0
+	if len(src) > 0 {
+		height = len(src[0])
+	}
+	for i := range src {
+		if len(src[i]) != height {
+			return nil, nil, fmt.Errorf("Slices are not rectangular: src[%d] has length %d instead of %d",
+				i, len(src[i]), height)
+		}
+	}
+
+	return joinRows(src, height), []int{len(src), height}, nil
+}
+
+// flatten3D is the same as flatten2D for 3-dimensional slices.
+func flatten3D[T any](src [][][]T) ([]T, []int, error) {
+	height, depth := 0, 0
+	if len(src) > 0 {
+		height = len(src[0])
+		if height > 0 {
+			depth = len(src[0][0])
+		}
+	}
+
+	rows := make([][]T, 0, len(src)*height)
+	for i := range src {
+		if len(src[i]) != height {
+			return nil, nil, fmt.Errorf("Slices are not rectangular: src[%d] has length %d instead of %d",
+				i, len(src[i]), height)
+		}
+		for j := range src[i] {
+			if len(src[i][j]) != depth {
+				return nil, nil, fmt.Errorf("Slices are not rectangular: src[%d][%d] has length %d "+
+					"instead of %d", i, j, len(src[i][j]), depth)
+			}
+			rows = append(rows, src[i][j])
+		}
+	}
+
+	return joinRows(rows, depth), []int{len(src), height, depth}, nil
+}
+
+// joinRows joins rows that each have rowLen elements into one slice. If the rows already lie one
+// after another in the same backing array, and the capacity of the first row reaches the end of the
+// last one, that array is returned instead of a copy. Rows that are full slice expressions, such as
+// the ones that NewBuffer2D and NewBuffer3D return, are always copied.
+func joinRows[T any](rows [][]T, rowLen int) []T {
+	n := len(rows) * rowLen
+	if n == 0 {
+		return nil
+	}
+
+	if cap(rows[0]) >= n {
+		joined := rows[0][:n]
+		contiguous := true
+		for i := range rows {
+			if &rows[i][0] != &joined[i*rowLen] {
+				contiguous = false
+				break
+			}
+		}
+		if contiguous {
+			return joined
+		}
+	}
+
+	joined := make([]T, 0, n)
+	for _, row := range rows {
+		joined = append(joined, row...)
+	}
+
+	return joined
+}
+
+// gather copies the elements of a shape with the provided offset and strides out of data into a
+// new slice, in row-major order.
+func gather[T any](data []T, offset int, shape, strides []int) []T {
+	n := shapeLen(shape)
+	elems := make([]T, 0, n)
+
+	pos := make([]int, len(shape))
+	for i := 0; i < n; i++ {
+		elems = append(elems, data[elementIndex(offset, shape, strides, pos)])
+
+		// Move to the next position, like an odometer.
+		for axis := len(shape) - 1; axis >= 0; axis-- {
+			pos[axis]++
+			if pos[axis] < shape[axis] {
+				break
+			}
+			pos[axis] = 0
+		}
+	}
+
+	return elems
+}
@@ -0,0 +1,265 @@
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_contiguousStrides tests that contiguousStrides calculates row-major strides.
+func Test_contiguousStrides(t *testing.T) {
+	require.Equal(t, []int{}, contiguousStrides([]int{}))
+	require.Equal(t, []int{1}, contiguousStrides([]int{5}))
+	require.Equal(t, []int{3, 1}, contiguousStrides([]int{2, 3}))
+	require.Equal(t, []int{12, 4, 1}, contiguousStrides([]int{2, 3, 4}))
+	require.Equal(t, []int{3 * 32 * 32, 32 * 32, 32, 1}, contiguousStrides([]int{8, 3, 32, 32}))
+}
+
+// Test_isContiguous tests that isContiguous identifies contiguous row-major layouts.
+func Test_isContiguous(t *testing.T) {
+	require.True(t, isContiguous([]int{2, 3, 4}, []int{12, 4, 1}))
+	require.True(t, isContiguous([]int{2, 1, 4}, []int{4, 100, 1}))
+	require.True(t, isContiguous([]int{1, 3}, []int{0, 1}))
+	require.False(t, isContiguous([]int{4, 3}, []int{1, 4}))
+	require.False(t, isContiguous([]int{2, 2}, []int{3, 1}))
+	require.False(t, isContiguous([]int{2, 3}, []int{6, 2}))
+}
+
+// Test_elementIndex tests that elementIndex finds the correct element and panics on invalid
+// indexes.
+func Test_elementIndex(t *testing.T) {
+	shape := []int{2, 3, 4}
+	strides := contiguousStrides(shape)
+
+	// Every position maps to its row-major index.
+	want := 0
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 4; k++ {
+				require.Equal(t, want, elementIndex(0, shape, strides, []int{i, j, k}))
+				require.Equal(t, want+10, elementIndex(10, shape, strides, []int{i, j, k}))
+				want++
+			}
+		}
+	}
+
+	// Transposed strides
+	require.Equal(t, 1*1+2*4, elementIndex(0, []int{4, 3}, []int{1, 4}, []int{1, 2}))
+
+	require.PanicsWithValue(t, "metal: 2 indexes provided for a tensor with 3 dimensions", func() {
+		elementIndex(0, shape, strides, []int{0, 0})
+	})
+	require.PanicsWithValue(t, "metal: index 3 out of range for axis 1 with length 3", func() {
+		elementIndex(0, shape, strides, []int{0, 3, 0})
+	})
+	require.PanicsWithValue(t, "metal: index -1 out of range for axis 2 with length 4", func() {
+		elementIndex(0, shape, strides, []int{0, 0, -1})
+	})
+}
+
+// Test_reshape tests that reshape validates new shapes and infers dimensions.
+func Test_reshape(t *testing.T) {
+	shape, err := reshape(24, []int{2, 3, 4})
+	require.Nil(t, err)
+	require.Equal(t, []int{2, 3, 4}, shape)
+
+	shape, err = reshape(24, []int{6, -1})
+	require.Nil(t, err)
+	require.Equal(t, []int{6, 4}, shape)
+
+	shape, err = reshape(24, []int{-1})
+	require.Nil(t, err)
+	require.Equal(t, []int{24}, shape)
+
+	// The shape provided isn't modified.
+	newShape := []int{-1, 2}
+	shape, err = reshape(24, newShape)
+	require.Nil(t, err)
+	require.Equal(t, []int{12, 2}, shape)
+	require.Equal(t, []int{-1, 2}, newShape)
+
+	type scenario struct {
+		shape   []int
+		wantErr string
+	}
+	for _, s := range []scenario{
+		{nil, "Missing dimension(s)"},
+		{[]int{0, 24}, "Invalid dimension"},
+		{[]int{-2, 12}, "Invalid dimension"},
+		{[]int{-1, -1}, "Only one dimension can be inferred"},
+		{[]int{-1, 5}, "Unable to infer dimension: 24 elements don't divide into 5"},
+		{[]int{5, 5}, "Shape [5 5] holds 25 elements, not 24"},
+	} {
+		shape, err := reshape(24, s.shape)
+		require.NotNil(t, err, "%v", s.shape)
+		require.Equal(t, s.wantErr, err.Error())
+		require.Nil(t, shape)
+	}
+}
+
+// Test_permute tests that permute reorders axes and validates them.
+func Test_permute(t *testing.T) {
+	shape, strides, err := permute([]int{2, 3, 4}, []int{12, 4, 1}, nil)
+	require.Nil(t, err)
+	require.Equal(t, []int{4, 3, 2}, shape)
+	require.Equal(t, []int{1, 4, 12}, strides)
+
+	shape, strides, err = permute([]int{2, 3, 4}, []int{12, 4, 1}, []int{1, 0, 2})
+	require.Nil(t, err)
+	require.Equal(t, []int{3, 2, 4}, shape)
+	require.Equal(t, []int{4, 12, 1}, strides)
+
+	for _, axes := range [][]int{{0, 1}, {0, 1, 1}, {0, 1, 3}, {-1, 0, 1}} {
+		shape, strides, err := permute([]int{2, 3, 4}, []int{12, 4, 1}, axes)
+		require.NotNil(t, err, "%v", axes)
+		require.Nil(t, shape)
+		require.Nil(t, strides)
+	}
+}
+
+// Test_sliceAxis tests that sliceAxis narrows an axis and validates the range.
+func Test_sliceAxis(t *testing.T) {
+	shape := []int{2, 3, 4}
+	strides := contiguousStrides(shape)
+
+	offset, newShape, err := sliceAxis(0, shape, strides, 1, 1, 3)
+	require.Nil(t, err)
+	require.Equal(t, 4, offset)
+	require.Equal(t, []int{2, 2, 4}, newShape)
+	require.Equal(t, []int{2, 3, 4}, shape)
+
+	offset, newShape, err = sliceAxis(5, shape, strides, 0, 1, 2)
+	require.Nil(t, err)
+	require.Equal(t, 17, offset)
+	require.Equal(t, []int{1, 3, 4}, newShape)
+
+	type scenario struct {
+		axis, start, end int
+		wantErr          string
+	}
+	for _, s := range []scenario{
+		{-1, 0, 1, "Invalid axis -1 for a tensor with 3 dimensions"},
+		{3, 0, 1, "Invalid axis 3 for a tensor with 3 dimensions"},
+		{1, -1, 2, "Invalid range [-1:2] for axis 1 with length 3"},
+		{1, 0, 4, "Invalid range [0:4] for axis 1 with length 3"},
+		{1, 2, 2, "Invalid range [2:2] for axis 1 with length 3"},
+	} {
+		_, newShape, err := sliceAxis(0, shape, strides, s.axis, s.start, s.end)
+		require.NotNil(t, err)
+		require.Equal(t, s.wantErr, err.Error())
+		require.Nil(t, newShape)
+	}
+}
+
+// Test_flatten2D tests that flatten2D joins the rows of a rectangular 2-dimensional slice, without
+// copying them if they are already contiguous.
+func Test_flatten2D(t *testing.T) {
+	// Separately allocated rows are copied.
+	src := [][]int{{1, 2, 3}, {4, 5, 6}}
+	flat, dims, err := flatten2D(src)
+	require.Nil(t, err)
+	require.Equal(t, []int{1, 2, 3, 4, 5, 6}, flat)
+	require.Equal(t, []int{2, 3}, dims)
+	flat[0] = 100
+	require.Equal(t, 1, src[0][0])
+
+	// Rows that lie one after another in memory are not.
+	backing := []int{1, 2, 3, 4, 5, 6}
+	src = [][]int{backing[0:2], backing[2:4], backing[4:6]}
+	flat, dims, err = flatten2D(src)
+	require.Nil(t, err)
+	require.Equal(t, backing, flat)
+	require.Equal(t, []int{3, 2}, dims)
+	require.Same(t, &backing[0], &flat[0])
+
+	// Rows from the same backing array, but out of order
+	src = [][]int{backing[2:4], backing[0:2]}
+	flat, _, err = flatten2D(src)
+	require.Nil(t, err)
+	require.Equal(t, []int{3, 4, 1, 2}, flat)
+
+	// Empty slices
+	flat, dims, err = flatten2D([][]int{})
+	require.Nil(t, err)
+	require.Nil(t, flat)
+	require.Equal(t, []int{0, 0}, dims)
+	flat, dims, err = flatten2D([][]int{{}, {}})
+	require.Nil(t, err)
+	require.Nil(t, flat)
+	require.Equal(t, []int{2, 0}, dims)
+
+	// Jagged slices
+	_, _, err = flatten2D([][]int{{1, 2}, {3}})
+	require.NotNil(t, err)
+	require.Equal(t, "Slices are not rectangular: src[1] has length 1 instead of 2", err.Error())
+	_, _, err = flatten2D([][]int{{}, {3}})
+	require.NotNil(t, err)
+	require.Equal(t, "Slices are not rectangular: src[1] has length 1 instead of 0", err.Error())
+}
+
+// Test_flatten3D tests that flatten3D joins the rows of a rectangular 3-dimensional slice, without
+// copying them if they are already contiguous.
+func Test_flatten3D(t *testing.T) {
+	src := [][][]int{
+		{{1, 2}, {3, 4}, {5, 6}},
+		{{7, 8}, {9, 10}, {11, 12}},
+	}
+	flat, dims, err := flatten3D(src)
+	require.Nil(t, err)
+	require.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, flat)
+	require.Equal(t, []int{2, 3, 2}, dims)
+
+	// Rows that are sliced out of one backing array aren't copied.
+	backing := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	src = [][][]int{
+		{backing[0:2], backing[2:4], backing[4:6]},
+		{backing[6:8], backing[8:10], backing[10:12]},
+	}
+	flat, dims, err = flatten3D(src)
+	require.Nil(t, err)
+	require.Equal(t, []int{2, 3, 2}, dims)
+	require.Same(t, &backing[0], &flat[0])
+	require.Len(t, flat, 12)
+
+	// Rows whose capacity ends with the row, such as the ones that NewBuffer3D returns, are copied.
+	src = [][][]int{
+		{backing[0:2:2], backing[2:4:4], backing[4:6:6]},
+		{backing[6:8:8], backing[8:10:10], backing[10:12:12]},
+	}
+	flat, dims, err = flatten3D(src)
+	require.Nil(t, err)
+	require.Equal(t, []int{2, 3, 2}, dims)
+	require.Equal(t, backing, flat)
+	require.NotSame(t, &backing[0], &flat[0])
+
+	// Empty slices
+	_, dims, err = flatten3D([][][]int{{}, {}})
+	require.Nil(t, err)
+	require.Equal(t, []int{2, 0, 0}, dims)
+
+	// Jagged slices
+	_, _, err = flatten3D([][][]int{{{1}, {2}}, {{3}}})
+	require.NotNil(t, err)
+	require.Equal(t, "Slices are not rectangular: src[1] has length 1 instead of 2", err.Error())
+	_, _, err = flatten3D([][][]int{{{1}, {2}}, {{3}, {4, 5}}})
+	require.NotNil(t, err)
+	require.Equal(t, "Slices are not rectangular: src[1][1] has length 2 instead of 1", err.Error())
+}
+
+// Test_gather tests that gather copies the elements of any view in row-major order.
+func Test_gather(t *testing.T) {
+	data := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+
+	// A contiguous view is copied as is.
+	require.Equal(t, data, gather(data, 0, []int{3, 4}, []int{4, 1}))
+
+	// A transposed view.
+	require.Equal(t, []int{0, 4, 8, 1, 5, 9, 2, 6, 10, 3, 7, 11},
+		gather(data, 0, []int{4, 3}, []int{1, 4}))
+
+	// A slice of the middle columns.
+	require.Equal(t, []int{1, 2, 5, 6, 9, 10}, gather(data, 1, []int{3, 2}, []int{4, 1}))
+
+	// A single element.
+	require.Equal(t, []int{7}, gather(data, 7, []int{1}, []int{1}))
+}
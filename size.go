@@ -0,0 +1,135 @@
+package metal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// bufferSize calculates how many elements and bytes are needed for a buffer with the provided
+// dimensions and size in bytes of each element. It checks that every dimension is valid and that
+// the total number of bytes doesn't exceed maxBytes. All arithmetic is done with 64-bit unsigned
+// integers and is checked for overflow, so this is safe for any combination of dimensions.
+func bufferSize(elemSize int, dimLens []int, maxBytes uint64) (numElems int, numBytes uint64, err error) {
+	if len(dimLens) == 0 {
+		return 0, 0, errors.New("Missing dimension(s)")
+	}
+	if elemSize < 1 {
+		return 0, 0, errors.New("Invalid element size")
+	}
+
+	// A slice can't have more than math.MaxInt elements, so that's a limit as well.
+	if maxElems := uint64(math.MaxInt); maxBytes/uint64(elemSize) > maxElems {
+		maxBytes = maxElems * uint64(elemSize)
+	}
+
+	elems := uint64(1)
+	numBytes = uint64(elemSize)
+	for _, dimLen := range dimLens {
+		if dimLen < 1 {
+			return 0, 0, errors.New("Invalid dimension")
+		}
+
+		var overflow uint64
+		overflow, numBytes = bits.Mul64(numBytes, uint64(dimLen))
+		if overflow != 0 || numBytes > maxBytes {
+			return 0, 0, errors.New("Exceeded maximum number of bytes")
+		}
+
+		// The number of elements is always less than or equal to the number of bytes, so this
+		// can't overflow if the bytes didn't.
+		elems *= uint64(dimLen)
+	}
+
+	return int(elems), numBytes, nil
+}
+
+// viewRange calculates the range of bytes covered by a view of length elements that starts
+// offset elements into a buffer of bufferLen bytes. Every element is elemSize bytes long. The
+// range must lie completely inside the buffer.
+func viewRange(elemSize, offset, length int, bufferLen uint64) (offsetBytes, numBytes uint64, err error) {
+	if offset < 0 {
+		return 0, 0, errors.New("Invalid offset")
+	}
+	if length < 1 {
+		return 0, 0, errors.New("Invalid length")
+	}
+
+	hi, offsetBytes := bits.Mul64(uint64(offset), uint64(elemSize))
+	if hi != 0 || offsetBytes >= bufferLen {
+		return 0, 0, errors.New("Offset is outside of the buffer")
+	}
+
+	hi, numBytes = bits.Mul64(uint64(length), uint64(elemSize))
+	if hi != 0 || numBytes > bufferLen-offsetBytes {
+		return 0, 0, errors.New("View extends past the end of the buffer")
+	}
+
+	return offsetBytes, numBytes, nil
+}
+
+// reinterpretLen calculates how many elements of elemSize bytes fit exactly in numBytes bytes of
+// memory that start at address addr. The number of bytes must be a multiple of the element size,
+// and the address must be aligned to elemAlign bytes.
+func reinterpretLen(addr uintptr, numBytes uint64, elemSize, elemAlign int) (int, error) {
+	if numBytes == 0 {
+		return 0, errors.New("Invalid length")
+	}
+	if numBytes%uint64(elemSize) != 0 {
+		return 0, fmt.Errorf("Length of %d bytes is not a multiple of the element size of %d bytes",
+			numBytes, elemSize)
+	}
+	if elemAlign > 1 && addr%uintptr(elemAlign) != 0 {
+		return 0, fmt.Errorf("Memory is not aligned to %d bytes", elemAlign)
+	}
+
+	return int(numBytes / uint64(elemSize)), nil
+}
+
+// checkNoCopy checks that numBytes bytes of memory at address addr can be wrapped by a metal buffer
+// without copying them. Metal requires both the address and the length to be multiples of the page
+// size.
+func checkNoCopy(addr uintptr, numBytes, pageSize int, maxBytes uint64) error {
+	switch {
+	case numBytes <= 0:
+		return errors.New("Missing memory")
+	case addr%uintptr(pageSize) != 0:
+		return fmt.Errorf("Memory is not aligned to the page size of %d bytes", pageSize)
+	case numBytes%pageSize != 0:
+		return fmt.Errorf("Length of %d bytes is not a multiple of the page size of %d bytes",
+			numBytes, pageSize)
+	case uint64(numBytes) > maxBytes:
+		return errors.New("Exceeded maximum number of bytes")
+	}
+
+	return nil
+}
+
+// blitRange checks that the n bytes starting offset bytes into a range of rangeLen bytes can be
+// copied or filled on the GPU. Metal requires the offset and the number of bytes to be multiples of
+// 4 on macOS.
+func blitRange(offset, n int, rangeLen uint64) error {
+	switch {
+	case offset < 0:
+		return errors.New("Invalid offset")
+	case n < 1:
+		return errors.New("Invalid length")
+	case uint64(offset) >= rangeLen:
+		return errors.New("Offset is outside of the buffer")
+	case uint64(n) > rangeLen-uint64(offset):
+		return errors.New("Range extends past the end of the buffer")
+	case offset%4 != 0:
+		return fmt.Errorf("Offset of %d bytes is not a multiple of 4 bytes", offset)
+	case n%4 != 0:
+		return fmt.Errorf("Length of %d bytes is not a multiple of 4 bytes", n)
+	}
+
+	return nil
+}
+
+// rangesOverlap checks whether or not the n bytes starting at offset a overlap the n bytes starting
+// at offset b.
+func rangesOverlap(a, b, n uint64) bool {
+	return a < b+n && b < a+n
+}
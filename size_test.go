@@ -0,0 +1,239 @@
+package metal
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_bufferSize tests that bufferSize calculates the number of elements and bytes for a variety
+// of dimensions.
+func Test_bufferSize(t *testing.T) {
+	type scenario struct {
+		elemSize  int
+		dimLens   []int
+		maxBytes  uint64
+		wantElems int
+		wantBytes uint64
+	}
+
+	for _, s := range []scenario{
+		{1, []int{1}, 1, 1, 1},
+		{4, []int{10}, 40, 10, 40},
+		{4, []int{10, 20}, math.MaxUint64, 200, 800},
+		{16, []int{2, 3, 4, 5}, math.MaxUint64, 120, 1920},
+		{1, []int{math.MaxInt32 + 1}, math.MaxUint64, math.MaxInt32 + 1, math.MaxInt32 + 1},
+		{4, []int{1 << 30, 4}, 1 << 34, 1 << 32, 1 << 34},
+		{1, []int{math.MaxInt}, math.MaxUint64, math.MaxInt, math.MaxInt},
+		{8, []int{1 << 20, 1 << 20, 1 << 10}, 1 << 53, 1 << 50, 1 << 53},
+	} {
+		numElems, numBytes, err := bufferSize(s.elemSize, s.dimLens, s.maxBytes)
+		require.Nil(t, err, "%v", s)
+		require.Equal(t, s.wantElems, numElems, "%v", s)
+		require.Equal(t, s.wantBytes, numBytes, "%v", s)
+	}
+}
+
+// Test_bufferSize_invalid tests that bufferSize rejects invalid dimensions and sizes that are too
+// large or that overflow.
+func Test_bufferSize_invalid(t *testing.T) {
+	type scenario struct {
+		elemSize int
+		dimLens  []int
+		maxBytes uint64
+		wantErr  string
+	}
+
+	for _, s := range []scenario{
+		{4, nil, math.MaxUint64, "Missing dimension(s)"},
+		{4, []int{}, math.MaxUint64, "Missing dimension(s)"},
+		{0, []int{1}, math.MaxUint64, "Invalid element size"},
+		{-4, []int{1}, math.MaxUint64, "Invalid element size"},
+		{4, []int{0}, math.MaxUint64, "Invalid dimension"},
+		{4, []int{10, -1}, math.MaxUint64, "Invalid dimension"},
+		{4, []int{10, 10, 0}, math.MaxUint64, "Invalid dimension"},
+		{4, []int{10}, 39, "Exceeded maximum number of bytes"},
+		{4, []int{10, 10}, 399, "Exceeded maximum number of bytes"},
+		{1, []int{math.MaxInt32 + 1}, math.MaxInt32, "Exceeded maximum number of bytes"},
+
+		// These overflow 64 bits.
+		{4, []int{math.MaxInt}, math.MaxUint64, "Exceeded maximum number of bytes"},
+		{4, []int{1 << 31, 1 << 31}, math.MaxUint64, "Exceeded maximum number of bytes"},
+		{4, []int{100_000, 100_000, 100_000, 100_000}, math.MaxUint64, "Exceeded maximum number of bytes"},
+		{1, []int{math.MaxInt, math.MaxInt}, math.MaxUint64, "Exceeded maximum number of bytes"},
+		{1, []int{1 << 32, 1 << 32, 1 << 32, 1}, math.MaxUint64, "Exceeded maximum number of bytes"},
+
+		// This doesn't overflow 64 bits, but it's too many elements for a slice.
+		{1, []int{math.MaxInt, 2}, math.MaxUint64, "Exceeded maximum number of bytes"},
+	} {
+		numElems, numBytes, err := bufferSize(s.elemSize, s.dimLens, s.maxBytes)
+		require.NotNil(t, err, "%v", s)
+		require.Equal(t, s.wantErr, err.Error(), "%v", s)
+		require.Equal(t, 0, numElems)
+		require.Equal(t, uint64(0), numBytes)
+	}
+}
+
+// Test_viewRange tests that viewRange calculates the range of bytes covered by a view and rejects
+// views that don't fit in the buffer.
+func Test_viewRange(t *testing.T) {
+	type scenario struct {
+		elemSize, offset, length int
+		bufferLen                uint64
+		wantOffset, wantBytes    uint64
+		wantErr                  string
+	}
+
+	for _, s := range []scenario{
+		// Valid
+		{4, 0, 10, 40, 0, 40, ""},
+		{4, 5, 5, 40, 20, 20, ""},
+		{4, 9, 1, 40, 36, 4, ""},
+		{1, 3, 7, 10, 3, 7, ""},
+		{16, 2, 2, 64, 32, 32, ""},
+		{12, 1, 2, 36, 12, 24, ""},
+		{4, 1 << 31, 1 << 30, 1 << 34, 1 << 33, 1 << 32, ""},
+
+		// Invalid arguments
+		{4, -1, 1, 40, 0, 0, "Invalid offset"},
+		{4, 0, 0, 40, 0, 0, "Invalid length"},
+		{4, 0, -1, 40, 0, 0, "Invalid length"},
+
+		// Outside of the buffer
+		{4, 10, 1, 40, 0, 0, "Offset is outside of the buffer"},
+		{4, math.MaxInt, 1, math.MaxUint64, 0, 0, "Offset is outside of the buffer"},
+		{4, 5, 6, 40, 0, 0, "View extends past the end of the buffer"},
+		{4, 0, math.MaxInt, math.MaxUint64, 0, 0, "View extends past the end of the buffer"},
+	} {
+		offset, numBytes, err := viewRange(s.elemSize, s.offset, s.length, s.bufferLen)
+		if s.wantErr != "" {
+			require.NotNil(t, err, "%v", s)
+			require.Equal(t, s.wantErr, err.Error(), "%v", s)
+			continue
+		}
+
+		require.Nil(t, err, "%v", s)
+		require.Equal(t, s.wantOffset, offset, "%v", s)
+		require.Equal(t, s.wantBytes, numBytes, "%v", s)
+	}
+}
+
+// Test_reinterpretLen tests that reinterpretLen calculates how many elements fit in a block of
+// memory and rejects lengths and addresses that don't line up with the elements.
+func Test_reinterpretLen(t *testing.T) {
+	type scenario struct {
+		addr                uintptr
+		numBytes            uint64
+		elemSize, elemAlign int
+		want                int
+		wantErr             string
+	}
+
+	for _, s := range []scenario{
+		{0x1000, 400, 4, 4, 100, ""},
+		{0x1000, 400, 2, 2, 200, ""},
+		{0x1000, 400, 16, 16, 25, ""},
+		{0x1004, 12, 12, 4, 1, ""},
+		{0x1001, 3, 1, 1, 3, ""},
+		{0x1000, 1 << 40, 8, 8, 1 << 37, ""},
+
+		{0x1000, 0, 4, 4, 0, "Invalid length"},
+		{0x1000, 402, 4, 4, 0, "Length of 402 bytes is not a multiple of the element size of 4 bytes"},
+		{0x1000, 40, 12, 4, 0, "Length of 40 bytes is not a multiple of the element size of 12 bytes"},
+		{0x1002, 400, 4, 4, 0, "Memory is not aligned to 4 bytes"},
+		{0x1008, 32, 16, 16, 0, "Memory is not aligned to 16 bytes"},
+	} {
+		n, err := reinterpretLen(s.addr, s.numBytes, s.elemSize, s.elemAlign)
+		if s.wantErr != "" {
+			require.NotNil(t, err, "%v", s)
+			require.Equal(t, s.wantErr, err.Error(), "%v", s)
+			require.Equal(t, 0, n)
+			continue
+		}
+
+		require.Nil(t, err, "%v", s)
+		require.Equal(t, s.want, n, "%v", s)
+	}
+}
+
+// Test_checkNoCopy tests that checkNoCopy only accepts page-aligned memory.
+func Test_checkNoCopy(t *testing.T) {
+	type scenario struct {
+		addr     uintptr
+		numBytes int
+		pageSize int
+		maxBytes uint64
+		wantErr  string
+	}
+
+	for _, s := range []scenario{
+		{0x4000, 0x4000, 0x4000, 1 << 30, ""},
+		{0x8000, 0x40000, 0x4000, 1 << 30, ""},
+		{0x1000, 0x1000, 0x1000, 1 << 30, ""},
+		{0x4000, 0x4000, 0x4000, 0x4000, ""},
+
+		{0x4000, 0, 0x4000, 1 << 30, "Missing memory"},
+		{0x4000, -0x4000, 0x4000, 1 << 30, "Missing memory"},
+		{0x1000, 0x4000, 0x4000, 1 << 30, "Memory is not aligned to the page size of 16384 bytes"},
+		{0x4008, 0x4000, 0x4000, 1 << 30, "Memory is not aligned to the page size of 16384 bytes"},
+		{0x4000, 0x1000, 0x4000, 1 << 30,
+			"Length of 4096 bytes is not a multiple of the page size of 16384 bytes"},
+		{0x4000, 0x4001, 0x4000, 1 << 30,
+			"Length of 16385 bytes is not a multiple of the page size of 16384 bytes"},
+		{0x4000, 0x8000, 0x4000, 0x4000, "Exceeded maximum number of bytes"},
+	} {
+		err := checkNoCopy(s.addr, s.numBytes, s.pageSize, s.maxBytes)
+		if s.wantErr == "" {
+			require.Nil(t, err, "%v", s)
+		} else {
+			require.NotNil(t, err, "%v", s)
+			require.Equal(t, s.wantErr, err.Error(), "%v", s)
+		}
+	}
+}
+
+// Test_blitRange tests that blitRange only accepts ranges that metal can copy and fill.
+func Test_blitRange(t *testing.T) {
+	type scenario struct {
+		offset, n int
+		rangeLen  uint64
+		wantErr   string
+	}
+
+	for _, s := range []scenario{
+		{0, 4, 4, ""},
+		{0, 400, 400, ""},
+		{4, 396, 400, ""},
+		{100, 200, 400, ""},
+		{0, 4, 1 << 40, ""},
+
+		{-4, 4, 400, "Invalid offset"},
+		{0, 0, 400, "Invalid length"},
+		{0, -4, 400, "Invalid length"},
+		{400, 4, 400, "Offset is outside of the buffer"},
+		{0, 404, 400, "Range extends past the end of the buffer"},
+		{200, 204, 400, "Range extends past the end of the buffer"},
+		{2, 4, 400, "Offset of 2 bytes is not a multiple of 4 bytes"},
+		{0, 6, 400, "Length of 6 bytes is not a multiple of 4 bytes"},
+	} {
+		err := blitRange(s.offset, s.n, s.rangeLen)
+		if s.wantErr == "" {
+			require.Nil(t, err, "%v", s)
+		} else {
+			require.NotNil(t, err, "%v", s)
+			require.Equal(t, s.wantErr, err.Error(), "%v", s)
+		}
+	}
+}
+
+// Test_rangesOverlap tests that rangesOverlap detects ranges that share at least one byte.
+func Test_rangesOverlap(t *testing.T) {
+	require.True(t, rangesOverlap(0, 0, 4))
+	require.True(t, rangesOverlap(0, 3, 4))
+	require.True(t, rangesOverlap(3, 0, 4))
+	require.True(t, rangesOverlap(10, 12, 100))
+	require.False(t, rangesOverlap(0, 4, 4))
+	require.False(t, rangesOverlap(4, 0, 4))
+	require.False(t, rangesOverlap(0, 400, 100))
+}
@@ -0,0 +1,98 @@
+package metal
+
+import (
+	"math/bits"
+	"time"
+)
+
+// minSizeClass is the smallest size class, in bytes, that a BufferPool allocates.
+const minSizeClass = 4096
+
+// sizeClass rounds numBytes up to the size class of the buffer that holds it: the next power of 2
+// that is at least minSizeClass. If that is larger than maxBytes, the size class is numBytes
+// itself, so that the largest buffers can still be pooled.
+func sizeClass(numBytes, maxBytes uint64) uint64 {
+	if numBytes <= minSizeClass {
+		return minSizeClass
+	}
+
+	class := uint64(1) << bits.Len64(numBytes-1)
+	if class > maxBytes || class < numBytes {
+		return numBytes
+	}
+
+	return class
+}
+
+// An idleBuffer is a buffer that is waiting in a pool to be reused.
+type idleBuffer struct {
+	id    int
+	class uint64
+	since time.Time
+}
+
+// idleBuffers keeps track of the idle buffers in a pool by size class.
+type idleBuffers struct {
+	byClass map[uint64][]idleBuffer
+	numIdle int
+}
+
+// put adds the buffer with the provided Id and size class, which became idle at now.
+func (b *idleBuffers) put(id int, class uint64, now time.Time) {
+	if b.byClass == nil {
+		b.byClass = make(map[uint64][]idleBuffer)
+	}
+
+	b.byClass[class] = append(b.byClass[class], idleBuffer{id: id, class: class, since: now})
+	b.numIdle++
+}
+
+// take removes a buffer of the provided size class and returns its Id. The buffer that became idle
+// most recently is reused first, so that rarely needed buffers stay idle and can be trimmed. take
+// reports false if there are no idle buffers of the size class.
+func (b *idleBuffers) take(class uint64) (int, bool) {
+	list := b.byClass[class]
+	if len(list) == 0 {
+		return 0, false
+	}
+
+	last := list[len(list)-1]
+	b.byClass[class] = list[:len(list)-1]
+	b.numIdle--
+
+	return last.id, true
+}
+
+// expire removes and returns every buffer that became idle before cutoff.
+func (b *idleBuffers) expire(cutoff time.Time) []idleBuffer {
+	var expired []idleBuffer
+	for class, list := range b.byClass {
+		// Buffers are added in order, so the oldest ones are at the front.
+		n := 0
+		for n < len(list) && list[n].since.Before(cutoff) {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+
+		expired = append(expired, list[:n]...)
+		b.byClass[class] = append(list[:0:0], list[n:]...)
+		b.numIdle -= n
+	}
+
+	return expired
+}
+
+// removeAll removes and returns every idle buffer.
+func (b *idleBuffers) removeAll() []idleBuffer {
+	var all []idleBuffer
+	for _, list := range b.byClass {
+		all = append(all, list...)
+	}
+
+	b.byClass = nil
+	b.numIdle = 0
+
+	return all
+}
@@ -0,0 +1,75 @@
+package metal
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_sizeClass tests that sizeClass rounds sizes up to the next power of 2.
+func Test_sizeClass(t *testing.T) {
+	const maxBytes = 1 << 30
+
+	require.Equal(t, uint64(4096), sizeClass(0, maxBytes))
+	require.Equal(t, uint64(4096), sizeClass(1, maxBytes))
+	require.Equal(t, uint64(4096), sizeClass(4096, maxBytes))
+	require.Equal(t, uint64(8192), sizeClass(4097, maxBytes))
+	require.Equal(t, uint64(8192), sizeClass(8192, maxBytes))
+	require.Equal(t, uint64(1<<20), sizeClass(1<<19+1, maxBytes))
+	require.Equal(t, uint64(1<<30), sizeClass(1<<30, maxBytes))
+
+	// Size classes never exceed the maximum.
+	require.Equal(t, uint64(1<<29+1), sizeClass(1<<29+1, 1<<29+100))
+	require.Equal(t, uint64(1<<63+1), sizeClass(1<<63+1, 1<<64-1))
+}
+
+// Test_idleBuffers tests that idleBuffers hands out buffers by size class and expires the ones
+// that have been idle the longest.
+func Test_idleBuffers(t *testing.T) {
+	var b idleBuffers
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, ok := b.take(4096)
+	require.False(t, ok)
+
+	b.put(1, 4096, start)
+	b.put(2, 4096, start.Add(time.Second))
+	b.put(3, 8192, start.Add(2*time.Second))
+	b.put(4, 4096, start.Add(3*time.Second))
+	require.Equal(t, 4, b.numIdle)
+
+	// The most recently idle buffer is reused first.
+	id, ok := b.take(4096)
+	require.True(t, ok)
+	require.Equal(t, 4, id)
+	_, ok = b.take(16384)
+	require.False(t, ok)
+	require.Equal(t, 3, b.numIdle)
+
+	// Only buffers that became idle before the cutoff expire.
+	expired := b.expire(start.Add(1500 * time.Millisecond))
+	require.Equal(t, []idleBuffer{
+		{id: 1, class: 4096, since: start},
+		{id: 2, class: 4096, since: start.Add(time.Second)},
+	}, expired)
+	require.Equal(t, 1, b.numIdle)
+	_, ok = b.take(4096)
+	require.False(t, ok)
+
+	require.Nil(t, b.expire(start))
+
+	b.put(5, 4096, start.Add(4*time.Second))
+	all := b.removeAll()
+	sort.Slice(all, func(i, j int) bool { return all[i].id < all[j].id })
+	require.Equal(t, []int{3, 5}, []int{all[0].id, all[1].id})
+	require.Equal(t, 0, b.numIdle)
+	require.Nil(t, b.removeAll())
+
+	// The buffers can be used again after they're all removed.
+	b.put(6, 4096, start)
+	id, ok = b.take(4096)
+	require.True(t, ok)
+	require.Equal(t, 6, id)
+}
@@ -0,0 +1,188 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"errors"
+)
+
+// A Tensor is an N-dimensional view of a metal buffer. It has a shape, which is the length of
+// every dimension (axis), and strides, which are the number of elements to skip in the buffer to
+// move one position along every axis. A new tensor has contiguous row-major strides: the last axis
+// changes the fastest, so the element at (i, j, k) in a tensor with shape (X, Y, Z) is at index
+// (i*Y*Z)+(j*Z)+k in the buffer.
+//
+// Reshaping, transposing, and slicing a tensor creates a new view of the same buffer without
+// copying any data. Writing to the elements of one view changes them in every other view.
+//
+// A tensor can be supplied to a metal function as an argument. The metal function always receives
+// the entire buffer, so for views that don't start at the beginning of the buffer or that aren't
+// contiguous, it needs to use the tensor's offset and strides to find the elements.
+type Tensor[T any] struct {
+	id      BufferId
+	data    []T
+	offset  int
+	shape   []int
+	strides []int
+}
+
+// NewTensor allocates a block of memory that is accessible to both the CPU and GPU and is large
+// enough to hold a tensor with the provided shape. Every dimension must have a length of at least
+// 1. The memory is wrapped in a tensor with contiguous row-major strides.
+func NewTensor[T BufferType](shape ...int) (*Tensor[T], error) {
+	bufferId, data, err := newBuffer[T](shape...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTensor(bufferId, data, shape), nil
+}
+
+// newTensor wraps the buffer data in a tensor with the provided shape and contiguous row-major
+// strides.
+func newTensor[T any](bufferId BufferId, data []T, shape []int) *Tensor[T] {
+	t := &Tensor[T]{
+		id:   bufferId,
+		data: data,
+	}
+	t.shape = append(t.shape, shape...)
+	t.strides = contiguousStrides(t.shape)
+
+	return t
+}
+
+// Id returns the Id of the buffer that holds the tensor's elements.
+func (t *Tensor[T]) Id() BufferId {
+	return t.id
+}
+
+// Rank returns the number of dimensions in the tensor.
+func (t *Tensor[T]) Rank() int {
+	return len(t.shape)
+}
+
+// Shape returns the length of every dimension in the tensor.
+func (t *Tensor[T]) Shape() []int {
+	return append([]int(nil), t.shape...)
+}
+
+// Strides returns the number of elements to skip in the buffer to move one position along every
+// dimension in the tensor.
+func (t *Tensor[T]) Strides() []int {
+	return append([]int(nil), t.strides...)
+}
+
+// Offset returns the index in the buffer of the tensor's first element.
+func (t *Tensor[T]) Offset() int {
+	return t.offset
+}
+
+// Len returns the number of elements in the tensor.
+func (t *Tensor[T]) Len() int {
+	return shapeLen(t.shape)
+}
+
+// Contiguous checks whether or not the tensor's elements are one contiguous block of memory in
+// row-major order.
+func (t *Tensor[T]) Contiguous() bool {
+	return isContiguous(t.shape, t.strides)
+}
+
+// Data returns the tensor's elements if they are one contiguous block of memory in row-major
+// order, or nil if they aren't. Like the slices returned by NewBuffer1D, only the contents of the
+// slice should be modified.
+func (t *Tensor[T]) Data() []T {
+	if !t.Contiguous() {
+		return nil
+	}
+
+	end := t.offset + t.Len()
+
+	return t.data[t.offset:end:end]
+}
+
+// At returns the element at the provided position, which must have one index for every dimension.
+// It panics if the position is out of range.
+func (t *Tensor[T]) At(idx ...int) T {
+	return t.data[elementIndex(t.offset, t.shape, t.strides, idx)]
+}
+
+// Set sets the element at the provided position, which must have one index for every dimension.
+// It panics if the position is out of range.
+func (t *Tensor[T]) Set(value T, idx ...int) {
+	t.data[elementIndex(t.offset, t.shape, t.strides, idx)] = value
+}
+
+// Reshape returns a view of the tensor with a new shape that has the same number of elements. One
+// dimension can be -1, in which case its length is calculated from the other dimensions. Only a
+// tensor whose elements are contiguous can be reshaped, because otherwise the data would need to
+// be copied.
+func (t *Tensor[T]) Reshape(shape ...int) (*Tensor[T], error) {
+	if !t.Contiguous() {
+		return nil, errors.New("Unable to reshape a tensor that is not contiguous")
+	}
+
+	newShape, err := reshape(t.Len(), shape)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tensor[T]{
+		id:      t.id,
+		data:    t.data,
+		offset:  t.offset,
+		shape:   newShape,
+		strides: contiguousStrides(newShape),
+	}, nil
+}
+
+// Transpose returns a view of the tensor with its dimensions reordered, so that dimension i of
+// the new view is dimension axes[i] of this tensor. If no axes are provided, the order of the
+// dimensions is reversed, which transposes a 2-dimensional tensor like a matrix.
+func (t *Tensor[T]) Transpose(axes ...int) (*Tensor[T], error) {
+	newShape, newStrides, err := permute(t.shape, t.strides, axes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tensor[T]{
+		id:      t.id,
+		data:    t.data,
+		offset:  t.offset,
+		shape:   newShape,
+		strides: newStrides,
+	}, nil
+}
+
+// Slice returns a view of the tensor that only includes the elements from start up to (but not
+// including) end along the provided dimension. The view has the same number of dimensions.
+func (t *Tensor[T]) Slice(axis, start, end int) (*Tensor[T], error) {
+	newOffset, newShape, err := sliceAxis(t.offset, t.shape, t.strides, axis, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tensor[T]{
+		id:      t.id,
+		data:    t.data,
+		offset:  newOffset,
+		shape:   newShape,
+		strides: t.Strides(),
+	}, nil
+}
+
+// binding supplies the tensor's entire buffer to the metal function.
+func (t *Tensor[T]) binding() binding {
+	return binding{bufferId: t.id}
+}
+
+// contiguousData returns the tensor's elements in row-major order, copying them if they aren't
+// contiguous.
+func contiguousData[T any](t *Tensor[T]) []T {
+	if data := t.Data(); data != nil {
+		return data
+	}
+
+	return gather(t.data, t.offset, t.shape, t.strides)
+}
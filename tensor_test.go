@@ -0,0 +1,152 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_NewTensor tests that NewTensor creates a tensor with the expected shape and strides that
+// wraps a new metal buffer.
+func Test_NewTensor(t *testing.T) {
+	tensor, err := NewTensor[float32](2, 3, 4, 5)
+	require.Nil(t, err, "Unable to create tensor: %s", err)
+	require.True(t, validId(tensor.Id()))
+	require.Equal(t, 4, tensor.Rank())
+	require.Equal(t, []int{2, 3, 4, 5}, tensor.Shape())
+	require.Equal(t, []int{60, 20, 5, 1}, tensor.Strides())
+	require.Equal(t, 0, tensor.Offset())
+	require.Equal(t, 120, tensor.Len())
+	require.True(t, tensor.Contiguous())
+
+	data := tensor.Data()
+	require.Len(t, data, 120)
+	require.Equal(t, 120, cap(data))
+
+	// Every element is set in row-major order.
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 4; k++ {
+				for l := 0; l < 5; l++ {
+					tensor.Set(float32(i*60+j*20+k*5+l), i, j, k, l)
+				}
+			}
+		}
+	}
+	for i := range data {
+		require.Equal(t, float32(i), data[i])
+	}
+	require.Equal(t, float32(119), tensor.At(1, 2, 3, 4))
+
+	// The shape can't be modified from the outside.
+	shape := tensor.Shape()
+	shape[0] = 100
+	require.Equal(t, []int{2, 3, 4, 5}, tensor.Shape())
+
+	// Invalid shapes
+	for _, shape := range [][]int{nil, {0}, {2, -1}} {
+		tensor, err := NewTensor[float32](shape...)
+		require.NotNil(t, err)
+		require.Nil(t, tensor)
+	}
+}
+
+// Test_Tensor_views tests that reshaping, transposing, and slicing a tensor creates views of the
+// same buffer.
+func Test_Tensor_views(t *testing.T) {
+	tensor, err := NewTensor[int32](2, 3, 4)
+	require.Nil(t, err, "Unable to create tensor: %s", err)
+	require.True(t, validId(tensor.Id()))
+	for i, data := 0, tensor.Data(); i < len(data); i++ {
+		data[i] = int32(i)
+	}
+
+	// Reshape
+	reshaped, err := tensor.Reshape(6, -1)
+	require.Nil(t, err)
+	require.Equal(t, tensor.Id(), reshaped.Id())
+	require.Equal(t, []int{6, 4}, reshaped.Shape())
+	require.Equal(t, []int{4, 1}, reshaped.Strides())
+	require.Equal(t, int32(23), reshaped.At(5, 3))
+	reshaped.Set(-1, 5, 3)
+	require.Equal(t, int32(-1), tensor.At(1, 2, 3))
+	reshaped.Set(23, 5, 3)
+
+	_, err = tensor.Reshape(5, 5)
+	require.NotNil(t, err)
+
+	// Transpose
+	transposed, err := tensor.Transpose()
+	require.Nil(t, err)
+	require.Equal(t, []int{4, 3, 2}, transposed.Shape())
+	require.Equal(t, []int{1, 4, 12}, transposed.Strides())
+	require.False(t, transposed.Contiguous())
+	require.Nil(t, transposed.Data())
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 4; k++ {
+				require.Equal(t, tensor.At(i, j, k), transposed.At(k, j, i))
+			}
+		}
+	}
+
+	swapped, err := tensor.Transpose(1, 0, 2)
+	require.Nil(t, err)
+	require.Equal(t, []int{3, 2, 4}, swapped.Shape())
+	require.Equal(t, tensor.At(1, 2, 3), swapped.At(2, 1, 3))
+
+	// A view that isn't contiguous can't be reshaped.
+	_, err = transposed.Reshape(24)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to reshape a tensor that is not contiguous", err.Error())
+
+	// Slice
+	sliced, err := tensor.Slice(1, 1, 3)
+	require.Nil(t, err)
+	require.Equal(t, []int{2, 2, 4}, sliced.Shape())
+	require.Equal(t, []int{12, 4, 1}, sliced.Strides())
+	require.Equal(t, 4, sliced.Offset())
+	require.False(t, sliced.Contiguous())
+	require.Equal(t, tensor.At(1, 1, 2), sliced.At(1, 0, 2))
+
+	batch, err := tensor.Slice(0, 1, 2)
+	require.Nil(t, err)
+	require.Equal(t, []int{1, 3, 4}, batch.Shape())
+	require.Equal(t, 12, batch.Offset())
+	require.True(t, batch.Contiguous())
+	require.Equal(t, []int32{12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}, batch.Data())
+
+	_, err = tensor.Slice(3, 0, 1)
+	require.NotNil(t, err)
+
+	// Out of range
+	require.Panics(t, func() { tensor.At(2, 0, 0) })
+	require.Panics(t, func() { sliced.At(0, 2, 0) })
+	require.Panics(t, func() { tensor.Set(0, 0, 0) })
+}
+
+// Test_Tensor_Run tests that a tensor can be supplied to a metal function as an argument.
+func Test_Tensor_Run(t *testing.T) {
+	functionId, err := NewFunction(sourceTransfer1D, "transfer1D")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(functionId))
+
+	input, err := NewTensor[float32](4, 3, 8, 8)
+	require.Nil(t, err, "Unable to create tensor: %s", err)
+	require.True(t, validId(input.Id()))
+	output, err := NewTensor[float32](4, 3, 8, 8)
+	require.Nil(t, err, "Unable to create tensor: %s", err)
+	require.True(t, validId(output.Id()))
+
+	for i, data := 0, input.Data(); i < len(data); i++ {
+		data[i] = float32(i) * 1.1
+	}
+
+	err = functionId.RunResources(Grid{X: input.Len()}, input, output)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+	require.Equal(t, input.Data(), output.Data())
+	require.Equal(t, input.At(3, 2, 7, 7), output.At(3, 2, 7, 7))
+}
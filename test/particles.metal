@@ -0,0 +1,9 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+%s
+kernel void particles(device Particle *particles, uint pos [[thread_position_in_grid]]) {
+    particles[pos].Pos *= particles[pos].Mass;
+    particles[pos].Mass += 1;
+}
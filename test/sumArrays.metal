@@ -0,0 +1,17 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+struct Inputs {
+    device const float *arrays[40] [[id(0)]];
+    uint count [[id(40)]];
+    float scale [[id(41)]];
+};
+
+kernel void sumArrays(constant Inputs &inputs [[buffer(0)]], device float *result [[buffer(1)]], uint pos [[thread_position_in_grid]]) {
+    float sum = 0;
+    for (uint i = 0; i < inputs.count; i++) {
+        sum += inputs.arrays[i][pos];
+    }
+    result[pos] = sum * inputs.scale;
+}
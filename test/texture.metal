@@ -0,0 +1,12 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+kernel void sampleTexture(texture2d<float> input [[texture(0)]], sampler linear [[sampler(0)]], device float *result [[buffer(0)]], uint pos [[thread_position_in_grid]]) {
+    float x = float(pos + 1) / float(input.get_width());
+    result[pos] = input.sample(linear, float2(x, 0.5)).r;
+}
+
+kernel void scaleTexture(texture2d<float, access::read> input [[texture(0)]], constant float *factor [[buffer(0)]], texture2d<float, access::write> output [[texture(1)]], uint2 pos [[thread_position_in_grid]]) {
+    output.write(input.read(pos) * factor[0], pos);
+}
@@ -0,0 +1,323 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+/*
+#cgo LDFLAGS: -framework Metal -framework CoreGraphics -framework Foundation
+#include "metal.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// A TextureId references a specific metal texture created with NewTexture2D or NewTexture3D.
+// Textures are supplied to metal functions as texture2d or texture3d arguments, which, unlike
+// buffers, can be read through a sampler with hardware filtering, normalized coordinates, and
+// address modes.
+type TextureId int
+
+// Valid checks whether or not the texture Id is valid and can be used to run a computational
+// process on the GPU.
+func (id TextureId) Valid() bool {
+	return id > 0
+}
+
+// binding supplies the texture to the metal function at the next texture index.
+func (id TextureId) binding() binding {
+	return binding{kind: textureArgument, textureId: id}
+}
+
+// Release releases the texture and its memory. The texture must not be in use by a metal function
+// that is running, and the Id can't be used after this. It does nothing if the texture was already
+// released.
+func (id TextureId) Release() {
+	texturesMu.Lock()
+	_, ok := textures[id]
+	delete(textures, id)
+	texturesMu.Unlock()
+
+	if ok {
+		C.texture_release(C.int(id))
+		memory.remove(int(id))
+	}
+}
+
+// A SamplerId references a specific sampler created with NewSampler. Samplers are supplied to
+// metal functions as sampler arguments.
+type SamplerId int
+
+// Valid checks whether or not the sampler Id is valid and can be used to run a computational
+// process on the GPU.
+func (id SamplerId) Valid() bool {
+	return id > 0
+}
+
+// binding supplies the sampler to the metal function at the next sampler index.
+func (id SamplerId) binding() binding {
+	return binding{kind: samplerArgument, samplerId: id}
+}
+
+// Release releases the sampler. The sampler must not be in use by a metal function that is running,
+// and the Id can't be used after this. It does nothing if the sampler was already released.
+func (id SamplerId) Release() {
+	texturesMu.Lock()
+	_, ok := samplers[id]
+	delete(samplers, id)
+	texturesMu.Unlock()
+
+	if ok {
+		C.sampler_release(C.int(id))
+	}
+}
+
+// A textureRecord is what this package knows about a texture that it created.
+type textureRecord struct {
+	elemType reflect.Type
+	format   textureFormat
+	channels int
+
+	width, height, depth int
+}
+
+var (
+	// textures holds the record of every texture, and samplers holds every sampler, by Id. Both
+	// are guarded by texturesMu.
+	textures   = map[TextureId]textureRecord{}
+	samplers   = map[SamplerId]struct{}{}
+	texturesMu sync.Mutex
+)
+
+// NewTexture2D creates a 2-dimensional texture that is width texels wide and height texels high,
+// with the number of channels and other settings in opts. Every channel has type T, which
+// determines the texture's pixel format:
+//
+//	| Go      | Pixel format          | Metal function argument |
+//	| ------- | --------------------- | ----------------------- |
+//	| uint8   | r8Unorm, rgba8Unorm   | texture2d<float>        |
+//	| int8    | r8Snorm, rgba8Snorm   | texture2d<float>        |
+//	| uint16  | r16Unorm, rgba16Unorm | texture2d<float>        |
+//	| int16   | r16Snorm, rgba16Snorm | texture2d<float>        |
+//	| Float16 | r16Float, rgba16Float | texture2d<float>        |
+//	| float32 | r32Float, rgba32Float | texture2d<float>        |
+//	| uint32  | r32Uint, rgba32Uint   | texture2d<uint>         |
+//	| int32   | r32Sint, rgba32Sint   | texture2d<int>          |
+//
+// (The formats with 2 channels are named rg instead of rgba.) The 8- and 16-bit integers are
+// normalized, so that metal functions read them as values between 0 and 1 (or -1 and 1).
+//
+// The texture's texels start out as zero. Use UploadTexture to fill them in. The texture's memory
+// is counted by Memory and towards the memory budget until it's released with Release.
+func NewTexture2D[T TextureType](width, height int, opts TextureOptions) (TextureId, error) {
+	return newTexture[T](Device{}, width, height, 0, opts)
+}
+
+// NewTexture2DOnDevice creates a 2-dimensional texture on the provided device. It works the same
+// way as NewTexture2D otherwise. The texture can only be supplied to functions on the same device.
+func NewTexture2DOnDevice[T TextureType](device Device, width, height int, opts TextureOptions) (TextureId,
+	error) {
+	return newTexture[T](device, width, height, 0, opts)
+}
+
+// NewTexture3D creates a 3-dimensional texture that is width texels wide, height texels high, and
+// depth texels deep. It works the same way as NewTexture2D, except that metal functions take it as
+// a texture3d argument.
+func NewTexture3D[T TextureType](width, height, depth int, opts TextureOptions) (TextureId, error) {
+	return NewTexture3DOnDevice[T](Device{}, width, height, depth, opts)
+}
+
+// NewTexture3DOnDevice creates a 3-dimensional texture on the provided device. It works the same
+// way as NewTexture3D otherwise. The texture can only be supplied to functions on the same device.
+func NewTexture3DOnDevice[T TextureType](device Device, width, height, depth int, opts TextureOptions) (
+	TextureId, error) {
+	if depth < 1 {
+		return 0, errors.New("Invalid dimension")
+	}
+
+	return newTexture[T](device, width, height, depth, opts)
+}
+
+// newTexture is the common internal function for creating a texture. A depth of 0 creates a
+// 2-dimensional texture.
+func newTexture[T TextureType](device Device, width, height, depth int, opts TextureOptions) (TextureId,
+	error) {
+	if err := ensureInit(); err != nil {
+		return 0, err
+	}
+
+	if width < 1 || height < 1 {
+		return 0, errors.New("Invalid dimension")
+	}
+
+	channels, usage, err := opts.check()
+	if err != nil {
+		return 0, err
+	}
+	elemType := reflect.TypeOf((*T)(nil)).Elem()
+	format, err := textureFormatOf(elemType, channels)
+	if err != nil {
+		return 0, err
+	}
+
+	// Make sure the texture fits in the memory budget before asking metal for it.
+	numBytes := uint64(width) * uint64(height) * uint64(format.texelSize)
+	if depth > 0 {
+		numBytes *= uint64(depth)
+	}
+	if err := memory.reserve(numBytes); err != nil {
+		return 0, err
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	id := TextureId(C.texture_new(C.int(device.index), C.int(format.pixelFormat), C.int(width), C.int(height),
+		C.int(depth), C.ulonglong(usage), C.ulonglong(opts.Storage), &metalErr))
+	if !id.Valid() {
+		memory.cancel(numBytes)
+		return 0, metalErrToError(metalErr, "Unable to create texture")
+	}
+
+	if depth == 0 {
+		depth = 1
+	}
+	memory.add(int(id), bufferRecord{
+		elemType: format.name,
+		storage:  opts.Storage,
+		numBytes: numBytes,
+		texture:  true,
+	})
+
+	texturesMu.Lock()
+	textures[id] = textureRecord{
+		elemType: elemType,
+		format:   format,
+		channels: channels,
+		width:    width,
+		height:   height,
+		depth:    depth,
+	}
+	texturesMu.Unlock()
+
+	return id, nil
+}
+
+// UploadTexture copies the texels of a region of the texture from src. Every texel takes up as many
+// elements of src as the texture has channels, and the texels are in order of X, then Y, then Z, so
+// that the rows of the region are next to each other. src must hold exactly the texels of the
+// region. The zero Region covers the entire texture.
+func UploadTexture[T TextureType](id TextureId, region Region, src []T) error {
+	return transferTexture(id, region, src, true)
+}
+
+// DownloadTexture copies the texels of a region of the texture into dst. It works the same way as
+// UploadTexture otherwise.
+func DownloadTexture[T TextureType](id TextureId, region Region, dst []T) error {
+	return transferTexture(id, region, dst, false)
+}
+
+// transferTexture is the common internal function for UploadTexture and DownloadTexture.
+func transferTexture[T TextureType](id TextureId, region Region, data []T, upload bool) error {
+	action := "download from"
+	if upload {
+		action = "upload to"
+	}
+
+	rec, err := lookupTexture(id)
+	if err != nil {
+		return err
+	}
+
+	done, err := use(int(id))
+	if err != nil {
+		return fmt.Errorf("Unable to %s texture: %w", action, err)
+	}
+	defer done()
+
+	if elemType := reflect.TypeOf((*T)(nil)).Elem(); elemType != rec.elemType {
+		return fmt.Errorf("Unable to %s texture: Pixel format %s doesn't match the element type %s",
+			action, rec.format.name, elemType)
+	}
+
+	r, err := region.resolve(rec.width, rec.height, rec.depth)
+	if err != nil {
+		return fmt.Errorf("Unable to %s texture: %w", action, err)
+	}
+	if want := r.numTexels() * rec.channels; len(data) != want {
+		return fmt.Errorf("Unable to %s texture: Data of %d elements doesn't match the %d elements "+
+			"of the region", action, len(data), want)
+	}
+	bytesPerRow, bytesPerImage, _ := regionBytes(r, rec.format.texelSize)
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	var ok C._Bool
+	if upload {
+		ok = C.texture_upload(C.int(id), C.int(r.X), C.int(r.Y), C.int(r.Z), C.int(r.Width),
+			C.int(r.Height), C.int(r.Depth), unsafe.Pointer(&data[0]), C.ulonglong(bytesPerRow),
+			C.ulonglong(bytesPerImage), &metalErr)
+	} else {
+		ok = C.texture_download(C.int(id), C.int(r.X), C.int(r.Y), C.int(r.Z), C.int(r.Width),
+			C.int(r.Height), C.int(r.Depth), unsafe.Pointer(&data[0]), C.ulonglong(bytesPerRow),
+			C.ulonglong(bytesPerImage), &metalErr)
+	}
+	if !ok {
+		return metalErrToError(metalErr, "Unable to "+action+" texture")
+	}
+
+	return nil
+}
+
+// lookupTexture returns the record of a texture that this package created.
+func lookupTexture(id TextureId) (textureRecord, error) {
+	texturesMu.Lock()
+	defer texturesMu.Unlock()
+
+	rec, ok := textures[id]
+	if !ok {
+		return textureRecord{}, errors.New("Invalid texture Id")
+	}
+
+	return rec, nil
+}
+
+// NewSampler creates a sampler that reads from textures the way that the descriptor describes.
+// Samplers can also be declared in metal code as constexpr sampler variables; NewSampler is for
+// samplers whose settings are only known at run time.
+func NewSampler(desc SamplerDescriptor) (SamplerId, error) {
+	return NewSamplerOnDevice(Device{}, desc)
+}
+
+// NewSamplerOnDevice creates a sampler on the provided device. It works the same way as NewSampler
+// otherwise. The sampler can only be supplied to functions on the same device.
+func NewSamplerOnDevice(device Device, desc SamplerDescriptor) (SamplerId, error) {
+	if err := desc.check(); err != nil {
+		return 0, fmt.Errorf("Unable to create sampler: %w", err)
+	}
+	if err := ensureInit(); err != nil {
+		return 0, err
+	}
+
+	metalErr := C.CString("")
+	defer C.free(unsafe.Pointer(metalErr))
+
+	id := SamplerId(C.sampler_new(C.int(device.index), C.int(desc.MinFilter), C.int(desc.MagFilter),
+		C.int(desc.AddressModeS), C.int(desc.AddressModeT), C.int(desc.AddressModeR),
+		C._Bool(!desc.PixelCoordinates), &metalErr))
+	if !id.Valid() {
+		return 0, metalErrToError(metalErr, "Unable to create sampler")
+	}
+
+	texturesMu.Lock()
+	samplers[id] = struct{}{}
+	texturesMu.Unlock()
+
+	return id, nil
+}
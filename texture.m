@@ -0,0 +1,187 @@
+// go:build darwin
+//  +build darwin
+
+#include "cache.h"
+#include "device.h"
+#include "error.h"
+#import <Metal/Metal.h>
+
+// Create a new texture on the GPU with the provided index (see device_get),
+// with the provided pixel format (an MTLPixelFormat value) and dimensions. A depth of 0 creates a 2-dimensional texture, and any other
+// depth creates a 3-dimensional one. usage is an MTLTextureUsage value, and
+// storage is an MTLStorageMode value. The texture is cached and can be
+// retrieved with the texture Id that's returned. If any error is encountered
+// creating the texture, this returns 0 and sets an error message in error.
+int texture_new(int deviceIndex, int pixelFormat, int width, int height,
+                int depth, unsigned long long usage,
+                unsigned long long storage, const char **error) {
+  id<MTLDevice> device = device_get(deviceIndex);
+  if (device == nil) {
+    logError(error, @"Failed to find device");
+    return 0;
+  }
+
+  MTLTextureDescriptor *descriptor = [MTLTextureDescriptor new];
+  descriptor.textureType = depth == 0 ? MTLTextureType2D : MTLTextureType3D;
+  descriptor.pixelFormat = (MTLPixelFormat)pixelFormat;
+  descriptor.width = width;
+  descriptor.height = height;
+  descriptor.depth = depth == 0 ? 1 : depth;
+  descriptor.usage = (MTLTextureUsage)usage;
+  descriptor.storageMode = (MTLStorageMode)storage;
+
+  id<MTLTexture> texture = [device newTextureWithDescriptor:descriptor];
+  [descriptor release];
+  if (texture == nil) {
+    logError(error,
+             [NSString stringWithFormat:@"Failed to create %dx%dx%d texture",
+                                        width, height, depth == 0 ? 1 : depth]);
+    return 0;
+  }
+
+  // Add the texture to the cache and return its unique Id.
+  int textureId = cache_cache(texture);
+  if (textureId == 0) {
+    [texture release];
+    logError(error, @"Failed to cache texture");
+    return 0;
+  }
+
+  return textureId;
+}
+
+// Retrieve a texture that the CPU can access from the cache. If any error is
+// encountered, this returns nil and sets an error message in error.
+static id<MTLTexture> cpu_texture(int textureId, const char **error) {
+  id<MTLTexture> texture = cache_retrieve(textureId);
+  if (texture == nil) {
+    logError(error, @"Failed to retrieve texture");
+    return nil;
+  }
+
+  if ([texture storageMode] == MTLStorageModePrivate) {
+    logError(error, @"Texture is not accessible to the CPU");
+    return nil;
+  }
+
+  return texture;
+}
+
+// Copy the texels of a region of a texture from bytes. The rows of the region
+// are bytesPerRow bytes apart in bytes, and the 2-dimensional images (for
+// 3-dimensional textures) are bytesPerImage bytes apart. If any error is
+// encountered, this returns false and sets an error message in error.
+_Bool texture_upload(int textureId, int x, int y, int z, int width, int height,
+                     int depth, const void *bytes,
+                     unsigned long long bytesPerRow,
+                     unsigned long long bytesPerImage, const char **error) {
+  id<MTLTexture> texture = cpu_texture(textureId, error);
+  if (texture == nil) {
+    return false;
+  }
+
+  // The number of bytes between images only applies to 3-dimensional textures.
+  if ([texture textureType] != MTLTextureType3D) {
+    bytesPerImage = 0;
+  }
+
+  [texture replaceRegion:MTLRegionMake3D(x, y, z, width, height, depth)
+             mipmapLevel:0
+                   slice:0
+               withBytes:bytes
+             bytesPerRow:(NSUInteger)bytesPerRow
+           bytesPerImage:(NSUInteger)bytesPerImage];
+
+  return true;
+}
+
+// Copy the texels of a region of a texture into bytes. This works the same way
+// as texture_upload otherwise.
+_Bool texture_download(int textureId, int x, int y, int z, int width,
+                       int height, int depth, void *bytes,
+                       unsigned long long bytesPerRow,
+                       unsigned long long bytesPerImage, const char **error) {
+  id<MTLTexture> texture = cpu_texture(textureId, error);
+  if (texture == nil) {
+    return false;
+  }
+
+  if ([texture textureType] != MTLTextureType3D) {
+    bytesPerImage = 0;
+  }
+
+  [texture getBytes:bytes
+        bytesPerRow:(NSUInteger)bytesPerRow
+      bytesPerImage:(NSUInteger)bytesPerImage
+         fromRegion:MTLRegionMake3D(x, y, z, width, height, depth)
+        mipmapLevel:0
+              slice:0];
+
+  return true;
+}
+
+// Create a new sampler state on the GPU with the provided index (see
+// device_get). The filters are MTLSamplerMinMagFilter values,
+// and the address modes are MTLSamplerAddressMode values for the width, height,
+// and depth coordinates. The sampler is cached and can be retrieved with the
+// sampler Id that's returned. If any error is encountered creating the sampler,
+// this returns 0 and sets an error message in error.
+int sampler_new(int deviceIndex, int minFilter, int magFilter,
+                int addressModeS, int addressModeT, int addressModeR,
+                _Bool normalized, const char **error) {
+  id<MTLDevice> device = device_get(deviceIndex);
+  if (device == nil) {
+    logError(error, @"Failed to find device");
+    return 0;
+  }
+
+  MTLSamplerDescriptor *descriptor = [MTLSamplerDescriptor new];
+  descriptor.minFilter = (MTLSamplerMinMagFilter)minFilter;
+  descriptor.magFilter = (MTLSamplerMinMagFilter)magFilter;
+  descriptor.sAddressMode = (MTLSamplerAddressMode)addressModeS;
+  descriptor.tAddressMode = (MTLSamplerAddressMode)addressModeT;
+  descriptor.rAddressMode = (MTLSamplerAddressMode)addressModeR;
+  descriptor.normalizedCoordinates = normalized;
+
+  id<MTLSamplerState> sampler =
+      [device newSamplerStateWithDescriptor:descriptor];
+  [descriptor release];
+  if (sampler == nil) {
+    logError(error, @"Failed to create sampler");
+    return 0;
+  }
+
+  // Add the sampler to the cache and return its unique Id.
+  int samplerId = cache_cache(sampler);
+  if (samplerId == 0) {
+    [sampler release];
+    logError(error, @"Failed to cache sampler");
+    return 0;
+  }
+
+  return samplerId;
+}
+
+// Release the texture with the provided texture Id. The texture Id can't be
+// used after this.
+void texture_release(int textureId) {
+  id<MTLTexture> texture = cache_retrieve(textureId);
+  if (texture == nil) {
+    return;
+  }
+
+  cache_remove(textureId);
+  [texture release];
+}
+
+// Release the sampler with the provided sampler Id. The sampler Id can't be
+// used after this.
+void sampler_release(int samplerId) {
+  id<MTLSamplerState> sampler = cache_retrieve(samplerId);
+  if (sampler == nil) {
+    return;
+  }
+
+  cache_remove(samplerId);
+  [sampler release];
+}
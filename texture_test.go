@@ -0,0 +1,215 @@
+//go:build darwin
+// +build darwin
+
+package metal
+
+import (
+	_ "embed"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed test/texture.metal
+var sourceTexture string
+
+// Test_NewTexture2D tests that NewTexture2D creates textures whose texels can be uploaded and
+// downloaded, in full or by region.
+func Test_NewTexture2D(t *testing.T) {
+	textureId, err := NewTexture2D[uint8](3, 2, TextureOptions{Channels: 4})
+	require.Nil(t, err, "Unable to create texture: %s", err)
+	require.True(t, validId(textureId))
+
+	// The texels start out as zero.
+	texels := make([]uint8, 3*2*4)
+	err = DownloadTexture(textureId, Region{}, texels)
+	require.Nil(t, err, "Unable to download texture: %s", err)
+	require.Equal(t, make([]uint8, 24), texels)
+
+	for i := range texels {
+		texels[i] = uint8(i + 1)
+	}
+	err = UploadTexture(textureId, Region{}, texels)
+	require.Nil(t, err, "Unable to upload texture: %s", err)
+
+	// Replace the last two texels of the second row.
+	err = UploadTexture(textureId, Region{X: 1, Y: 1, Width: 2, Height: 1}, []uint8{100, 101, 102, 103, 104, 105, 106, 107})
+	require.Nil(t, err, "Unable to upload texture: %s", err)
+
+	got := make([]uint8, 24)
+	err = DownloadTexture(textureId, Region{}, got)
+	require.Nil(t, err, "Unable to download texture: %s", err)
+	copy(texels[16:], []uint8{100, 101, 102, 103, 104, 105, 106, 107})
+	require.Equal(t, texels, got)
+
+	// Read back a single column.
+	column := make([]uint8, 8)
+	err = DownloadTexture(textureId, Region{X: 2, Width: 1, Height: 2}, column)
+	require.Nil(t, err, "Unable to download texture: %s", err)
+	require.Equal(t, []uint8{9, 10, 11, 12, 104, 105, 106, 107}, column)
+
+	// Invalid transfers
+	err = UploadTexture(textureId, Region{}, make([]float32, 24))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to upload to texture: Pixel format rgba8Unorm doesn't match the element type float32", err.Error())
+	err = UploadTexture(textureId, Region{}, make([]uint8, 23))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to upload to texture: Data of 23 elements doesn't match the 24 elements of the region", err.Error())
+	err = DownloadTexture(textureId, Region{Y: 1, Width: 1, Height: 2}, make([]uint8, 8))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to download from texture: Region 1x2x1 at (0, 1, 0) is outside of the 3x2x1 texture", err.Error())
+	err = DownloadTexture(TextureId(10000), Region{}, texels)
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid texture Id", err.Error())
+
+	// The CPU can't access private textures.
+	privateId, err := NewTexture2D[float32](2, 2, TextureOptions{Storage: StoragePrivate})
+	require.Nil(t, err, "Unable to create texture: %s", err)
+	require.True(t, validId(privateId))
+	err = DownloadTexture(privateId, Region{}, make([]float32, 4))
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to download from texture: Texture is not accessible to the CPU", err.Error())
+
+	// Invalid textures
+	_, err = NewTexture2D[float32](0, 2, TextureOptions{})
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid dimension", err.Error())
+	_, err = NewTexture2D[float32](2, 2, TextureOptions{Channels: 3})
+	require.NotNil(t, err)
+	require.Equal(t, "Unsupported number of channels 3", err.Error())
+
+	// Textures count towards the memory until they are released.
+	before := Memory().Textures
+	releasedId, err := NewTexture2D[float32](4, 4, TextureOptions{Channels: 4})
+	require.Nil(t, err, "Unable to create texture: %s", err)
+	require.True(t, validId(releasedId))
+	require.Equal(t, Allocation{Buffers: before.Buffers + 1, Bytes: before.Bytes + 256}, Memory().Textures)
+	releasedId.Release()
+	releasedId.Release()
+	require.Equal(t, before, Memory().Textures)
+	err = DownloadTexture(releasedId, Region{}, make([]float32, 64))
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid texture Id", err.Error())
+}
+
+// Test_NewTexture3D tests that NewTexture3D creates textures whose regions span several images.
+func Test_NewTexture3D(t *testing.T) {
+	textureId, err := NewTexture3D[uint32](2, 3, 4, TextureOptions{Channels: 2})
+	require.Nil(t, err, "Unable to create texture: %s", err)
+	require.True(t, validId(textureId))
+
+	texels := make([]uint32, 2*3*4*2)
+	for i := range texels {
+		texels[i] = uint32(i)
+	}
+	err = UploadTexture(textureId, Region{}, texels)
+	require.Nil(t, err, "Unable to upload texture: %s", err)
+
+	// Read the texel at (1, 2) in the last two images.
+	got := make([]uint32, 4)
+	err = DownloadTexture(textureId, Region{X: 1, Y: 2, Z: 2, Width: 1, Height: 1, Depth: 2}, got)
+	require.Nil(t, err, "Unable to download texture: %s", err)
+	index := func(x, y, z int) uint32 { return uint32(((z*3+y)*2 + x) * 2) }
+	require.Equal(t, []uint32{index(1, 2, 2), index(1, 2, 2) + 1, index(1, 2, 3), index(1, 2, 3) + 1}, got)
+
+	_, err = NewTexture3D[uint32](2, 3, 0, TextureOptions{})
+	require.NotNil(t, err)
+	require.Equal(t, "Invalid dimension", err.Error())
+}
+
+// Test_NewSampler tests that metal functions read textures through samplers, and that textures
+// and samplers are bound at their own indexes when mixed in with buffers.
+func Test_NewSampler(t *testing.T) {
+	sampleId, err := NewFunction(sourceTexture, "sampleTexture")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(sampleId))
+	scaleId, err := NewFunction(sourceTexture, "scaleTexture")
+	require.Nil(t, err, "Unable to create metal function: %s", err)
+	require.True(t, validId(scaleId))
+
+	// Sampling between two texels with a linear filter interpolates them.
+	textureId, err := NewTexture2D[float32](4, 1, TextureOptions{Usage: TextureRead})
+	require.Nil(t, err, "Unable to create texture: %s", err)
+	require.True(t, validId(textureId))
+	err = UploadTexture(textureId, Region{}, []float32{0, 1, 2, 4})
+	require.Nil(t, err, "Unable to upload texture: %s", err)
+
+	samplerId, err := NewSampler(SamplerDescriptor{MinFilter: FilterLinear, MagFilter: FilterLinear})
+	require.Nil(t, err, "Unable to create sampler: %s", err)
+	require.True(t, validId(samplerId))
+
+	resultId, result, err := NewBuffer1D[float32](3)
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(resultId))
+
+	err = sampleId.RunResources(Grid{X: 3}, textureId, samplerId, resultId)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+	require.InDeltaSlice(t, []float32{0.5, 1.5, 3}, result, 1e-3)
+
+	// Textures that metal functions write to can be downloaded afterwards.
+	inputId, err := NewTexture2D[float32](3, 2, TextureOptions{Channels: 4})
+	require.Nil(t, err, "Unable to create texture: %s", err)
+	require.True(t, validId(inputId))
+	outputId, err := NewTexture2D[float32](3, 2, TextureOptions{Channels: 4})
+	require.Nil(t, err, "Unable to create texture: %s", err)
+	require.True(t, validId(outputId))
+	factorId, factor, err := NewBufferFrom1D([]float32{2})
+	require.Nil(t, err, "Unable to create metal buffer: %s", err)
+	require.True(t, validId(factorId))
+
+	input := make([]float32, 24)
+	for i := range input {
+		input[i] = float32(i)
+	}
+	err = UploadTexture(inputId, Region{}, input)
+	require.Nil(t, err, "Unable to upload texture: %s", err)
+
+	err = scaleId.RunResources(Grid{X: 3, Y: 2}, inputId, factorId, outputId)
+	require.Nil(t, err, "Unable to run metal function: %s", err)
+	output := make([]float32, 24)
+	err = DownloadTexture(outputId, Region{}, output)
+	require.Nil(t, err, "Unable to download texture: %s", err)
+	for i := range output {
+		require.Equal(t, input[i]*factor[0], output[i])
+	}
+
+	// The same works in a batch.
+	batch, err := NewBatch()
+	require.Nil(t, err, "Unable to create batch: %s", err)
+	addId()
+	require.Nil(t, batch.Run(scaleId, Grid{X: 3, Y: 2}, outputId, factorId, inputId))
+	require.Nil(t, batch.Commit())
+	err = DownloadTexture(inputId, Region{}, output)
+	require.Nil(t, err, "Unable to download texture: %s", err)
+	for i := range output {
+		require.Equal(t, input[i]*4, output[i])
+	}
+
+	// Textures aren't buffers.
+	batch, err = NewBatch()
+	require.Nil(t, err, "Unable to create batch: %s", err)
+	addId()
+	err = batch.Fill(textureId, 0)
+	require.NotNil(t, err)
+	require.Equal(t, "Resource is not a buffer", err.Error())
+	batch.Discard()
+
+	// Invalid textures, samplers, and descriptors
+	err = sampleId.RunResources(Grid{X: 3}, TextureId(10000), samplerId, resultId)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to run metal function: Failed to retrieve texture 1/1 using Id 10000", err.Error())
+	err = sampleId.RunResources(Grid{X: 3}, textureId, SamplerId(10000), resultId)
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to run metal function: Failed to retrieve sampler 1/1 using Id 10000", err.Error())
+	_, err = NewSampler(SamplerDescriptor{PixelCoordinates: true, AddressModeS: AddressRepeat})
+	require.NotNil(t, err)
+	require.Equal(t, "Unable to create sampler: Pixel coordinates only support the clamp-to-edge and clamp-to-zero address modes", err.Error())
+
+	// Released samplers can't be used anymore.
+	samplerId.Release()
+	samplerId.Release()
+	err = sampleId.RunResources(Grid{X: 3}, textureId, samplerId, resultId)
+	require.NotNil(t, err)
+	require.Equal(t, fmt.Sprintf("Unable to run metal function: Failed to retrieve sampler 1/1 using Id %d", samplerId), err.Error())
+}
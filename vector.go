@@ -0,0 +1,127 @@
+package metal
+
+import (
+	"reflect"
+)
+
+// These are the Go equivalents of the metal vector types. Each one has the same size as its metal
+// counterpart, so that a slice of them lines up element for element with a metal array. Note in
+// particular that the 3-component types (except for PackedFloat3) take up as much space as the
+// 4-component types: their fourth component is unused padding.
+//
+// Metal aligns vectors to their size, which can be up to 16 bytes. Go can't align anything to more
+// than 8 bytes, so the alignment of the 16-byte types is only 8 bytes in Go. This makes no
+// difference for a buffer of vectors, because the memory for a buffer is always page-aligned. It
+// does make a difference for vectors that are fields in a struct, which is why NewStructBuffer1D
+// checks the layout of struct types.
+//
+// The leading zero-length fields don't take up any space. They only raise the alignment of the
+// smaller types to match metal.
+type (
+	// Float2 is the Go equivalent of the metal type float2.
+	Float2 struct {
+		_    [0]uint64
+		X, Y float32
+	}
+
+	// Float3 is the Go equivalent of the metal type float3. It is 16 bytes long.
+	Float3 struct {
+		_       [0]uint64
+		X, Y, Z float32
+		_       float32
+	}
+
+	// Float4 is the Go equivalent of the metal type float4.
+	Float4 struct {
+		_          [0]uint64
+		X, Y, Z, W float32
+	}
+
+	// PackedFloat3 is the Go equivalent of the metal type packed_float3. Unlike Float3, it is only
+	// 12 bytes long and is aligned like a float32.
+	PackedFloat3 struct {
+		X, Y, Z float32
+	}
+
+	// Half2 is the Go equivalent of the metal type half2.
+	Half2 struct {
+		_    [0]uint32
+		X, Y Float16
+	}
+
+	// Half3 is the Go equivalent of the metal type half3. It is 8 bytes long.
+	Half3 struct {
+		_       [0]uint64
+		X, Y, Z Float16
+		_       Float16
+	}
+
+	// Half4 is the Go equivalent of the metal type half4.
+	Half4 struct {
+		_          [0]uint64
+		X, Y, Z, W Float16
+	}
+
+	// Int2 is the Go equivalent of the metal type int2.
+	Int2 struct {
+		_    [0]uint64
+		X, Y int32
+	}
+
+	// Int3 is the Go equivalent of the metal type int3. It is 16 bytes long.
+	Int3 struct {
+		_       [0]uint64
+		X, Y, Z int32
+		_       int32
+	}
+
+	// Int4 is the Go equivalent of the metal type int4.
+	Int4 struct {
+		_          [0]uint64
+		X, Y, Z, W int32
+	}
+
+	// UInt2 is the Go equivalent of the metal type uint2.
+	UInt2 struct {
+		_    [0]uint64
+		X, Y uint32
+	}
+
+	// UInt3 is the Go equivalent of the metal type uint3. It is 16 bytes long.
+	UInt3 struct {
+		_       [0]uint64
+		X, Y, Z uint32
+		_       uint32
+	}
+
+	// UInt4 is the Go equivalent of the metal type uint4.
+	UInt4 struct {
+		_          [0]uint64
+		X, Y, Z, W uint32
+	}
+)
+
+// An mslType describes the name, size, and alignment of a type in the Metal Shading Language, as
+// listed in the tables in section 2 of the MSL Specification.
+type mslType struct {
+	name  string
+	size  int
+	align int
+}
+
+// vectorTypes maps every vector type to its metal equivalent.
+var vectorTypes = map[reflect.Type]mslType{
+	reflect.TypeOf(Float2{}):       {"float2", 8, 8},
+	reflect.TypeOf(Float3{}):       {"float3", 16, 16},
+	reflect.TypeOf(Float4{}):       {"float4", 16, 16},
+	reflect.TypeOf(PackedFloat3{}): {"packed_float3", 12, 4},
+	reflect.TypeOf(Half2{}):        {"half2", 4, 4},
+	reflect.TypeOf(Half3{}):        {"half3", 8, 8},
+	reflect.TypeOf(Half4{}):        {"half4", 8, 8},
+	reflect.TypeOf(Int2{}):         {"int2", 8, 8},
+	reflect.TypeOf(Int3{}):         {"int3", 16, 16},
+	reflect.TypeOf(Int4{}):         {"int4", 16, 16},
+	reflect.TypeOf(UInt2{}):        {"uint2", 8, 8},
+	reflect.TypeOf(UInt3{}):        {"uint3", 16, 16},
+	reflect.TypeOf(UInt4{}):        {"uint4", 16, 16},
+}
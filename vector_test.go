@@ -0,0 +1,97 @@
+package metal
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_vectorTypes tests that the size and alignment of every vector type match the metal type
+// (within the limits of Go's alignment) and that the components are where metal expects them.
+func Test_vectorTypes(t *testing.T) {
+	// The largest alignment Go can give to a type.
+	maxAlign := int(unsafe.Alignof(uint64(0)))
+
+	// These values come straight from tables 2.2 and 2.4 in the MSL Specification.
+	type scenario struct {
+		typ   reflect.Type
+		name  string
+		size  int
+		align int
+		comp  int // size of each component
+		n     int // number of components
+	}
+
+	for _, s := range []scenario{
+		{reflect.TypeOf(Float2{}), "float2", 8, 8, 4, 2},
+		{reflect.TypeOf(Float3{}), "float3", 16, 16, 4, 3},
+		{reflect.TypeOf(Float4{}), "float4", 16, 16, 4, 4},
+		{reflect.TypeOf(PackedFloat3{}), "packed_float3", 12, 4, 4, 3},
+		{reflect.TypeOf(Half2{}), "half2", 4, 4, 2, 2},
+		{reflect.TypeOf(Half3{}), "half3", 8, 8, 2, 3},
+		{reflect.TypeOf(Half4{}), "half4", 8, 8, 2, 4},
+		{reflect.TypeOf(Int2{}), "int2", 8, 8, 4, 2},
+		{reflect.TypeOf(Int3{}), "int3", 16, 16, 4, 3},
+		{reflect.TypeOf(Int4{}), "int4", 16, 16, 4, 4},
+		{reflect.TypeOf(UInt2{}), "uint2", 8, 8, 4, 2},
+		{reflect.TypeOf(UInt3{}), "uint3", 16, 16, 4, 3},
+		{reflect.TypeOf(UInt4{}), "uint4", 16, 16, 4, 4},
+	} {
+		t.Run(s.name, func(t *testing.T) {
+			require.Equal(t, mslType{s.name, s.size, s.align}, vectorTypes[s.typ])
+
+			require.Equal(t, s.size, int(s.typ.Size()))
+			wantAlign := s.align
+			if wantAlign > maxAlign {
+				wantAlign = maxAlign
+			}
+			require.Equal(t, wantAlign, s.typ.Align())
+
+			// An array of vectors must have the same stride in Go as in metal.
+			require.Equal(t, 4*s.size, int(reflect.ArrayOf(4, s.typ).Size()))
+
+			// The components must be packed together at the start.
+			names := []string{"X", "Y", "Z", "W"}
+			for i := 0; i < 4; i++ {
+				field, ok := s.typ.FieldByName(names[i])
+				require.Equal(t, i < s.n, ok, names[i])
+				if ok {
+					require.Equal(t, i*s.comp, int(field.Offset), names[i])
+					require.Equal(t, s.comp, int(field.Type.Size()), names[i])
+				}
+			}
+		})
+	}
+
+	require.Len(t, vectorTypes, 13)
+}
+
+// Test_vectorTypes_unsafe tests the layout of the vector types with the unsafe package, which is
+// what actually determines how the types are laid out in a buffer.
+func Test_vectorTypes_unsafe(t *testing.T) {
+	var f3 Float3
+	require.Equal(t, uintptr(16), unsafe.Sizeof(f3))
+	require.Equal(t, uintptr(8), unsafe.Offsetof(f3.Z))
+	var pf3 PackedFloat3
+	require.Equal(t, uintptr(12), unsafe.Sizeof(pf3))
+	require.Equal(t, uintptr(4), unsafe.Alignof(pf3))
+	var f2 Float2
+	require.Equal(t, uintptr(8), unsafe.Sizeof(f2))
+	require.Equal(t, uintptr(8), unsafe.Alignof(f2))
+	var h2 Half2
+	require.Equal(t, uintptr(4), unsafe.Sizeof(h2))
+	require.Equal(t, uintptr(4), unsafe.Alignof(h2))
+	var h3 Half3
+	require.Equal(t, uintptr(8), unsafe.Sizeof(h3))
+	require.Equal(t, uintptr(4), unsafe.Offsetof(h3.Z))
+	var h4 Half4
+	require.Equal(t, uintptr(8), unsafe.Sizeof(h4))
+	require.Equal(t, uintptr(8), unsafe.Alignof(h4))
+	var i4 Int4
+	require.Equal(t, uintptr(16), unsafe.Sizeof(i4))
+	require.Equal(t, uintptr(12), unsafe.Offsetof(i4.W))
+	var u3 UInt3
+	require.Equal(t, uintptr(16), unsafe.Sizeof(u3))
+}
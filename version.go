@@ -0,0 +1,34 @@
+package metal
+
+import (
+	"fmt"
+)
+
+// A LanguageVersion is a version of the Metal Shading Language (MSL).
+type LanguageVersion struct {
+	Major int
+	Minor int
+}
+
+// newLanguageVersion converts a packed MTLLanguageVersion value, which stores the major version in
+// the upper 16 bits and the minor version in the lower 16 bits, into a LanguageVersion.
+func newLanguageVersion(packed int) LanguageVersion {
+	return LanguageVersion{
+		Major: packed >> 16,
+		Minor: packed & 0xffff,
+	}
+}
+
+// AtLeast checks whether or not this version is the same as or newer than other.
+func (v LanguageVersion) AtLeast(other LanguageVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+
+	return v.Minor >= other.Minor
+}
+
+// String returns the version formatted as "major.minor".
+func (v LanguageVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
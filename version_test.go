@@ -0,0 +1,34 @@
+package metal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_newLanguageVersion tests that newLanguageVersion unpacks MTLLanguageVersion values.
+func Test_newLanguageVersion(t *testing.T) {
+	require.Equal(t, LanguageVersion{Major: 1, Minor: 0}, newLanguageVersion(1<<16))
+	require.Equal(t, LanguageVersion{Major: 2, Minor: 4}, newLanguageVersion(2<<16+4))
+	require.Equal(t, LanguageVersion{Major: 3, Minor: 1}, newLanguageVersion(3<<16+1))
+}
+
+// Test_LanguageVersion_AtLeast tests that AtLeast compares versions correctly.
+func Test_LanguageVersion_AtLeast(t *testing.T) {
+	v31 := LanguageVersion{Major: 3, Minor: 1}
+
+	require.True(t, v31.AtLeast(LanguageVersion{Major: 3, Minor: 1}))
+	require.True(t, v31.AtLeast(LanguageVersion{Major: 3, Minor: 0}))
+	require.True(t, v31.AtLeast(LanguageVersion{Major: 2, Minor: 4}))
+	require.True(t, v31.AtLeast(LanguageVersion{Major: 1, Minor: 9}))
+	require.False(t, v31.AtLeast(LanguageVersion{Major: 3, Minor: 2}))
+	require.False(t, v31.AtLeast(LanguageVersion{Major: 4, Minor: 0}))
+	require.False(t, LanguageVersion{Major: 2, Minor: 4}.AtLeast(v31))
+}
+
+// Test_LanguageVersion_String tests that a version is formatted as "major.minor".
+func Test_LanguageVersion_String(t *testing.T) {
+	require.Equal(t, "3.1", LanguageVersion{Major: 3, Minor: 1}.String())
+	require.Equal(t, "2.4", LanguageVersion{Major: 2, Minor: 4}.String())
+	require.Equal(t, "0.0", LanguageVersion{}.String())
+}